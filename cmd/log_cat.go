@@ -32,14 +32,19 @@ import (
 	"github.com/yuuki0xff/goapptrace/config"
 	"github.com/yuuki0xff/goapptrace/tracer/restapi"
 	"github.com/yuuki0xff/goapptrace/tracer/types"
+	"golang.org/x/sync/errgroup"
 )
 
 // logCatCmd represents the cat command
 var logCatCmd = &cobra.Command{
-	Use: "cat <id>",
+	Use:                   "cat <id>",
 	DisableFlagsInUseLine: true,
-	Short: "Show logs on console",
-	RunE:  wrap(runLogCatfunc),
+	Short:                 "Show logs on console",
+	Long: `Show logs on console.
+
+If --follow is specified, it keeps printing function calls of the running
+application after they ended, until the application disconnects.`,
+	RunE: wrap(runLogCatfunc),
 }
 
 func runLogCatfunc(opt *handlerOpt) error {
@@ -55,8 +60,15 @@ func runLogCatfunc(opt *handlerOpt) error {
 		opt.ErrLog.Println("Invalid format:", err)
 		return errInvalidArgs
 	}
-	api, cancel, err := opt.ApiWithCancel(context.Background())
+	follow, err := opt.Cmd.Flags().GetBool("follow")
+	if err != nil {
+		opt.ErrLog.Println("Invalid follow flag:", err)
+		return errInvalidArgs
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	api, logID, err := opt.ApiForLog(ctx, logID)
 	if err != nil {
+		cancel()
 		opt.ErrLog.Println(err)
 		return errInvalidArgs
 	}
@@ -67,11 +79,17 @@ func runLogCatfunc(opt *handlerOpt) error {
 		return errGeneral
 	}
 
-	ch, eg := api.SearchFuncLogs(logID, restapi.SearchFuncLogParams{
-		SortKey:   restapi.SortByStartTime,
-		SortOrder: restapi.AscendingSortOrder,
-		//Limit:     1000,
-	})
+	var ch <-chan types.FuncLog
+	var eg *errgroup.Group
+	if follow {
+		ch, eg = api.StreamFuncLogs(logID, restapi.SearchFuncLogParams{})
+	} else {
+		ch, eg = api.SearchFuncLogs(logID, restapi.SearchFuncLogParams{
+			SortKey:   restapi.SortByStartTime,
+			SortOrder: restapi.AscendingSortOrder,
+			//Limit:     1000,
+		})
+	}
 	eg.Go(func() error {
 		defer cancel()
 		writer.SetGoLineGetter(func(pc uintptr) types.GoLine {
@@ -221,4 +239,5 @@ func init() {
 	// is called directly, e.g.:
 	// logCatCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
 	logCatCmd.Flags().StringP("format", "f", "text", `Specify output format. You can choose "json" or "text"`)
+	logCatCmd.Flags().Bool("follow", false, "Keep printing function calls of the running application")
 }
@@ -0,0 +1,87 @@
+// Copyright © 2017 yuuki0xff <yuuki0xff@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/spf13/cobra"
+)
+
+// logEventsCmd represents the events command
+var logEventsCmd = &cobra.Command{
+	Use:                   "events [flags] <id>",
+	DisableFlagsInUseLine: true,
+	Short:                 "Show events recorded by the watchdog",
+	Long: `Show events recorded by the watchdog.
+The log server records an event when a rule in watchdog.json matched
+while writing logs.`,
+	RunE: wrap(runLogEvents),
+}
+
+func runLogEvents(opt *handlerOpt) error {
+	if len(opt.Args) != 1 {
+		opt.ErrLog.Println("Should specify one args")
+		return errInvalidArgs
+	}
+
+	api, logID, err := opt.ApiForLog(context.Background(), opt.Args[0])
+	if err != nil {
+		opt.ErrLog.Println(err)
+		return errGeneral
+	}
+	events, err := api.Events(logID)
+	if err != nil {
+		opt.ErrLog.Println(err)
+		return errGeneral
+	}
+
+	tbl := defaultTable(opt.Stdout)
+	tbl.SetHeader([]string{
+		"ID", "Timestamp", "Kind", "Rule", "Message",
+	})
+	for _, e := range events {
+		tbl.Append([]string{
+			strconv.FormatInt(e.ID, 10),
+			e.Timestamp.String(),
+			string(e.Kind),
+			e.Rule,
+			e.Message,
+		})
+	}
+	tbl.Render()
+	return nil
+}
+
+func init() {
+	logCmd.AddCommand(logEventsCmd)
+
+	// Here you will define your flags and configuration settings.
+
+	// Cobra supports Persistent Flags which will work for this command
+	// and all subcommands, e.g.:
+	// logEventsCmd.PersistentFlags().String("foo", "", "A help for foo")
+
+	// Cobra supports local flags which will only run when this command
+	// is called directly, e.g.:
+	// logEventsCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
+}
@@ -0,0 +1,164 @@
+// Copyright © 2017 yuuki0xff <yuuki0xff@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"context"
+	"io"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/yuuki0xff/goapptrace/tracer/restapi"
+	"github.com/yuuki0xff/goapptrace/tracer/types"
+)
+
+// logFlamegraphCmd represents the flamegraph command
+var logFlamegraphCmd = &cobra.Command{
+	Use:                   "flamegraph [flags] <id>",
+	DisableFlagsInUseLine: true,
+	Short:                 "Generate a flame graph of function calls",
+	Long: `Generate a flame graph of function calls.
+
+The output format is specified by --format:
+  svg     a self-contained interactive SVG image (default)
+  folded  folded stacks, one stack and its weight per line
+Folded stacks can be processed by external tools such as flamegraph.pl.
+
+Each stack is weighted by the self time of function calls in nanoseconds,
+so the width of each frame is the total time of the function. Running
+function calls are not included.
+
+Function calls can be filtered by --gid, --since, --until and --where.
+--where takes a condition of a WHERE clause on the "calls" table.`,
+	RunE: wrap(runLogFlamegraph),
+}
+
+func runLogFlamegraph(opt *handlerOpt) error {
+	if len(opt.Args) != 1 {
+		opt.ErrLog.Println("Should specify one args")
+		return errInvalidArgs
+	}
+	flags := opt.Cmd.Flags()
+	var p restapi.FlameGraphParams
+	format, err := flags.GetString("format")
+	if err != nil {
+		opt.ErrLog.Println(err)
+		return errInvalidArgs
+	}
+	if err := p.Format.Parse(format); err != nil {
+		opt.ErrLog.Println(err)
+		return errInvalidArgs
+	}
+	gids, err := flags.GetStringSlice("gid")
+	if err != nil {
+		opt.ErrLog.Println(err)
+		return errInvalidArgs
+	}
+	for _, s := range gids {
+		var gid types.GID
+		if err := gid.FromString(s); err != nil {
+			opt.ErrLog.Printf("Invalid --gid flag: %s", err)
+			return errInvalidArgs
+		}
+		p.Gids = append(p.Gids, gid)
+	}
+	now := time.Now()
+	for _, f := range []struct {
+		name string
+		ts   *types.Time
+	}{
+		{"since", &p.MinTimestamp},
+		{"until", &p.MaxTimestamp},
+	} {
+		value, err := flags.GetString(f.name)
+		if err != nil {
+			opt.ErrLog.Println(err)
+			return errInvalidArgs
+		}
+		*f.ts, err = parseTimeFlag(value, now)
+		if err != nil {
+			opt.ErrLog.Printf("Invalid --%s flag: %s", f.name, err)
+			return errInvalidArgs
+		}
+	}
+	where, err := flags.GetString("where")
+	if err != nil {
+		opt.ErrLog.Println(err)
+		return errInvalidArgs
+	}
+	if where != "" {
+		p.Sql = "SELECT * FROM calls WHERE " + where
+	}
+	output, err := flags.GetString("output")
+	if err != nil {
+		opt.ErrLog.Println(err)
+		return errInvalidArgs
+	}
+
+	api, logID, err := opt.ApiForLog(context.Background(), opt.Args[0])
+	if err != nil {
+		opt.ErrLog.Println(err)
+		return errGeneral
+	}
+	r, err := api.FlameGraph(logID, p)
+	if err != nil {
+		opt.ErrLog.Println(err)
+		return errGeneral
+	}
+	defer r.Close() // nolint
+
+	w := opt.Stdout
+	if output != "" {
+		f, err := os.Create(output)
+		if err != nil {
+			opt.ErrLog.Println(err)
+			return errIo
+		}
+		defer f.Close() // nolint
+		w = f
+	}
+	if _, err := io.Copy(w, r); err != nil {
+		opt.ErrLog.Println(err)
+		return errIo
+	}
+	return nil
+}
+
+func init() {
+	logCmd.AddCommand(logFlamegraphCmd)
+
+	// Here you will define your flags and configuration settings.
+
+	// Cobra supports Persistent Flags which will work for this command
+	// and all subcommands, e.g.:
+	// logFlamegraphCmd.PersistentFlags().String("foo", "", "A help for foo")
+
+	// Cobra supports local flags which will only run when this command
+	// is called directly, e.g.:
+	// logFlamegraphCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
+	logFlamegraphCmd.Flags().StringP("format", "f", "svg", "Output format (svg or folded)")
+	logFlamegraphCmd.Flags().StringSliceP("gid", "g", nil, "Include only function calls on the goroutines")
+	logFlamegraphCmd.Flags().StringP("since", "", "", "Include only function calls running after the time")
+	logFlamegraphCmd.Flags().StringP("until", "", "", "Include only function calls running before the time")
+	logFlamegraphCmd.Flags().StringP("where", "", "", `Include only function calls that match the condition of a WHERE clause on the "calls" table`)
+	logFlamegraphCmd.Flags().StringP("output", "o", "", "Write to the file instead of stdout")
+}
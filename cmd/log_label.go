@@ -0,0 +1,120 @@
+// Copyright © 2017 yuuki0xff <yuuki0xff@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/yuuki0xff/goapptrace/tracer/types"
+)
+
+// logLabelCmd represents the label command
+var logLabelCmd = &cobra.Command{
+	Use:                   "label [flags] <id> [key=value | key-]...",
+	DisableFlagsInUseLine: true,
+	Short:                 "Update labels and description of a log",
+	Long: `Update labels and description of a log.
+"key=value" adds or updates a label, and "key-" removes a label.
+If no labels and no flags are specified, show current labels and description.`,
+	RunE: wrap(runLogLabel),
+}
+
+func runLogLabel(opt *handlerOpt) error {
+	if len(opt.Args) < 1 {
+		opt.ErrLog.Println("Log ID is not specified.")
+		return errInvalidArgs
+	}
+	id := opt.Args[0]
+
+	setLabels := types.Labels{}
+	var removeLabels []string
+	for _, arg := range opt.Args[1:] {
+		if strings.HasSuffix(arg, "-") && !strings.Contains(arg, "=") {
+			removeLabels = append(removeLabels, strings.TrimSuffix(arg, "-"))
+			continue
+		}
+		if err := setLabels.Set(arg); err != nil {
+			opt.ErrLog.Println(err)
+			return errInvalidArgs
+		}
+	}
+	descChanged := opt.Cmd.Flags().Changed("description")
+	desc, err := opt.Cmd.Flags().GetString("description")
+	if err != nil {
+		opt.ErrLog.Println(err)
+		return errInvalidArgs
+	}
+
+	api, id, err := opt.ApiForLog(context.Background(), id)
+	if err != nil {
+		opt.ErrLog.Println(err)
+		return errGeneral
+	}
+
+	var info types.LogInfo
+	if len(setLabels) == 0 && len(removeLabels) == 0 && !descChanged {
+		info, err = api.LogInfo(id)
+	} else {
+		info, err = api.UpdateLogInfo(id, 3, func(info *types.LogInfo) error {
+			labels := types.Labels{}
+			for key, value := range info.Metadata.Labels {
+				labels[key] = value
+			}
+			for key, value := range setLabels {
+				labels[key] = value
+			}
+			for _, key := range removeLabels {
+				delete(labels, key)
+			}
+			info.Metadata.Labels = labels
+			if descChanged {
+				info.Metadata.Description = desc
+			}
+			return nil
+		})
+	}
+	if err != nil {
+		opt.ErrLog.Println(err)
+		return errGeneral
+	}
+
+	fmt.Fprintln(opt.Stdout, "Labels:", info.Metadata.Labels.String())
+	fmt.Fprintln(opt.Stdout, "Description:", info.Metadata.Description)
+	return nil
+}
+
+func init() {
+	logCmd.AddCommand(logLabelCmd)
+
+	// Here you will define your flags and configuration settings.
+
+	// Cobra supports Persistent Flags which will work for this command
+	// and all subcommands, e.g.:
+	// logLabelCmd.PersistentFlags().String("foo", "", "A help for foo")
+
+	// Cobra supports local flags which will only run when this command
+	// is called directly, e.g.:
+	// logLabelCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
+	logLabelCmd.Flags().StringP("description", "d", "", "Set the description")
+}
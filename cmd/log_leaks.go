@@ -0,0 +1,137 @@
+// Copyright © 2017 yuuki0xff <yuuki0xff@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/yuuki0xff/goapptrace/tracer/restapi"
+)
+
+// logLeaksCmd represents the leaks command
+var logLeaksCmd = &cobra.Command{
+	Use:                   "leaks [flags] <id>",
+	DisableFlagsInUseLine: true,
+	Short:                 "Show goroutines alive at the end of the process",
+	Long: `Show goroutines alive at the end of the process, grouped by function.
+They are goroutine leaks in most cases.
+If the log is being written, goroutines which are currently alive are shown.
+
+Goroutines are grouped by the function called at the start of the goroutine
+(--group-by=start), or by the function on top of the stack (--group-by=top).
+If --baseline is specified, growth from the baseline log is shown.`,
+	RunE: wrap(runLogLeaks),
+}
+
+func runLogLeaks(opt *handlerOpt) error {
+	if len(opt.Args) != 1 {
+		opt.ErrLog.Println("Should specify one args")
+		return errInvalidArgs
+	}
+	groupBy, err := opt.Cmd.Flags().GetString("group-by")
+	if err != nil {
+		opt.ErrLog.Println(err)
+		return errInvalidArgs
+	}
+	baselineID, err := opt.Cmd.Flags().GetString("baseline")
+	if err != nil {
+		opt.ErrLog.Println(err)
+		return errInvalidArgs
+	}
+	var p restapi.LeakReportParams
+	if err := p.GroupBy.Parse(groupBy); err != nil {
+		opt.ErrLog.Println(err)
+		return errInvalidArgs
+	}
+
+	ctx := context.Background()
+	api, logID, err := opt.ApiForLog(ctx, opt.Args[0])
+	if err != nil {
+		opt.ErrLog.Println(err)
+		return errGeneral
+	}
+	report, err := api.GoroutineLeaks(logID, p)
+	if err != nil {
+		opt.ErrLog.Println(err)
+		return errGeneral
+	}
+	if baselineID != "" {
+		// 比較対象のログは、別のサーバに存在する場合がある。
+		// それぞれのサーバからレポートを取得して比較する。
+		baseApi, baseLogID, err := opt.ApiForLog(ctx, baselineID)
+		if err != nil {
+			opt.ErrLog.Println(err)
+			return errGeneral
+		}
+		baseline, err := baseApi.GoroutineLeaks(baseLogID, p)
+		if err != nil {
+			opt.ErrLog.Println(err)
+			return errGeneral
+		}
+		report.Diff(baselineID, &baseline)
+	}
+
+	if report.Active {
+		fmt.Fprintln(opt.Stdout, "The log is being written. Showing goroutines which are currently alive.")
+	}
+	header := []string{"Function", "Count"}
+	if report.Baseline != "" {
+		header = append(header, "Baseline", "Growth")
+	}
+	header = append(header, "Max Age", "Min Age", "Location")
+
+	tbl := defaultTable(opt.Stdout)
+	tbl.SetHeader(header)
+	for _, g := range report.Groups {
+		row := []string{g.Func, strconv.Itoa(g.Count)}
+		if report.Baseline != "" {
+			row = append(row, strconv.Itoa(g.BaselineCount), strconv.Itoa(g.Growth))
+		}
+		if g.Count > 0 {
+			row = append(row, time.Duration(g.MaxAge).String(), time.Duration(g.MinAge).String(), g.Line)
+		} else {
+			row = append(row, "-", "-", g.Line)
+		}
+		tbl.Append(row)
+	}
+	tbl.Render()
+	return nil
+}
+
+func init() {
+	logCmd.AddCommand(logLeaksCmd)
+
+	// Here you will define your flags and configuration settings.
+
+	// Cobra supports Persistent Flags which will work for this command
+	// and all subcommands, e.g.:
+	// logLeaksCmd.PersistentFlags().String("foo", "", "A help for foo")
+
+	// Cobra supports local flags which will only run when this command
+	// is called directly, e.g.:
+	// logLeaksCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
+	logLeaksCmd.Flags().StringP("group-by", "g", "start", "Group goroutines by the start function (start) or by the top of the stack (top)")
+	logLeaksCmd.Flags().StringP("baseline", "b", "", "ID of the baseline log to compare with")
+}
@@ -23,33 +23,96 @@ package cmd
 import (
 	"context"
 	"strconv"
+	"time"
 
 	"github.com/spf13/cobra"
+	"github.com/yuuki0xff/goapptrace/tracer/restapi"
+	"github.com/yuuki0xff/goapptrace/tracer/types"
 )
 
 // logLsCmd represents the ls command
 var logLsCmd = &cobra.Command{
 	Use:   "ls",
 	Short: "Show available log names",
-	RunE:  wrap(runLogLs),
+	Long: `Show available log names.
+Logs can be filtered by labels, application name, host name and the time of the last record.
+--since and --until flags accept a duration (e.g. "24h" means 24 hours ago), a date ("2006-01-02") or RFC3339 format.
+If two or more API servers are specified, logs on all servers are shown and log IDs are qualified by the server ID like "<server-id>:<log-id>".`,
+	RunE: wrap(runLogLs),
 }
 
 func runLogLs(opt *handlerOpt) error {
-	api, err := opt.Api(context.Background())
+	var p restapi.SearchLogsParams
+	var err error
+	flags := opt.Cmd.Flags()
+	p.Labels, err = labelsFlag(flags, "label")
 	if err != nil {
 		opt.ErrLog.Println(err)
-		return errGeneral
+		return errInvalidArgs
+	}
+	p.AppName, err = flags.GetString("app")
+	if err != nil {
+		opt.ErrLog.Println(err)
+		return errInvalidArgs
+	}
+	p.Host, err = flags.GetString("host")
+	if err != nil {
+		opt.ErrLog.Println(err)
+		return errInvalidArgs
+	}
+	now := time.Now()
+	for _, f := range []struct {
+		name string
+		ts   *types.Time
+	}{
+		{"since", &p.MinTimestamp},
+		{"until", &p.MaxTimestamp},
+	} {
+		value, err := flags.GetString(f.name)
+		if err != nil {
+			opt.ErrLog.Println(err)
+			return errInvalidArgs
+		}
+		*f.ts, err = parseTimeFlag(value, now)
+		if err != nil {
+			opt.ErrLog.Printf("Invalid --%s flag: %s", f.name, err)
+			return errInvalidArgs
+		}
+	}
+	sortKey, err := flags.GetString("sort")
+	if err != nil {
+		opt.ErrLog.Println(err)
+		return errInvalidArgs
+	}
+	if err := p.SortKey.Parse(sortKey); err != nil {
+		opt.ErrLog.Println(err)
+		return errInvalidArgs
+	}
+	if reverse, err := flags.GetBool("reverse"); err != nil {
+		opt.ErrLog.Println(err)
+		return errInvalidArgs
+	} else if reverse {
+		p.SortOrder = restapi.DescendingSortOrder
 	}
 
-	logs, err := api.Logs()
+	api, err := opt.Federation(context.Background())
 	if err != nil {
 		opt.ErrLog.Println(err)
 		return errGeneral
 	}
 
+	logs, err := api.SearchLogs(p)
+	if err != nil {
+		opt.ErrLog.Println(err)
+		if logs == nil {
+			return errGeneral
+		}
+		// 一部のサーバからは取得できたため、取得できたログのみを表示する。
+	}
+
 	tbl := defaultTable(opt.Stdout)
 	tbl.SetHeader([]string{
-		"ID", "AppName", "Time", "PID", "Host",
+		"ID", "AppName", "Time", "PID", "Host", "Labels", "Description",
 	})
 	for i := range logs {
 		tbl.Append([]string{
@@ -58,6 +121,8 @@ func runLogLs(opt *handlerOpt) error {
 			logs[i].Metadata.Timestamp.String(),
 			strconv.FormatInt(logs[i].Metadata.PID, 10),
 			logs[i].Metadata.Host,
+			logs[i].Metadata.Labels.String(),
+			logs[i].Metadata.Description,
 		})
 	}
 	tbl.Render()
@@ -76,4 +141,11 @@ func init() {
 	// Cobra supports local flags which will only run when this command
 	// is called directly, e.g.:
 	// logLsCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
+	logLsCmd.Flags().StringArrayP("label", "l", nil, "Show logs that have the label. format is key=value")
+	logLsCmd.Flags().StringP("app", "", "", "Show logs of the application")
+	logLsCmd.Flags().StringP("host", "", "", "Show logs of the host")
+	logLsCmd.Flags().StringP("since", "", "", "Show logs updated after the time")
+	logLsCmd.Flags().StringP("until", "", "", "Show logs updated before the time")
+	logLsCmd.Flags().StringP("sort", "s", "", "Sort key (id, app-name, host, timestamp or label:<key>)")
+	logLsCmd.Flags().BoolP("reverse", "r", false, "Sort in descending order")
 }
@@ -21,18 +21,42 @@
 package cmd
 
 import (
+	"bytes"
 	"context"
+	"encoding/csv"
+	"fmt"
 	"io"
+	"strings"
 
 	"github.com/spf13/cobra"
+	"github.com/yuuki0xff/goapptrace/tracer/restapi"
 )
 
 // logQueryCmd represents the query command
 var logQueryCmd = &cobra.Command{
-	Use: "query <id> <SQL>",
+	Use:                   "query [flags] <id> <SQL>",
 	DisableFlagsInUseLine: true,
-	Short: "Execute a SELECT query",
-	RunE:  wrap(runLogQuery),
+	Short:                 "Execute a SELECT query",
+	Long: `Execute a SELECT query.
+
+The output format is specified by --format:
+  csv         comma separated values with a header line (default)
+  json        one JSON object per line (JSON lines)
+  json-array  a JSON array of objects
+  table       aligned columns for terminals
+In JSON formats, datetime values are printed as nanoseconds from the UNIX
+epoch, or as RFC3339 strings if --datetime=rfc3339 is specified.
+
+If --follow is specified, the query keeps running and prints newly matching
+rows until interrupted. It supports only queries with a WHERE clause on the
+"calls" or "goroutines" table. Running function calls and goroutines are
+printed after they ended.
+
+If --timeout is specified, the server aborts the query when it runs longer
+than the duration. The server may also abort queries that exceed its own
+limits. Use "goapptrace query ps" and "goapptrace query kill" to manage
+running queries.`,
+	RunE: wrap(runLogQuery),
 }
 
 func runLogQuery(opt *handlerOpt) error {
@@ -47,20 +71,71 @@ func runLogQuery(opt *handlerOpt) error {
 		return errInvalidArgs
 	}
 
-	api, err := opt.Api(context.Background())
+	follow, err := opt.Cmd.Flags().GetBool("follow")
+	if err != nil {
+		opt.ErrLog.Println(err)
+		return errInvalidArgs
+	}
+	format, err := opt.Cmd.Flags().GetString("format")
+	if err != nil {
+		opt.ErrLog.Println(err)
+		return errInvalidArgs
+	}
+	datetime, err := opt.Cmd.Flags().GetString("datetime")
+	if err != nil {
+		opt.ErrLog.Println(err)
+		return errInvalidArgs
+	}
+	timeout, err := opt.Cmd.Flags().GetDuration("timeout")
+	if err != nil {
+		opt.ErrLog.Println(err)
+		return errInvalidArgs
+	}
+	var p restapi.SearchParams
+	if err := p.Datetime.Parse(datetime); err != nil {
+		opt.ErrLog.Println(err)
+		return errInvalidArgs
+	}
+	p.Timeout = timeout
+	table := format == "table"
+	if table {
+		// 表はCSV形式の結果から作成する。
+		p.Format = restapi.CsvFormat
+	} else if err := p.Format.Parse(format); err != nil {
+		opt.ErrLog.Println(err)
+		return errInvalidArgs
+	}
+	if follow && p.Format == restapi.JsonArrayFormat {
+		opt.ErrLog.Printf("%s format is not supported with --follow.", format)
+		return errInvalidArgs
+	}
+
+	api, id, err := opt.ApiForLog(context.Background(), opt.Args[0])
 	if err != nil {
 		opt.ErrLog.Println(err)
 		return errGeneral
 	}
 
-	id, query := opt.Args[0], opt.Args[1]
-	r, err := api.SearchRaw(id, query)
+	query := opt.Args[1]
+	var r io.ReadCloser
+	if follow {
+		r, err = api.SearchFollow(id, query, p)
+	} else {
+		r, err = api.SearchWithParams(id, query, p)
+	}
 	if err != nil {
 		opt.ErrLog.Println(err)
 		return errGeneral
 	}
 	defer r.Close() // nolint
-	_, err = io.Copy(opt.Stdout, r)
+	switch {
+	case table && follow:
+		err = followTable(opt.Stdout, r)
+	case table:
+		err = printTable(opt.Stdout, r)
+	default:
+		_, err = io.Copy(opt.Stdout, r)
+	}
 	if err != nil {
 		opt.ErrLog.Println(err)
 		return errIo
@@ -68,6 +143,80 @@ func runLogQuery(opt *handlerOpt) error {
 	return nil
 }
 
+// followTable は、CSV形式の結果を読み出し、列を揃えた表として1行ずつ書き出す。
+// 全ての行を読み出す前に出力を始めるため、列の幅はそれまでに出力した値の幅に合わせて広げる。
+func followTable(w io.Writer, r io.Reader) error {
+	cr := csv.NewReader(r)
+	var widths []int
+	for header := true; ; header = false {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		widths = columnWidths(widths, rec)
+		if _, err := w.Write(tableRow(widths, rec, header)); err != nil {
+			return err
+		}
+	}
+}
+
+// printTable は、CSV形式の結果を全て読み出してから、列を揃えた表として書き出す。
+func printTable(w io.Writer, r io.Reader) error {
+	recs, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return err
+	}
+	var widths []int
+	for _, rec := range recs {
+		widths = columnWidths(widths, rec)
+	}
+	for i, rec := range recs {
+		if _, err := w.Write(tableRow(widths, rec, i == 0)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// columnWidths は、rec の値が収まるように列の幅 widths を広げて返す。
+func columnWidths(widths []int, rec []string) []int {
+	for i, v := range rec {
+		if len(widths) <= i {
+			widths = append(widths, 0)
+		}
+		if widths[i] < len(v) {
+			widths[i] = len(v)
+		}
+	}
+	return widths
+}
+
+// tableRow は、rec を表の1行に変換する。header がtrueなら、ヘッダの下に区切り線を追加する。
+func tableRow(widths []int, rec []string, header bool) []byte {
+	var buf bytes.Buffer
+	for i, v := range rec {
+		if i < len(rec)-1 {
+			fmt.Fprintf(&buf, "%-*s  ", widths[i], v)
+		} else {
+			buf.WriteString(v)
+		}
+	}
+	buf.WriteByte('\n')
+	if header {
+		for i := range rec {
+			if i > 0 {
+				buf.WriteString("  ")
+			}
+			buf.WriteString(strings.Repeat("-", widths[i]))
+		}
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes()
+}
+
 func init() {
 	logCmd.AddCommand(logQueryCmd)
 
@@ -80,4 +229,8 @@ func init() {
 	// Cobra supports local flags which will only run when this command
 	// is called directly, e.g.:
 	// logQueryCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
+	logQueryCmd.Flags().BoolP("follow", "f", false, "Keep running and print newly matching rows")
+	logQueryCmd.Flags().String("format", "csv", `Specify output format. You can choose "csv", "json", "json-array" or "table". "json-array" cannot be used with --follow`)
+	logQueryCmd.Flags().String("datetime", "ns", `Specify datetime format in JSON output. You can choose "ns" or "rfc3339"`)
+	logQueryCmd.Flags().Duration("timeout", 0, "Abort the query if it runs longer than this duration")
 }
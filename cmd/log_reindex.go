@@ -0,0 +1,81 @@
+// Copyright © 2017 yuuki0xff <yuuki0xff@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"github.com/yuuki0xff/goapptrace/tracer/storage"
+)
+
+// logReindexCmd represents the reindex command
+var logReindexCmd = &cobra.Command{
+	Use:                   "reindex <id>",
+	DisableFlagsInUseLine: true,
+	Short:                 "Rebuild secondary indexes and function statistics of a log",
+	Long: `Rebuild secondary indexes and function statistics of a log.
+The secondary indexes are used to speed up searching by goroutine ID and function name,
+and to look up the functions called by a function call.
+Logs created by older versions do not have them; use this command to build them.
+Stop the log server before running this command.`,
+	RunE: wrap(runLogReindex),
+}
+
+func runLogReindex(opt *handlerOpt) error {
+	if len(opt.Args) != 1 {
+		opt.ErrLog.Println("Should specify one args")
+		return errInvalidArgs
+	}
+	id, err := storage.LogID{}.Unhex(opt.Args[0])
+	if err != nil {
+		opt.ErrLog.Println("Invalid log ID:", err)
+		return errInvalidArgs
+	}
+
+	d := storage.DirLayout{
+		Root: opt.Conf.LogsDir(),
+	}
+	if err := storage.BuildPostings(d, id); err != nil {
+		opt.ErrLog.Println("Failed to rebuild indexes:", err)
+		return errGeneral
+	}
+	if err := storage.BuildFuncStats(d, id); err != nil {
+		opt.ErrLog.Println("Failed to rebuild function statistics:", err)
+		return errGeneral
+	}
+	fmt.Fprintln(opt.Stdout, "Done.")
+	return nil
+}
+
+func init() {
+	logCmd.AddCommand(logReindexCmd)
+
+	// Here you will define your flags and configuration settings.
+
+	// Cobra supports Persistent Flags which will work for this command
+	// and all subcommands, e.g.:
+	// logReindexCmd.PersistentFlags().String("foo", "", "A help for foo")
+
+	// Cobra supports local flags which will only run when this command
+	// is called directly, e.g.:
+	// logReindexCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
+}
@@ -0,0 +1,93 @@
+// Copyright © 2017 yuuki0xff <yuuki0xff@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"github.com/yuuki0xff/goapptrace/tracer/storage"
+)
+
+// logRepairCmd represents the repair command
+var logRepairCmd = &cobra.Command{
+	Use:                   "repair <id>",
+	DisableFlagsInUseLine: true,
+	Short:                 "Repair a broken log",
+	Long: `Repair a broken log.
+This command truncates torn records, rebuilds the index and restores missing files.
+Stop the log server before running this command.`,
+	RunE: wrap(runLogRepair),
+}
+
+func runLogRepair(opt *handlerOpt) error {
+	if len(opt.Args) != 1 {
+		opt.ErrLog.Println("Should specify one args")
+		return errInvalidArgs
+	}
+	id, err := storage.LogID{}.Unhex(opt.Args[0])
+	if err != nil {
+		opt.ErrLog.Println("Invalid log ID:", err)
+		return errInvalidArgs
+	}
+	dryRun, err := opt.Cmd.Flags().GetBool("dry-run")
+	if err != nil {
+		opt.ErrLog.Println(err)
+		return errInvalidArgs
+	}
+
+	r := storage.Repairer{
+		Root: storage.DirLayout{
+			Root: opt.Conf.LogsDir(),
+		},
+		ID:     id,
+		DryRun: dryRun,
+	}
+	problems, err := r.Repair()
+	for _, p := range problems {
+		fmt.Fprintln(opt.Stdout, p)
+	}
+	if err != nil {
+		opt.ErrLog.Println("Failed to repair:", err)
+		return errGeneral
+	}
+	if len(problems) == 0 {
+		fmt.Fprintln(opt.Stdout, "No problems found.")
+	} else if dryRun {
+		fmt.Fprintln(opt.Stdout, "Dry run mode. Nothing changed.")
+	}
+	return nil
+}
+
+func init() {
+	logCmd.AddCommand(logRepairCmd)
+
+	// Here you will define your flags and configuration settings.
+
+	// Cobra supports Persistent Flags which will work for this command
+	// and all subcommands, e.g.:
+	// logRepairCmd.PersistentFlags().String("foo", "", "A help for foo")
+
+	// Cobra supports local flags which will only run when this command
+	// is called directly, e.g.:
+	// logRepairCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
+	logRepairCmd.Flags().BoolP("dry-run", "n", false, "Show problems without changing any files")
+}
@@ -0,0 +1,102 @@
+// Copyright © 2017 yuuki0xff <yuuki0xff@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// logRunningCmd represents the running command
+var logRunningCmd = &cobra.Command{
+	Use:                   "running [flags] <id>",
+	DisableFlagsInUseLine: true,
+	Short:                 "Show running function calls for each goroutine",
+	Long: `Show running function calls for each goroutine.
+It helps to diagnose hangs while the application is still stuck.
+Function calls which have not been written to the storage are also shown.
+Only logs being written have running function calls.`,
+	RunE: wrap(runLogRunning),
+}
+
+func runLogRunning(opt *handlerOpt) error {
+	if len(opt.Args) != 1 {
+		opt.ErrLog.Println("Should specify one args")
+		return errInvalidArgs
+	}
+	minElapsed, err := opt.Cmd.Flags().GetDuration("min-elapsed")
+	if err != nil {
+		opt.ErrLog.Println(err)
+		return errInvalidArgs
+	}
+
+	api, logID, err := opt.ApiForLog(context.Background(), opt.Args[0])
+	if err != nil {
+		opt.ErrLog.Println(err)
+		return errGeneral
+	}
+	res, err := api.Running(logID)
+	if err != nil {
+		opt.ErrLog.Println(err)
+		return errGeneral
+	}
+	if !res.Active {
+		opt.ErrLog.Println("The log is not being written")
+		return errGeneral
+	}
+
+	for _, g := range res.Goroutines {
+		// 最も長く実行している関数はスタックの底にある。
+		if len(g.Calls) == 0 || g.Calls[0].Elapsed(res.Now) < minElapsed {
+			continue
+		}
+		fmt.Fprintf(opt.Stdout, "goroutine %d:\n", g.GID)
+		// スタックトップから順に表示する。
+		for i := len(g.Calls) - 1; i >= 0; i-- {
+			c := &g.Calls[i]
+			name := c.Func
+			if name == "" {
+				name = "?"
+			}
+			fmt.Fprintf(opt.Stdout, "\t%s\n\t\t%s (running for %s)\n", name, c.Line, c.Elapsed(res.Now).Round(time.Millisecond))
+		}
+		fmt.Fprintln(opt.Stdout)
+	}
+	return nil
+}
+
+func init() {
+	logCmd.AddCommand(logRunningCmd)
+
+	// Here you will define your flags and configuration settings.
+
+	// Cobra supports Persistent Flags which will work for this command
+	// and all subcommands, e.g.:
+	// logRunningCmd.PersistentFlags().String("foo", "", "A help for foo")
+
+	// Cobra supports local flags which will only run when this command
+	// is called directly, e.g.:
+	// logRunningCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
+	logRunningCmd.Flags().Duration("min-elapsed", 0, "Show only goroutines blocked longer than this duration")
+}
@@ -0,0 +1,134 @@
+// Copyright © 2017 yuuki0xff <yuuki0xff@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/yuuki0xff/goapptrace/tracer/types"
+)
+
+// logStatsCmd represents the stats command
+var logStatsCmd = &cobra.Command{
+	Use:                   "stats [flags] <id>",
+	DisableFlagsInUseLine: true,
+	Short:                 "Show statistics for each function",
+	Long: `Show statistics for each function.
+The statistics are aggregated by the log server while writing logs.
+Only finished function calls are counted.`,
+	RunE: wrap(runLogStats),
+}
+
+func runLogStats(opt *handlerOpt) error {
+	if len(opt.Args) != 1 {
+		opt.ErrLog.Println("Should specify one args")
+		return errInvalidArgs
+	}
+	sortKey, err := opt.Cmd.Flags().GetString("sort")
+	if err != nil {
+		opt.ErrLog.Println(err)
+		return errInvalidArgs
+	}
+	limit, err := opt.Cmd.Flags().GetInt("limit")
+	if err != nil {
+		opt.ErrLog.Println(err)
+		return errInvalidArgs
+	}
+
+	var key func(s *types.FuncStats) int64
+	switch sortKey {
+	case "calls":
+		key = func(s *types.FuncStats) int64 { return s.Calls }
+	case "total":
+		key = func(s *types.FuncStats) int64 { return int64(s.TotalTime) }
+	case "self":
+		key = func(s *types.FuncStats) int64 { return int64(s.SelfTime) }
+	case "avg":
+		key = func(s *types.FuncStats) int64 { return int64(s.AvgTime()) }
+	case "max":
+		key = func(s *types.FuncStats) int64 { return int64(s.MaxTime) }
+	default:
+		opt.ErrLog.Println("Invalid sort key:", sortKey)
+		return errInvalidArgs
+	}
+
+	api, logID, err := opt.ApiForLog(context.Background(), opt.Args[0])
+	if err != nil {
+		opt.ErrLog.Println(err)
+		return errGeneral
+	}
+	stats, err := api.FuncStats(logID)
+	if err != nil {
+		opt.ErrLog.Println(err)
+		return errGeneral
+	}
+
+	// 降順にソートする
+	sort.SliceStable(stats, func(i, j int) bool {
+		return key(&stats[i]) > key(&stats[j])
+	})
+	if limit > 0 && limit < len(stats) {
+		stats = stats[:limit]
+	}
+
+	tbl := defaultTable(opt.Stdout)
+	tbl.SetHeader([]string{
+		"Name", "Calls", "Total", "Self", "Avg", "Min", "Max",
+	})
+	for i := range stats {
+		name := stats[i].Name
+		if name == "" {
+			name = fmt.Sprintf("? (pc=%d)", stats[i].PC)
+		}
+		tbl.Append([]string{
+			name,
+			strconv.FormatInt(stats[i].Calls, 10),
+			time.Duration(stats[i].TotalTime).String(),
+			time.Duration(stats[i].SelfTime).String(),
+			time.Duration(stats[i].AvgTime()).String(),
+			time.Duration(stats[i].MinTime).String(),
+			time.Duration(stats[i].MaxTime).String(),
+		})
+	}
+	tbl.Render()
+	return nil
+}
+
+func init() {
+	logCmd.AddCommand(logStatsCmd)
+
+	// Here you will define your flags and configuration settings.
+
+	// Cobra supports Persistent Flags which will work for this command
+	// and all subcommands, e.g.:
+	// logStatsCmd.PersistentFlags().String("foo", "", "A help for foo")
+
+	// Cobra supports local flags which will only run when this command
+	// is called directly, e.g.:
+	// logStatsCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
+	logStatsCmd.Flags().StringP("sort", "s", "total", "Sort key (calls, total, self, avg or max)")
+	logStatsCmd.Flags().IntP("limit", "l", 0, "Maximum number of functions to show (0 means unlimited)")
+}
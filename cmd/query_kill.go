@@ -0,0 +1,87 @@
+// Copyright © 2017 yuuki0xff <yuuki0xff@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/spf13/cobra"
+	"github.com/yuuki0xff/goapptrace/tracer/restapi"
+)
+
+// queryKillCmd represents the kill command
+var queryKillCmd = &cobra.Command{
+	Use:                   "kill <query-id>...",
+	DisableFlagsInUseLine: true,
+	Short:                 "Abort running queries",
+	Long: `Abort running queries.
+The query IDs are shown by "goapptrace query ps".
+The client that executed the query receives an error.`,
+	RunE: wrap(runQueryKill),
+}
+
+func runQueryKill(opt *handlerOpt) error {
+	if len(opt.Args) == 0 {
+		opt.ErrLog.Println("Query ID is not specified.")
+		return errInvalidArgs
+	}
+	ids := make([]restapi.QueryID, len(opt.Args))
+	for i, arg := range opt.Args {
+		id, err := strconv.ParseInt(arg, 10, 64)
+		if err != nil {
+			opt.ErrLog.Printf("Invalid query ID: %s", arg)
+			return errInvalidArgs
+		}
+		ids[i] = restapi.QueryID(id)
+	}
+
+	api, err := opt.Api(context.Background())
+	if err != nil {
+		opt.ErrLog.Println(err)
+		return errGeneral
+	}
+	var failed bool
+	for _, id := range ids {
+		if err := api.KillQuery(id); err != nil {
+			opt.ErrLog.Println(err)
+			failed = true
+		}
+	}
+	if failed {
+		return errGeneral
+	}
+	return nil
+}
+
+func init() {
+	queryCmd.AddCommand(queryKillCmd)
+
+	// Here you will define your flags and configuration settings.
+
+	// Cobra supports Persistent Flags which will work for this command
+	// and all subcommands, e.g.:
+	// queryKillCmd.PersistentFlags().String("foo", "", "A help for foo")
+
+	// Cobra supports local flags which will only run when this command
+	// is called directly, e.g.:
+	// queryKillCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
+}
@@ -0,0 +1,86 @@
+// Copyright © 2017 yuuki0xff <yuuki0xff@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"context"
+
+	"github.com/spf13/cobra"
+)
+
+// queryLsCmd represents the ls command
+var queryLsCmd = &cobra.Command{
+	Use:   "ls",
+	Short: "Show saved views",
+	Long: `Show saved views.
+If --app flag is specified, show views available for the application.
+Otherwise, show views of all applications.`,
+	RunE: wrap(runQueryLs),
+}
+
+func runQueryLs(opt *handlerOpt) error {
+	app, err := opt.Cmd.Flags().GetString("app")
+	if err != nil {
+		opt.ErrLog.Println(err)
+		return errInvalidArgs
+	}
+
+	api, err := opt.Api(context.Background())
+	if err != nil {
+		opt.ErrLog.Println(err)
+		return errGeneral
+	}
+	views, err := api.Views(app)
+	if err != nil {
+		opt.ErrLog.Println(err)
+		return errGeneral
+	}
+
+	tbl := defaultTable(opt.Stdout)
+	tbl.SetHeader([]string{
+		"AppName", "Name", "Query", "Description",
+	})
+	for _, v := range views {
+		tbl.Append([]string{
+			v.App,
+			v.Name,
+			v.Query,
+			v.Description,
+		})
+	}
+	tbl.Render()
+	return nil
+}
+
+func init() {
+	queryCmd.AddCommand(queryLsCmd)
+
+	// Here you will define your flags and configuration settings.
+
+	// Cobra supports Persistent Flags which will work for this command
+	// and all subcommands, e.g.:
+	// queryLsCmd.PersistentFlags().String("foo", "", "A help for foo")
+
+	// Cobra supports local flags which will only run when this command
+	// is called directly, e.g.:
+	// queryLsCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
+	queryLsCmd.Flags().String("app", "", "Show views available for the application")
+}
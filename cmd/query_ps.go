@@ -0,0 +1,85 @@
+// Copyright © 2017 yuuki0xff <yuuki0xff@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// queryPsCmd represents the ps command
+var queryPsCmd = &cobra.Command{
+	Use:   "ps",
+	Short: "Show running queries",
+	Long: `Show queries running on the API server.
+ScannedRows is the number of rows read from tables, and BufferedRows is the
+number of rows held in memory for sorting or grouping.
+Use "goapptrace query kill" to abort a query.`,
+	RunE: wrap(runQueryPs),
+}
+
+func runQueryPs(opt *handlerOpt) error {
+	api, err := opt.Api(context.Background())
+	if err != nil {
+		opt.ErrLog.Println(err)
+		return errGeneral
+	}
+	queries, err := api.Queries()
+	if err != nil {
+		opt.ErrLog.Println(err)
+		return errGeneral
+	}
+
+	tbl := defaultTable(opt.Stdout)
+	tbl.SetHeader([]string{
+		"ID", "LogID", "Client", "Elapsed", "ScannedRows", "BufferedRows", "Query",
+	})
+	for _, q := range queries {
+		tbl.Append([]string{
+			strconv.FormatInt(int64(q.ID), 10),
+			q.LogID.Hex(),
+			q.RemoteAddr,
+			time.Since(q.StartTime.UnixTime()).Round(time.Millisecond).String(),
+			strconv.FormatInt(q.ScannedRows, 10),
+			strconv.FormatInt(q.BufferedRows, 10),
+			q.Sql,
+		})
+	}
+	tbl.Render()
+	return nil
+}
+
+func init() {
+	queryCmd.AddCommand(queryPsCmd)
+
+	// Here you will define your flags and configuration settings.
+
+	// Cobra supports Persistent Flags which will work for this command
+	// and all subcommands, e.g.:
+	// queryPsCmd.PersistentFlags().String("foo", "", "A help for foo")
+
+	// Cobra supports local flags which will only run when this command
+	// is called directly, e.g.:
+	// queryPsCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
+}
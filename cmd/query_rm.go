@@ -0,0 +1,80 @@
+// Copyright © 2017 yuuki0xff <yuuki0xff@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"context"
+
+	"github.com/spf13/cobra"
+	"github.com/yuuki0xff/goapptrace/config"
+)
+
+// queryRmCmd represents the rm command
+var queryRmCmd = &cobra.Command{
+	Use:                   "rm [flags] <name>...",
+	DisableFlagsInUseLine: true,
+	Short:                 "Remove saved views",
+	RunE:                  wrap(runQueryRm),
+}
+
+func runQueryRm(opt *handlerOpt) error {
+	if len(opt.Args) == 0 {
+		opt.ErrLog.Println("View name is not specified.")
+		return errInvalidArgs
+	}
+	app, err := opt.Cmd.Flags().GetString("app")
+	if err != nil {
+		opt.ErrLog.Println(err)
+		return errInvalidArgs
+	}
+
+	api, err := opt.Api(context.Background())
+	if err != nil {
+		opt.ErrLog.Println(err)
+		return errGeneral
+	}
+	var failed bool
+	for _, name := range opt.Args {
+		if err := api.RemoveView(app, name); err != nil {
+			opt.ErrLog.Println(err)
+			failed = true
+		}
+	}
+	if failed {
+		return errGeneral
+	}
+	return nil
+}
+
+func init() {
+	queryCmd.AddCommand(queryRmCmd)
+
+	// Here you will define your flags and configuration settings.
+
+	// Cobra supports Persistent Flags which will work for this command
+	// and all subcommands, e.g.:
+	// queryRmCmd.PersistentFlags().String("foo", "", "A help for foo")
+
+	// Cobra supports local flags which will only run when this command
+	// is called directly, e.g.:
+	// queryRmCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
+	queryRmCmd.Flags().String("app", config.ViewAnyApp, `Application name. "*" means all applications`)
+}
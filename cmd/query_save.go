@@ -0,0 +1,114 @@
+// Copyright © 2017 yuuki0xff <yuuki0xff@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/yuuki0xff/goapptrace/config"
+	"github.com/yuuki0xff/goapptrace/tracer/restapi"
+)
+
+// createViewRegexp は、"CREATE VIEW name AS SELECT ..." 形式の文にマッチする。
+var createViewRegexp = regexp.MustCompile(`(?is)^\s*CREATE\s+(?:OR\s+REPLACE\s+)?VIEW\s+(\S+)\s+AS\s+(.+)$`)
+
+// querySaveCmd represents the save command
+var querySaveCmd = &cobra.Command{
+	Use:                   "save [flags] (<name> <select-statement> | <create-view-statement>)",
+	DisableFlagsInUseLine: true,
+	Short:                 "Save a query as a view",
+	Long: `Save a query as a view.
+The view can be referenced as a table in later queries.
+The query must be a SELECT statement with only a WHERE clause, and its column list must be "*" or column names.
+A view can also be defined by "CREATE VIEW <name> AS SELECT ..." statement.
+If a view with the same name already exists, it is replaced.
+
+Example:
+  goapptrace query save slow "SELECT * FROM calls WHERE exectime > '100ms'"
+  goapptrace query save --app myapp "CREATE VIEW db AS SELECT * FROM calls WHERE FRAME(package = 'database/sql')"
+  goapptrace log query <id> "SELECT id, exectime FROM slow"`,
+	RunE: wrap(runQuerySave),
+}
+
+func runQuerySave(opt *handlerOpt) error {
+	var v restapi.View
+	switch len(opt.Args) {
+	case 1:
+		m := createViewRegexp.FindStringSubmatch(opt.Args[0])
+		if m == nil {
+			opt.ErrLog.Println("Invalid CREATE VIEW statement.")
+			return errInvalidArgs
+		}
+		v.Name = m[1]
+		v.Query = strings.TrimSpace(m[2])
+	case 2:
+		v.Name = opt.Args[0]
+		v.Query = opt.Args[1]
+	default:
+		opt.ErrLog.Println("Invalid arguments. Specify a view name and a query.")
+		return errInvalidArgs
+	}
+
+	var err error
+	flags := opt.Cmd.Flags()
+	v.App, err = flags.GetString("app")
+	if err != nil {
+		opt.ErrLog.Println(err)
+		return errInvalidArgs
+	}
+	v.Description, err = flags.GetString("description")
+	if err != nil {
+		opt.ErrLog.Println(err)
+		return errInvalidArgs
+	}
+
+	api, err := opt.Api(context.Background())
+	if err != nil {
+		opt.ErrLog.Println(err)
+		return errGeneral
+	}
+	if _, err := api.SaveView(v); err != nil {
+		opt.ErrLog.Println(err)
+		return errGeneral
+	}
+	fmt.Fprintf(opt.Stdout, "Saved %s view for %s.\n", v.Name, v.App)
+	return nil
+}
+
+func init() {
+	queryCmd.AddCommand(querySaveCmd)
+
+	// Here you will define your flags and configuration settings.
+
+	// Cobra supports Persistent Flags which will work for this command
+	// and all subcommands, e.g.:
+	// querySaveCmd.PersistentFlags().String("foo", "", "A help for foo")
+
+	// Cobra supports local flags which will only run when this command
+	// is called directly, e.g.:
+	// querySaveCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
+	querySaveCmd.Flags().String("app", config.ViewAnyApp, `Application name. "*" means all applications`)
+	querySaveCmd.Flags().StringP("description", "d", "", "Description of the view")
+}
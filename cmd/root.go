@@ -30,8 +30,8 @@ import (
 // Path to config and log directory.
 var storageDir string
 
-// API server address.
-var apiSrvAddr string
+// API server addresses.
+var apiSrvAddrs []string
 
 // Log server address.
 var logSrvAddr string
@@ -56,8 +56,8 @@ func init() {
 	// Cobra supports persistent flags, which, if defined here,
 	// will be global for your application.
 	RootCmd.PersistentFlags().StringVar(&storageDir, "storage", info.DefaultStorageDir, "Path to log directory")
-	RootCmd.PersistentFlags().StringVar(&apiSrvAddr, "api-server", config.DefaultApiServerAddr, "REST API server address")
-	RootCmd.PersistentFlags().StringVar(&logSrvAddr, "log-server", config.DefaultLogServerAddr, "Log server address")
+	RootCmd.PersistentFlags().StringSliceVar(&apiSrvAddrs, "api-server", nil, "REST API server address. It can be specified multiple times to use several servers at once (default "+config.DefaultApiServerAddr+")")
+	RootCmd.PersistentFlags().StringVar(&logSrvAddr, "log-server", "", "Log server address (default "+config.DefaultLogServerAddr+")")
 
 	// Cobra also supports local flags, which will only run
 	// when this action is called directly.
@@ -44,7 +44,9 @@ var runCmd = &cobra.Command{
 	Short: "compile and run Go program",
 	Long: `"goapptrace run" is a useful command like "go run".
 This command compiles specified files with logging codes, and execute them.
-Arguments are compatible with "go run". See "go run --help" to get more information about arguments.`,
+Arguments are compatible with "go run". See "go run --help" to get more information about arguments.
+
+Labels and a description can be attached to the log by "--label key=value" and "--description" flags.`,
 	RunE: wrap(runRun),
 }
 
@@ -56,6 +58,17 @@ func runRun(opt *handlerOpt) error {
 		return errGeneral
 	}
 
+	labels, err := labelsFlag(opt.Cmd.Flags(), "label")
+	if err != nil {
+		opt.ErrLog.Println(err)
+		return errInvalidArgs
+	}
+	desc, err := opt.Cmd.Flags().GetString("description")
+	if err != nil {
+		opt.ErrLog.Println(err)
+		return errInvalidArgs
+	}
+
 	tmpdir, err := ioutil.TempDir("", ".goapptrace.run")
 	if err != nil {
 		opt.ErrLog.Println(err)
@@ -89,6 +102,12 @@ func runRun(opt *handlerOpt) error {
 	// 実行用の環境変数を追加しなきゃ鳴らない
 	logSrvAddr := opt.LogServer()
 	runCmd.Env = append(os.Environ(), runEnv(logSrvAddr, b.Goroot, b.Gopath, files)...)
+	if len(labels) > 0 {
+		runCmd.Env = append(runCmd.Env, info.DefaultLabelsEnv+"="+labels.String())
+	}
+	if desc != "" {
+		runCmd.Env = append(runCmd.Env, info.DefaultDescEnv+"="+desc)
+	}
 	return runCmd.Run()
 }
 
@@ -131,6 +150,8 @@ func init() {
 	// runCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
 
 	runCmd.Flags().StringP("exec", "", "", "invoke the binary using specified command")
+	runCmd.Flags().StringArrayP("label", "", nil, "attach a label to the log. format is key=value")
+	runCmd.Flags().StringP("description", "", "", "attach a description to the log")
 	runCmd.Flags().AddFlagSet(sharedFlags())
 
 	runCmd.SetFlagErrorFunc(fixFlagName(runFlags))
@@ -0,0 +1,92 @@
+// Copyright © 2017 yuuki0xff
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"github.com/yuuki0xff/goapptrace/tracer/storage"
+)
+
+// serverMigrateCmd represents the migrate command
+var serverMigrateCmd = &cobra.Command{
+	Use:   "migrate",
+	Short: "Upgrade the data format of the log directory",
+	RunE:  wrap(runServerMigrate),
+}
+
+func runServerMigrate(opt *handlerOpt) error {
+	dryRun, err := opt.Cmd.Flags().GetBool("dry-run")
+	if err != nil {
+		opt.ErrLog.Println(err)
+		return errInvalidArgs
+	}
+	backupDir, err := opt.Cmd.Flags().GetString("backup")
+	if err != nil {
+		opt.ErrLog.Println(err)
+		return errInvalidArgs
+	}
+
+	root := storage.DirLayout{
+		Root: opt.Conf.LogsDir(),
+	}
+	if !root.InfoFile().Exists() {
+		opt.ErrLog.Println("Not found the info file:", root.InfoFile())
+		return errGeneral
+	}
+
+	m := storage.Migrator{
+		Root:      root,
+		DryRun:    dryRun,
+		BackupDir: backupDir,
+	}
+	steps, err := m.Migrate()
+	for _, step := range steps {
+		fmt.Fprintf(opt.Stdout, "%s -> %s: %s\n", step.From, step.To, step.Description)
+	}
+	if err != nil {
+		opt.ErrLog.Println("Failed to migrate:", err)
+		return errGeneral
+	}
+	if len(steps) == 0 {
+		fmt.Fprintln(opt.Stdout, "Already up to date.")
+	} else if dryRun {
+		fmt.Fprintln(opt.Stdout, "Dry run mode. Nothing changed.")
+	}
+	return nil
+}
+
+func init() {
+	serverCmd.AddCommand(serverMigrateCmd)
+
+	// Here you will define your flags and configuration settings.
+
+	// Cobra supports Persistent Flags which will work for this command
+	// and all subcommands, e.g.:
+	// serverMigrateCmd.PersistentFlags().String("foo", "", "A help for foo")
+
+	// Cobra supports local flags which will only run when this command
+	// is called directly, e.g.:
+	// serverMigrateCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
+	serverMigrateCmd.Flags().BoolP("dry-run", "n", false, "Show migration steps without changing any files")
+	serverMigrateCmd.Flags().StringP("backup", "b", "", "Copy the log directory to the specified path before migration")
+}
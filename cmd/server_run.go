@@ -22,6 +22,7 @@ package cmd
 
 import (
 	"context"
+	"fmt"
 	"log"
 	"os"
 	"os/signal"
@@ -29,13 +30,16 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
+	"github.com/yuuki0xff/goapptrace/config"
 	"github.com/yuuki0xff/goapptrace/httpserver"
 	"github.com/yuuki0xff/goapptrace/tracer/protocol"
 	"github.com/yuuki0xff/goapptrace/tracer/restapi"
 	"github.com/yuuki0xff/goapptrace/tracer/simulator"
 	"github.com/yuuki0xff/goapptrace/tracer/storage"
 	"github.com/yuuki0xff/goapptrace/tracer/types"
+	"github.com/yuuki0xff/goapptrace/tracer/watchdog"
 	"github.com/yuuki0xff/xtcp"
 )
 
@@ -53,8 +57,21 @@ var serverRunCmd = &cobra.Command{
 }
 
 func runServerRun(opt *handlerOpt) error {
-	apiAddr := opt.Conf.ApiServer()
-	logAddr := opt.Conf.LogServer()
+	// servers.jsonに記載されたサーバは連携先のリモートのサーバである可能性があるため、待ち受けるアドレスには使用しない。
+	apiAddr := opt.Conf.ApiServerListenAddr()
+	logAddr := opt.Conf.LogServerListenAddr()
+	if addr, err := opt.Cmd.Flags().GetString("listen-api"); err != nil {
+		opt.ErrLog.Println(err)
+		return errInvalidArgs
+	} else if addr != "" {
+		apiAddr = addr
+	}
+	if addr, err := opt.Cmd.Flags().GetString("listen-log"); err != nil {
+		opt.ErrLog.Println(err)
+		return errInvalidArgs
+	} else if addr != "" {
+		logAddr = addr
+	}
 
 	strg := storage.Storage{
 		Root: storage.DirLayout{
@@ -67,11 +84,27 @@ func runServerRun(opt *handlerOpt) error {
 	}
 	simulatorStore := simulator.StateSimulatorStore{}
 
+	var limits restapi.QueryLimits
+	var err error
+	if limits.Timeout, err = opt.Cmd.Flags().GetDuration("query-timeout"); err != nil {
+		opt.ErrLog.Println(err)
+		return errInvalidArgs
+	}
+	if limits.MaxScannedRows, err = opt.Cmd.Flags().GetInt64("max-scanned-rows"); err != nil {
+		opt.ErrLog.Println(err)
+		return errInvalidArgs
+	}
+	if limits.MaxBufferedRows, err = opt.Cmd.Flags().GetInt64("max-buffered-rows"); err != nil {
+		opt.ErrLog.Println(err)
+		return errInvalidArgs
+	}
+
 	// start API Server
 	apiSrv := httpserver.NewHttpServer(apiAddr, restapi.NewRouter(restapi.RouterArgs{
 		Config:         opt.Conf,
 		Storage:        &strg,
 		SimulatorStore: &simulatorStore,
+		QueryLimits:    limits,
 	}))
 	if err := apiSrv.Start(); err != nil {
 		opt.ErrLog.Println("Failed to start the API server:", err)
@@ -87,8 +120,9 @@ func runServerRun(opt *handlerOpt) error {
 	// start Log Server
 
 	m := &ServerHandlerMaker{
-		Storage: &strg,
-		SSStore: &simulatorStore,
+		Storage:  &strg,
+		SSStore:  &simulatorStore,
+		Watchdog: opt.Conf.Watchdog,
 	}
 	logSrv := protocol.Server{
 		Addr:       logAddr,
@@ -127,13 +161,18 @@ func init() {
 	// Cobra supports local flags which will only run when this command
 	// is called directly, e.g.:
 	// serverRunCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
-	serverRunCmd.Flags().StringP("listen-api", "p", "", "Address and port for REST API Server")
-	serverRunCmd.Flags().StringP("listen-log", "P", "", "Address and port for Log Server")
+	serverRunCmd.Flags().StringP("listen-api", "p", "", "Address and port for REST API Server (default "+config.DefaultApiServerAddr+")")
+	serverRunCmd.Flags().StringP("listen-log", "P", "", "Address and port for Log Server (default "+config.DefaultLogServerAddr+")")
+	serverRunCmd.Flags().Duration("query-timeout", 0, "Abort SQL queries running longer than this duration. 0 means no limit")
+	serverRunCmd.Flags().Int64("max-scanned-rows", 0, "Abort SQL queries reading more rows than this. 0 means no limit")
+	serverRunCmd.Flags().Int64("max-buffered-rows", 0, "Abort SQL queries holding more rows than this in memory for sorting or grouping. 0 means no limit")
 }
 
 type ServerHandlerMaker struct {
 	Storage *storage.Storage
 	SSStore *simulator.StateSimulatorStore
+	// ログに対して評価するルール。nilならルールを評価しない。
+	Watchdog *config.Watchdog
 
 	initOnce sync.Once
 
@@ -160,15 +199,29 @@ func (m *ServerHandlerMaker) NewConnHandler(id protocol.ConnID, conn protocol.Pa
 
 			logobj, err := m.Storage.New()
 			if err != nil {
-				log.Panicf("ERROR: Server: failed to a create Log object: err=%s", err.Error())
+				// ログを記録できないため、切断する。
+				log.Printf("ERROR: Server(connID=%d): failed to create a Log object: %s", id, err.Error())
+				conn.Stop(xtcp.StopImmediately)
+				return
 			}
 			info := logobj.LogInfo()
 			info.Metadata.PID = int64(pkt.PID)
 			info.Metadata.AppName = pkt.AppName
 			info.Metadata.Host = pkt.Host
+			info.Metadata.Description = pkt.Description
+			if labels, err := types.ParseLabels(pkt.Labels); err != nil {
+				log.Printf("ERROR: Server(connID=%d): invalid labels are ignored: %s", id, err.Error())
+			} else {
+				info.Metadata.Labels = labels
+			}
 			err = logobj.UpdateMetadata(info.Version, &info.Metadata)
 			if err != nil {
-				log.Panicf("ERROR: Server(connID=%d): failed to update LogMetadata: %s", id, err.Error())
+				log.Printf("ERROR: Server(connID=%d): failed to update LogMetadata: %s", id, err.Error())
+				if err := logobj.Close(); err != nil {
+					log.Printf("ERROR: Server(connID=%d): failed to close a Log(%s): %s", id, logobj.ID, err.Error())
+				}
+				conn.Stop(xtcp.StopImmediately)
+				return
 			}
 
 			ch := make(chan interface{}, DefaultReceiveBufferSize)
@@ -177,6 +230,23 @@ func (m *ServerHandlerMaker) NewConnHandler(id protocol.ConnID, conn protocol.Pa
 				Ch:                 ch,
 				ConnID:             id,
 				Log:                logobj,
+				Sender:             conn,
+			}
+			if m.Watchdog != nil {
+				if rules := m.Watchdog.Rules(pkt.AppName); len(rules) > 0 {
+					lwWorker.Watchdog = &watchdog.Watchdog{
+						Rules:   rules,
+						Symbols: logobj.Symbols(),
+					}
+					lwWorker.Actions = &watchdog.ActionRunner{
+						LogID: logobj.ID.Hex(),
+						FlightRecorder: func(reason string) error {
+							return conn.Send(&protocol.DumpFlightRecorderCmdPacket{
+								Reason: reason,
+							})
+						},
+					}
+				}
 			}
 			go lwWorker.Run()
 
@@ -197,8 +267,11 @@ func (m *ServerHandlerMaker) NewConnHandler(id protocol.ConnID, conn protocol.Pa
 			log.Println("INFO: Server: disconnected")
 
 			m.lock.Lock()
-			close(m.chMap[id])
-			delete(m.chMap, id)
+			// Connected() が失敗したときは、chanが作成されていない。
+			if ch, ok := m.chMap[id]; ok {
+				close(ch)
+				delete(m.chMap, id)
+			}
 			m.lock.Unlock()
 
 			if cancel != nil {
@@ -209,35 +282,58 @@ func (m *ServerHandlerMaker) NewConnHandler(id protocol.ConnID, conn protocol.Pa
 			log.Printf("ERROR: Server: connID=%d err=%s", id, err.Error())
 		},
 		Symbols: func(s *types.SymbolsData) {
-			m.lock.RLock()
-			m.chMap[id] <- s
-			m.lock.RUnlock()
+			m.send(id, s)
 		},
 		RawFuncLog: func(f *types.RawFuncLog) {
-			m.lock.RLock()
-			m.chMap[id] <- f
-			m.lock.RUnlock()
+			m.send(id, f)
 		},
 	}
 }
 
+// send は、idに対応する logWriteWorker に obj を送る。
+// 切断中のため logWriteWorker が存在しないときは、 obj を破棄する。
+func (m *ServerHandlerMaker) send(id protocol.ConnID, obj interface{}) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	if ch, ok := m.chMap[id]; ok {
+		ch <- obj
+	}
+}
+
 // logWriteWorker - ServerHandlerMaker worker
 type logWriteWorker struct {
 	*ServerHandlerMaker
 	Ch     chan interface{}
 	ConnID protocol.ConnID
 	Log    *storage.Log
+	// ログへの書き込みに失敗したときに、コネクションを切断するために使用する。
+	Sender protocol.PacketSender
+	// ウォッチドッグのルール。nilならルールを評価しない。
+	Watchdog *watchdog.Watchdog
+	Actions  *watchdog.ActionRunner
+
+	// 最後に受信した RawFuncLog のタイムスタンプ。
+	// ウォッチドッグが実行中の関数の実行時間を求めるときに使用する。
+	lastTimestamp types.Time
+	// 統計情報に追加済みの、実行が終了したFuncLogのID。
+	// writeSS() が途中で失敗すると同じFuncLogが再び書き出されるため、二重に集計しないように記録しておく。
+	// シミュレータから削除したFuncLogは再び書き出されないため、記録も削除する。
+	statsAdded map[types.FuncLogID]bool
+
+	abortOnce sync.Once
 }
 
 func (w *logWriteWorker) Run() {
 	logobj := w.Log
 	defer func() {
+		// 閉じられなかったログは、読み出し時にエラーになる。
+		// サーバ全体を停止させないように、エラーを記録するだけにする。
 		if err := logobj.Close(); err != nil {
-			log.Panicf("failed to close a Log(%s): connID=%d err=%s", logobj.ID, w.ConnID, err.Error())
+			log.Printf("ERROR: failed to close a Log(%s): connID=%d err=%s", logobj.ID, w.ConnID, err.Error())
 		}
 		logobj.ReadOnly = true
 		if err := logobj.Open(); err != nil {
-			log.Panicf("failed to reopen a Log(%s): connID=%d err=%s", logobj.ID, w.ConnID, err.Error())
+			log.Printf("ERROR: failed to reopen a Log(%s): connID=%d err=%s", logobj.ID, w.ConnID, err.Error())
 		}
 	}()
 
@@ -292,6 +388,9 @@ func (w *logWriteWorker) Run() {
 				//	log.Panicln("failed to append RawFuncLog:", err.Error())
 				//}
 				ss.Next(*obj)
+				if w.lastTimestamp < obj.Timestamp {
+					w.lastTimestamp = obj.Timestamp
+				}
 				types.RawFuncLogPool.Put(obj)
 
 				flCount++
@@ -303,13 +402,13 @@ func (w *logWriteWorker) Run() {
 				}
 			case *types.SymbolsData:
 				if err := logobj.SetSymbolsData(obj); err != nil {
-					log.Panicln("failed to append Symbols:", err.Error())
+					w.abort(errors.Wrap(err, "failed to append Symbols"))
 				}
 			case *simulator.StateSimulator:
 				w.writeSS(logobj, ss)
 				flCount = 0
 			default:
-				log.Panicf("unsupported type: %+v", rawobj)
+				w.abort(fmt.Errorf("unsupported type: %+v", rawobj))
 			}
 
 			if len(w.Ch) == 0 {
@@ -320,27 +419,106 @@ func (w *logWriteWorker) Run() {
 	}
 }
 
+// abort は、エラーを記録してコネクションを切断する。
+// 切断すると Ch がcloseされるため、 Run() はシミュレータの内容を書き出した後、ログを読み込み専用で開き直す。
+// それまでに受信したデータは、引き続き処理する。
+func (w *logWriteWorker) abort(err error) {
+	log.Printf("ERROR: Server(connID=%d): %s", w.ConnID, err.Error())
+	w.abortOnce.Do(func() {
+		w.Sender.Stop(xtcp.StopImmediately)
+	})
+}
+
 // writeSS は、 StateSimulator の内容をファイルへ書き出す。
 // 書き込みには時間がかかる可能性がある。
 // 書き込み済みのレコードはメモリ上から削除するのため、メモリ解放が行える。
+// 書き込み後にファイルを同期するため、サーバがクラッシュしても書き込み済みのデータは失われない。
+// 途中で失敗した場合は、シミュレータから削除せずに、次に呼び出されたときに書き出し直す。
 func (w *logWriteWorker) writeSS(logobj *storage.Log, ss *simulator.StateSimulator) {
+	ir := storage.NewIndexRecord()
+	fls := ss.FuncLogs(false)
+	var err error
 	logobj.FuncLog(func(store *storage.FuncLogStore) {
-		for _, fl := range ss.FuncLogs(false) {
-			err := store.SetNolock(fl)
+		for _, fl := range fls {
+			err = store.SetNolock(fl)
 			if err != nil {
-				log.Panicln("ERROR: failed to append FuncLog during rotating:", err.Error())
+				return
+			}
+			ir.Add(fl)
+			err = logobj.AddPostings(fl)
+			if err != nil {
+				return
 			}
 		}
 	})
+	if err != nil {
+		log.Println("ERROR: failed to append FuncLog during rotating:", err.Error())
+		return
+	}
+	if w.statsAdded == nil {
+		w.statsAdded = map[types.FuncLogID]bool{}
+	}
+	var ended []*types.FuncLog
+	for _, fl := range fls {
+		if fl.IsEnded() && !w.statsAdded[fl.ID] {
+			ended = append(ended, fl)
+		}
+	}
+	if err := logobj.AddFuncStats(ended); err != nil {
+		log.Println("ERROR: failed to update FuncStats:", err.Error())
+		return
+	}
+	for _, fl := range ended {
+		w.statsAdded[fl.ID] = true
+	}
 	logobj.Goroutine(func(store *storage.GoroutineStore) {
 		for _, g := range ss.Goroutines() {
-			err := store.SetNolock(g)
+			err = store.SetNolock(g)
 			if err != nil {
-				log.Panicln("ERROR: failed to append Goroutine during rotating:", err.Error())
+				return
 			}
 		}
 	})
+	if err != nil {
+		log.Println("ERROR: failed to append Goroutine during rotating:", err.Error())
+		return
+	}
+
+	w.checkWatchdog(logobj, fls)
+
+	if err := logobj.MergeIndex(ir); err != nil {
+		log.Println("ERROR: failed to update Index:", err.Error())
+	} else if err := logobj.Sync(); err != nil {
+		log.Println("ERROR: failed to sync Log:", err.Error())
+	}
+	// Sync()によってコミットされたレコードは、スナップショットから読み出せるようになる。
+	// 読み出し中のクライアントがレコードを見失わないように、コミットした後でシミュレータから削除する。
 	ss.Clear()
+	w.statsAdded = nil
+}
+
+// checkWatchdog は、ウォッチドッグのルールを評価する。
+// ルールに一致したら、ログにイベントを記録してアクションを実行する。
+func (w *logWriteWorker) checkWatchdog(logobj *storage.Log, fls []*types.FuncLog) {
+	if w.Watchdog == nil {
+		return
+	}
+	matches := w.Watchdog.Check(fls, w.lastTimestamp)
+	if len(matches) == 0 {
+		return
+	}
+
+	events := make([]types.Event, len(matches))
+	for i := range matches {
+		events[i] = matches[i].Event
+		log.Printf("INFO: Watchdog(log=%s): %s: %s", logobj.ID, matches[i].Rule.Name, matches[i].Event.Message)
+	}
+	if err := logobj.AddEvents(events...); err != nil {
+		log.Println("ERROR: failed to append Events:", err.Error())
+	}
+	for _, m := range matches {
+		w.Actions.Run(m)
+	}
 }
 
 type tracerSyncWorker struct {
@@ -46,7 +46,7 @@ func runTraceLs(opt *handlerOpt) error {
 	}
 	logID := opt.Args[0]
 
-	api, err := opt.Api(context.Background())
+	api, logID, err := opt.ApiForLog(context.Background(), logID)
 	if err != nil {
 		opt.ErrLog.Println(err)
 		return errApiClient
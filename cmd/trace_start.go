@@ -51,7 +51,7 @@ func runTraceStart(opt *handlerOpt) error {
 		opt.ErrLog.Panicln(err)
 	}
 
-	api, err := opt.Api(context.Background())
+	api, logID, err := opt.ApiForLog(context.Background(), logID)
 	if err != nil {
 		opt.ErrLog.Println(err)
 		return errApiClient
@@ -45,7 +45,7 @@ func runTuiCmd(opt *handlerOpt) error {
 		logID = targets[0]
 	}
 
-	api, err := opt.Api(context.Background())
+	api, err := opt.Federation(context.Background())
 	if err != nil {
 		opt.ErrLog.Println(err)
 		return errGeneral
@@ -53,7 +53,7 @@ func runTuiCmd(opt *handlerOpt) error {
 
 	t := logviewer.UICoordinator{
 		Config: opt.Conf,
-		Api:    &api.Client,
+		Api:    api.Federation,
 		LogID:  logID,
 	}
 	err = t.Run()
@@ -9,6 +9,7 @@ import (
 	"os/exec"
 	"path"
 	"strings"
+	"time"
 
 	"github.com/olekukonko/tablewriter"
 	"github.com/pkg/errors"
@@ -17,6 +18,7 @@ import (
 	"github.com/yuuki0xff/goapptrace/config"
 	"github.com/yuuki0xff/goapptrace/tracer/builder"
 	"github.com/yuuki0xff/goapptrace/tracer/restapi"
+	"github.com/yuuki0xff/goapptrace/tracer/types"
 )
 
 // func(*handlerOpt) error が返すエラーの一覧
@@ -61,7 +63,7 @@ type handlerOpt struct {
 	ErrLog *log.Logger
 }
 
-// Api returns an API Client object.
+// Api returns an API Client object for the primary API server.
 func (opt *handlerOpt) Api(ctx context.Context) (api restapi.ClientWithCtx, err error) {
 	var apiNoctx *restapi.Client
 	apiNoctx, err = getAPIClient(opt.Conf)
@@ -74,13 +76,29 @@ func (opt *handlerOpt) Api(ctx context.Context) (api restapi.ClientWithCtx, err
 	return
 }
 
-// ApiWithCancel returns an API Client object with cancelable context.
-func (opt *handlerOpt) ApiWithCancel(ctx context.Context) (api restapi.ClientWithCtx, cancel func(), err error) {
-	ctx, cancel = context.WithCancel(ctx)
-	api, err = opt.Api(ctx)
+// Federation returns an API Client object for all API servers.
+func (opt *handlerOpt) Federation(ctx context.Context) (api restapi.FederationWithCtx, err error) {
+	var f *restapi.Federation
+	f, err = restapi.NewFederation(opt.Conf.Servers.ApiServer)
+	if err != nil {
+		err = errors.Wrap(err, errApiClient.Error())
+		return
+	}
+	api = f.WithCtx(ctx)
 	return
 }
 
+// ApiForLog returns an API Client object for the server that has the specified log.
+// logID is a qualified or unqualified log ID. It returns the log ID on the server.
+func (opt *handlerOpt) ApiForLog(ctx context.Context, logID string) (api restapi.ClientWithCtx, localID string, err error) {
+	var f restapi.FederationWithCtx
+	f, err = opt.Federation(ctx)
+	if err != nil {
+		return
+	}
+	return f.Resolve(logID)
+}
+
 func (opt *handlerOpt) LogServer() string {
 	return opt.Conf.LogServer()
 }
@@ -109,7 +127,7 @@ func wrap(fn func(*handlerOpt) error) cobraHandler {
 }
 
 func getConfig() (*config.Config, error) {
-	c := config.NewConfig(storageDir, apiSrvAddr, logSrvAddr)
+	c := config.NewConfig(storageDir, apiSrvAddrs, logSrvAddr)
 	err := c.Load()
 	if err != nil {
 		return nil, err
@@ -169,6 +187,41 @@ func mergeFlagNames(a, b map[string]bool) map[string]bool {
 	return a
 }
 
+// labelsFlag は、"key=value"形式の値を持つフラグをLabelsに変換する。
+func labelsFlag(flagset *pflag.FlagSet, name string) (types.Labels, error) {
+	kvs, err := flagset.GetStringArray(name)
+	if err != nil {
+		return nil, err
+	}
+	labels := types.Labels{}
+	for _, kv := range kvs {
+		if err := labels.Set(kv); err != nil {
+			return nil, err
+		}
+	}
+	return labels, nil
+}
+
+// parseTimeFlag は、時刻を表すフラグの値を解析する。
+// 値には、nowからの経過時間 ("24h"など)、日付 ("2006-01-02")、およびRFC3339形式の時刻を指定できる。
+// 空文字列の場合は0を返す。
+func parseTimeFlag(value string, now time.Time) (types.Time, error) {
+	if value == "" {
+		return 0, nil
+	}
+	if d, err := time.ParseDuration(value); err == nil {
+		return types.NewTime(now.Add(-d)), nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", value, time.Local); err == nil {
+		return types.NewTime(t), nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return 0, err
+	}
+	return types.NewTime(t), nil
+}
+
 func getAPIClient(conf *config.Config) (*restapi.Client, error) {
 	api := &restapi.Client{
 		BaseUrl: conf.ApiServer(),
@@ -1,4 +1,7 @@
 // Directory Layout
 //   $dir/targets.json        - includes target, trace, build
+//   $dir/servers.json        - addresses of the API servers and the log servers
+//   $dir/watchdog.json       - watchdog rules evaluated by the log server
+//   $dir/views.json          - saved queries referenced as tables from SQL queries
 //   $dir/logs/               - managed under tracer.storage
 package config
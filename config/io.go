@@ -2,6 +2,7 @@ package config
 
 import (
 	"encoding/json"
+	"fmt"
 	"io/ioutil"
 	"log"
 	"os"
@@ -23,36 +24,120 @@ const (
 type Config struct {
 	// Path to config and log directory.
 	dir string
-	// API server address.
-	apiServer string
-	// Log server address.
+	// API server addresses specified by command line.
+	apiServers []string
+	// Log server address specified by command line.
 	logServer string
 	wantSave  bool
+
+	// Servers holds addresses of the API servers and the log servers.
+	// It is initialized by Load().
+	Servers *Servers
+	// Watchdog holds rules evaluated by the log server for each app name.
+	// It is initialized by Load().
+	Watchdog *Watchdog
+	// Views holds saved queries referenced as tables from SQL queries.
+	// It is initialized by Load().
+	Views *Views
 }
 
-func NewConfig(dir, apiServer, logServer string) *Config {
+// NewConfig returns a Config object.
+// If apiServers or logServer are empty, servers are loaded from the servers.json file by Load().
+func NewConfig(dir string, apiServers []string, logServer string) *Config {
 	if dir == "" {
 		dir = info.DefaultStorageDir
 	}
-	if apiServer == "" {
-		apiServer = DefaultApiServerAddr
-	}
-	if logServer == "" {
-		logServer = DefaultLogServerAddr
-	}
 
 	dir, err := homedir.Expand(dir)
 	if err != nil {
 		log.Panic(err)
 	}
 	return &Config{
-		dir:       dir,
-		apiServer: apiServer,
-		logServer: logServer,
+		dir:        dir,
+		apiServers: apiServers,
+		logServer:  logServer,
 	}
 }
 
 func (c *Config) Load() error {
+	c.Servers = NewServers()
+	if _, err := os.Stat(c.ServersFile()); err == nil {
+		if err := readFromJsonFile(c.ServersFile(), c.Servers); err != nil {
+			return fmt.Errorf("failed to read %s: %s", c.ServersFile(), err.Error())
+		}
+		if c.Servers.LogServer == nil {
+			c.Servers.LogServer = map[ServerID]*LogServerConfig{}
+		}
+		if c.Servers.ApiServer == nil {
+			c.Servers.ApiServer = map[ServerID]*ApiServerConfig{}
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	// コマンドラインで指定されたサーバは、設定ファイルよりも優先する。
+	if len(c.apiServers) > 0 {
+		c.Servers.ApiServer = map[ServerID]*ApiServerConfig{}
+		for i, addr := range c.apiServers {
+			id := ServerID(i)
+			c.Servers.ApiServer[id] = &ApiServerConfig{
+				ServerID: id,
+				Addr:     addr,
+			}
+		}
+	}
+	if c.logServer != "" {
+		c.Servers.LogServer = map[ServerID]*LogServerConfig{
+			0: {
+				ServerID: 0,
+				Addr:     c.logServer,
+			},
+		}
+	}
+
+	c.Watchdog = NewWatchdog()
+	if _, err := os.Stat(c.WatchdogFile()); err == nil {
+		if err := readFromJsonFile(c.WatchdogFile(), c.Watchdog); err != nil {
+			return fmt.Errorf("failed to read %s: %s", c.WatchdogFile(), err.Error())
+		}
+		if c.Watchdog.Apps == nil {
+			c.Watchdog.Apps = map[string][]WatchdogRule{}
+		}
+		if err := c.Watchdog.Validate(); err != nil {
+			return fmt.Errorf("failed to read %s: %s", c.WatchdogFile(), err.Error())
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	c.Views = NewViews()
+	if _, err := os.Stat(c.ViewsFile()); err == nil {
+		if err := readFromJsonFile(c.ViewsFile(), c.Views); err != nil {
+			return fmt.Errorf("failed to read %s: %s", c.ViewsFile(), err.Error())
+		}
+		if c.Views.Apps == nil {
+			c.Views.Apps = map[string][]View{}
+		}
+		if err := c.Views.Validate(); err != nil {
+			return fmt.Errorf("failed to read %s: %s", c.ViewsFile(), err.Error())
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	// サーバが1つも指定されていなければ、デフォルトのサーバを使用する。
+	if len(c.Servers.ApiServer) == 0 {
+		c.Servers.ApiServer[0] = &ApiServerConfig{
+			ServerID: 0,
+			Addr:     DefaultApiServerAddr,
+		}
+	}
+	if len(c.Servers.LogServer) == 0 {
+		c.Servers.LogServer[0] = &LogServerConfig{
+			ServerID: 0,
+			Addr:     DefaultLogServerAddr,
+		}
+	}
 	return nil
 }
 
@@ -76,12 +161,58 @@ func (c *Config) SaveIfWant() error {
 	return nil
 }
 
+// ApiServer returns the address of the primary API server.
 func (c Config) ApiServer() string {
-	return c.apiServer
+	return c.Servers.PrimaryApiServer().Addr
 }
 
+// LogServer returns the address of the primary log server.
 func (c Config) LogServer() string {
-	return c.logServer
+	return c.Servers.PrimaryLogServer().Addr
+}
+
+// ApiServerListenAddr returns the address that the local API server listens on.
+// It is the first API server specified by command line, or the default address.
+// API servers in the servers.json file are not used, because they may be remote servers for federation.
+func (c Config) ApiServerListenAddr() string {
+	if len(c.apiServers) > 0 {
+		return c.apiServers[0]
+	}
+	return DefaultApiServerAddr
+}
+
+// LogServerListenAddr returns the address that the local log server listens on.
+// It is the log server specified by command line, or the default address.
+func (c Config) LogServerListenAddr() string {
+	if c.logServer != "" {
+		return c.logServer
+	}
+	return DefaultLogServerAddr
+}
+
+// ServersFile returns the path to the file that holds addresses of servers.
+func (c Config) ServersFile() string {
+	return path.Join(c.dir, "servers.json")
+}
+
+// WatchdogFile returns the path to the file that holds watchdog rules.
+func (c Config) WatchdogFile() string {
+	return path.Join(c.dir, "watchdog.json")
+}
+
+// ViewsFile returns the path to the file that holds saved views.
+func (c Config) ViewsFile() string {
+	return path.Join(c.dir, "views.json")
+}
+
+// SaveViews writes the views to the views.json file.
+func (c *Config) SaveViews() error {
+	if err := c.Save(); err != nil {
+		return err
+	}
+	c.Views.lock.RLock()
+	defer c.Views.lock.RUnlock()
+	return writeToJsonFile(c.ViewsFile(), c.Views)
 }
 
 func (c Config) LogsDir() string {
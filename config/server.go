@@ -7,8 +7,8 @@ const (
 
 type ServerID int64
 type Servers struct {
-	LogServer map[ServerID]*LogServerConfig
-	ApiServer map[ServerID]*ApiServerConfig
+	LogServer map[ServerID]*LogServerConfig `json:"log-servers"`
+	ApiServer map[ServerID]*ApiServerConfig `json:"api-servers"`
 }
 
 func NewServers() *Servers {
@@ -33,3 +33,27 @@ type ApiServerConfig struct {
 	// server address like "http://x.x.x.x:xxxx".
 	Addr string `json:"address"`
 }
+
+// PrimaryLogServer returns the log server that has the smallest ServerID.
+// If no log server is configured, it returns nil.
+func (s *Servers) PrimaryLogServer() *LogServerConfig {
+	var primary *LogServerConfig
+	for _, srv := range s.LogServer {
+		if primary == nil || srv.ServerID < primary.ServerID {
+			primary = srv
+		}
+	}
+	return primary
+}
+
+// PrimaryApiServer returns the API server that has the smallest ServerID.
+// If no API server is configured, it returns nil.
+func (s *Servers) PrimaryApiServer() *ApiServerConfig {
+	var primary *ApiServerConfig
+	for _, srv := range s.ApiServer {
+		if primary == nil || srv.ServerID < primary.ServerID {
+			primary = srv
+		}
+	}
+	return primary
+}
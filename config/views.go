@@ -0,0 +1,161 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"sync"
+)
+
+// 全てのアプリケーションから参照できるビューのキー。
+const ViewAnyApp = "*"
+
+// viewNameRegexp は、ビューの名前として使用できる文字列にマッチする。
+var viewNameRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// Views は、SQLのクエリからテーブルとして参照できる、名前付きのSELECT文を保持する。
+// 全てのメソッドは、並行して呼び出せる。
+type Views struct {
+	// アプリケーション名ごとのビュー。
+	// キーが ViewAnyApp のビューは、全てのアプリケーションから参照できる。
+	Apps map[string][]View `json:"apps"`
+
+	lock sync.RWMutex
+}
+
+// View は、1つのビューを表す。
+type View struct {
+	Name string `json:"name"`
+	// ビューを定義するSELECT文。
+	Query       string `json:"query"`
+	Description string `json:"description,omitempty"`
+}
+
+func NewViews() *Views {
+	return &Views{
+		Apps: map[string][]View{},
+	}
+}
+
+// Lookup は、指定したアプリケーションから参照できる name という名前のビューを返す。
+// アプリケーション固有のビューは、全てのアプリケーションから参照できるビューよりも優先する。
+func (v *Views) Lookup(appName, name string) (View, bool) {
+	v.lock.RLock()
+	defer v.lock.RUnlock()
+	if view, ok := v.find(appName, name); ok {
+		return view, true
+	}
+	return v.find(ViewAnyApp, name)
+}
+
+// Get は、指定したアプリケーションで定義された name という名前のビューを返す。
+// Lookup() とは異なり、全てのアプリケーションから参照できるビューは返さない。
+func (v *Views) Get(appName, name string) (View, bool) {
+	v.lock.RLock()
+	defer v.lock.RUnlock()
+	return v.find(appName, name)
+}
+
+// List は、指定したアプリケーションで定義されたビューを名前順に返す。
+// ViewAnyApp を指定すると、全てのアプリケーションから参照できるビューを返す。
+func (v *Views) List(appName string) []View {
+	v.lock.RLock()
+	defer v.lock.RUnlock()
+	views := make([]View, len(v.Apps[appName]))
+	copy(views, v.Apps[appName])
+	sort.Slice(views, func(i, j int) bool {
+		return views[i].Name < views[j].Name
+	})
+	return views
+}
+
+// AppNames は、ビューが定義されているアプリケーション名を返す。
+func (v *Views) AppNames() []string {
+	v.lock.RLock()
+	defer v.lock.RUnlock()
+	var names []string
+	for app, views := range v.Apps {
+		if len(views) > 0 {
+			names = append(names, app)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Set は、指定したアプリケーションにビューを追加する。
+// 同じ名前のビューが既に存在すれば、置き換える。
+func (v *Views) Set(appName string, view View) error {
+	if err := view.Validate(); err != nil {
+		return err
+	}
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	views := v.Apps[appName]
+	for i := range views {
+		if views[i].Name == view.Name {
+			views[i] = view
+			return nil
+		}
+	}
+	v.Apps[appName] = append(views, view)
+	return nil
+}
+
+// Remove は、指定したアプリケーションのビューを削除する。
+// ビューが存在しなければ、falseを返す。
+func (v *Views) Remove(appName, name string) bool {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	views := v.Apps[appName]
+	for i := range views {
+		if views[i].Name == name {
+			v.Apps[appName] = append(views[:i:i], views[i+1:]...)
+			if len(v.Apps[appName]) == 0 {
+				delete(v.Apps, appName)
+			}
+			return true
+		}
+	}
+	return false
+}
+
+// Validate は、全てのビューが正しいか検証する。
+// ビューのクエリの文法は、ここでは検証しない。
+func (v *Views) Validate() error {
+	v.lock.RLock()
+	defer v.lock.RUnlock()
+	for app, views := range v.Apps {
+		names := map[string]bool{}
+		for i := range views {
+			if err := views[i].Validate(); err != nil {
+				return fmt.Errorf("invalid view for %s: %s", app, err.Error())
+			}
+			if names[views[i].Name] {
+				return fmt.Errorf("invalid view for %s: %s: duplicate name", app, views[i].Name)
+			}
+			names[views[i].Name] = true
+		}
+	}
+	return nil
+}
+
+func (v *Views) find(appName, name string) (View, bool) {
+	for _, view := range v.Apps[appName] {
+		if view.Name == name {
+			return view, true
+		}
+	}
+	return View{}, false
+}
+
+// Validate は、ビューの名前とクエリが空でないか検証する。
+func (v *View) Validate() error {
+	if !viewNameRegexp.MatchString(v.Name) {
+		return fmt.Errorf("invalid name: %q", v.Name)
+	}
+	if v.Query == "" {
+		return fmt.Errorf("%s: query is empty", v.Name)
+	}
+	return nil
+}
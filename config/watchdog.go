@@ -0,0 +1,140 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+const (
+	// 全てのアプリケーションに適用されるルールのキー。
+	WatchdogAnyApp = "*"
+
+	// ルールに一致したときに、JSON形式のイベントをPOSTする。
+	WebhookAction WatchdogActionType = "webhook"
+	// ルールに一致したときに、コマンドを実行する。
+	// イベントはJSON形式で標準入力に渡される。
+	CommandAction WatchdogActionType = "command"
+	// ルールに一致したときに、トレース対象のプロセスにフライトレコーダーの内容を書き出させる。
+	FlightRecorderAction WatchdogActionType = "flight-recorder"
+)
+
+// Watchdog は、ログサーバが書き込み中のログに対して評価するルールを保持する。
+type Watchdog struct {
+	// アプリケーション名ごとのルール。
+	// キーが WatchdogAnyApp のルールは、全てのアプリケーションに適用される。
+	Apps map[string][]WatchdogRule `json:"apps"`
+}
+
+// WatchdogRule は、1つのルールを表す。
+// MaxDuration と MaxGoroutines のうち、少なくとも一方を指定しなければならない。
+type WatchdogRule struct {
+	Name string `json:"name"`
+	// 監視対象の関数名。
+	Func string `json:"func"`
+	// Funcの実行時間がこの値を超えたら、ルールに一致する。0なら評価しない。
+	MaxDuration Duration `json:"max-duration"`
+	// Funcを実行中のgoroutineの数がこの値を超えたら、ルールに一致する。0なら評価しない。
+	MaxGoroutines int `json:"max-goroutines"`
+	// ルールに一致したときに実行するアクション。
+	Actions []WatchdogAction `json:"actions"`
+}
+
+type WatchdogActionType string
+
+// WatchdogAction は、ルールに一致したときに実行するアクションを表す。
+type WatchdogAction struct {
+	Type WatchdogActionType `json:"type"`
+	// WebhookAction のPOST先のURL。
+	URL string `json:"url,omitempty"`
+	// CommandAction で実行するコマンドと引数。
+	Command []string `json:"command,omitempty"`
+}
+
+// Duration は、"500ms"のような文字列としてJSONにエンコードされる time.Duration である。
+// デコード時は、ナノ秒単位の整数も受け付ける。
+type Duration time.Duration
+
+func NewWatchdog() *Watchdog {
+	return &Watchdog{
+		Apps: map[string][]WatchdogRule{},
+	}
+}
+
+// Rules は、指定したアプリケーションに適用されるルールを返す。
+func (w *Watchdog) Rules(appName string) []WatchdogRule {
+	var rules []WatchdogRule
+	rules = append(rules, w.Apps[WatchdogAnyApp]...)
+	if appName != WatchdogAnyApp {
+		rules = append(rules, w.Apps[appName]...)
+	}
+	return rules
+}
+
+// Validate は、全てのルールが正しいか検証する。
+func (w *Watchdog) Validate() error {
+	for app, rules := range w.Apps {
+		for i := range rules {
+			if err := rules[i].Validate(); err != nil {
+				return fmt.Errorf("invalid rule for %s: %s", app, err.Error())
+			}
+		}
+	}
+	return nil
+}
+
+// Validate は、ルールが正しいか検証する。
+func (r *WatchdogRule) Validate() error {
+	if r.Name == "" {
+		return fmt.Errorf("name is empty")
+	}
+	if r.Func == "" {
+		return fmt.Errorf("%s: func is empty", r.Name)
+	}
+	if r.MaxDuration < 0 || r.MaxGoroutines < 0 {
+		return fmt.Errorf("%s: limits must not be negative", r.Name)
+	}
+	if r.MaxDuration == 0 && r.MaxGoroutines == 0 {
+		return fmt.Errorf("%s: max-duration or max-goroutines is required", r.Name)
+	}
+	for _, a := range r.Actions {
+		switch a.Type {
+		case WebhookAction:
+			if a.URL == "" {
+				return fmt.Errorf("%s: url is required by %s action", r.Name, a.Type)
+			}
+		case CommandAction:
+			if len(a.Command) == 0 {
+				return fmt.Errorf("%s: command is required by %s action", r.Name, a.Type)
+			}
+		case FlightRecorderAction:
+		default:
+			return fmt.Errorf("%s: unknown action: %s", r.Name, a.Type)
+		}
+	}
+	return nil
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var v interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	switch val := v.(type) {
+	case float64:
+		*d = Duration(val)
+	case string:
+		dur, err := time.ParseDuration(val)
+		if err != nil {
+			return err
+		}
+		*d = Duration(dur)
+	default:
+		return fmt.Errorf("invalid duration: %s", string(data))
+	}
+	return nil
+}
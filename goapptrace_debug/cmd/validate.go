@@ -33,19 +33,55 @@ import (
 
 // validateCmd represents the validate command
 var validateCmd = &cobra.Command{
-	Use: "validate <FuncLogFile> <GoroutineLog>",
+	Use: "validate {<FuncLogFile> <GoroutineLog> | --storage <dir> [--repair] <LogID>}",
 	DisableFlagsInUseLine: true,
 	Short: "validate logs",
+	Long: `Validate logs.
+If --storage is specified, checks the files of the log (torn records, index, symbols and metadata) before validating records.
+With --repair, fixes those problems instead of reporting them.`,
 	Run: func(cmd *cobra.Command, args []string) {
 		errlog := log.New(cmd.OutOrStderr(), "ERROR: ", log.Lshortfile)
 		stdout := cmd.OutOrStdout()
 
+		storageDir, err := cmd.Flags().GetString("storage")
+		if err != nil {
+			errlog.Fatalln(err)
+		}
+		repair, err := cmd.Flags().GetBool("repair")
+		if err != nil {
+			errlog.Fatalln(err)
+		}
+
+		var invalid bool
 		var flFile string
 		var gFile string
-		switch len(args) {
-		case 2:
+		switch {
+		case len(args) == 2 && storageDir == "":
 			flFile = args[0]
 			gFile = args[1]
+		case len(args) == 1 && storageDir != "":
+			id, err := storage.LogID{}.Unhex(args[0])
+			if err != nil {
+				errlog.Fatalln("invalid LogID:", err)
+			}
+			root := storage.DirLayout{Root: storageDir}
+			r := storage.Repairer{
+				Root:   root,
+				ID:     id,
+				DryRun: !repair,
+			}
+			problems, err := r.Repair()
+			for _, p := range problems {
+				fmt.Fprintln(stdout, p)
+			}
+			if err != nil {
+				errlog.Fatalln("Cannot check the log:", err)
+			}
+			if len(problems) > 0 && !repair {
+				invalid = true
+			}
+			flFile = string(root.FuncLogFile(id, 0))
+			gFile = string(root.GoroutineLogFile(id, 0))
 		default:
 			errlog.Fatalln("invalid args")
 		}
@@ -64,7 +100,7 @@ var validateCmd = &cobra.Command{
 				ReadOnly:   true,
 			},
 		}
-		err := flStore.Open()
+		err = flStore.Open()
 		if err != nil {
 			errlog.Fatalln("Cannot open the FuncLogStore:", err)
 		}
@@ -73,7 +109,6 @@ var validateCmd = &cobra.Command{
 			errlog.Fatalln("Cannot open the GoroutineStore:", err)
 		}
 
-		var invalid bool
 		fl := types.FuncLogPool.Get().(*types.FuncLog)
 		g := &types.Goroutine{}
 
@@ -153,4 +188,6 @@ func init() {
 	// Cobra supports local flags which will only run when this command
 	// is called directly, e.g.:
 	// validateCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
+	validateCmd.Flags().StringP("storage", "s", "", "Path to log directory")
+	validateCmd.Flags().BoolP("repair", "", false, "Repair the log before validation. It requires --storage option")
 }
@@ -16,6 +16,9 @@ const (
 	DefaultHttpDocRoot   = "./static/"
 	DefaultExeName       = "exe"
 	DefaultAppNameEnv    = "GOAPPTRACE_APP_NAME"
+	DefaultLabelsEnv     = "GOAPPTRACE_LABELS"
+	DefaultDescEnv       = "GOAPPTRACE_DESCRIPTION"
+	DefaultDumpDirEnv    = "GOAPPTRACE_DUMP_DIR"
 )
 
 var (
@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"github.com/marcusolsson/tui-go"
+	"github.com/yuuki0xff/goapptrace/config"
 	"github.com/yuuki0xff/goapptrace/tracer/restapi"
 	"github.com/yuuki0xff/goapptrace/tracer/types"
 	"golang.org/x/sync/errgroup"
@@ -21,13 +22,18 @@ type FuncLogDetailState struct {
 	Mods   []types.GoModule
 	Funcs  []types.GoFunc
 	Lines  []types.GoLine
+	// 呼び出し元 (呼び出しツリーの根から順に並ぶ) と、呼び出し先の関数呼び出し。
+	Ancestors []restapi.CallTreeNode
+	Children  []restapi.CallTreeNode
 }
 type FuncLogDetailStateMutable FuncLogDetailState
 type FuncLogDetailVM struct {
 	Root   Coordinator
 	Client restapi.ClientWithCtx
-	LogID  string
-	Record types.FuncLog
+	// ログを保持しているAPIサーバのID
+	ServerID config.ServerID
+	LogID    string
+	Record   types.FuncLog
 
 	m     sync.Mutex
 	view  *FuncLogDetailView
@@ -65,6 +71,15 @@ func (vm *FuncLogDetailVM) Update(ctx context.Context) {
 		for i := range vm.Record.Frames {
 			fetch(i)
 		}
+		var ancestors, children []restapi.CallTreeNode
+		eg.Go(func() (err error) {
+			ancestors, err = vm.Client.FuncLogAncestors(vm.LogID, vm.Record.ID)
+			return
+		})
+		eg.Go(func() (err error) {
+			children, err = vm.Client.FuncLogChildren(vm.LogID, vm.Record.ID)
+			return
+		})
 		err := eg.Wait()
 
 		vm.m.Lock()
@@ -77,10 +92,14 @@ func (vm *FuncLogDetailVM) Update(ctx context.Context) {
 			vm.state.Mods = mods
 			vm.state.Funcs = funcs
 			vm.state.Lines = lines
+			vm.state.Ancestors = ancestors
+			vm.state.Children = children
 		} else {
 			vm.state.Mods = nil
 			vm.state.Funcs = nil
 			vm.state.Lines = nil
+			vm.state.Ancestors = nil
+			vm.state.Children = nil
 		}
 		vm.m.Unlock()
 
@@ -101,7 +120,16 @@ func (vm *FuncLogDetailVM) View() View {
 }
 func (vm *FuncLogDetailVM) onUnselectedRecord(logID string) {
 	vm.Root.SetState(UIState{
-		LogID: logID,
+		ServerID: vm.ServerID,
+		LogID:    logID,
+	})
+}
+func (vm *FuncLogDetailVM) onActivatedRecord(record types.FuncLog) {
+	vm.Root.SetState(UIState{
+		ServerID: vm.ServerID,
+		LogID:    vm.LogID,
+		RecordID: record.ID,
+		Record:   record,
 	})
 }
 
@@ -145,14 +173,28 @@ func (v *FuncLogDetailView) init() {
 				v.newFramesTable(),
 			)
 
+			callersInfo := tui.NewVBox(
+				tui.NewLabel("Callers:"),
+				v.newCallTreeTable(v.Ancestors),
+			)
+
+			calleesInfo := tui.NewVBox(
+				tui.NewLabel("Callees:"),
+				v.newCallTreeTable(v.Children),
+			)
+
 			v.widget = tui.NewVBox(
 				fcInfo,
 				tui.NewLabel(""),
 				framesInfo,
+				tui.NewLabel(""),
+				callersInfo,
+				tui.NewLabel(""),
+				calleesInfo,
 				tui.NewSpacer(),
 				v.newStatusBar(""),
 			)
-			v.fc = newFocusChain(fcInfo, framesInfo)
+			v.fc = newFocusChain(fcInfo, framesInfo, callersInfo, calleesInfo)
 			return
 		}
 	default:
@@ -222,6 +264,40 @@ func (v *FuncLogDetailView) newFramesTable() *headerTable {
 	}
 	return t
 }
+func (v *FuncLogDetailView) newCallTreeTable(nodes []restapi.CallTreeNode) *headerTable {
+	t := newHeaderTable(
+		tui.NewLabel("Name"),
+		tui.NewLabel("ExecTime (ns)"),
+		tui.NewLabel("Callees"),
+	)
+	t.OnItemActivated(func(table *tui.Table) {
+		idx := table.Selected()
+		if idx <= 0 || len(nodes) < idx {
+			return
+		}
+		v.VM.onActivatedRecord(nodes[idx-1].FuncLog)
+	})
+	t.SetColumnStretch(0, 10)
+	t.SetColumnStretch(1, 3)
+	t.SetColumnStretch(2, 1)
+
+	for _, node := range nodes {
+		name := node.Func
+		if name == "" {
+			name = node.Line
+		}
+		execTime := "running"
+		if node.IsEnded() {
+			execTime = (node.EndTime - node.StartTime).NumberString()
+		}
+		t.AppendRow(
+			tui.NewLabel(name),
+			tui.NewLabel(execTime),
+			tui.NewLabel(strconv.Itoa(node.ChildCount)),
+		)
+	}
+	return t
+}
 func (v *FuncLogDetailView) newStatusBar(text string) *tui.StatusBar {
 	s := tui.NewStatusBar(LoadingText)
 	s.SetPermanentText("Function Call Detail")
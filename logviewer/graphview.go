@@ -10,6 +10,7 @@ import (
 	"time"
 
 	"github.com/marcusolsson/tui-go"
+	"github.com/yuuki0xff/goapptrace/config"
 	"github.com/yuuki0xff/goapptrace/tracer/restapi"
 	"github.com/yuuki0xff/goapptrace/tracer/types"
 	"golang.org/x/sync/errgroup"
@@ -141,7 +142,9 @@ func (c *GraphCache) RunningFuncLogs(t types.Time) int {
 type GraphVM struct {
 	Root   Coordinator
 	Client restapi.ClientWithCtx
-	LogID  string
+	// ログを保持しているAPIサーバのID
+	ServerID config.ServerID
+	LogID    string
 
 	m     sync.Mutex
 	view  *GraphView
@@ -355,7 +358,8 @@ func (vm *GraphVM) buildLines(c *GraphCache) (lines []Line) {
 }
 func (vm *GraphVM) onGoback() {
 	vm.Root.SetState(UIState{
-		LogID: vm.LogID,
+		ServerID: vm.ServerID,
+		LogID:    vm.LogID,
 	})
 }
 func (vm *GraphVM) onChangedOffset(dx, dy int) {
@@ -24,7 +24,7 @@ type LogListStateMutable LogListState
 // LogListVM implements ViewModel.
 type LogListVM struct {
 	Root   Coordinator
-	Client restapi.ClientWithCtx
+	Client restapi.FederationWithCtx
 
 	m     sync.Mutex
 	view  *LogListView
@@ -70,8 +70,15 @@ func (vm *LogListVM) View() View {
 	return vm.view
 }
 func (vm *LogListVM) onActivatedLog(logID string) {
+	// 複数のサーバを使用している場合、ログIDはサーバIDで修飾されている。
+	id, err := vm.Client.SplitLogID(logID)
+	if err != nil {
+		log.Println(err)
+		return
+	}
 	vm.Root.SetState(UIState{
-		LogID: logID,
+		ServerID: id.ServerID,
+		LogID:    id.LogID,
 	})
 }
 func (vm *LogListVM) onSelectionChanged(logID string) {
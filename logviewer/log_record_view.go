@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"github.com/marcusolsson/tui-go"
+	"github.com/yuuki0xff/goapptrace/config"
 	"github.com/yuuki0xff/goapptrace/tracer/restapi"
 	"github.com/yuuki0xff/goapptrace/tracer/types"
 )
@@ -28,7 +29,9 @@ type LogRecordStateMutable LogRecordState
 type LogRecordVM struct {
 	Root   Coordinator
 	Client restapi.ClientWithCtx
-	LogID  string
+	// ログを保持しているAPIサーバのID
+	ServerID config.ServerID
+	LogID    string
 
 	m     sync.Mutex
 	state LogRecordStateMutable
@@ -103,6 +106,7 @@ func (vm *LogRecordVM) onUnselectedLog() {
 }
 func (vm *LogRecordVM) onActivatedRecord(record types.FuncLog) {
 	vm.Root.SetState(UIState{
+		ServerID: vm.ServerID,
 		LogID:    vm.LogID,
 		RecordID: record.ID,
 		Record:   record,
@@ -118,6 +122,7 @@ func (vm *LogRecordVM) onSelectionChanged(id types.FuncLogID) {
 }
 func (vm *LogRecordVM) onUseGraph() {
 	vm.Root.SetState(UIState{
+		ServerID:     vm.ServerID,
 		LogID:        vm.LogID,
 		UseGraphView: true,
 	})
@@ -16,7 +16,7 @@ import (
 // UICoordinator implements of Coordinator.
 type UICoordinator struct {
 	Config *config.Config
-	Api    *restapi.Client
+	Api    *restapi.Federation
 	LogID  string
 	UI     tui.UI
 
@@ -59,6 +59,16 @@ func (c *UICoordinator) SetState(s UIState) {
 	c.m.Lock()
 	defer c.m.Unlock()
 
+	var api restapi.ClientWithCtx
+	if s.LogID != "" {
+		var err error
+		api, err = c.Api.WithCtx(c.ctx).Client(s.ServerID)
+		if err != nil {
+			log.Println(err)
+			s = UIState{}
+		}
+	}
+
 	if s.LogID == "" {
 		c.setVM(func(ctx context.Context) ViewModel {
 			return &LogListVM{
@@ -72,10 +82,11 @@ func (c *UICoordinator) SetState(s UIState) {
 	if s.RecordID != 0 {
 		c.setVM(func(ctx context.Context) ViewModel {
 			return &FuncLogDetailVM{
-				Root:   c,
-				Client: c.Api.WithCtx(ctx),
-				LogID:  s.LogID,
-				Record: s.Record,
+				Root:     c,
+				Client:   api.WithCtx(ctx),
+				ServerID: s.ServerID,
+				LogID:    s.LogID,
+				Record:   s.Record,
 			}
 		})
 		return
@@ -84,18 +95,20 @@ func (c *UICoordinator) SetState(s UIState) {
 	if s.UseGraphView {
 		c.setVM(func(ctx context.Context) ViewModel {
 			return &GraphVM{
-				Root:   c,
-				Client: c.Api.WithCtx(ctx),
-				LogID:  s.LogID,
+				Root:     c,
+				Client:   api.WithCtx(ctx),
+				ServerID: s.ServerID,
+				LogID:    s.LogID,
 			}
 		})
 		return
 	} else {
 		c.setVM(func(ctx context.Context) ViewModel {
 			return &LogRecordVM{
-				Root:   c,
-				Client: c.Api.WithCtx(ctx),
-				LogID:  s.LogID,
+				Root:     c,
+				Client:   api.WithCtx(ctx),
+				ServerID: s.ServerID,
+				LogID:    s.LogID,
 			}
 		})
 		return
@@ -1,11 +1,14 @@
 package logviewer
 
 import (
+	"github.com/yuuki0xff/goapptrace/config"
 	"github.com/yuuki0xff/goapptrace/tracer/types"
 )
 
 // UIState is status of Coordinator.
 type UIState struct {
+	// ログを保持しているAPIサーバのID
+	ServerID     config.ServerID
 	LogID        string
 	RecordID     types.FuncLogID
 	Record       types.FuncLog
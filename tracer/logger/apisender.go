@@ -56,11 +56,21 @@ func (s *LogServerSender) Open() error {
 					panic("FuncName MUST NOT empty")
 				}
 			},
+			DumpFlightRecorder: func(pkt *protocol.DumpFlightRecorderCmdPacket) {
+				fpath, err := DumpFlightRecorder(pkt.Reason)
+				if err != nil {
+					log.Println("ERROR: failed to dump the flight recorder:", err.Error())
+					return
+				}
+				log.Println("INFO: the flight recorder was dumped to", fpath)
+			},
 		},
-		PID:     uint64(os.Getpid()),
-		AppName: appname,
-		Host:    hostname,
-		Secret:  "secret", // TODO
+		PID:         uint64(os.Getpid()),
+		AppName:     appname,
+		Host:        hostname,
+		Labels:      os.Getenv(info.DefaultLabelsEnv),
+		Description: os.Getenv(info.DefaultDescEnv),
+		Secret:      "secret", // TODO
 	}
 	s.client.Init()
 	go func() {
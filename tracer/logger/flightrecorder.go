@@ -0,0 +1,143 @@
+package logger
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"time"
+
+	"github.com/yuuki0xff/goapptrace/info"
+	"github.com/yuuki0xff/goapptrace/tracer/types"
+)
+
+const (
+	// フライトレコーダーが保持するログの数。
+	defaultFlightRecorderSize = 1000
+	// 全goroutineのスタックトレースを取得するときの、バッファサイズの上限。
+	maxStackDumpSize = 64 << 20
+)
+
+// 最近送信したログ。
+// lockを取得してからアクセスすること。
+var recorder = newFlightRecorder(defaultFlightRecorderSize)
+
+// flightRecorder は、最近送信したログを一定数だけ保持するリングバッファである。
+// スレッドセーフではない。
+type flightRecorder struct {
+	logs []types.RawFuncLog
+	// 次に書き込む位置
+	next int
+	// 全ての要素が書き込まれていればtrue。
+	full bool
+}
+
+func newFlightRecorder(size int) *flightRecorder {
+	r := &flightRecorder{
+		logs: make([]types.RawFuncLog, size),
+	}
+	for i := range r.logs {
+		r.logs[i].Frames = make([]uintptr, 0, types.MaxStackSize)
+	}
+	return r
+}
+
+// Add は、ログを追加する。
+// バッファが一杯なら、最も古いログを上書きする。
+// raw は再利用される可能性があるため、Framesを含めてコピーする。
+func (r *flightRecorder) Add(raw *types.RawFuncLog) {
+	dst := &r.logs[r.next]
+	frames := append(dst.Frames[:0], raw.Frames...)
+	*dst = *raw
+	dst.Frames = frames
+
+	r.next++
+	if r.next == len(r.logs) {
+		r.next = 0
+		r.full = true
+	}
+}
+
+// Logs は、保持しているログのコピーを古い順に返す。
+func (r *flightRecorder) Logs() []types.RawFuncLog {
+	var logs []types.RawFuncLog
+	if r.full {
+		logs = append(logs, r.logs[r.next:]...)
+	}
+	logs = append(logs, r.logs[:r.next]...)
+	for i := range logs {
+		logs[i].Frames = append([]uintptr(nil), logs[i].Frames...)
+	}
+	return logs
+}
+
+// DumpFlightRecorder は、最近送信したログと全goroutineのスタックトレースをファイルに書き出す。
+// ファイルは、環境変数 info.DefaultDumpDirEnv で指定したディレクトリに作成される。
+// 指定されていなければ、一時ディレクトリに作成する。
+// 作成したファイルのパスを返す。
+func DumpFlightRecorder(reason string) (string, error) {
+	lock.Lock()
+	logs := recorder.Logs()
+	lock.Unlock()
+
+	dir := os.Getenv(info.DefaultDumpDirEnv)
+	if dir == "" {
+		dir = os.TempDir()
+	}
+	now := time.Now()
+	fpath := filepath.Join(dir, fmt.Sprintf("goapptrace-flight-recorder.%d.%d.txt", os.Getpid(), now.UnixNano()))
+	f, err := os.Create(fpath)
+	if err != nil {
+		return "", err
+	}
+	if err := writeFlightRecorder(f, reason, now, logs); err != nil {
+		f.Close() // nolint: errcheck
+		return "", err
+	}
+	return fpath, f.Close()
+}
+
+// writeFlightRecorder は、ログとスタックトレースを人が読める形式で書き出す。
+func writeFlightRecorder(w io.Writer, reason string, now time.Time, logs []types.RawFuncLog) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "reason: %s\n", reason)
+	fmt.Fprintf(bw, "time: %s\n", now.Format(time.RFC3339Nano))
+	fmt.Fprintf(bw, "pid: %d\n", os.Getpid())
+
+	fmt.Fprintf(bw, "\n# recent %d logs (oldest first)\n", len(logs))
+	for _, raw := range logs {
+		tag := "start"
+		if raw.Tag == types.FuncEnd {
+			tag = "end"
+		}
+		name := "?"
+		line := "?"
+		if len(raw.Frames) > 0 {
+			if fn := runtime.FuncForPC(raw.Frames[0]); fn != nil {
+				name = fn.Name()
+				file, l := fn.FileLine(raw.Frames[0])
+				line = fmt.Sprintf("%s:%d", file, l)
+			}
+		}
+		fmt.Fprintf(bw, "%s %-5s gid=%d txid=%d %s %s\n",
+			raw.Timestamp.UnixTime().Format(time.RFC3339Nano), tag, raw.GID, raw.TxID, name, line)
+	}
+
+	fmt.Fprintf(bw, "\n# goroutines\n")
+	bw.Write(stackDump()) // nolint: errcheck
+	return bw.Flush()
+}
+
+// stackDump は、全goroutineのスタックトレースを返す。
+func stackDump() []byte {
+	buf := make([]byte, 1<<16)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) || len(buf) >= maxStackDumpSize {
+			return buf[:n]
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+}
@@ -0,0 +1,46 @@
+package logger
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yuuki0xff/goapptrace/tracer/types"
+)
+
+func TestFlightRecorder(t *testing.T) {
+	a := assert.New(t)
+	r := newFlightRecorder(3)
+	a.Len(r.Logs(), 0)
+
+	raw := dummyRawFuncLog()
+	for i := 0; i < 4; i++ {
+		raw.ID = types.RawFuncLogID(i)
+		raw.Frames[0] = uintptr(i)
+		r.Add(raw)
+	}
+	// 追加したログは、呼び出し元がバッファを再利用しても破壊されない。
+	raw.Frames[0] = 100
+
+	logs := r.Logs()
+	if a.Len(logs, 3) {
+		for i, l := range logs {
+			a.Equal(types.RawFuncLogID(i+1), l.ID)
+			a.Equal([]uintptr{uintptr(i + 1), 1}, l.Frames)
+		}
+	}
+}
+
+func TestWriteFlightRecorder(t *testing.T) {
+	a := assert.New(t)
+	var buf bytes.Buffer
+	a.NoError(writeFlightRecorder(&buf, "slow-call", time.Now(), []types.RawFuncLog{*dummyRawFuncLog()}))
+
+	out := buf.String()
+	a.Contains(out, "reason: slow-call\n")
+	a.Contains(out, "# recent 1 logs (oldest first)\n")
+	a.Contains(out, "gid=10")
+	a.True(strings.Contains(out, "# goroutines\ngoroutine "), out)
+}
@@ -155,6 +155,7 @@ func sendLog(tag types.TagName, id types.TxID) {
 
 	lock.Lock()
 	defer lock.Unlock()
+	recorder.Add(logmsg)
 	if sender == nil {
 		// init()関数により初期化が完了する前に、sendLog()が実行された。
 		// この状態ではlogmsgを送信することが出来ないため、バッファに蓄積しておく。
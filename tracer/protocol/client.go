@@ -35,6 +35,8 @@ type ClientHandler struct {
 	Shutdown   func(*ShutdownPacket)
 	StartTrace func(*StartTraceCmdPacket)
 	StopTrace  func(*StopTraceCmdPacket)
+	// ウォッチドッグのルールに一致したときに、サーバから要求される。
+	DumpFlightRecorder func(*DumpFlightRecorderCmdPacket)
 }
 
 // ログサーバとの通信を行うクライアントの実装。
@@ -48,6 +50,8 @@ type Client struct {
 	PID          uint64
 	AppName      string
 	Host         string
+	Labels       string
+	Description  string
 	Secret       string
 	PingInterval time.Duration
 	MaxRetries   int
@@ -217,6 +221,8 @@ func (c *Client) OnEvent(et xtcp.EventType, conn *xtcp.Conn, p xtcp.Packet) {
 			Host:            c.Host,
 			ClientSecret:    c.Secret,
 			ProtocolVersion: ProtocolVersion,
+			Labels:          c.Labels,
+			Description:     c.Description,
 		}
 		if err := c.xtcpconn.Send(pkt); err != nil {
 			c.error(err)
@@ -269,6 +275,10 @@ func (c *Client) OnEvent(et xtcp.EventType, conn *xtcp.Conn, p xtcp.Packet) {
 				if c.Handler.StopTrace != nil {
 					c.Handler.StopTrace(pkt)
 				}
+			case *DumpFlightRecorderCmdPacket:
+				if c.Handler.DumpFlightRecorder != nil {
+					c.Handler.DumpFlightRecorder(pkt)
+				}
 			case *SymbolPacket:
 				conn.Stop(xtcp.StopImmediately)
 			case *RawFuncLogPacket:
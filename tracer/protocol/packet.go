@@ -24,6 +24,7 @@ const (
 	StopTraceCmdPacketType
 	SymbolPacketType
 	RawFuncLogPacketType
+	DumpFlightRecorderCmdPacketType
 )
 
 // detectPacketType returns PacketType of packet.
@@ -51,6 +52,8 @@ func detectPacketType(packet xtcp.Packet) PacketType {
 		return SymbolPacketType
 	case *RawFuncLogPacket:
 		return RawFuncLogPacketType
+	case *DumpFlightRecorderCmdPacket:
+		return DumpFlightRecorderCmdPacketType
 	default:
 		log.Panicf("unknown packet type: type=%T value=%+v", packet, packet)
 		panic(nil)
@@ -80,6 +83,8 @@ func createPacket(packetType PacketType) xtcp.Packet {
 		return &SymbolPacket{}
 	case RawFuncLogPacketType:
 		return &RawFuncLogPacket{}
+	case DumpFlightRecorderCmdPacketType:
+		return &DumpFlightRecorderCmdPacket{}
 	default:
 		log.Panicf("unknown packet type: PacketType=%+v", packetType)
 		panic(nil)
@@ -184,6 +189,10 @@ type ClientHelloPacket struct {
 	Host            string
 	ClientSecret    string
 	ProtocolVersion string
+	// ユーザ定義のラベル ("key1=value1,key2=value2"形式)
+	Labels string
+	// ユーザ定義の説明文
+	Description string
 }
 
 type ServerHelloPacket struct {
@@ -199,6 +208,8 @@ func (p *ClientHelloPacket) Marshal(buf []byte) int64 {
 	total += encoding.MarshalString(buf[total:], p.Host)
 	total += encoding.MarshalString(buf[total:], p.ClientSecret)
 	total += encoding.MarshalString(buf[total:], p.ProtocolVersion)
+	total += encoding.MarshalString(buf[total:], p.Labels)
+	total += encoding.MarshalString(buf[total:], p.Description)
 	return total
 }
 func (p *ClientHelloPacket) Unmarshal(buf []byte) int64 {
@@ -215,6 +226,10 @@ func (p *ClientHelloPacket) Unmarshal(buf []byte) int64 {
 	total += n
 	p.ProtocolVersion, n = encoding.UnmarshalString(buf[total:])
 	total += n
+	p.Labels, n = encoding.UnmarshalString(buf[total:])
+	total += n
+	p.Description, n = encoding.UnmarshalString(buf[total:])
+	total += n
 	return total
 }
 func (p *ServerHelloPacket) Marshal(buf []byte) int64 {
@@ -259,6 +274,12 @@ type StopTraceCmdPacket struct {
 	FuncName string
 }
 
+// DumpFlightRecorderCmdPacket は、トレース対象のプロセスに、フライトレコーダーの内容をファイルへ書き出させる。
+// Reason には、書き出す理由 (一致したウォッチドッグのルール名など) を指定する。
+type DumpFlightRecorderCmdPacket struct {
+	Reason string
+}
+
 type SymbolPacket struct {
 	types.SymbolsData
 }
@@ -271,8 +292,11 @@ func (p PingPacket) String() string          { return "<PingPacket>" }
 func (p ShutdownPacket) String() string      { return "<ShutdownPacket>" }
 func (p StartTraceCmdPacket) String() string { return "<StartTraceCmdPacket>" }
 func (p StopTraceCmdPacket) String() string  { return "<StopTraceCmdPacket>" }
-func (p SymbolPacket) String() string        { return "<SymbolPacket>" }
-func (p RawFuncLogPacket) String() string    { return "<RawFuncLogPacket>" }
+func (p DumpFlightRecorderCmdPacket) String() string {
+	return "<DumpFlightRecorderCmdPacket>"
+}
+func (p SymbolPacket) String() string     { return "<SymbolPacket>" }
+func (p RawFuncLogPacket) String() string { return "<RawFuncLogPacket>" }
 
 func (p *LogPacket) Marshal(buf []byte) int64 {
 	panic("not implemented")
@@ -293,6 +317,9 @@ func (p *StartTraceCmdPacket) Unmarshal(buf []byte) int64 { return slowUnmarshal
 func (p *StopTraceCmdPacket) Marshal(buf []byte) int64   { return slowMarshal(buf, p) }
 func (p *StopTraceCmdPacket) Unmarshal(buf []byte) int64 { return slowUnmarshal(buf, p) }
 
+func (p *DumpFlightRecorderCmdPacket) Marshal(buf []byte) int64   { return slowMarshal(buf, p) }
+func (p *DumpFlightRecorderCmdPacket) Unmarshal(buf []byte) int64 { return slowUnmarshal(buf, p) }
+
 func (p *SymbolPacket) Marshal(buf []byte) int64 {
 	return encoding.MarshalSymbolsData(&p.SymbolsData, buf)
 }
@@ -61,6 +61,7 @@ func BenchmarkDetectPacketType(b *testing.B) {
 	p6 := &StopTraceCmdPacket{}
 	p7 := &SymbolPacket{}
 	p8 := &RawFuncLogPacket{}
+	p9 := &DumpFlightRecorderCmdPacket{}
 
 	b.ResetTimer()
 	for i := b.N; i > 0; i-- {
@@ -72,6 +73,7 @@ func BenchmarkDetectPacketType(b *testing.B) {
 		detectPacketType(p6)
 		detectPacketType(p7)
 		detectPacketType(p8)
+		detectPacketType(p9)
 	}
 	b.StopTimer()
 }
@@ -87,6 +89,7 @@ func BenchmarkCreatePacket(b *testing.B) {
 		createPacket(StopTraceCmdPacketType)
 		createPacket(SymbolPacketType)
 		createPacket(RawFuncLogPacketType)
+		createPacket(DumpFlightRecorderCmdPacketType)
 	}
 	b.StopTimer()
 }
@@ -142,6 +145,24 @@ func TestPacketType_Unmarshal(t *testing.T) {
 	pt.Unmarshal(buf)
 	a.Equal(PacketType(5), pt)
 }
+func TestClientHelloPacket_Marshal(t *testing.T) {
+	buf := make([]byte, DefaultMaxSmallPacketSize)
+	a := assert.New(t)
+	p := &ClientHelloPacket{
+		PID:             10,
+		AppName:         "app",
+		Host:            "localhost",
+		ClientSecret:    "secret",
+		ProtocolVersion: ProtocolVersion,
+		Labels:          "env=test,run=1",
+		Description:     "load test",
+	}
+	n := p.Marshal(buf)
+
+	var p2 ClientHelloPacket
+	a.Equal(n, p2.Unmarshal(buf[:n]))
+	a.Equal(*p, p2)
+}
 func TestMergePacket_Merge(t *testing.T) {
 	var buf bytes.Buffer
 	a := assert.New(t)
@@ -10,7 +10,7 @@ import (
 )
 
 const (
-	ProtocolVersion = "1"
+	ProtocolVersion = "3"
 
 	// パケットをエンコードすることにより増加するバイト数。
 	// 内約は、パケットサイズ(4byte)+HeaderPacket(1byte)
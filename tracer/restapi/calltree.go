@@ -0,0 +1,197 @@
+package restapi
+
+import (
+	"sort"
+
+	"github.com/pkg/errors"
+	"github.com/yuuki0xff/goapptrace/tracer/storage"
+	"github.com/yuuki0xff/goapptrace/tracer/types"
+)
+
+const (
+	// defaultCallTreeDepth は、depth パラメータを省略したときに展開する呼び出しツリーの深さである。
+	defaultCallTreeDepth = 1
+	// callTreeMaxNodes は、1回のリクエストで展開する呼び出しツリーのノード数の上限である。
+	callTreeMaxNodes = 10000
+)
+
+var errFuncLogNotFound = errors.New("func-call not found")
+
+// callTree は、関数呼び出しの親子関係を辿って呼び出しツリーを読み出す。
+// スレッドセーフではない。
+type callTree struct {
+	// 指定したIDのFuncLogを読み出す。
+	// 存在しないか記録されていない場合は、errFuncLogNotFound を返す。
+	read func(id types.FuncLogID) (types.FuncLog, error)
+	// parent から直接呼び出された可能性のあるFuncLogのIDを、昇順に返す。
+	// 呼び出し元が parent ではないFuncLogのIDが含まれていてもよい。
+	candidates func(parent *types.FuncLog) []types.FuncLogID
+	symbols    *types.Symbols
+
+	// 展開したノード数
+	nodes int
+}
+
+// newCallTree は、スナップショットに含まれるFuncLogから呼び出しツリーを読み出す callTree を返す。
+// 書き込み中のログでは、 live に含まれるシミュレータ上の最新の状態をスナップショットに重ね合わせる。
+// 呼び出し先は、呼び出し元のインデックスから探す。
+// インデックスが無効なログでは、呼び出し元と同じgoroutineで実行されたFuncLogを走査する。
+func newCallTree(logobj *storage.Log, snapshot *storage.LogSnapshot, live liveFuncLogs) *callTree {
+	records := snapshot.FuncLogRecords()
+	return &callTree{
+		read: func(id types.FuncLogID) (fl types.FuncLog, err error) {
+			if id < 0 {
+				return fl, errFuncLogNotFound
+			}
+			if records <= int64(id) {
+				// スナップショットの作成後に追加されたレコードは、シミュレータから読み出す。
+				i := sort.Search(len(live.added), func(i int) bool { return live.added[i].ID >= id })
+				if i == len(live.added) || live.added[i].ID != id {
+					return fl, errFuncLogNotFound
+				}
+				fl = *live.added[i]
+				fl.Frames = append([]uintptr(nil), fl.Frames...)
+				return
+			}
+			buf := types.FuncLogPool.Get().(*types.FuncLog)
+			defer types.FuncLogPool.Put(buf)
+			if err = snapshot.FuncLog(id, buf); err != nil {
+				return
+			}
+			live.overlay(buf)
+			fl = *buf
+			fl.Frames = append([]uintptr(nil), buf.Frames...)
+			if fl.StartTime == 0 {
+				// 記録されていないレコード
+				return fl, errFuncLogNotFound
+			}
+			return
+		},
+		candidates: func(parent *types.FuncLog) []types.FuncLogID {
+			ids, ok := logobj.ChildFuncLogIDs(parent.ID)
+			if !ok {
+				ids, ok = logobj.FuncLogIDsByGID(parent.GID)
+			}
+			if ok {
+				// インデックスには、スナップショットの作成後に追加されたレコードが含まれる場合がある。
+				// それらのレコードは、シミュレータのレコードとして追加する。
+				n := sort.Search(len(ids), func(i int) bool { return records <= int64(ids[i]) })
+				ids = ids[:n]
+			} else if int64(parent.ID) < records {
+				// 呼び出し先は、呼び出し元よりも大きなIDを持つ。
+				ids = make([]types.FuncLogID, 0, records-int64(parent.ID))
+				for id := parent.ID + 1; int64(id) < records; id++ {
+					ids = append(ids, id)
+				}
+			}
+			// シミュレータのみが保持しているレコードは、インデックスに追加されていない。
+			for _, fl := range live.added {
+				if fl.ParentID == parent.ID {
+					ids = append(ids, fl.ID)
+				}
+			}
+			return ids
+		},
+		symbols: logobj.Symbols(),
+	}
+}
+
+// children は、 parent から直接呼び出されたFuncLogを、IDの昇順に返す。
+func (t *callTree) children(parent *types.FuncLog) ([]types.FuncLog, error) {
+	var children []types.FuncLog
+	for _, id := range t.candidates(parent) {
+		if id <= parent.ID {
+			continue
+		}
+		fl, err := t.read(id)
+		if err == errFuncLogNotFound {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		if fl.ParentID != parent.ID {
+			continue
+		}
+		children = append(children, fl)
+	}
+	return children, nil
+}
+
+// ancestors は、 fl の呼び出し元を、呼び出しツリーの根から順に返す。
+// fl 自身は含まない。
+func (t *callTree) ancestors(fl *types.FuncLog) ([]types.FuncLog, error) {
+	var ancestors []types.FuncLog
+	id := fl.ID
+	parentID := fl.ParentID
+	for parentID != types.NotFoundParent {
+		if id <= parentID {
+			// 呼び出し元は、呼び出し先よりも小さなIDを持つ。
+			return nil, errors.Errorf("invalid parent-id: id=%d parent-id=%d", id, parentID)
+		}
+		parent, err := t.read(parentID)
+		if err != nil {
+			return nil, err
+		}
+		ancestors = append(ancestors, parent)
+		id = parent.ID
+		parentID = parent.ParentID
+	}
+	for i, j := 0, len(ancestors)-1; i < j; i, j = i+1, j-1 {
+		ancestors[i], ancestors[j] = ancestors[j], ancestors[i]
+	}
+	return ancestors, nil
+}
+
+// node は、 fl の子ノードを展開していない CallTreeNode を返す。
+func (t *callTree) node(fl *types.FuncLog) (CallTreeNode, error) {
+	children, err := t.children(fl)
+	if err != nil {
+		return CallTreeNode{}, err
+	}
+	return t.newNode(fl, children), nil
+}
+
+// subtree は、 fl を根とする呼び出しツリーを depth の深さまで展開して返す。
+// 展開したノード数が callTreeMaxNodes に達した場合、それ以降のノードは展開しない。
+func (t *callTree) subtree(fl *types.FuncLog, depth int) (CallTreeNode, error) {
+	children, err := t.children(fl)
+	if err != nil {
+		return CallTreeNode{}, err
+	}
+	node := t.newNode(fl, children)
+	if depth <= 0 || callTreeMaxNodes < t.nodes+len(children) {
+		return node, nil
+	}
+	t.nodes += len(children)
+	node.Children = make([]CallTreeNode, 0, len(children))
+	for i := range children {
+		child, err := t.subtree(&children[i], depth-1)
+		if err != nil {
+			return CallTreeNode{}, err
+		}
+		node.Children = append(node.Children, child)
+	}
+	return node, nil
+}
+
+// newNode は、 fl と、 fl から直接呼び出されたFuncLogから CallTreeNode を作成する。
+func (t *callTree) newNode(fl *types.FuncLog, children []types.FuncLog) CallTreeNode {
+	node := CallTreeNode{
+		FuncLog:    *fl,
+		ChildCount: len(children),
+	}
+	if len(fl.Frames) > 0 {
+		if f, ok := t.symbols.GoFunc(fl.Frames[0]); ok {
+			node.Func = f.Name
+		}
+		node.Line = t.symbols.FileLine(fl.Frames[0])
+	}
+	for i := range children {
+		if children[i].IsEnded() {
+			node.ChildTime += children[i].EndTime - children[i].StartTime
+		} else {
+			node.RunningChildCount++
+		}
+	}
+	return node
+}
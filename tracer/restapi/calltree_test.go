@@ -0,0 +1,158 @@
+package restapi
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yuuki0xff/goapptrace/tracer/storage"
+	"github.com/yuuki0xff/goapptrace/tracer/types"
+)
+
+// newTestCallTree は、 fls を読み出す callTree を返す。
+// fls[i].ID は i でなければならない。
+func newTestCallTree(fls []types.FuncLog) *callTree {
+	symbols := &types.Symbols{}
+	symbols.Init()
+	return &callTree{
+		read: func(id types.FuncLogID) (types.FuncLog, error) {
+			if id < 0 || len(fls) <= int(id) || fls[id].StartTime == 0 {
+				return types.FuncLog{}, errFuncLogNotFound
+			}
+			return fls[id], nil
+		},
+		candidates: func(parent *types.FuncLog) []types.FuncLogID {
+			// インデックスが無効な場合と同様に、全てのレコードを候補にする。
+			ids := make([]types.FuncLogID, len(fls))
+			for i := range ids {
+				ids[i] = types.FuncLogID(i)
+			}
+			return ids
+		},
+		symbols: symbols,
+	}
+}
+
+func TestCallTree(t *testing.T) {
+	a := assert.New(t)
+	// 0 -+- 1 -+- 2
+	//    |     +- 4 (running)
+	//    +- 5
+	// 3 (other goroutine)
+	// 6 (not recorded)
+	fls := []types.FuncLog{
+		{ID: 0, StartTime: 1, EndTime: 100, ParentID: types.NotFoundParent, GID: 1},
+		{ID: 1, StartTime: 2, EndTime: 50, ParentID: 0, GID: 1},
+		{ID: 2, StartTime: 3, EndTime: 10, ParentID: 1, GID: 1},
+		{ID: 3, StartTime: 4, EndTime: 5, ParentID: types.NotFoundParent, GID: 2},
+		{ID: 4, StartTime: 11, EndTime: types.NotEnded, ParentID: 1, GID: 1},
+		{ID: 5, StartTime: 60, EndTime: 90, ParentID: 0, GID: 1},
+		{},
+	}
+	ct := newTestCallTree(fls)
+
+	children, err := ct.children(&fls[1])
+	a.NoError(err)
+	a.Equal([]types.FuncLog{fls[2], fls[4]}, children)
+	children, err = ct.children(&fls[3])
+	a.NoError(err)
+	a.Empty(children)
+
+	ancestors, err := ct.ancestors(&fls[4])
+	a.NoError(err)
+	a.Equal([]types.FuncLog{fls[0], fls[1]}, ancestors)
+	ancestors, err = ct.ancestors(&fls[0])
+	a.NoError(err)
+	a.Empty(ancestors)
+
+	node, err := ct.node(&fls[1])
+	a.NoError(err)
+	a.Equal(2, node.ChildCount)
+	a.Equal(1, node.RunningChildCount)
+	a.Equal(types.Time(7), node.ChildTime)
+	a.Nil(node.Children)
+
+	// 深さ1まで展開する。
+	node, err = ct.subtree(&fls[0], 1)
+	a.NoError(err)
+	a.Equal(types.Time(48+30), node.ChildTime)
+	a.Len(node.Children, 2)
+	a.Equal(types.FuncLogID(1), node.Children[0].ID)
+	a.Equal(2, node.Children[0].ChildCount)
+	a.Nil(node.Children[0].Children)
+	a.Equal(types.FuncLogID(5), node.Children[1].ID)
+	a.Equal(0, node.Children[1].ChildCount)
+
+	// 全て展開する。
+	node, err = ct.subtree(&fls[0], 10)
+	a.NoError(err)
+	a.Len(node.Children[0].Children, 2)
+	a.Equal(types.FuncLogID(4), node.Children[0].Children[1].ID)
+	a.NotNil(node.Children[1].Children)
+
+	// 呼び出し元が壊れている。
+	broken := types.FuncLog{ID: 2, StartTime: 3, EndTime: 10, ParentID: 2}
+	_, err = ct.ancestors(&broken)
+	a.Error(err)
+}
+
+func TestNewCallTree_live(t *testing.T) {
+	a := assert.New(t)
+	tempdir, err := ioutil.TempDir("", ".goapptrace_restapi")
+	a.NoError(err)
+	defer func() {
+		a.NoError(os.RemoveAll(tempdir))
+	}()
+	st := storage.Storage{Root: storage.DirLayout{Root: tempdir}}
+	a.NoError(st.Init())
+	logobj, err := st.New()
+	a.NoError(err)
+	defer logobj.Close() // nolint: errcheck
+
+	// 0 -+- 1 (running in the snapshot)
+	//    +- 2 (only in the simulator) --- 3 (only in the simulator, running)
+	fls := []types.FuncLog{
+		{ID: 0, StartTime: 1, EndTime: types.NotEnded, ParentID: types.NotFoundParent, GID: 1, Frames: []uintptr{100}},
+		{ID: 1, StartTime: 2, EndTime: types.NotEnded, ParentID: 0, GID: 1, Frames: []uintptr{100}},
+	}
+	logobj.FuncLog(func(store *storage.FuncLogStore) {
+		for i := range fls {
+			a.NoError(store.SetNolock(&fls[i]))
+			a.NoError(logobj.AddPostings(&fls[i]))
+		}
+	})
+	a.NoError(logobj.Sync())
+	snapshot, err := logobj.Snapshot()
+	a.NoError(err)
+
+	ended := fls[1]
+	ended.EndTime = 10
+	live := newLiveFuncLogs([]*types.FuncLog{
+		&fls[0],
+		&ended,
+		{ID: 2, StartTime: 20, EndTime: 30, ParentID: 0, GID: 1, Frames: []uintptr{100}},
+		{ID: 3, StartTime: 21, EndTime: types.NotEnded, ParentID: 2, GID: 1, Frames: []uintptr{100}},
+	}, snapshot.FuncLogRecords())
+	ct := newCallTree(logobj, snapshot, live)
+
+	node, err := ct.subtree(&fls[0], 10)
+	a.NoError(err)
+	a.Equal(2, node.ChildCount)
+	a.Equal(0, node.RunningChildCount)
+	a.Equal(types.Time(8+10), node.ChildTime)
+	a.Len(node.Children, 2)
+	a.Equal(types.FuncLogID(1), node.Children[0].ID)
+	a.Equal(types.Time(10), node.Children[0].EndTime)
+	a.Equal(types.FuncLogID(2), node.Children[1].ID)
+	a.Equal(1, node.Children[1].RunningChildCount)
+
+	fl, err := ct.read(3)
+	a.NoError(err)
+	ancestors, err := ct.ancestors(&fl)
+	a.NoError(err)
+	a.Len(ancestors, 2)
+	a.Equal(types.FuncLogID(2), ancestors[1].ID)
+	_, err = ct.read(4)
+	a.Equal(errFuncLogNotFound, err)
+}
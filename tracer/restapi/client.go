@@ -7,11 +7,14 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"net"
 	"net/http"
+	neturl "net/url"
 	"strconv"
 	"strings"
 	"sync"
 	"sync/atomic"
+	"time"
 	"unsafe"
 
 	"github.com/levigross/grequests"
@@ -22,12 +25,16 @@ import (
 
 const (
 	UserAgent = "goapptrace-restapi-client"
+
+	// streamRetryInterval is the delay before StreamFuncLogs reconnects to the server.
+	streamRetryInterval = time.Second
 )
 
 var (
 	msgUseCache = "<cache>"
 
 	ErrConflict         = errors.New("conflict")
+	ErrNotFound         = errors.New("not found")
 	ErrNotFoundGoModule = errors.New("not found GoModule")
 	ErrNotFoundGoFunc   = errors.New("not found GoFunc")
 	ErrNotFoundGoLine   = errors.New("not found GoLine")
@@ -125,9 +132,15 @@ func (c *ClientWithCtx) Symbols(logID string) (s *types.Symbols, err error) {
 
 // Logs returns a list of log status.
 func (c ClientWithCtx) Logs() ([]types.LogInfo, error) {
+	return c.SearchLogs(SearchLogsParams{})
+}
+
+// SearchLogs returns a list of log status that matches the specified conditions.
+func (c ClientWithCtx) SearchLogs(so SearchLogsParams) ([]types.LogInfo, error) {
 	var res Logs
 	url := c.url("/logs")
 	ro := c.ro()
+	ro.Params = so.ToParamMap()
 	err := c.getJSON(url, &ro, &res)
 	if err != nil {
 		return nil, err
@@ -196,7 +209,31 @@ func (c *ClientWithCtx) SearchRaw(id string, query string) (io.ReadCloser, error
 	url := c.url("/log", id, "search.csv")
 	ro := c.ro()
 	ro.Params["sql"] = query
-	return c.get(url, &ro)
+	return c.getQuery(url, &ro)
+}
+
+// SearchWithParams executes a SQL query and returns result by the format specified in p.
+// CsvFormat uses the search.csv API, and other formats use the search.json API.
+func (c *ClientWithCtx) SearchWithParams(id string, query string, p SearchParams) (io.ReadCloser, error) {
+	url := c.url("/log", id, "search.json")
+	if p.Format == CsvFormat {
+		url = c.url("/log", id, "search.csv")
+	}
+	ro := c.ro()
+	ro.Params = p.ToParamMap()
+	ro.Params["sql"] = query
+	return c.getQuery(url, &ro)
+}
+
+// SearchFollow executes a continuous query, and returns matching rows as a stream.
+// After the rows that match at the start of the query, it returns newly matching rows until the context is canceled.
+// p.Format is CsvFormat or JsonFormat (JSON lines).
+func (c *ClientWithCtx) SearchFollow(id, query string, p SearchParams) (io.ReadCloser, error) {
+	url := c.url("/log", id, "search", "follow")
+	ro := c.ro()
+	ro.Params = p.ToParamMap()
+	ro.Params["sql"] = query
+	return c.getQuery(url, &ro)
 }
 
 // Search executes a SQL statement.
@@ -232,6 +269,7 @@ func (c *ClientWithCtx) Search(id string, query string) (chan<- []string, *errgr
 }
 
 // SearchFuncLogs filters the function call log records.
+// so.After and so.Before take a cursor returned by SearchFuncLogsPage.
 func (c ClientWithCtx) SearchFuncLogs(id string, so SearchFuncLogParams) (<-chan types.FuncLog, *errgroup.Group) {
 	ch := make(chan types.FuncLog, 1024)
 	eg := &errgroup.Group{}
@@ -261,6 +299,201 @@ func (c ClientWithCtx) SearchFuncLogs(id string, so SearchFuncLogParams) (<-chan
 	})
 	return ch, eg
 }
+
+// SearchFuncLogsPage returns a page of the function call log records.
+// so.Limit is the number of records in a page.
+// To get the next or previous page, set page.Next to so.After or page.Prev to so.Before, and call it again.
+// Records with the same sort key are ordered by ID, so pages are stable even if new records are added.
+func (c ClientWithCtx) SearchFuncLogsPage(id string, so SearchFuncLogParams) (page FuncLogPage, err error) {
+	url := c.url("/log", id, "func-call", "search")
+	ro := c.ro()
+	ro.Params = so.ToParamMap()
+	r, err := c.get(url, &ro)
+	if err != nil {
+		return
+	}
+	defer r.Close() // nolint: errcheck
+
+	page.Next, page.Prev = pageCursors(r)
+	dec := json.NewDecoder(r)
+	for {
+		var fl types.FuncLog
+		if err = dec.Decode(&fl); err != nil {
+			if err == io.EOF {
+				err = nil
+			}
+			return
+		}
+		page.Records = append(page.Records, fl)
+	}
+}
+
+// StreamFuncLogs tails the function call log records of a running app.
+// It sends each record that matches so after the function returns, and keeps streaming until the app disconnects or the context is canceled.
+// If the connection is lost, it reconnects to the server and resumes from the last received event ID.
+// so.Limit, so.SortKey and so.SortOrder are not supported.
+func (c ClientWithCtx) StreamFuncLogs(id string, so SearchFuncLogParams) (<-chan types.FuncLog, *errgroup.Group) {
+	ch := make(chan types.FuncLog, 1024)
+	eg := &errgroup.Group{}
+
+	eg.Go(func() error {
+		defer close(ch)
+		url := c.url("/log", id, "func-call", "stream")
+		// lastID is the last event ID sent by the server.
+		var lastID string
+		// seen holds the IDs of records received after the last event ID.
+		// The server sends them again when resuming from lastID.
+		seen := map[types.FuncLogID]bool{}
+		for {
+			ro := c.ro()
+			ro.Params = so.ToParamMap()
+			if lastID != "" {
+				ro.Params["from-id"] = lastID
+			}
+			r, err := c.getQuery(url, &ro)
+			if err != nil {
+				return err
+			}
+			err = func() error {
+				defer r.Close() // nolint: errcheck
+				sr := newSSEReader(r)
+				for {
+					ev, err := sr.next()
+					if err != nil {
+						return err
+					}
+					if ev.HasID {
+						lastID = ev.ID
+						seen = map[types.FuncLogID]bool{}
+					}
+					if ev.Data == nil {
+						continue
+					}
+					var fl types.FuncLog
+					if err := json.Unmarshal(ev.Data, &fl); err != nil {
+						return errors.Wrap(err, "invalid event data")
+					}
+					if seen[fl.ID] {
+						continue
+					}
+					seen[fl.ID] = true
+					select {
+					case ch <- fl:
+					case <-c.ctx.Done():
+						return c.ctx.Err()
+					}
+				}
+			}()
+			if err == io.EOF {
+				return nil
+			}
+			if c.ctx.Err() != nil || !isConnectionLost(err) {
+				return err
+			}
+			select {
+			case <-time.After(streamRetryInterval):
+			case <-c.ctx.Done():
+				return c.ctx.Err()
+			}
+		}
+	})
+	return ch, eg
+}
+
+// FuncStats returns statistics for each function.
+func (c ClientWithCtx) FuncStats(id string) ([]types.FuncStats, error) {
+	var res FuncStatsList
+	url := c.url("/log", id, "stats", "funcs")
+	ro := c.ro()
+	err := c.getJSON(url, &ro, &res)
+	if err != nil {
+		return nil, err
+	}
+	return res.Funcs, nil
+}
+
+// Events returns events recorded by the watchdog, in the order of detection.
+func (c ClientWithCtx) Events(id string) ([]types.Event, error) {
+	var res EventList
+	url := c.url("/log", id, "events")
+	ro := c.ro()
+	err := c.getJSON(url, &ro, &res)
+	if err != nil {
+		return nil, err
+	}
+	return res.Events, nil
+}
+
+// Running returns the stack of running function calls for each goroutine.
+// If the log is not being written, RunningCalls.Active is false.
+func (c ClientWithCtx) Running(id string) (RunningCalls, error) {
+	var res RunningCalls
+	url := c.url("/log", id, "running")
+	ro := c.ro()
+	err := c.getJSON(url, &ro, &res)
+	return res, err
+}
+
+// GoroutineLeaks returns the report of goroutines which have not ended.
+func (c ClientWithCtx) GoroutineLeaks(id string, p LeakReportParams) (LeakReport, error) {
+	var res LeakReport
+	url := c.url("/log", id, "leaks")
+	ro := c.ro()
+	ro.Params = p.ToParamMap()
+	err := c.getJSON(url, &ro, &res)
+	return res, err
+}
+
+// FlameGraph returns a flame graph of function calls that match p.
+// The response is an SVG image or a folded stacks text, depending on p.Format.
+func (c ClientWithCtx) FlameGraph(id string, p FlameGraphParams) (io.ReadCloser, error) {
+	url := c.url("/log", id, "flamegraph")
+	ro := c.ro()
+	ro.Params = p.ToParamMap()
+	r, err := c.get(url, &ro)
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// FuncLogChildren returns function calls called directly by the specified function call, in ascending order of ID.
+// The children of the returned nodes are not expanded.
+func (c ClientWithCtx) FuncLogChildren(logID string, id types.FuncLogID) ([]CallTreeNode, error) {
+	var res CallTreeNodeList
+	url := c.url("/log", logID, "func-call", strconv.FormatInt(int64(id), 10), "children")
+	ro := c.ro()
+	err := c.getJSON(url, &ro, &res)
+	if err != nil {
+		return nil, err
+	}
+	return res.Nodes, nil
+}
+
+// FuncLogAncestors returns callers of the specified function call, ordered from the root of the call tree.
+// The children of the returned nodes are not expanded.
+func (c ClientWithCtx) FuncLogAncestors(logID string, id types.FuncLogID) ([]CallTreeNode, error) {
+	var res CallTreeNodeList
+	url := c.url("/log", logID, "func-call", strconv.FormatInt(int64(id), 10), "ancestors")
+	ro := c.ro()
+	err := c.getJSON(url, &ro, &res)
+	if err != nil {
+		return nil, err
+	}
+	return res.Nodes, nil
+}
+
+// FuncLogTree returns the call tree rooted at the specified function call.
+// The tree is expanded up to depth levels; depth 0 returns only the root node.
+func (c ClientWithCtx) FuncLogTree(logID string, id types.FuncLogID, depth int) (node CallTreeNode, err error) {
+	url := c.url("/log", logID, "func-call", strconv.FormatInt(int64(id), 10), "tree")
+	ro := c.ro()
+	ro.Params = map[string]string{
+		"depth": strconv.Itoa(depth),
+	}
+	err = c.getJSON(url, &ro, &node)
+	return
+}
 func (c ClientWithCtx) GoModule(logID string, pc uintptr) (m types.GoModule, err error) {
 	if c.UseCache {
 		// fast path
@@ -375,6 +608,79 @@ func (c ClientWithCtx) Goroutines(logID string) (gl chan types.Goroutine, err er
 	return ch, nil
 }
 
+// SearchGoroutinesPage returns a page of goroutines.
+// It works like SearchFuncLogsPage. The "id" sort key sorts goroutines by GID.
+func (c ClientWithCtx) SearchGoroutinesPage(logID string, p SearchGoroutinesParams) (page GoroutinePage, err error) {
+	url := c.url("/log", logID, "goroutines", "search")
+	ro := c.ro()
+	ro.Params = p.ToParamMap()
+	r, err := c.get(url, &ro)
+	if err != nil {
+		return
+	}
+	defer r.Close() // nolint: errcheck
+
+	page.Next, page.Prev = pageCursors(r)
+	dec := json.NewDecoder(r)
+	for {
+		var g types.Goroutine
+		if err = dec.Decode(&g); err != nil {
+			if err == io.EOF {
+				err = nil
+			}
+			return
+		}
+		page.Goroutines = append(page.Goroutines, g)
+	}
+}
+
+// Views returns views available for the app.
+// If appName is empty, it returns views of all apps.
+func (c ClientWithCtx) Views(appName string) ([]View, error) {
+	var res ViewList
+	url := c.url("/views")
+	ro := c.ro()
+	if appName != "" {
+		ro.Params["app-name"] = appName
+	}
+	err := c.getJSON(url, &ro, &res)
+	return res.Views, err
+}
+
+// SaveView creates or replaces the view.
+// The server validates the query before saving it.
+func (c ClientWithCtx) SaveView(v View) (saved View, err error) {
+	url := c.url("/view", neturl.PathEscape(v.App), neturl.PathEscape(v.Name))
+	ro := c.ro()
+	ro.JSON = v
+	err = c.putJSON(url, &ro, &saved)
+	return
+}
+
+// RemoveView removes the view.
+func (c ClientWithCtx) RemoveView(appName, name string) error {
+	url := c.url("/view", neturl.PathEscape(appName), neturl.PathEscape(name))
+	ro := c.ro()
+	return c.delete(url, &ro)
+}
+
+// Queries returns the queries running on the server.
+func (c ClientWithCtx) Queries() ([]RunningQuery, error) {
+	var res RunningQueries
+	url := c.url("/queries")
+	ro := c.ro()
+	err := c.getJSON(url, &ro, &res)
+	return res.Queries, err
+}
+
+// KillQuery aborts the running query.
+// The client that executed the query receives an error.
+func (c ClientWithCtx) KillQuery(id QueryID) error {
+	url := c.url("/query", strconv.FormatInt(int64(id), 10))
+	ro := c.ro()
+	return c.delete(url, &ro)
+}
+
 func (c Client) get(url string, ro *grequests.RequestOptions) (*grequests.Response, error) {
 	r, err := wrapResp(c.s.Get(url, ro))
 	if err != nil {
@@ -383,12 +689,26 @@ func (c Client) get(url string, ro *grequests.RequestOptions) (*grequests.Respon
 	switch r.StatusCode {
 	case http.StatusOK:
 		return r, nil
+	case http.StatusNotFound:
+		return nil, errors.Wrap(ErrNotFound, errUnexpStatus(r, []int{
+			http.StatusOK,
+		}).Error())
 	default:
 		return nil, errUnexpStatus(r, []int{
 			http.StatusOK,
 		})
 	}
 }
+
+// getQuery sends a GET request to the API that executes a query.
+// If the server aborts the query while sending the result, reading the returned body fails.
+func (c Client) getQuery(url string, ro *grequests.RequestOptions) (io.ReadCloser, error) {
+	r, err := c.get(url, ro)
+	if err != nil {
+		return nil, err
+	}
+	return queryResult{r}, nil
+}
 func (c Client) getJSON(url string, ro *grequests.RequestOptions, data interface{}) (err error) {
 	var r *grequests.Response
 	r, err = c.get(url, ro)
@@ -427,7 +747,7 @@ func (c Client) put(url string, ro *grequests.RequestOptions) (*grequests.Respon
 		r.Close() // nolint: errcheck
 		return nil, ErrConflict
 	default:
-		r.Close() // nolint: errcheck
+		defer r.Close() // nolint: errcheck
 		return nil, errUnexpStatus(r, []int{
 			http.StatusOK,
 		})
@@ -460,6 +780,36 @@ func (c Client) validateGoLine(pc uintptr, url string, l types.GoLine) {
 	}
 }
 
+// queryResult reads the result of a query.
+// The server reports the reason why it aborted the query by the QueryErrorTrailer, because it has already sent the status code.
+type queryResult struct {
+	*grequests.Response
+}
+
+func (r queryResult) Read(p []byte) (int, error) {
+	n, err := r.Response.Read(p)
+	if err == io.EOF {
+		if msg := r.RawResponse.Trailer.Get(QueryErrorTrailer); msg != "" {
+			return n, fmt.Errorf("query was aborted by the server: %s", msg)
+		}
+	}
+	return n, err
+}
+
+// pageCursors returns cursors for the next and previous pages from the response headers.
+func pageCursors(r *grequests.Response) (next, prev Cursor) {
+	return Cursor(r.Header.Get(NextCursorHeader)), Cursor(r.Header.Get(PrevCursorHeader))
+}
+
+// isConnectionLost reports whether err means that the connection was lost while reading a response.
+func isConnectionLost(err error) bool {
+	if errors.Cause(err) == io.ErrUnexpectedEOF {
+		return true
+	}
+	_, ok := errors.Cause(err).(net.Error)
+	return ok
+}
+
 func (c *apiCache) init() {
 	c.logs = map[string]*logCache{}
 }
@@ -0,0 +1,237 @@
+package restapi
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/yuuki0xff/goapptrace/tracer/sql"
+	"github.com/yuuki0xff/goapptrace/tracer/types"
+)
+
+func TestSearchCsv(t *testing.T) {
+	goroutines := []types.Goroutine{
+		{GID: 3, StartTime: 0, EndTime: 30},
+		{GID: 1, StartTime: 0, EndTime: 10},
+		{GID: 5, StartTime: 10, EndTime: types.NotEnded},
+		{GID: 2, StartTime: 0, EndTime: 20},
+		{GID: 4, StartTime: 20, EndTime: 60},
+	}
+	lt := &sql.LogTime{Start: 0, End: 60}
+	open := func(table string, sel *sql.SelectParser) (sql.Source, error) {
+		row := &sql.SqlGoroutineRow{LogTime: lt}
+		i := 0
+		return sql.Source{
+			Row: row,
+			Read: func() error {
+				if len(goroutines) <= i {
+					return io.EOF
+				}
+				row.Goroutine = goroutines[i]
+				i++
+				return nil
+			},
+			NewRow: func() sql.SqlRow {
+				return &sql.SqlGoroutineRow{LogTime: lt}
+			},
+			Save: func() interface{} {
+				g := row.Goroutine
+				return &g
+			},
+			Load: func(dst sql.SqlRow, v interface{}) {
+				dst.(*sql.SqlGoroutineRow).Goroutine = *v.(*types.Goroutine)
+			},
+		}, nil
+	}
+	doFormat := func(t *testing.T, p SearchParams, query string, status int, expected string) {
+		a := assert.New(t)
+		sel, err := sql.ParseSelect(query)
+		if !a.NoError(err) {
+			return
+		}
+		src, err := sel.Open(open)
+		if !a.NoError(err) {
+			return
+		}
+
+		w := httptest.NewRecorder()
+		searchRows(w, sel, src, p, nil)
+		a.Equal(status, w.Code)
+		if status == http.StatusOK {
+			a.Equal(expected, w.Body.String())
+		}
+	}
+	do := func(t *testing.T, query string, status int, expected string) {
+		doFormat(t, SearchParams{Format: CsvFormat}, query, status, expected)
+	}
+
+	t.Run("limit", func(t *testing.T) {
+		do(t, "SELECT gid FROM goroutines LIMIT 2", http.StatusOK, "gid\n3\n1\n")
+	})
+	t.Run("offset", func(t *testing.T) {
+		do(t, "SELECT gid FROM goroutines LIMIT 1, 2", http.StatusOK, "gid\n1\n5\n")
+	})
+	t.Run("order-by", func(t *testing.T) {
+		do(t, "SELECT gid FROM goroutines ORDER BY gid DESC", http.StatusOK, "gid\n5\n4\n3\n2\n1\n")
+	})
+	t.Run("top-n", func(t *testing.T) {
+		do(t, "SELECT gid FROM goroutines ORDER BY gid LIMIT 2", http.StatusOK, "gid\n1\n2\n")
+		do(t, "SELECT gid FROM goroutines ORDER BY gid DESC LIMIT 1, 2", http.StatusOK, "gid\n4\n3\n")
+		do(t, "SELECT gid FROM goroutines ORDER BY gid LIMIT 4, 10", http.StatusOK, "gid\n5\n")
+	})
+	t.Run("group-by", func(t *testing.T) {
+		do(t, "SELECT running, COUNT(*), MAX(exectime) FROM goroutines GROUP BY running", http.StatusOK,
+			"running,COUNT(*),MAX(exectime)\nfalse,4,40\ntrue,1,50\n")
+		do(t, "SELECT starttime, COUNT(*) FROM goroutines WHERE gid < 5 GROUP BY starttime HAVING COUNT(*) > 1", http.StatusOK,
+			"starttime,COUNT(*)\n"+types.Time(0).UnixTime().String()+",3\n")
+		do(t, "SELECT COUNT(*) FROM goroutines WHERE gid > 100", http.StatusOK, "COUNT(*)\n0\n")
+	})
+	t.Run("group-by-order-limit", func(t *testing.T) {
+		do(t, "SELECT starttime, SUM(exectime) FROM goroutines WHERE gid < 5 GROUP BY starttime ORDER BY SUM(exectime) DESC LIMIT 1", http.StatusOK,
+			"starttime,SUM(exectime)\n"+types.Time(0).UnixTime().String()+",60\n")
+	})
+	t.Run("join", func(t *testing.T) {
+		do(t, "SELECT a.gid, b.gid FROM goroutines a JOIN goroutines b ON a.starttime = b.starttime WHERE a.gid < b.gid ORDER BY a.gid, b.gid", http.StatusOK,
+			"a.gid,b.gid\n1,2\n1,3\n2,3\n")
+		do(t, "SELECT a.starttime, COUNT(*) AS n FROM goroutines a JOIN goroutines b ON a.starttime = b.starttime GROUP BY a.starttime ORDER BY n DESC LIMIT 1", http.StatusOK,
+			"a.starttime,n\n"+types.Time(0).UnixTime().String()+",9\n")
+	})
+	t.Run("subquery", func(t *testing.T) {
+		do(t, "SELECT gid FROM goroutines WHERE gid IN (SELECT gid FROM goroutines WHERE exectime >= 20) ORDER BY gid", http.StatusOK,
+			"gid\n2\n3\n4\n5\n")
+	})
+	t.Run("quote", func(t *testing.T) {
+		// 列名と値にカンマを含む場合は、引用符で囲む。
+		do(t, "SELECT gid, CONCAT(gid, ',', running) FROM goroutines WHERE gid = 1", http.StatusOK,
+			"gid,\"CONCAT(gid, ',', running)\"\n1,\"1,false\"\n")
+		do(t, `SELECT REPLACE('a"b', 'a', 'c') AS s FROM goroutines WHERE gid = 1`, http.StatusOK,
+			"s\n\"c\"\"b\"\n")
+	})
+	t.Run("json", func(t *testing.T) {
+		p := SearchParams{Format: JsonFormat, Datetime: NsDatetimeFormat}
+		doFormat(t, p, "SELECT gid, endtime, running FROM goroutines WHERE gid >= 4 ORDER BY gid", http.StatusOK,
+			`{"gid":4,"endtime":60,"running":false}`+"\n"+`{"gid":5,"endtime":-1,"running":true}`+"\n")
+		p.Datetime = RFC3339DatetimeFormat
+		doFormat(t, p, "SELECT gid, endtime, exectime FROM goroutines WHERE gid >= 4 ORDER BY gid", http.StatusOK,
+			`{"gid":4,"endtime":"`+types.Time(60).UnixTime().Format(time.RFC3339Nano)+`","exectime":40}`+"\n"+
+				`{"gid":5,"endtime":null,"exectime":50}`+"\n")
+	})
+	t.Run("json-array", func(t *testing.T) {
+		p := SearchParams{Format: JsonArrayFormat}
+		doFormat(t, p, "SELECT gid, COUNT(*) AS n FROM goroutines GROUP BY gid ORDER BY gid LIMIT 2", http.StatusOK,
+			"[\n"+`{"gid":1,"n":1}`+",\n"+`{"gid":2,"n":1}`+"\n]\n")
+		doFormat(t, p, "SELECT gid FROM goroutines WHERE gid > 100", http.StatusOK, "[\n]\n")
+	})
+	t.Run("error", func(t *testing.T) {
+		do(t, "SELECT SUM(running) FROM goroutines", http.StatusBadRequest, "")
+	})
+	t.Run("read-error", func(t *testing.T) {
+		// テーブルの読み出しに失敗したときは、クエリの誤りではないため500を返す。
+		a := assert.New(t)
+		sel, err := sql.ParseSelect("SELECT gid FROM goroutines ORDER BY gid")
+		if !a.NoError(err) {
+			return
+		}
+		var q *query
+		src, err := sel.Open(func(table string, sel *sql.SelectParser) (sql.Source, error) {
+			src, err := open(table, sel)
+			src.Read = func() error {
+				return errors.New("i/o error")
+			}
+			return q.wrapSource(src), err
+		})
+		if !a.NoError(err) {
+			return
+		}
+
+		w := httptest.NewRecorder()
+		searchRows(w, sel, src, SearchParams{Format: CsvFormat}, q)
+		a.Equal(http.StatusInternalServerError, w.Result().StatusCode)
+	})
+	t.Run("read-error-mid-stream", func(t *testing.T) {
+		// 結果の送信中に失敗したときは、ステータスコードを送信済みなのでトレーラーで理由を返す。
+		a := assert.New(t)
+		sel, err := sql.ParseSelect("SELECT gid FROM goroutines")
+		if !a.NoError(err) {
+			return
+		}
+		var q *query
+		src, err := sel.Open(func(table string, sel *sql.SelectParser) (sql.Source, error) {
+			src, err := open(table, sel)
+			read := src.Read
+			n := 0
+			src.Read = func() error {
+				if n++; n > 2 {
+					return errors.New("i/o error")
+				}
+				return read()
+			}
+			return q.wrapSource(src), err
+		})
+		if !a.NoError(err) {
+			return
+		}
+
+		w := httptest.NewRecorder()
+		searchRows(w, sel, src, SearchParams{Format: CsvFormat}, q)
+		res := w.Result()
+		a.Equal(http.StatusOK, res.StatusCode)
+		// ヘッダと、失敗するまでに読み出した2行を送信する。
+		a.Equal(3, strings.Count(w.Body.String(), "\n"))
+		a.Contains(res.Trailer.Get(QueryErrorTrailer), "i/o error")
+	})
+	t.Run("eval-error-mid-stream", func(t *testing.T) {
+		a := assert.New(t)
+		sel, err := sql.ParseSelect("SELECT gid/0 FROM goroutines")
+		if !a.NoError(err) {
+			return
+		}
+		src, err := sel.Open(open)
+		if !a.NoError(err) {
+			return
+		}
+
+		w := httptest.NewRecorder()
+		searchRows(w, sel, src, SearchParams{Format: CsvFormat}, nil)
+		res := w.Result()
+		a.Equal(http.StatusOK, res.StatusCode)
+		a.Contains(res.Trailer.Get(QueryErrorTrailer), "division by zero")
+	})
+	t.Run("limits", func(t *testing.T) {
+		doLimits := func(t *testing.T, limits QueryLimits, query string, status int, trailer string) {
+			a := assert.New(t)
+			q := newQueryManager().start(httptest.NewRequest(http.MethodGet, "/", nil), types.LogID{}, query, limits)
+			defer q.done()
+			sel, err := sql.ParseSelect(query)
+			if !a.NoError(err) {
+				return
+			}
+			src, err := sel.Open(func(table string, sel *sql.SelectParser) (sql.Source, error) {
+				src, err := open(table, sel)
+				return q.wrapSource(src), err
+			})
+			if !a.NoError(err) {
+				return
+			}
+
+			w := httptest.NewRecorder()
+			searchRows(w, sel, src, SearchParams{Format: CsvFormat}, q)
+			res := w.Result()
+			a.Equal(status, res.StatusCode, query)
+			a.Contains(res.Trailer.Get(QueryErrorTrailer), trailer, query)
+		}
+		// ソートと集約をするクエリは、ヘッダを書き込む前に中止する。
+		doLimits(t, QueryLimits{MaxScannedRows: 3}, "SELECT gid FROM goroutines ORDER BY gid", http.StatusServiceUnavailable, "")
+		doLimits(t, QueryLimits{MaxBufferedRows: 3}, "SELECT gid FROM goroutines ORDER BY gid", http.StatusServiceUnavailable, "")
+		doLimits(t, QueryLimits{MaxBufferedRows: 3}, "SELECT gid FROM goroutines ORDER BY gid LIMIT 3", http.StatusOK, "")
+		doLimits(t, QueryLimits{MaxBufferedRows: 2}, "SELECT gid, COUNT(*) FROM goroutines GROUP BY gid", http.StatusServiceUnavailable, "")
+		// 結果の送信中に中止したときは、トレーラーで理由を返す。
+		doLimits(t, QueryLimits{MaxScannedRows: 3}, "SELECT gid FROM goroutines", http.StatusOK, "too many rows")
+		doLimits(t, QueryLimits{MaxScannedRows: 5}, "SELECT gid FROM goroutines", http.StatusOK, "")
+	})
+}
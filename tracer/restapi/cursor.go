@@ -0,0 +1,259 @@
+package restapi
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/yuuki0xff/goapptrace/tracer/types"
+)
+
+const (
+	// NextCursorHeader は、次のページを読み出すためのカーソルを設定するレスポンスヘッダの名前である。
+	NextCursorHeader = "Goapptrace-Next-Cursor"
+	// PrevCursorHeader は、前のページを読み出すためのカーソルを設定するレスポンスヘッダの名前である。
+	PrevCursorHeader = "Goapptrace-Prev-Cursor"
+)
+
+// Cursor は、ソートされた検索結果の中の位置を指す不透明なトークンである。
+// ページの先頭または末尾のレコードについて、ソートキーとその値、およびIDを保持する。
+// ソートキーの値が同じレコードはIDの順に並ぶため、新しいレコードが追加されても既存のレコードの順序は変わらない。
+type Cursor string
+
+// pageKey は、レコードの並び順を決める値である。
+// value はソートキーの値、 id は関数呼び出しのIDまたはGIDである。
+type pageKey struct {
+	value int64
+	id    int64
+}
+
+// funcLogPageKey は、 key でソートするときの fl の pageKey を返す。
+func funcLogPageKey(key SortKey, fl *types.FuncLog) pageKey {
+	switch key {
+	case SortByStartTime:
+		return pageKey{value: int64(fl.StartTime), id: int64(fl.ID)}
+	case SortByEndTime:
+		return pageKey{value: int64(fl.EndTime), id: int64(fl.ID)}
+	default:
+		return pageKey{value: int64(fl.ID), id: int64(fl.ID)}
+	}
+}
+
+// goroutinePageKey は、 key でソートするときの g の pageKey を返す。
+// SortByID は、GIDの順にソートする。
+func goroutinePageKey(key SortKey, g *types.Goroutine) pageKey {
+	switch key {
+	case SortByStartTime:
+		return pageKey{value: int64(g.StartTime), id: int64(g.GID)}
+	case SortByEndTime:
+		return pageKey{value: int64(g.EndTime), id: int64(g.GID)}
+	default:
+		return pageKey{value: int64(g.GID), id: int64(g.GID)}
+	}
+}
+
+// cursorPos は、 Cursor をデコードした値である。
+type cursorPos struct {
+	SortKey   SortKey
+	SortOrder SortOrder
+	Key       pageKey
+}
+
+// encode は、 pos を指す Cursor を返す。
+func (pos cursorPos) encode() Cursor {
+	s := fmt.Sprintf("%s,%s,%d,%d", pos.SortKey, pos.SortOrder, pos.Key.value, pos.Key.id)
+	return Cursor(base64.RawURLEncoding.EncodeToString([]byte(s)))
+}
+
+// decode は、 c が指す位置を返す。
+func (c Cursor) decode() (pos cursorPos, err error) {
+	b, err := base64.RawURLEncoding.DecodeString(string(c))
+	if err != nil {
+		return pos, errors.Wrap(err, "invalid cursor")
+	}
+	fields := strings.Split(string(b), ",")
+	if len(fields) != 4 {
+		return pos, errors.New("invalid cursor")
+	}
+	if err = pos.SortKey.Parse(fields[0]); err != nil || pos.SortKey == NoSortKey {
+		return pos, errors.New("invalid cursor")
+	}
+	if err = pos.SortOrder.Parse(fields[1], NoSortOrder); err != nil || pos.SortOrder == NoSortOrder {
+		return pos, errors.New("invalid cursor")
+	}
+	if pos.Key.value, err = strconv.ParseInt(fields[2], 10, 64); err != nil {
+		return pos, errors.New("invalid cursor")
+	}
+	if pos.Key.id, err = strconv.ParseInt(fields[3], 10, 64); err != nil {
+		return pos, errors.New("invalid cursor")
+	}
+	return pos, nil
+}
+
+// pager は、ソートされた検索結果から1ページ分のレコードを取り出す。
+//
+// レコードは readLess() の順に読み出し、 inRange() がtrueを返すレコードのうち先頭から rows() 件を result() に渡す。
+// before を指定した場合は、カーソルに近い順に読み出すため、ページ内のレコードを逆順に並べ替えてから返す。
+type pager struct {
+	sortKey   SortKey
+	sortOrder SortOrder
+	// 1ページに含めるレコード数。0以下ならページングしない。
+	limit int64
+	// カーソルが指す位置。nilなら指定されていない。
+	after  *pageKey
+	before *pageKey
+}
+
+// newPager は、検索条件から pager を作成する。
+// カーソルを指定した場合は、ソートキーと並び順はカーソルに従う。
+// sortKey と sortOrder は、カーソルと一致するか空でなければならない。
+// ソートキーが指定されていなければ、IDの昇順に並べる。
+func newPager(sortKey SortKey, sortOrder SortOrder, limit int64, after, before Cursor) (*pager, error) {
+	p := &pager{
+		sortKey:   sortKey,
+		sortOrder: sortOrder,
+		limit:     limit,
+	}
+	if after != "" && before != "" {
+		return nil, errors.New("after and before parameters are mutually exclusive")
+	}
+	if before != "" && limit <= 0 {
+		return nil, errors.New("before parameter requires limit parameter")
+	}
+
+	var c Cursor
+	switch {
+	case after != "":
+		c = after
+	case before != "":
+		c = before
+	}
+	if c != "" {
+		pos, err := c.decode()
+		if err != nil {
+			return nil, err
+		}
+		if (p.sortKey != NoSortKey && p.sortKey != pos.SortKey) || (p.sortOrder != NoSortOrder && p.sortOrder != pos.SortOrder) {
+			return nil, errors.New("the cursor does not match the sort key or the sort order")
+		}
+		p.sortKey = pos.SortKey
+		p.sortOrder = pos.SortOrder
+		if after != "" {
+			p.after = &pos.Key
+		} else {
+			p.before = &pos.Key
+		}
+	}
+
+	if p.sortKey == NoSortKey {
+		p.sortKey = SortByID
+	}
+	if p.sortOrder == NoSortOrder {
+		p.sortOrder = AscendingSortOrder
+	}
+	return p, nil
+}
+
+// less は、ソート順で k1 が k2 よりも前であればtrueを返す。
+// ソートキーの値が同じ場合は、IDで比較する。
+func (p *pager) less(k1, k2 pageKey) bool {
+	if p.sortOrder == DescendingSortOrder {
+		k1, k2 = k2, k1
+	}
+	if k1.value != k2.value {
+		return k1.value < k2.value
+	}
+	return k1.id < k2.id
+}
+
+// readLess は、レコードを読み出す順序の比較関数である。
+// before を指定した場合は、ソート順とは逆順になる。
+func (p *pager) readLess(k1, k2 pageKey) bool {
+	if p.before != nil {
+		return p.less(k2, k1)
+	}
+	return p.less(k1, k2)
+}
+
+// paging は、検索結果を複数のページに分けて返す場合にtrueを返す。
+func (p *pager) paging() bool {
+	return p.limit > 0 || p.after != nil || p.before != nil
+}
+
+// inRange は、 k がカーソルよりも読み出し方向の先にあればtrueを返す。
+// カーソルが指すレコード自身は含まない。
+//
+// 終了時刻でソートしてページングする場合、実行中のレコードは常にfalseを返す。
+// 実行中のレコードの終了時刻は NotEnded であり、実行が終了したときにソート順の別の位置へ移動してしまう。
+// そのため、ページングの対象に含めると同じレコードが複数のページに現れてしまう。
+func (p *pager) inRange(k pageKey) bool {
+	if p.sortKey == SortByEndTime && k.value == int64(types.NotEnded) && p.paging() {
+		return false
+	}
+	switch {
+	case p.after != nil:
+		return p.less(*p.after, k)
+	case p.before != nil:
+		return p.less(k, *p.before)
+	default:
+		return true
+	}
+}
+
+// rows は、読み出すレコード数の上限を返す。0なら制限しない。
+// 次のページが存在するかを判定するため、 limit よりも1件多く読み出す。
+func (p *pager) rows() int64 {
+	if p.limit <= 0 {
+		return 0
+	}
+	return p.limit + 1
+}
+
+// result は、 readLess() の順に読み出したレコードの pageKey から、ページに含めるレコード数と前後のページのカーソルを返す。
+// ページには、 keys の先頭から n 件のレコードを含める。
+// p.before != nil の場合は、それらを逆順に並べ替えたものがページになる。
+// 前後のページにレコードが存在しない場合、カーソルは空文字列になる。
+func (p *pager) result(keys []pageKey) (n int, next, prev Cursor) {
+	n = len(keys)
+	more := false
+	if p.limit > 0 && int64(n) > p.limit {
+		n = int(p.limit)
+		more = true
+	}
+	if n == 0 {
+		return
+	}
+	cursor := func(k pageKey) Cursor {
+		return cursorPos{SortKey: p.sortKey, SortOrder: p.sortOrder, Key: k}.encode()
+	}
+	first, last := keys[0], keys[n-1]
+	if p.before != nil {
+		// カーソルの直前から逆順に読み出したため、 first と last が入れ替わる。
+		first, last = last, first
+		next = cursor(last)
+		if more {
+			prev = cursor(first)
+		}
+		return
+	}
+	if more {
+		next = cursor(last)
+	}
+	if p.after != nil {
+		prev = cursor(first)
+	}
+	return
+}
+
+// setPageHeaders は、前後のページのカーソルをレスポンスヘッダに設定する。
+func setPageHeaders(w http.ResponseWriter, next, prev Cursor) {
+	if next != "" {
+		w.Header().Set(NextCursorHeader, string(next))
+	}
+	if prev != "" {
+		w.Header().Set(PrevCursorHeader, string(prev))
+	}
+}
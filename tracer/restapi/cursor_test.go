@@ -0,0 +1,178 @@
+package restapi
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yuuki0xff/goapptrace/tracer/types"
+)
+
+func TestCursor(t *testing.T) {
+	a := assert.New(t)
+	pos := cursorPos{
+		SortKey:   SortByStartTime,
+		SortOrder: DescendingSortOrder,
+		Key:       pageKey{value: -1, id: 42},
+	}
+	decoded, err := pos.encode().decode()
+	a.NoError(err)
+	a.Equal(pos, decoded)
+
+	// 不正なカーソル
+	for _, c := range []Cursor{
+		"",
+		"!!",
+		cursorPos{}.encode(),
+		"aWQsYXNjLDE",    // "id,asc,1"
+		"aWQsdXAsMSwy",   // "id,up,1,2"
+		"aWQsYXNjLHgsMg", // "id,asc,x,2"
+	} {
+		_, err := c.decode()
+		a.Error(err, string(c))
+	}
+}
+
+func TestNewPager(t *testing.T) {
+	a := assert.New(t)
+	pg, err := newPager(NoSortKey, NoSortOrder, 10, "", "")
+	a.NoError(err)
+	a.Equal(SortByID, pg.sortKey)
+	a.Equal(AscendingSortOrder, pg.sortOrder)
+	a.Equal(int64(11), pg.rows())
+
+	c := cursorPos{SortKey: SortByEndTime, SortOrder: DescendingSortOrder, Key: pageKey{value: 5, id: 3}}.encode()
+	// ソートキーと並び順は、カーソルに従う。
+	pg, err = newPager(NoSortKey, NoSortOrder, 10, c, "")
+	a.NoError(err)
+	a.Equal(SortByEndTime, pg.sortKey)
+	a.Equal(DescendingSortOrder, pg.sortOrder)
+	a.Equal(&pageKey{value: 5, id: 3}, pg.after)
+
+	_, err = newPager(SortByStartTime, NoSortOrder, 10, c, "")
+	a.Error(err)
+	_, err = newPager(NoSortKey, AscendingSortOrder, 10, c, "")
+	a.Error(err)
+	_, err = newPager(NoSortKey, NoSortOrder, 10, c, c)
+	a.Error(err)
+	_, err = newPager(NoSortKey, NoSortOrder, 0, "", c)
+	a.Error(err)
+	_, err = newPager(NoSortKey, NoSortOrder, 10, "invalid", "")
+	a.Error(err)
+}
+
+// readPage は、 pg に従って keys から1ページ分を読み出す。
+func readPage(pg *pager, keys []pageKey) (page []pageKey, next, prev Cursor) {
+	var read []pageKey
+	for _, k := range keys {
+		if pg.inRange(k) {
+			read = append(read, k)
+		}
+	}
+	sort.Slice(read, func(i, j int) bool {
+		return pg.readLess(read[i], read[j])
+	})
+	if rows := pg.rows(); rows > 0 && rows < int64(len(read)) {
+		read = read[:rows]
+	}
+	n, next, prev := pg.result(read)
+	page = read[:n]
+	if pg.before != nil {
+		for i, j := 0, len(page)-1; i < j; i, j = i+1, j-1 {
+			page[i], page[j] = page[j], page[i]
+		}
+	}
+	return
+}
+
+func TestPager(t *testing.T) {
+	a := assert.New(t)
+	// 降順に並べる場合は、ソートキーの値が同じレコードはIDの降順に並ぶ。
+	keys := []pageKey{
+		{value: 10, id: 0},
+		{value: 30, id: 1},
+		{value: 20, id: 2},
+		{value: 30, id: 3},
+		{value: 10, id: 4},
+	}
+	sorted := []pageKey{keys[3], keys[1], keys[2], keys[4], keys[0]}
+
+	// 先頭のページから順に読み出す。
+	var all []pageKey
+	var pages int
+	var last Cursor
+	for after := Cursor(""); ; {
+		pg, err := newPager(SortByEndTime, DescendingSortOrder, 2, after, "")
+		a.NoError(err)
+		page, next, prev := readPage(pg, keys)
+		a.Equal(after != "", prev != "")
+		all = append(all, page...)
+		pages++
+		if next == "" {
+			last = prev
+			break
+		}
+		after = next
+	}
+	a.Equal(sorted, all)
+	a.Equal(3, pages)
+
+	// 最後のページから逆順に読み出す。
+	pg, err := newPager(NoSortKey, NoSortOrder, 2, "", last)
+	a.NoError(err)
+	page, next, prev := readPage(pg, keys)
+	a.Equal(sorted[2:4], page)
+	a.NotEmpty(next)
+	a.NotEmpty(prev)
+	pg, err = newPager(NoSortKey, NoSortOrder, 2, "", prev)
+	a.NoError(err)
+	page, next, prev = readPage(pg, keys)
+	a.Equal(sorted[:2], page)
+	a.NotEmpty(next)
+	a.Empty(prev)
+
+	// 新しいレコードが追加されても、既存のページの境界は変わらない。
+	pg, err = newPager(NoSortKey, NoSortOrder, 2, next, "")
+	a.NoError(err)
+	page, _, _ = readPage(pg, append(keys, pageKey{value: 30, id: 5}))
+	a.Equal(sorted[2:4], page)
+
+	// 空のページ
+	c := cursorPos{SortKey: SortByEndTime, SortOrder: AscendingSortOrder, Key: pageKey{value: 30, id: 3}}.encode()
+	pg, err = newPager(NoSortKey, NoSortOrder, 2, c, "")
+	a.NoError(err)
+	page, next, prev = readPage(pg, keys)
+	a.Empty(page)
+	a.Empty(next)
+	a.Empty(prev)
+}
+
+func TestPager_running(t *testing.T) {
+	a := assert.New(t)
+	keys := []pageKey{
+		{value: 30, id: 0},
+		{value: int64(types.NotEnded), id: 1},
+		{value: 20, id: 2},
+	}
+
+	// 終了時刻でソートしてページングする場合は、実行中のレコードを含めない。
+	pg, err := newPager(SortByEndTime, AscendingSortOrder, 1, "", "")
+	a.NoError(err)
+	page, next, _ := readPage(pg, keys)
+	a.Equal([]pageKey{keys[2]}, page)
+	pg, err = newPager(NoSortKey, NoSortOrder, 1, next, "")
+	a.NoError(err)
+	page, next, _ = readPage(pg, keys)
+	a.Equal([]pageKey{keys[0]}, page)
+	a.Empty(next)
+
+	// ページングしない場合と、他のソートキーの場合は含める。
+	pg, err = newPager(SortByEndTime, AscendingSortOrder, 0, "", "")
+	a.NoError(err)
+	page, _, _ = readPage(pg, keys)
+	a.Equal([]pageKey{keys[1], keys[2], keys[0]}, page)
+	pg, err = newPager(SortByID, AscendingSortOrder, 10, "", "")
+	a.NoError(err)
+	page, _, _ = readPage(pg, keys)
+	a.Len(page, 3)
+}
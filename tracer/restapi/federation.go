@@ -0,0 +1,290 @@
+package restapi
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/yuuki0xff/goapptrace/config"
+	"github.com/yuuki0xff/goapptrace/tracer/types"
+)
+
+// QualifiedLogIDSep separates the server ID and the log ID in the qualified log ID.
+const QualifiedLogIDSep = ":"
+
+var (
+	ErrUnknownServer = errors.New("unknown server")
+	ErrAmbiguousLog  = errors.New("log ID is ambiguous. specify the qualified log ID like <server-id>:<log-id>")
+)
+
+// QualifiedLogID is a log ID qualified by the API server ID.
+// Its string representation is "<server-id>:<log-id>".
+type QualifiedLogID struct {
+	ServerID config.ServerID
+	LogID    string
+}
+
+// String returns a string like "<server-id>:<log-id>".
+func (id QualifiedLogID) String() string {
+	return strconv.FormatInt(int64(id.ServerID), 10) + QualifiedLogIDSep + id.LogID
+}
+
+// ParseQualifiedLogID parses a qualified log ID.
+// If s is not qualified by the server ID, it returns false.
+func ParseQualifiedLogID(s string) (id QualifiedLogID, qualified bool, err error) {
+	idx := strings.Index(s, QualifiedLogIDSep)
+	if idx < 0 {
+		id.LogID = s
+		return
+	}
+	sid, err := strconv.ParseInt(s[:idx], 10, 64)
+	if err != nil {
+		err = fmt.Errorf("invalid server ID in the log ID: %s", s)
+		return
+	}
+	id.ServerID = config.ServerID(sid)
+	id.LogID = s[idx+len(QualifiedLogIDSep):]
+	qualified = true
+	return
+}
+
+// Federation helps calling the REST API of several servers.
+type Federation struct {
+	Clients map[config.ServerID]*Client
+}
+
+// FederationWithCtx is a Federation with context.
+type FederationWithCtx struct {
+	*Federation
+	ctx context.Context
+}
+
+// FederationError holds errors occurred on each server.
+type FederationError struct {
+	Errors map[config.ServerID]error
+}
+
+// NewFederation returns an initialized Federation.
+func NewFederation(servers map[config.ServerID]*config.ApiServerConfig) (*Federation, error) {
+	f := &Federation{
+		Clients: map[config.ServerID]*Client{},
+	}
+	for id, srv := range servers {
+		c := &Client{
+			BaseUrl: srv.Addr,
+		}
+		if err := c.Init(); err != nil {
+			return nil, errors.Wrapf(err, "failed to initialize an API client for server %d", id)
+		}
+		f.Clients[id] = c
+	}
+	return f, nil
+}
+
+// IsFederated returns true if two or more servers are configured.
+// Log IDs are qualified by the server ID only when IsFederated() is true.
+func (f *Federation) IsFederated() bool {
+	return len(f.Clients) > 1
+}
+
+// ServerIDs returns IDs of all servers in ascending order.
+func (f *Federation) ServerIDs() []config.ServerID {
+	ids := make([]config.ServerID, 0, len(f.Clients))
+	for id := range f.Clients {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+// WithCtx returns a new FederationWithCtx object with specified context.
+func (f *Federation) WithCtx(ctx context.Context) FederationWithCtx {
+	return FederationWithCtx{
+		Federation: f,
+		ctx:        ctx,
+	}
+}
+
+// Client returns an API client for the specified server.
+func (f FederationWithCtx) Client(id config.ServerID) (ClientWithCtx, error) {
+	c, ok := f.Clients[id]
+	if !ok {
+		return ClientWithCtx{}, errors.Wrapf(ErrUnknownServer, "server-id=%d", id)
+	}
+	return c.WithCtx(f.ctx), nil
+}
+
+// QualifyLogID returns the log ID which is shown to users.
+// If two or more servers are configured, the log ID is qualified by the server ID.
+func (f FederationWithCtx) QualifyLogID(id QualifiedLogID) string {
+	if f.IsFederated() {
+		return id.String()
+	}
+	return id.LogID
+}
+
+// SplitLogID splits the log ID shown to users into the server ID and the log ID on the server.
+// Unlike Resolve(), it does not send any request to servers.
+func (f *Federation) SplitLogID(id string) (QualifiedLogID, error) {
+	qid, qualified, err := ParseQualifiedLogID(id)
+	if err != nil || qualified {
+		return qid, err
+	}
+	if f.IsFederated() {
+		return qid, errors.Wrapf(ErrAmbiguousLog, "log-id=%s", id)
+	}
+	for sid := range f.Clients {
+		qid.ServerID = sid
+		return qid, nil
+	}
+	return qid, ErrUnknownServer
+}
+
+// Logs returns a list of log status on all servers.
+func (f FederationWithCtx) Logs() ([]types.LogInfo, error) {
+	return f.SearchLogs(SearchLogsParams{})
+}
+
+// SearchLogs sends the search request to all servers, and merges results.
+// If some servers are failed, it returns logs on other servers and *FederationError.
+// If all servers are failed, it returns nil and *FederationError.
+func (f FederationWithCtx) SearchLogs(so SearchLogsParams) ([]types.LogInfo, error) {
+	sids := f.ServerIDs()
+	results := make([][]types.LogInfo, len(sids))
+	errs := make([]error, len(sids))
+	var wg sync.WaitGroup
+	for i, sid := range sids {
+		wg.Add(1)
+		go func(i int, sid config.ServerID) {
+			defer wg.Done()
+			api, err := f.Client(sid)
+			if err == nil {
+				results[i], err = api.SearchLogs(so)
+			}
+			errs[i] = err
+		}(i, sid)
+	}
+	wg.Wait()
+
+	// 並び替えのキーが指定されていなくても結果が一定になるように、サーバIDの順に結合する。
+	var logs []types.LogInfo
+	ferr := &FederationError{
+		Errors: map[config.ServerID]error{},
+	}
+	for i, sid := range sids {
+		if errs[i] != nil {
+			ferr.Errors[sid] = errs[i]
+			continue
+		}
+		for _, info := range results[i] {
+			info.ID = f.QualifyLogID(QualifiedLogID{
+				ServerID: sid,
+				LogID:    info.ID,
+			})
+			logs = append(logs, info)
+		}
+	}
+	so.Sort(logs)
+
+	switch len(ferr.Errors) {
+	case 0:
+		return logs, nil
+	case len(sids):
+		return nil, ferr
+	default:
+		if logs == nil {
+			// 全てのサーバで失敗した場合と区別できるようにする。
+			logs = []types.LogInfo{}
+		}
+		return logs, ferr
+	}
+}
+
+// Resolve returns the API client and the log ID on the server.
+// id is a qualified or unqualified log ID.
+// If the unqualified log ID is given and two or more servers are configured,
+// Resolve searches the log from all servers.
+func (f FederationWithCtx) Resolve(id string) (api ClientWithCtx, logID string, err error) {
+	qid, qualified, err := ParseQualifiedLogID(id)
+	if err != nil {
+		return
+	}
+	if qualified {
+		api, err = f.Client(qid.ServerID)
+		logID = qid.LogID
+		return
+	}
+	if !f.IsFederated() {
+		for sid := range f.Clients {
+			api, err = f.Client(sid)
+			logID = qid.LogID
+			return
+		}
+		err = ErrUnknownServer
+		return
+	}
+
+	found := make([]bool, len(f.Clients))
+	errs := make([]error, len(f.Clients))
+	sids := f.ServerIDs()
+	var wg sync.WaitGroup
+	for i, sid := range sids {
+		wg.Add(1)
+		go func(i int, sid config.ServerID) {
+			defer wg.Done()
+			c, err := f.Client(sid)
+			if err == nil {
+				_, err = c.LogInfo(qid.LogID)
+			}
+			if errors.Cause(err) == ErrNotFound {
+				return
+			}
+			found[i] = err == nil
+			errs[i] = err
+		}(i, sid)
+	}
+	wg.Wait()
+
+	ferr := &FederationError{
+		Errors: map[config.ServerID]error{},
+	}
+	var candidates []config.ServerID
+	for i, sid := range sids {
+		if found[i] {
+			candidates = append(candidates, sid)
+		} else if errs[i] != nil {
+			ferr.Errors[sid] = errs[i]
+		}
+	}
+
+	switch {
+	case len(candidates) == 1:
+		api, err = f.Client(candidates[0])
+		logID = qid.LogID
+	case len(candidates) > 1:
+		err = errors.Wrapf(ErrAmbiguousLog, "log-id=%s", id)
+	case len(ferr.Errors) > 0:
+		err = ferr
+	default:
+		err = errors.Wrapf(ErrNotFound, "log-id=%s", id)
+	}
+	return
+}
+
+func (e *FederationError) Error() string {
+	ids := make([]config.ServerID, 0, len(e.Errors))
+	for id := range e.Errors {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	msgs := make([]string, len(ids))
+	for i, id := range ids {
+		msgs[i] = fmt.Sprintf("server %d: %s", id, e.Errors[id])
+	}
+	return strings.Join(msgs, "\n")
+}
@@ -0,0 +1,148 @@
+package restapi
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/yuuki0xff/goapptrace/config"
+	"github.com/yuuki0xff/goapptrace/tracer/types"
+)
+
+// newStandInServer returns an API server that has only the specified logs.
+func newStandInServer(logs ...types.LogInfo) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/api/v0.1/logs":
+			json.NewEncoder(w).Encode(Logs{Logs: logs}) // nolint: errcheck
+		case strings.HasPrefix(r.URL.Path, "/api/v0.1/log/"):
+			id := strings.TrimPrefix(r.URL.Path, "/api/v0.1/log/")
+			for _, l := range logs {
+				if l.ID == id {
+					json.NewEncoder(w).Encode(l) // nolint: errcheck
+					return
+				}
+			}
+			http.Error(w, "log not found", http.StatusNotFound)
+		default:
+			http.Error(w, "not implemented", http.StatusNotImplemented)
+		}
+	}))
+}
+
+func newTestFederation(t *testing.T, addrs ...string) FederationWithCtx {
+	servers := map[config.ServerID]*config.ApiServerConfig{}
+	for i, addr := range addrs {
+		id := config.ServerID(i + 1)
+		servers[id] = &config.ApiServerConfig{
+			ServerID: id,
+			Addr:     addr,
+		}
+	}
+	f, err := NewFederation(servers)
+	assert.NoError(t, err)
+	return f.WithCtx(context.Background())
+}
+
+func TestParseQualifiedLogID(t *testing.T) {
+	a := assert.New(t)
+	id, qualified, err := ParseQualifiedLogID("2:0123abcd")
+	a.NoError(err)
+	a.True(qualified)
+	a.Equal(QualifiedLogID{ServerID: 2, LogID: "0123abcd"}, id)
+	a.Equal("2:0123abcd", id.String())
+
+	id, qualified, err = ParseQualifiedLogID("0123abcd")
+	a.NoError(err)
+	a.False(qualified)
+	a.Equal("0123abcd", id.LogID)
+
+	_, _, err = ParseQualifiedLogID("x:0123abcd")
+	a.Error(err)
+}
+
+func TestFederation_SearchLogs(t *testing.T) {
+	a := assert.New(t)
+	srv1 := newStandInServer(
+		types.LogInfo{ID: "aa", Metadata: types.LogMetadata{AppName: "b"}},
+		types.LogInfo{ID: "bb", Metadata: types.LogMetadata{AppName: "d"}},
+	)
+	defer srv1.Close()
+	srv2 := newStandInServer(
+		types.LogInfo{ID: "aa", Metadata: types.LogMetadata{AppName: "c"}},
+		types.LogInfo{ID: "cc", Metadata: types.LogMetadata{AppName: "a"}},
+	)
+	defer srv2.Close()
+
+	f := newTestFederation(t, srv1.URL, srv2.URL)
+	logs, err := f.SearchLogs(SearchLogsParams{SortKey: LogSortByAppName})
+	a.NoError(err)
+	ids := []string{}
+	for _, l := range logs {
+		ids = append(ids, l.ID)
+	}
+	a.Equal([]string{"2:cc", "1:aa", "2:aa", "1:bb"}, ids)
+
+	// 1つのサーバのみを使用している場合は、ログIDを修飾しない。
+	logs, err = newTestFederation(t, srv1.URL).Logs()
+	a.NoError(err)
+	a.Len(logs, 2)
+	a.Equal("aa", logs[0].ID)
+}
+
+func TestFederation_SearchLogsWithBrokenServer(t *testing.T) {
+	a := assert.New(t)
+	srv1 := newStandInServer()
+	defer srv1.Close()
+	srv2 := newStandInServer(types.LogInfo{ID: "aa"})
+	srv2.Close()
+
+	f := newTestFederation(t, srv1.URL, srv2.URL)
+	logs, err := f.Logs()
+	a.Error(err)
+	a.IsType(&FederationError{}, err)
+	a.Contains(err.(*FederationError).Errors, config.ServerID(2))
+	a.NotNil(logs)
+	a.Len(logs, 0)
+
+	logs, err = newTestFederation(t, srv2.URL, srv2.URL).Logs()
+	a.Error(err)
+	a.Nil(logs)
+}
+
+func TestFederation_Resolve(t *testing.T) {
+	a := assert.New(t)
+	srv1 := newStandInServer(types.LogInfo{ID: "aa"}, types.LogInfo{ID: "bb"})
+	defer srv1.Close()
+	srv2 := newStandInServer(types.LogInfo{ID: "aa"}, types.LogInfo{ID: "cc"})
+	defer srv2.Close()
+	f := newTestFederation(t, srv1.URL, srv2.URL)
+
+	api, logID, err := f.Resolve("2:aa")
+	a.NoError(err)
+	a.Equal(srv2.URL, api.BaseUrl)
+	a.Equal("aa", logID)
+
+	api, logID, err = f.Resolve("cc")
+	a.NoError(err)
+	a.Equal(srv2.URL, api.BaseUrl)
+	a.Equal("cc", logID)
+
+	_, _, err = f.Resolve("aa")
+	a.Equal(ErrAmbiguousLog, errors.Cause(err))
+	_, _, err = f.Resolve("dd")
+	a.Equal(ErrNotFound, errors.Cause(err))
+	_, _, err = f.Resolve("3:aa")
+	a.Equal(ErrUnknownServer, errors.Cause(err))
+
+	qid, err := f.SplitLogID("1:bb")
+	a.NoError(err)
+	a.Equal(QualifiedLogID{ServerID: 1, LogID: "bb"}, qid)
+	_, err = f.SplitLogID("bb")
+	a.Equal(ErrAmbiguousLog, errors.Cause(err))
+}
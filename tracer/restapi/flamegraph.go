@@ -0,0 +1,313 @@
+package restapi
+
+import (
+	"bufio"
+	"fmt"
+	"hash/fnv"
+	"html"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/yuuki0xff/goapptrace/tracer/types"
+)
+
+const (
+	// SVG画像の幅 (px)
+	flameGraphWidth = 1200
+	// SVG画像の左右の余白 (px)
+	flameGraphPadding = 10
+	// 1つのフレームの高さ (px)
+	flameGraphFrameHeight = 16
+	// フレームの上下に表示するタイトルと詳細情報の領域の高さ (px)
+	flameGraphHeaderHeight = 36
+	// この幅 (px) よりも狭いフレームは出力しない。
+	flameGraphMinFrameWidth = 0.1
+	// 1文字の幅の目安 (px)
+	flameGraphCharWidth = 7
+	// 関数名が不明なフレームに表示する名前
+	flameGraphUnknownFunc = "?"
+)
+
+// flameGraph は、関数呼び出しのスタックごとに実行時間を集計する。
+// スタックは、関数呼び出しの Frames を呼び出し元から順に並べたものである。
+// 各スタックの重みは、呼び出し先の関数の実行時間を除いた時間 (self time) である。
+// 呼び出し元のフレームの幅は呼び出し先の重みを合計したものになるため、関数の実行時間 (total time) を表す。
+// スレッドセーフではない。
+type flameGraph struct {
+	symbols *types.Symbols
+
+	// スタックごとの重み。
+	// キーは、関数名を呼び出し元から順に";"で区切って連結した文字列である。
+	stacks map[string]int64
+	// PCに対応する関数名のキャッシュ
+	funcNames map[uintptr]string
+	// goroutineごとの、集計済みの関数呼び出しのうち実行中だったもの。
+	// 呼び出し元から順に並んでいる。
+	open map[types.GID][]flameGraphCall
+}
+
+// flameGraphCall は、呼び出し先の実行時間を差し引くために保持している関数呼び出しである。
+type flameGraphCall struct {
+	id      types.FuncLogID
+	endTime types.Time
+	depth   int
+	stack   string
+}
+
+func newFlameGraph(symbols *types.Symbols) *flameGraph {
+	return &flameGraph{
+		symbols:   symbols,
+		stacks:    map[string]int64{},
+		funcNames: map[uintptr]string{},
+		open:      map[types.GID][]flameGraphCall{},
+	}
+}
+
+// add は、 fl を集計する。
+// FuncLogはIDの昇順に追加しなければならない。
+// 実行中の関数呼び出しと記録されていないレコードは無視する。
+func (g *flameGraph) add(fl *types.FuncLog) {
+	if fl.StartTime == 0 || !fl.IsEnded() || len(fl.Frames) == 0 {
+		return
+	}
+	stack := g.stack(fl)
+	execTime := int64(fl.EndTime - fl.StartTime)
+	g.stacks[stack] += execTime
+
+	// 同じgoroutineで実行された関数呼び出しは入れ子になっている。
+	// 集計済みの関数呼び出しのうち、 fl の開始前に終了したものを取り除くと、末尾が fl の呼び出し元になる。
+	// 呼び出し元が集計対象外であれば、さらに上位の呼び出し元から fl の実行時間を差し引く。
+	calls := g.open[fl.GID]
+	for len(calls) > 0 {
+		c := calls[len(calls)-1]
+		if c.id == fl.ParentID || (fl.EndTime <= c.endTime && c.depth < len(fl.Frames)) {
+			g.stacks[c.stack] -= execTime
+			break
+		}
+		calls = calls[:len(calls)-1]
+	}
+	g.open[fl.GID] = append(calls, flameGraphCall{
+		id:      fl.ID,
+		endTime: fl.EndTime,
+		depth:   len(fl.Frames),
+		stack:   stack,
+	})
+}
+
+// stack は、 fl のスタックを表す文字列を返す。
+func (g *flameGraph) stack(fl *types.FuncLog) string {
+	names := make([]string, len(fl.Frames))
+	for i, pc := range fl.Frames {
+		// Frames[0] は、呼び出された関数である。
+		names[len(names)-1-i] = g.funcName(pc)
+	}
+	return strings.Join(names, ";")
+}
+
+func (g *flameGraph) funcName(pc uintptr) string {
+	name, ok := g.funcNames[pc]
+	if ok {
+		return name
+	}
+	name = flameGraphUnknownFunc
+	if f, ok := g.symbols.GoFunc(pc); ok {
+		// 区切り文字と空白は、folded stacks形式では使用できない。
+		name = strings.NewReplacer(";", ":", " ", "_").Replace(f.Name)
+	}
+	g.funcNames[pc] = name
+	return name
+}
+
+// sortedStacks は、重みが正のスタックを、スタックの昇順に返す。
+func (g *flameGraph) sortedStacks() []string {
+	stacks := make([]string, 0, len(g.stacks))
+	for stack, value := range g.stacks {
+		if value > 0 {
+			stacks = append(stacks, stack)
+		}
+	}
+	sort.Strings(stacks)
+	return stacks
+}
+
+// writeFolded は、集計結果をfolded stacks形式で書き出す。
+// 各行は、スタックと重み (ナノ秒) を空白で区切ったものである。
+func (g *flameGraph) writeFolded(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	for _, stack := range g.sortedStacks() {
+		bw.WriteString(stack)                                  // nolint: errcheck
+		bw.WriteByte(' ')                                      // nolint: errcheck
+		bw.WriteString(strconv.FormatInt(g.stacks[stack], 10)) // nolint: errcheck
+		bw.WriteByte('\n')                                     // nolint: errcheck
+	}
+	return bw.Flush()
+}
+
+// flameGraphNode は、フレームグラフの1つのフレームである。
+type flameGraphNode struct {
+	name     string
+	value    int64
+	children []*flameGraphNode
+}
+
+// tree は、集計結果を根が "all" のツリーに変換する。
+// 子ノードは関数名の昇順に並ぶ。
+func (g *flameGraph) tree() *flameGraphNode {
+	root := &flameGraphNode{name: "all"}
+	for _, stack := range g.sortedStacks() {
+		value := g.stacks[stack]
+		node := root
+		node.value += value
+		for _, name := range strings.Split(stack, ";") {
+			// スタックは昇順に並んでいるため、同じ関数の子ノードは末尾にある。
+			n := len(node.children)
+			if n == 0 || node.children[n-1].name != name {
+				node.children = append(node.children, &flameGraphNode{name: name})
+				n++
+			}
+			node = node.children[n-1]
+			node.value += value
+		}
+	}
+	return root
+}
+
+// writeSVG は、集計結果をSVG画像として書き出す。
+// フレームにマウスを重ねると詳細を表示し、クリックするとそのフレームを拡大する。
+func (g *flameGraph) writeSVG(w io.Writer, title string) error {
+	root := g.tree()
+	depth := root.depth()
+	height := depth*flameGraphFrameHeight + flameGraphHeaderHeight*2
+	bw := bufio.NewWriter(w)
+
+	fmt.Fprintf(bw, `<?xml version="1.0" standalone="no"?>
+<svg version="1.1" width="%d" height="%d" viewBox="0 0 %d %d" xmlns="http://www.w3.org/2000/svg">
+<style>
+text { font-family: Verdana, sans-serif; font-size: 12px; fill: #000; }
+g.frame { cursor: pointer; }
+g.frame rect { stroke: #eee; stroke-width: 0.5; }
+g.frame:hover rect { stroke: #000; }
+#unzoom { cursor: pointer; display: none; }
+</style>
+<script type="text/ecmascript"><![CDATA[
+var X0 = %d, W = %d, CW = %d;
+function frames() { return document.getElementsByClassName("frame"); }
+function attr(g, name) { return parseFloat(g.getAttribute("data-" + name)); }
+function label(name, px) {
+	var n = Math.floor((px - 6) / CW);
+	if (n < 3) return "";
+	return name.length <= n ? name : name.substring(0, n - 2) + "..";
+}
+function place(g, x, w) {
+	var r = g.getElementsByTagName("rect")[0], t = g.getElementsByTagName("text")[0];
+	r.setAttribute("x", X0 + x * W);
+	r.setAttribute("width", w * W);
+	t.setAttribute("x", X0 + x * W + 3);
+	t.textContent = label(g.getAttribute("data-name"), w * W);
+	g.style.display = "";
+}
+function zoom(z) {
+	var zx = attr(z, "x"), zw = attr(z, "w"), zd = attr(z, "d"), e = 1e-9;
+	var fs = frames();
+	for (var i = 0; i < fs.length; i++) {
+		var g = fs[i], x = attr(g, "x"), w = attr(g, "w"), d = attr(g, "d");
+		if (d < zd && x <= zx + e && zx + zw <= x + w + e) {
+			place(g, 0, 1);
+		} else if (zd <= d && zx - e <= x && x + w <= zx + zw + e) {
+			place(g, (x - zx) / zw, w / zw);
+		} else {
+			g.style.display = "none";
+		}
+	}
+	document.getElementById("unzoom").style.display = "block";
+}
+function unzoom() {
+	var fs = frames();
+	for (var i = 0; i < fs.length; i++) {
+		place(fs[i], attr(fs[i], "x"), attr(fs[i], "w"));
+	}
+	document.getElementById("unzoom").style.display = "none";
+}
+function show(g) { document.getElementById("details").textContent = g.getElementsByTagName("title")[0].textContent; }
+function hide() { document.getElementById("details").textContent = " "; }
+]]></script>
+<rect x="0" y="0" width="100%%" height="100%%" fill="#f8f8f8"/>
+<text x="%d" y="24" text-anchor="middle" style="font-size: 17px">%s</text>
+<text id="unzoom" x="%d" y="24" onclick="unzoom()">Reset Zoom</text>
+<text id="details" x="%d" y="%d"> </text>
+`,
+		flameGraphWidth, height, flameGraphWidth, height,
+		flameGraphPadding, flameGraphWidth-flameGraphPadding*2, flameGraphCharWidth,
+		flameGraphWidth/2, html.EscapeString(title),
+		flameGraphPadding,
+		flameGraphPadding, height-flameGraphHeaderHeight/2+6,
+	)
+	if root.value > 0 {
+		g.writeSVGFrames(bw, root, 0, 0, height-flameGraphHeaderHeight, float64(root.value))
+	}
+	bw.WriteString("</svg>\n") // nolint: errcheck
+	return bw.Flush()
+}
+
+// writeSVGFrames は、 node とその子孫のフレームを書き出す。
+// x は、 node の左端の位置を、全体の幅に対する割合で表したものである。
+// bottom は、根のフレームの下端のy座標である。
+func (g *flameGraph) writeSVGFrames(w *bufio.Writer, node *flameGraphNode, x float64, depth, bottom int, total float64) {
+	width := float64(node.value) / total
+	px := width * float64(flameGraphWidth-flameGraphPadding*2)
+	if px < flameGraphMinFrameWidth {
+		return
+	}
+	name := html.EscapeString(node.name)
+	y := bottom - (depth+1)*flameGraphFrameHeight
+	fmt.Fprintf(w, `<g class="frame" data-name="%s" data-x="%g" data-w="%g" data-d="%d" onclick="zoom(this)" onmouseover="show(this)" onmouseout="hide()">`,
+		name, x, width, depth)
+	fmt.Fprintf(w, `<title>%s (%s ns, %.2f%%)</title>`, name, strconv.FormatInt(node.value, 10), width*100)
+	fmt.Fprintf(w, `<rect x="%.1f" y="%d" width="%.1f" height="%d" fill="%s"/>`,
+		float64(flameGraphPadding)+x*float64(flameGraphWidth-flameGraphPadding*2), y, px, flameGraphFrameHeight-1, flameGraphColor(node.name))
+	fmt.Fprintf(w, `<text x="%.1f" y="%d">%s</text></g>`+"\n",
+		float64(flameGraphPadding)+x*float64(flameGraphWidth-flameGraphPadding*2)+3, y+flameGraphFrameHeight-4, html.EscapeString(flameGraphLabel(node.name, px)))
+
+	for _, child := range node.children {
+		g.writeSVGFrames(w, child, x, depth+1, bottom, total)
+		x += float64(child.value) / total
+	}
+}
+
+// depth は、 node を根とするツリーの深さを返す。
+func (node *flameGraphNode) depth() int {
+	max := 0
+	for _, child := range node.children {
+		if d := child.depth(); max < d {
+			max = d
+		}
+	}
+	return max + 1
+}
+
+// flameGraphLabel は、幅が px のフレームに表示する文字列を返す。
+// 表示しきれない場合は、末尾を省略する。
+func flameGraphLabel(name string, px float64) string {
+	n := int((px - 6) / flameGraphCharWidth)
+	if n < 3 {
+		return ""
+	}
+	if len(name) <= n {
+		return name
+	}
+	return name[:n-2] + ".."
+}
+
+// flameGraphColor は、関数名から暖色系の色を決める。
+// 同じ関数は常に同じ色になる。
+func flameGraphColor(name string) string {
+	h := fnv.New32a()
+	h.Write([]byte(name)) // nolint: errcheck
+	v := h.Sum32()
+	r := 205 + v%50
+	g := (v >> 8) % 230
+	b := (v >> 16) % 55
+	return fmt.Sprintf("rgb(%d,%d,%d)", r, g, b)
+}
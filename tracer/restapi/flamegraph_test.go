@@ -0,0 +1,172 @@
+package restapi
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yuuki0xff/goapptrace/tracer/types"
+)
+
+func newFlameGraphTestData() ([]types.FuncLog, *types.Symbols) {
+	symbols := &types.Symbols{}
+	symbols.Load(types.SymbolsData{
+		Mods: []types.GoModule{
+			{Name: "main", MinPC: 100, MaxPC: 999},
+		},
+		Funcs: []types.GoFunc{
+			{Entry: 100, Name: "main.worker"},
+			{Entry: 200, Name: "main.wait"},
+			{Entry: 300, Name: "main.serve"},
+		},
+	})
+	// 0 (main.serve) -+- 1 (main.worker) --- 2 (main.wait)
+	//                 +- 3 (main.wait)
+	// 4 (not recorded)
+	// 5 (running, other goroutine)
+	fls := []types.FuncLog{
+		{ID: 0, StartTime: 1, EndTime: 101, ParentID: types.NotFoundParent, GID: 1, Frames: []uintptr{300}},
+		{ID: 1, StartTime: 10, EndTime: 60, ParentID: 0, GID: 1, Frames: []uintptr{100, 300}},
+		{ID: 2, StartTime: 20, EndTime: 30, ParentID: 1, GID: 1, Frames: []uintptr{200, 100, 300}},
+		{ID: 3, StartTime: 70, EndTime: 80, ParentID: 0, GID: 1, Frames: []uintptr{200, 300}},
+		{},
+		{ID: 5, StartTime: 50, EndTime: types.NotEnded, ParentID: types.NotFoundParent, GID: 2, Frames: []uintptr{100}},
+	}
+	return fls, symbols
+}
+
+func TestFlameGraph_add(t *testing.T) {
+	a := assert.New(t)
+	fls, symbols := newFlameGraphTestData()
+
+	fg := newFlameGraph(symbols)
+	for i := range fls {
+		fg.add(&fls[i])
+	}
+	a.Equal(map[string]int64{
+		"main.serve":                       40,
+		"main.serve;main.worker":           40,
+		"main.serve;main.worker;main.wait": 10,
+		"main.serve;main.wait":             10,
+	}, fg.stacks)
+
+	// 呼び出し元が集計対象外の場合、さらに上位の呼び出し元から実行時間を差し引く。
+	fg = newFlameGraph(symbols)
+	for _, i := range []int{0, 2, 3} {
+		fg.add(&fls[i])
+	}
+	a.Equal(map[string]int64{
+		"main.serve":                       80,
+		"main.serve;main.worker;main.wait": 10,
+		"main.serve;main.wait":             10,
+	}, fg.stacks)
+
+	// 関数名が不明なフレーム
+	fg = newFlameGraph(symbols)
+	fg.add(&types.FuncLog{ID: 0, StartTime: 1, EndTime: 3, GID: 1, Frames: []uintptr{10}})
+	a.Equal(map[string]int64{"?": 2}, fg.stacks)
+}
+
+func TestFlameGraph_writeFolded(t *testing.T) {
+	a := assert.New(t)
+	fls, symbols := newFlameGraphTestData()
+	fg := newFlameGraph(symbols)
+	for i := range fls {
+		fg.add(&fls[i])
+	}
+
+	var buf bytes.Buffer
+	a.NoError(fg.writeFolded(&buf))
+	a.Equal(`main.serve 40
+main.serve;main.wait 10
+main.serve;main.worker 40
+main.serve;main.worker;main.wait 10
+`, buf.String())
+}
+
+func TestFlameGraph_tree(t *testing.T) {
+	a := assert.New(t)
+	fls, symbols := newFlameGraphTestData()
+	fg := newFlameGraph(symbols)
+	for i := range fls {
+		fg.add(&fls[i])
+	}
+
+	root := fg.tree()
+	a.Equal("all", root.name)
+	a.Equal(int64(100), root.value)
+	a.Equal(4, root.depth())
+	a.Len(root.children, 1)
+	serve := root.children[0]
+	a.Equal("main.serve", serve.name)
+	a.Equal(int64(100), serve.value)
+	a.Len(serve.children, 2)
+	a.Equal("main.wait", serve.children[0].name)
+	a.Equal(int64(10), serve.children[0].value)
+	a.Equal("main.worker", serve.children[1].name)
+	a.Equal(int64(50), serve.children[1].value)
+}
+
+func TestFlameGraph_writeSVG(t *testing.T) {
+	a := assert.New(t)
+	fls, symbols := newFlameGraphTestData()
+	fg := newFlameGraph(symbols)
+	for i := range fls {
+		fg.add(&fls[i])
+	}
+
+	var buf bytes.Buffer
+	a.NoError(fg.writeSVG(&buf, "<title>"))
+	svg := buf.String()
+	a.True(strings.HasPrefix(svg, "<?xml"))
+	a.True(strings.HasSuffix(svg, "</svg>\n"))
+	a.Contains(svg, "&lt;title&gt;")
+	a.Equal(5, strings.Count(svg, `<g class="frame"`))
+	a.Contains(svg, `data-name="main.worker" data-x="0.1" data-w="0.5" data-d="2"`)
+
+	// 関数呼び出しが無い場合は、フレームを出力しない。
+	buf.Reset()
+	fg = newFlameGraph(symbols)
+	a.NoError(fg.writeSVG(&buf, "empty"))
+	a.NotContains(buf.String(), `<g class="frame"`)
+}
+
+func TestFlameGraphParams_FromString(t *testing.T) {
+	a := assert.New(t)
+	var p FlameGraphParams
+	name, err := p.FromString("", "", "", "", "")
+	a.NoError(err)
+	a.Empty(name)
+	a.Equal(FlameGraphParams{
+		MinTimestamp: -1,
+		MaxTimestamp: -1,
+		Format:       SvgFlameGraph,
+	}, p)
+
+	name, err = p.FromString("1,3", "10", "20", "SELECT * FROM calls", "folded")
+	a.NoError(err)
+	a.Empty(name)
+	a.Equal([]types.GID{1, 3}, p.Gids)
+	a.Equal(p, func() FlameGraphParams {
+		var p2 FlameGraphParams
+		m := p.ToParamMap()
+		_, err := p2.FromString(m["gid"], m["min-timestamp"], m["max-timestamp"], m["sql"], m["format"])
+		a.NoError(err)
+		return p2
+	}())
+
+	for _, tc := range []struct {
+		args [5]string
+		name string
+	}{
+		{[5]string{"1,x", "", "", "", ""}, "gid"},
+		{[5]string{"", "x", "", "", ""}, "min-timestamp"},
+		{[5]string{"", "", "x", "", ""}, "max-timestamp"},
+		{[5]string{"", "", "", "", "png"}, "format"},
+	} {
+		name, err = p.FromString(tc.args[0], tc.args[1], tc.args[2], tc.args[3], tc.args[4])
+		a.Error(err)
+		a.Equal(tc.name, name)
+	}
+}
@@ -0,0 +1,98 @@
+package restapi
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// followCursor は、continuous query で既に読み出したレコードを記録する。
+// レコードは、calls テーブルならFuncLogのID、goroutines テーブルならGIDで識別する。
+//
+// 実行中の関数呼び出しやgoroutineのレコードは、終了後に値が変化する。
+// そのため、終了するまで出力を保留し、次回以降の scan() で再度読み出す。
+type followCursor struct {
+	// 次に読み出すレコードのID。
+	next int64
+	// 実行中だったため、出力を保留しているレコードのID。
+	pending []int64
+}
+
+// scan は、出力を保留しているレコードと、ids が返すIDのレコードを read で読み出す。
+// read は、レコードが終了していれば行を出力し、endedにtrueを返す。
+// ids が返すIDは、c.next 以上 end 未満でなければならない。
+// ids がnilなら、c.next 以上 end 未満の全てのレコードを読み出す。
+func (c *followCursor) scan(ids func() (int64, bool), end int64, read func(id int64) (ended bool, err error)) error {
+	if ids == nil {
+		ids = idRange(c.next, end)
+	}
+	pending := c.pending
+	c.pending = nil
+	for _, id := range pending {
+		ended, err := read(id)
+		if err != nil {
+			return err
+		}
+		if !ended {
+			c.pending = append(c.pending, id)
+		}
+	}
+	for id, ok := ids(); ok; id, ok = ids() {
+		ended, err := read(id)
+		if err != nil {
+			return err
+		}
+		if !ended {
+			c.pending = append(c.pending, id)
+		}
+	}
+	if c.next < end {
+		c.next = end
+	}
+	return nil
+}
+
+// String は、カーソルの状態を "next,pending1,pending2,..." の形式で返す。
+// 切断したクライアントは、この文字列を指定して再接続すると、出力済みのレコードを除いて続きから読み出せる。
+func (c *followCursor) String() string {
+	strs := make([]string, 0, len(c.pending)+1)
+	strs = append(strs, strconv.FormatInt(c.next, 10))
+	for _, id := range c.pending {
+		strs = append(strs, strconv.FormatInt(id, 10))
+	}
+	return strings.Join(strs, ",")
+}
+
+// FromString は、 String() が返した文字列からカーソルの状態を復元する。
+// IDのみを指定した場合は、そのID以降の全てのレコードを読み出す。
+func (c *followCursor) FromString(s string) error {
+	var ids []int64
+	for _, str := range strings.Split(s, ",") {
+		id, err := strconv.ParseInt(str, 10, 64)
+		if err != nil {
+			return err
+		}
+		if id < 0 {
+			return errors.Errorf("negative id: %d", id)
+		}
+		ids = append(ids, id)
+	}
+	for _, id := range ids[1:] {
+		if ids[0] <= id {
+			return errors.Errorf("pending id must be less than %d: %d", ids[0], id)
+		}
+	}
+	c.next = ids[0]
+	c.pending = ids[1:]
+	return nil
+}
+
+// idRange は、min 以上 max 未満のIDを昇順に返す関数を返す。
+func idRange(min, max int64) func() (int64, bool) {
+	id := min - 1
+	return func() (int64, bool) {
+		id++
+		return id, id < max
+	}
+}
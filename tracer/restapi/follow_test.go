@@ -0,0 +1,73 @@
+package restapi
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFollowCursor(t *testing.T) {
+	a := assert.New(t)
+	// ended[id] がtrueなら、そのレコードは終了している。
+	ended := map[int64]bool{0: true, 1: false, 2: true}
+	var out []int64
+	read := func(id int64) (bool, error) {
+		if ended[id] {
+			out = append(out, id)
+		}
+		return ended[id], nil
+	}
+
+	var c followCursor
+	a.NoError(c.scan(nil, 3, read))
+	a.Equal([]int64{0, 2}, out)
+	a.Equal([]int64{1}, c.pending)
+	a.Equal(int64(3), c.next)
+	a.Equal("3,1", c.String())
+
+	// 新しいレコードが無くても、保留しているレコードは再度読み出す。
+	out = nil
+	a.NoError(c.scan(nil, 3, read))
+	a.Nil(out)
+	a.Equal([]int64{1}, c.pending)
+
+	// 保留していたレコードが終了した。
+	out = nil
+	ended[1] = true
+	ended[3] = true
+	ended[4] = false
+	a.NoError(c.scan(nil, 5, read))
+	a.Equal([]int64{1, 3}, out)
+	a.Equal([]int64{4}, c.pending)
+	a.Equal(int64(5), c.next)
+	a.Equal("5,4", c.String())
+
+	// 復元したカーソルは、保留しているレコードと新しいレコードを読み出す。
+	var c2 followCursor
+	a.NoError(c2.FromString(c.String()))
+	out = nil
+	ended[4] = true
+	ended[5] = true
+	a.NoError(c2.scan(nil, 6, read))
+	a.Equal([]int64{4, 5}, out)
+	a.Equal("6", c2.String())
+}
+
+func TestFollowCursor_IDs(t *testing.T) {
+	a := assert.New(t)
+	var out []int64
+	read := func(id int64) (bool, error) {
+		out = append(out, id)
+		return true, nil
+	}
+
+	var c followCursor
+	// 最初のスキャンでは、プランが返したIDのみを読み出す。
+	a.NoError(c.scan(idRange(5, 7), 10, read))
+	a.Equal([]int64{5, 6}, out)
+	a.Equal(int64(10), c.next)
+
+	out = nil
+	a.NoError(c.scan(nil, 12, read))
+	a.Equal([]int64{10, 11}, out)
+}
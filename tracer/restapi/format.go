@@ -0,0 +1,165 @@
+package restapi
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net/url"
+	"time"
+
+	"github.com/yuuki0xff/goapptrace/tracer/sql"
+	"github.com/yuuki0xff/goapptrace/tracer/util"
+)
+
+// parseSearchParams は、URLパラメータから検索結果の出力方法を取得する。
+// format パラメータが省略された場合は def 形式になる。
+// formats 以外の形式が指定された場合はエラーを返す。
+func parseSearchParams(q url.Values, def SearchFormat, formats ...SearchFormat) (p SearchParams, err error) {
+	format := q.Get("format")
+	if format == "" {
+		format = string(def)
+	}
+	if err = p.Format.Parse(format); err != nil {
+		return
+	}
+	if err = p.Datetime.Parse(q.Get("datetime")); err != nil {
+		return
+	}
+	if timeout := q.Get("timeout"); timeout != "" {
+		p.Timeout, err = time.ParseDuration(timeout)
+		if err != nil || p.Timeout <= 0 {
+			err = fmt.Errorf("invalid timeout: %s", timeout)
+			return
+		}
+	}
+	for _, f := range formats {
+		if p.Format == f {
+			return
+		}
+	}
+	err = fmt.Errorf("%s format is not supported by this API", p.Format)
+	return
+}
+
+// resultWriter は、SQLクエリの結果を SearchParams で指定した形式で書き出す。
+type resultWriter struct {
+	w       io.Writer
+	format  SearchFormat
+	names   []string
+	printer sql.SqlFieldPrinter
+	line    []byte
+	// 書き出した行数
+	rows int64
+}
+
+// newResultWriter は、fields の値を1行として書き出す resultWriter を返す。
+// names は列名であり、fields と同じ長さでなければならない。
+// 列の型がサポートされていない場合や、列を取得できない場合はエラーを返す。
+func newResultWriter(w io.Writer, p SearchParams, names []string, fields func() sql.SqlFieldGetters) (rw *resultWriter, err error) {
+	rw = &resultWriter{
+		w:      w,
+		format: p.Format,
+		names:  names,
+		line:   make([]byte, 1<<20), // 1MiB
+	}
+	outFormat := sql.JsonFormat
+	if p.Datetime == RFC3339DatetimeFormat {
+		outFormat = sql.JsonRFC3339Format
+	}
+	err = util.PanicHandler(func() {
+		switch p.Format {
+		case CsvFormat:
+			rw.printer = fields().Printer(sql.CsvFormat)
+		case JsonFormat, JsonArrayFormat:
+			rw.printer = fields().ObjectPrinter(names, outFormat)
+		default:
+			panic(fmt.Errorf("%s format is not supported", p.Format))
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return rw, nil
+}
+
+// rowsWriter は、rows の各要素を文字列の列として書き出す resultWriter を返す。
+// 戻り値の関数は、i 番目の要素を書き出す。
+func rowsWriter(w io.Writer, p SearchParams, names []string, rows [][]string) (*resultWriter, func(i int) error, error) {
+	var cur []string
+	fields := make(sql.SqlFieldGetters, len(names))
+	for i := range fields {
+		i := i
+		fields[i] = func() sql.SqlAny { return sql.SqlString(cur[i]) }
+	}
+	rw, err := newResultWriter(w, p, names, func() sql.SqlFieldGetters { return fields })
+	if err != nil {
+		return nil, nil, err
+	}
+	return rw, func(i int) error {
+		cur = rows[i]
+		return rw.WriteRow()
+	}, nil
+}
+
+// ContentType returns the MIME type of the output.
+func (rw *resultWriter) ContentType() string {
+	switch rw.format {
+	case CsvFormat:
+		return "text/csv"
+	case JsonArrayFormat:
+		return "application/json"
+	default:
+		return "application/x-jsonlines"
+	}
+}
+
+// WriteHeader は、CSV形式ならヘッダを、JSONの配列なら配列の開始を書き出す。
+func (rw *resultWriter) WriteHeader() error {
+	switch rw.format {
+	case CsvFormat:
+		// 式の列名は、カンマを含むことがある。
+		w := csv.NewWriter(rw.w)
+		if err := w.Write(rw.names); err != nil {
+			return err
+		}
+		w.Flush()
+		return w.Error()
+	case JsonArrayFormat:
+		_, err := io.WriteString(rw.w, "[")
+		return err
+	default:
+		return nil
+	}
+}
+
+// WriteRow は、現在の行を書き出す。
+func (rw *resultWriter) WriteRow() error {
+	line := rw.line
+	var n int64
+	if rw.format == JsonArrayFormat {
+		if rw.rows > 0 {
+			line[n] = ','
+			n++
+		}
+		line[n] = '\n'
+		n++
+	}
+	n += rw.printer(line[n:])
+	if rw.format != JsonArrayFormat {
+		line[n] = '\n'
+		n++
+	}
+	rw.rows++
+	_, err := rw.w.Write(line[:n])
+	return err
+}
+
+// WriteFooter は、JSONの配列なら配列の終了を書き出す。
+// 全ての行を書き出した後に呼び出さなければならない。
+func (rw *resultWriter) WriteFooter() error {
+	if rw.format != JsonArrayFormat {
+		return nil
+	}
+	_, err := io.WriteString(rw.w, "\n]\n")
+	return err
+}
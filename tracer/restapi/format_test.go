@@ -0,0 +1,97 @@
+package restapi
+
+import (
+	"bytes"
+	"io"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yuuki0xff/goapptrace/tracer/sql"
+	"github.com/yuuki0xff/goapptrace/tracer/types"
+)
+
+func TestParseSearchParams(t *testing.T) {
+	a := assert.New(t)
+	p, err := parseSearchParams(url.Values{}, JsonFormat, JsonFormat, JsonArrayFormat)
+	a.NoError(err)
+	a.Equal(SearchParams{Format: JsonFormat, Datetime: NsDatetimeFormat}, p)
+
+	p, err = parseSearchParams(url.Values{
+		"format":   {"json-array"},
+		"datetime": {"rfc3339"},
+	}, JsonFormat, JsonFormat, JsonArrayFormat)
+	a.NoError(err)
+	a.Equal(SearchParams{Format: JsonArrayFormat, Datetime: RFC3339DatetimeFormat}, p)
+
+	_, err = parseSearchParams(url.Values{"format": {"csv"}}, JsonFormat, JsonFormat, JsonArrayFormat)
+	a.Error(err)
+	_, err = parseSearchParams(url.Values{"format": {"xml"}}, CsvFormat, CsvFormat)
+	a.Error(err)
+	_, err = parseSearchParams(url.Values{"datetime": {"unix"}}, CsvFormat, CsvFormat)
+	a.Error(err)
+}
+
+func TestResultWriter(t *testing.T) {
+	sel, err := sql.ParseSelect("SELECT gid, endtime, running FROM goroutines")
+	if !assert.NoError(t, err) {
+		return
+	}
+	row := &sql.SqlGoroutineRow{}
+	newWriter := func(w io.Writer, format SearchFormat) (*resultWriter, error) {
+		return newResultWriter(w, SearchParams{Format: format}, sel.ColNames(), func() sql.SqlFieldGetters {
+			return row.Fields(sel.Cols())
+		})
+	}
+
+	t.Run("csv", func(t *testing.T) {
+		a := assert.New(t)
+		var buf bytes.Buffer
+		fw, err := newWriter(&buf, CsvFormat)
+		if !a.NoError(err) {
+			return
+		}
+		a.Equal("text/csv", fw.ContentType())
+		a.NoError(fw.WriteHeader())
+		row.Goroutine = types.Goroutine{GID: 1, EndTime: 10}
+		a.NoError(fw.WriteRow())
+		a.Equal("gid,endtime,running\n1,"+types.Time(10).UnixTime().String()+",false\n", buf.String())
+	})
+	t.Run("json", func(t *testing.T) {
+		a := assert.New(t)
+		var buf bytes.Buffer
+		fw, err := newWriter(&buf, JsonFormat)
+		if !a.NoError(err) {
+			return
+		}
+		a.Equal("application/x-jsonlines", fw.ContentType())
+		a.NoError(fw.WriteHeader())
+		row.Goroutine = types.Goroutine{GID: 1, EndTime: 10}
+		a.NoError(fw.WriteRow())
+		row.Goroutine = types.Goroutine{GID: 2, EndTime: types.NotEnded}
+		a.NoError(fw.WriteRow())
+		a.Equal(`{"gid":1,"endtime":10,"running":false}`+"\n"+
+			`{"gid":2,"endtime":-1,"running":true}`+"\n", buf.String())
+	})
+	t.Run("json-array", func(t *testing.T) {
+		a := assert.New(t)
+		var buf bytes.Buffer
+		fw, err := newWriter(&buf, JsonArrayFormat)
+		if !a.NoError(err) {
+			return
+		}
+		a.Equal("application/json", fw.ContentType())
+		a.NoError(fw.WriteHeader())
+		row.Goroutine = types.Goroutine{GID: 1, EndTime: 10}
+		a.NoError(fw.WriteRow())
+		row.Goroutine = types.Goroutine{GID: 2, EndTime: 20}
+		a.NoError(fw.WriteRow())
+		a.NoError(fw.WriteFooter())
+		a.Equal("[\n"+`{"gid":1,"endtime":10,"running":false}`+",\n"+
+			`{"gid":2,"endtime":20,"running":false}`+"\n]\n", buf.String())
+	})
+	t.Run("unsupported", func(t *testing.T) {
+		_, err := newWriter(&bytes.Buffer{}, "xml")
+		assert.Error(t, err)
+	})
+}
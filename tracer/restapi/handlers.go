@@ -3,6 +3,7 @@ package restapi
 import (
 	"container/heap"
 	"context"
+	"encoding/csv"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -12,7 +13,6 @@ import (
 	"os"
 	"sort"
 	"strconv"
-	"strings"
 	"time"
 
 	"github.com/gorilla/mux"
@@ -41,12 +41,17 @@ type RouterArgs struct {
 	Config         *config.Config
 	Storage        *storage.Storage
 	SimulatorStore *simulator.StateSimulatorStore
+	// SQLクエリが使用できる資源の上限。
+	QueryLimits QueryLimits
 }
 
 // Goapptrace REST API v0.xのハンドラを提供する
 type APIv0 struct {
 	RouterArgs
 	Logger *log.Logger
+
+	// 実行中のSQLクエリ。
+	queries *queryManager
 }
 
 // APIのレスポンスの生成を支援するworker。
@@ -61,6 +66,8 @@ type APIWorker struct {
 
 	group *errgroup.Group
 	ctx   context.Context
+	// ワーカーが実行するクエリ。
+	query *query
 }
 
 type FuncLogAPIWorker struct {
@@ -99,6 +106,7 @@ func NewRouter(args RouterArgs) *mux.Router {
 	apiv0 := APIv0{
 		RouterArgs: args,
 		Logger:     log.New(os.Stdout, "[REST API] ", 0),
+		queries:    newQueryManager(),
 	}
 	apiv0.SetHandlers(router)
 	return router
@@ -115,7 +123,13 @@ func (api APIv0) SetHandlers(router *mux.Router) {
 			"version", "{version:[0-9]+}",
 			"timeout", "{timeout:[0-9]+}",
 		)
-	v01.HandleFunc("/log/{log-id}/search.csv", api.search)
+	v01.HandleFunc("/log/{log-id}/search.csv", func(w http.ResponseWriter, r *http.Request) {
+		api.search(w, r, CsvFormat)
+	})
+	v01.HandleFunc("/log/{log-id}/search.json", func(w http.ResponseWriter, r *http.Request) {
+		api.search(w, r, JsonFormat, JsonArrayFormat)
+	})
+	v01.HandleFunc("/log/{log-id}/search/follow", api.searchFollow).Methods(http.MethodGet)
 
 	v01.HandleFunc("/log/{log-id}/func-call/search", func(w http.ResponseWriter, r *http.Request) {
 		api.funcCallSearch(w, r, "json")
@@ -123,12 +137,26 @@ func (api APIv0) SetHandlers(router *mux.Router) {
 	v01.HandleFunc("/log/{log-id}/func-call/search.csv", func(w http.ResponseWriter, r *http.Request) {
 		api.funcCallSearch(w, r, "csv")
 	}).Methods(http.MethodGet)
-	v01.HandleFunc("/log/{log-id}/func-call/stream", api.notImpl).Methods(http.MethodGet)
+	v01.HandleFunc("/log/{log-id}/func-call/stream", api.funcCallStream).Methods(http.MethodGet)
+	v01.HandleFunc("/log/{log-id}/func-call/{func-log-id:[0-9]+}/children", api.funcCallChildren).Methods(http.MethodGet)
+	v01.HandleFunc("/log/{log-id}/func-call/{func-log-id:[0-9]+}/ancestors", api.funcCallAncestors).Methods(http.MethodGet)
+	v01.HandleFunc("/log/{log-id}/func-call/{func-log-id:[0-9]+}/tree", api.funcCallTree).Methods(http.MethodGet)
 	v01.HandleFunc("/log/{log-id}/goroutines/search", api.goroutineSearch).Methods(http.MethodGet)
+	v01.HandleFunc("/log/{log-id}/flamegraph", api.flameGraph).Methods(http.MethodGet)
+	v01.HandleFunc("/log/{log-id}/running", api.running).Methods(http.MethodGet)
+	v01.HandleFunc("/log/{log-id}/leaks", api.leaks).Methods(http.MethodGet)
+	v01.HandleFunc("/log/{log-id}/events", api.events).Methods(http.MethodGet)
+	v01.HandleFunc("/log/{log-id}/stats/funcs", api.funcStats).Methods(http.MethodGet)
 	v01.HandleFunc("/log/{log-id}/symbols", api.symbols).Methods(http.MethodGet)
 	v01.HandleFunc("/log/{log-id}/symbol/module/{pc}", api.goModule).Methods(http.MethodGet)
 	v01.HandleFunc("/log/{log-id}/symbol/func/{pc}", api.goFunc).Methods(http.MethodGet)
 	v01.HandleFunc("/log/{log-id}/symbol/line/{pc}", api.goLine).Methods(http.MethodGet)
+	v01.HandleFunc("/views", api.views).Methods(http.MethodGet)
+	v01.HandleFunc("/view/{app-name}/{name}", api.view).Methods(http.MethodGet)
+	v01.HandleFunc("/view/{app-name}/{name}", api.view).Methods(http.MethodPut)
+	v01.HandleFunc("/view/{app-name}/{name}", api.view).Methods(http.MethodDelete)
+	v01.HandleFunc("/queries", api.runningQueries).Methods(http.MethodGet)
+	v01.HandleFunc("/query/{query-id}", api.killQuery).Methods(http.MethodDelete)
 }
 func (api APIv0) serverError(w http.ResponseWriter, err error, msg string) {
 	api.Logger.Println(errors.Wrap(err, "failed to json.Marshal").Error())
@@ -151,6 +179,22 @@ func (api APIv0) writeObj(w http.ResponseWriter, obj interface{}) {
 
 // TODO: テストを書く
 func (api APIv0) logs(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	var p SearchLogsParams
+	invalidParamName, err := p.FromString(
+		q.Get("label"),
+		q.Get("app-name"),
+		q.Get("host"),
+		q.Get("min-timestamp"),
+		q.Get("max-timestamp"),
+		q.Get("sort"),
+		q.Get("order"),
+	)
+	if err != nil {
+		http.Error(w, "invalid "+invalidParamName, http.StatusBadRequest)
+		return
+	}
+
 	var res Logs
 	logs, err := api.Storage.Logs()
 	if err != nil {
@@ -159,8 +203,12 @@ func (api APIv0) logs(w http.ResponseWriter, r *http.Request) {
 	}
 
 	for _, l := range logs {
-		res.Logs = append(res.Logs, l.LogInfo())
+		info := l.LogInfo()
+		if p.Match(info) {
+			res.Logs = append(res.Logs, info)
+		}
 	}
+	p.Sort(res.Logs)
 
 	js, err := json.Marshal(res)
 	if err != nil {
@@ -264,139 +312,465 @@ func (api APIv0) logWatch(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func (api APIv0) search(w http.ResponseWriter, r *http.Request) {
+// search は、SQLクエリを実行して、結果を formats のいずれかの形式で返す。
+// format パラメータを省略した場合は、formats[0] の形式で返す。
+func (api APIv0) search(w http.ResponseWriter, r *http.Request, formats ...SearchFormat) {
 	logobj, ok := api.getLog(w, r)
 	if !ok {
 		return
 	}
 
-	query := r.URL.Query().Get("sql")
+	q := r.URL.Query()
+	query := q.Get("sql")
 	if query == "" {
 		http.Error(w, "missing \"sql\" parameter", http.StatusBadRequest)
 		return
 	}
+	p, err := parseSearchParams(q, formats[0], formats...)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	sel, explain, err := sql.ParseQueryWithViews(query, api.logViews(logobj))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if explain {
+		api.explain(w, logobj, sel, p)
+		return
+	}
+	qry := api.startQuery(r, logobj, query, p.Timeout)
+	defer qry.done()
+	if sel.From() == "calls" && !sel.Grouped() && !sel.Joined() {
+		// ORDER BY句とLIMIT句は、ヒープを使ったワーカーで処理する。
+		api.funcCallSearchBySelect(w, logobj, sel, p, qry)
+		return
+	}
+
+	tables, err := api.snapshotTables(logobj, sel.TableNames(), qry)
+	if err != nil {
+		api.serverError(w, err, "failed to create a snapshot")
+		return
+	}
+	src, err := sel.Open(tables.open)
+	if err != nil {
+		queryError(w, badQuery(err), false)
+		return
+	}
+	searchRows(w, sel, src, p, qry)
+}
+
+// searchFollow は、continuous query を実行する。
+// クエリの開始時点で条件を満たす行を出力した後、ログに追加された行のうち条件を満たすものを順次出力する。
+// 新しい行は、Log.Watch() の通知を受け取る度に読み出す。
+// 実行中の関数呼び出しとgoroutineは、値が確定するまで出力を保留し、終了した後で出力する。
+// クライアントが切断するか、ログが閉じられるまでレスポンスを返し続ける。
+func (api APIv0) searchFollow(w http.ResponseWriter, r *http.Request) {
+	logobj, ok := api.getLog(w, r)
+	if !ok {
+		return
+	}
 
-	sel, err := sql.ParseSelect(query)
+	q := r.URL.Query()
+	query := q.Get("sql")
+	if query == "" {
+		http.Error(w, "missing \"sql\" parameter", http.StatusBadRequest)
+		return
+	}
+	p, err := parseSearchParams(q, CsvFormat, CsvFormat, JsonFormat)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	sel, err := sql.ParseSelectWithViews(query, api.logViews(logobj))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := sel.CheckFollow(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+
+	// read は、スナップショットからIDがidのレコードを row に読み出す。
+	// レコードが終了していれば、endedはtrueになる。
+	var row sql.SqlRow
+	var read func(snapshot *storage.LogSnapshot, id int64) (ended bool, err error)
+	switch sel.From() {
+	case "calls":
+		fr := &sql.SqlFuncLogRow{
+			FuncLog: &types.FuncLog{},
+			Symbols: logobj.Symbols(),
+			LogTime: logTime(logobj),
+		}
+		row = fr
+		read = func(snapshot *storage.LogSnapshot, id int64) (bool, error) {
+			if err := snapshot.FuncLog(types.FuncLogID(id), fr.FuncLog); err != nil {
+				return false, err
+			}
+			return fr.FuncLog.IsEnded(), nil
+		}
+	case "goroutines":
+		gr := &sql.SqlGoroutineRow{LogTime: logTime(logobj)}
+		row = gr
+		read = func(snapshot *storage.LogSnapshot, id int64) (bool, error) {
+			if err := snapshot.Goroutine(types.GID(id), &gr.Goroutine); err != nil {
+				return false, err
+			}
+			return gr.Goroutine.EndTime != types.NotEnded, nil
+		}
+	}
 
 	where := sel.Where()
 	if where == nil {
 		where = sql.SqlBool(true)
 	}
-	limitOffset, limitRows := sel.Limit()
+	fw, err := newResultWriter(w, p, sel.ColNames(), func() sql.SqlFieldGetters {
+		return row.Fields(sel.Cols())
+	})
+	if err == nil {
+		err = util.PanicHandler(func() {
+			where.WithRow(row)
+		})
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
-	// write a header
-	writeHeader := func() error {
-		_, err := w.Write([]byte(strings.Join(sel.ColNames(), ",") + "\n"))
-		return err
+	// continuous query は終了しないため、サーバに設定された資源の上限は適用しない。
+	// 管理者による中止と、クライアントが指定した実行時間の上限のみに従う。
+	qry := api.queries.start(r, logobj.ID, query, QueryLimits{Timeout: p.Timeout})
+	defer qry.done()
+
+	// 通知を見逃さないように、最初のスキャンよりも先にコールバック関数を登録する。
+	ctx := qry.ctx
+	notify := make(chan struct{}, 1)
+	go logobj.Watch(ctx, func(info *types.LogInfo) {
+		select {
+		case notify <- struct{}{}:
+		default:
+			// 前回の通知をまだ処理していない。
+		}
+	})
+
+	w.Header().Set("Content-Type", fw.ContentType())
+	declareQueryTrailer(w)
+	if err := fw.WriteHeader(); err != nil {
+		api.Logger.Println(errors.Wrap(err, "write error"))
+		return
 	}
+	flusher.Flush()
 
-	switch sel.From() {
-	case "calls":
-		fallthrough
-	case "frames":
-		// build the send()
-		row := sql.SqlFuncLogRow{
+	var cursor followCursor
+	for first := true; ; first = false {
+		snapshot, err := logobj.Snapshot()
+		if err != nil {
+			// ログが閉じられたため、これ以上行は追加されない。
+			return
+		}
+		var ids func() (int64, bool)
+		var end int64
+		switch sel.From() {
+		case "calls":
+			end = snapshot.FuncLogRecords()
+			if first {
+				// 最初のスキャンでは、WHERE句を満たす可能性のあるレコードのみを読み出す。
+				// IDと開始時刻は変化しないため、除外したレコードが後から条件を満たすことはない。
+				next := funcLogPlan(logobj, snapshot, "calls", sel, true).Iterator()
+				ids = func() (int64, bool) {
+					id, ok := next()
+					return int64(id), ok
+				}
+			}
+		case "goroutines":
+			end = snapshot.GoroutineRecords()
+		}
+
+		var scanErr error
+		err = util.PanicHandler(func() {
+			scanErr = cursor.scan(ids, end, func(id int64) (bool, error) {
+				if err := qry.scan(); err != nil {
+					return false, err
+				}
+				ended, err := read(snapshot, id)
+				if err != nil || !ended {
+					return ended, err
+				}
+				if where.Bool() {
+					return true, fw.WriteRow()
+				}
+				return true, nil
+			})
+		})
+		if err == nil {
+			err = scanErr
+		}
+		if err != nil {
+			queryError(w, err, true)
+			api.Logger.Println(errors.Wrap(err, "searchFollow"))
+			return
+		}
+		flusher.Flush()
+
+		select {
+		case <-ctx.Done():
+			queryError(w, qry.Err(), true)
+			return
+		case <-notify:
+		}
+	}
+}
+
+// errFuncStatsNotAvailable は、関数の統計情報を持たないログの funcstats テーブルまたは calledges テーブルを開こうとしたときに返される。
+var errFuncStatsNotAvailable = errors.New("function statistics are not available")
+
+// explain は、クエリの実行計画を p で指定した形式で返す。
+func (api APIv0) explain(w http.ResponseWriter, logobj *storage.Log, sel *sql.SelectParser, p SearchParams) {
+	tables, err := api.snapshotTables(logobj, nil, nil)
+	if err != nil {
+		api.serverError(w, err, "failed to create a snapshot")
+		return
+	}
+	var rows []sql.ExplainRow
+	err = util.PanicHandler(func() {
+		rows = sel.Explain(tables.plan)
+	})
+	if err != nil {
+		api.serverError(w, err, "failed to create a query plan")
+		return
+	}
+
+	if p.Format == CsvFormat {
+		cw := csv.NewWriter(w)
+		cw.Write(sql.ExplainColumns) // nolint: errcheck
+		for _, row := range rows {
+			cw.Write(row.Strings()) // nolint: errcheck
+		}
+		cw.Flush()
+		if err := cw.Error(); err != nil {
+			log.Println(errors.Wrap(err, "write error"))
+		}
+		return
+	}
+
+	strs := make([][]string, len(rows))
+	for i := range rows {
+		strs[i] = rows[i].Strings()
+	}
+	rw, writeRow, err := rowsWriter(w, p, sql.ExplainColumns, strs)
+	if err != nil {
+		api.serverError(w, err, "failed to write a query plan")
+		return
+	}
+	w.Header().Set("Content-Type", rw.ContentType())
+	err = rw.WriteHeader()
+	for i := 0; err == nil && i < len(strs); i++ {
+		err = writeRow(i)
+	}
+	if err == nil {
+		err = rw.WriteFooter()
+	}
+	if err != nil {
+		log.Println(errors.Wrap(err, "write error"))
+	}
+}
+
+// snapshotTables は、同じスナップショットからログのテーブルを読み出す。
+type snapshotTables struct {
+	logobj   *storage.Log
+	snapshot *storage.LogSnapshot
+	// 書き込み中のログであればtrue。
+	live bool
+	// まだファイルに書き出されていないレコード。
+	simFuncLogs   []*types.FuncLog
+	simGoroutines []*types.Goroutine
+	// ログに記録されている期間。
+	logTime *sql.LogTime
+	// テーブルを読み出すクエリ。読み出した行数を数え、上限を超えたら読み出しを中止する。
+	query *query
+}
+
+// snapshotTables は、logobj のテーブルを読み出す snapshotTables を返す。
+// tables には、クエリで使用する全てのテーブル名を指定する。
+// 書き込み処理をブロックしないように、全てのテーブルは同じスナップショットから読み出す。
+// q がnilでなければ、テーブルから行を読み出すたびに q.scan() を呼び出す。
+func (api APIv0) snapshotTables(logobj *storage.Log, tables []string, q *query) (*snapshotTables, error) {
+	// 書き込み中のログであれば、まだファイルに書き出されていないレコードをシミュレータから読み出す。
+	// スナップショットとの間でレコードが欠けないように、スナップショットよりも先にコピーする。
+	ss := api.SimulatorStore.Get(logobj.ID)
+	t := &snapshotTables{
+		logobj:  logobj,
+		live:    ss != nil,
+		logTime: logTime(logobj),
+		query:   q,
+	}
+	for _, table := range tables {
+		switch table {
+		case "calls", "frames":
+			if t.simFuncLogs == nil {
+				t.simFuncLogs = simulatorFuncLogs(ss)
+			}
+		case "goroutines":
+			t.simGoroutines = simulatorGoroutines(ss)
+		}
+	}
+
+	var err error
+	t.snapshot, err = logobj.Snapshot()
+	if err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// plan は、table テーブルを読み出すプランを返す。sql.PlanFunc として使用する。
+func (t *snapshotTables) plan(table string, sel *sql.SelectParser) *sql.Plan {
+	switch table {
+	case "calls", "frames":
+		return funcLogPlan(t.logobj, t.snapshot, table, sel, t.live)
+	case "goroutines":
+		return sql.FullScanPlan(table, t.snapshot.GoroutineRecords())
+	case "funcs", "modules":
+		var n int
+		t.logobj.Symbols().Save(func(data types.SymbolsData) error { // nolint: errcheck
+			if table == "funcs" {
+				n = len(data.Funcs)
+			} else {
+				n = len(data.Mods)
+			}
+			return nil
+		})
+		return sql.FullScanPlan(table, int64(n))
+	case "funcstats":
+		stats, _ := t.logobj.FuncStats()
+		return sql.FullScanPlan(table, int64(len(stats)))
+	case "calledges":
+		edges, _ := t.logobj.CallEdges()
+		return sql.FullScanPlan(table, int64(len(edges)))
+	default:
+		log.Panicf("bug: tableName=%s", table)
+		return nil
+	}
+}
+
+// open は、スナップショットから table テーブルの行を読み出す sql.Source を返す。sql.OpenFunc として使用する。
+// sel がnilでなければ、WHERE句とセカンダリインデックスを使って読み出す行を絞り込む。
+func (t *snapshotTables) open(table string, sel *sql.SelectParser) (sql.Source, error) {
+	logobj, snapshot := t.logobj, t.snapshot
+	var src sql.Source
+	switch table {
+	case "calls", "frames":
+		row := &sql.SqlFuncLogRow{
 			FuncLog: types.FuncLogPool.Get().(*types.FuncLog),
 			Symbols: logobj.Symbols(),
+			LogTime: t.logTime,
 		}
-		printer := row.Fields(sel.Cols()).Printer(sql.CsvFormat)
-		line := make([]byte, 64<<10) // 64KiB
-		id := int64(-1)
 		offset := -1
+		live := newLiveFuncLogs(t.simFuncLogs, snapshot.FuncLogRecords())
+		// スナップショットに含まれないレコードのうち、次に読み出すレコードのインデックス。
+		liveIdx := 0
+
+		// nextID は、次に読み出すスナップショット上のレコードのIDを返す。
+		// プランに従って、条件を満たす可能性のあるレコードのみを返す。
+		// JOINするテーブル (sel == nil) は、全ての行を読み出す。
+		nextID := funcLogPlan(logobj, snapshot, table, sel, t.live).Iterator()
+		// readNext は、次のレコードを row.FuncLog に読み出す。
+		// スナップショットのレコードを読み終えたら、シミュレータのみが保持しているレコードを読み出す。
+		// これらはインデックスに含まれていないため、全て読み出す。
+		readNext := func() error {
+			if next, ok := nextID(); ok {
+				if err := snapshot.FuncLog(next, row.FuncLog); err != nil {
+					return err
+				}
+				live.overlay(row.FuncLog)
+				return nil
+			}
+			if len(live.added) <= liveIdx {
+				return io.EOF
+			}
+			copyFuncLog(row.FuncLog, live.added[liveIdx])
+			liveIdx++
+			return nil
+		}
 
-		res := csvResponse{
-			SetUpRow: func() error {
-				return util.PanicHandler(func() {
-					where.WithRow(&row)
-				})
+		src = sql.Source{
+			Row:  row,
+			Read: readNext,
+			NewRow: func() sql.SqlRow {
+				return &sql.SqlFuncLogRow{Symbols: logobj.Symbols(), LogTime: t.logTime}
 			},
-			WriteHeader: writeHeader,
-			Read: func() (err error) {
-				logobj.FuncLog(func(store *storage.FuncLogStore) {
-					id++
-					if store.Records() <= id {
-						err = io.EOF
-						return
-					}
-					err = store.GetNolock(types.FuncLogID(id), row.FuncLog)
-				})
-				return
+			Save: func() interface{} {
+				fl := types.FuncLogPool.Get().(*types.FuncLog)
+				copyFuncLog(fl, row.FuncLog)
+				return &sortedFrame{FuncLog: fl, Offset: offset}
 			},
-			Where: where.Bool,
-			Send: func() error {
-				n := printer(line)
-				line[n] = '\n'
-				_, err := w.Write(line[:n+1])
-				return err
+			Load: func(dst sql.SqlRow, v interface{}) {
+				f := v.(*sortedFrame)
+				dst.(*sql.SqlFuncLogRow).FuncLog = f.FuncLog
+				dst.SetOffset(f.Offset)
 			},
-			Offset: limitOffset,
-			Rows:   limitRows,
-		}
-		if sel.From() == "frames" {
-			res.Read = func() (err error) {
-				logobj.FuncLog(func(store *storage.FuncLogStore) {
-					if offset+1 < len(row.FuncLog.Frames) && offset >= 0 {
-						offset++
-					} else {
-						id++
-						offset = 0
-						if store.Records() <= id {
-							err = io.EOF
-							return
-						}
-						err = store.GetNolock(types.FuncLogID(id), row.FuncLog)
+		}
+		if table == "frames" {
+			src.Read = func() error {
+				if offset+1 < len(row.FuncLog.Frames) && offset >= 0 {
+					offset++
+				} else {
+					offset = 0
+					if err := readNext(); err != nil {
+						return err
 					}
-					row.SetOffset(offset)
-				})
-				return
+				}
+				row.SetOffset(offset)
+				return nil
 			}
 		}
-		res.Run(w)
 	case "goroutines":
-		var row sql.SqlGoroutineRow
-		printer := row.Fields(sel.Cols()).Printer(sql.CsvFormat)
-		line := make([]byte, 64<<10) // 64KiB
+		row := &sql.SqlGoroutineRow{LogTime: t.logTime}
 		gid := int64(0)
-
-		res := csvResponse{
-			SetUpRow: func() error {
-				return util.PanicHandler(func() {
-					where.WithRow(&row)
-				})
-			},
-			WriteHeader: writeHeader,
-			Read: func() (err error) {
-				logobj.Goroutine(func(store *storage.GoroutineStore) {
-					if store.Records() <= gid {
-						err = io.EOF
-						return
+		live := newLiveGoroutines(t.simGoroutines, snapshot.GoroutineRecords())
+		liveIdx := 0
+
+		src = sql.Source{
+			Row: row,
+			Read: func() error {
+				if snapshot.GoroutineRecords() <= gid {
+					if len(live.added) <= liveIdx {
+						return io.EOF
 					}
-					err = store.GetNolock(types.GID(gid), &row.Goroutine)
-					gid++
-				})
-				return
+					row.Goroutine = *live.added[liveIdx]
+					liveIdx++
+					return nil
+				}
+				if err := snapshot.Goroutine(types.GID(gid), &row.Goroutine); err != nil {
+					return err
+				}
+				live.overlay(&row.Goroutine)
+				gid++
+				return nil
 			},
-			Where: where.Bool,
-			Send: func() error {
-				n := printer(line)
-				line[n] = '\n'
-				_, err := w.Write(line[:n+1])
-				return err
+			NewRow: func() sql.SqlRow {
+				return &sql.SqlGoroutineRow{LogTime: t.logTime}
+			},
+			Save: func() interface{} {
+				g := row.Goroutine
+				return &g
+			},
+			Load: func(dst sql.SqlRow, v interface{}) {
+				dst.(*sql.SqlGoroutineRow).Goroutine = *v.(*types.Goroutine)
 			},
-			Offset: limitOffset,
-			Rows:   limitRows,
 		}
-		res.Run(w)
 	case "funcs":
-		row := sql.SqlGoFuncRow{
+		row := &sql.SqlGoFuncRow{
 			Symbols: logobj.Symbols(),
 		}
-		printer := row.Fields(sel.Cols()).Printer(sql.CsvFormat)
-		line := make([]byte, 1<<20) // 1MiB
 		var funcs []types.GoFunc
 		i := 0
 
@@ -406,17 +780,11 @@ func (api APIv0) search(w http.ResponseWriter, r *http.Request) {
 			return nil
 		})
 		if err != nil {
-			api.serverError(w, err, "symbols save error")
-			return
+			return src, errors.Wrap(err, "symbols save error")
 		}
 
-		res := csvResponse{
-			SetUpRow: func() error {
-				return util.PanicHandler(func() {
-					where.WithRow(&row)
-				})
-			},
-			WriteHeader: writeHeader,
+		src = sql.Source{
+			Row: row,
 			Read: func() (err error) {
 				if len(funcs) <= i {
 					return io.EOF
@@ -425,22 +793,18 @@ func (api APIv0) search(w http.ResponseWriter, r *http.Request) {
 				i++
 				return
 			},
-			Where: where.Bool,
-			Send: func() error {
-				n := printer(line)
-				line[n] = '\n'
-				_, err := w.Write(line[:n+1])
-				return err
+			NewRow: func() sql.SqlRow {
+				return &sql.SqlGoFuncRow{Symbols: logobj.Symbols()}
+			},
+			Save: func() interface{} {
+				return row.GoFunc
+			},
+			Load: func(dst sql.SqlRow, v interface{}) {
+				dst.(*sql.SqlGoFuncRow).GoFunc = v.(*types.GoFunc)
 			},
-			Offset: limitOffset,
-			Rows:   limitRows,
 		}
-		res.Run(w)
 	case "modules":
-		var row sql.SqlGoModuleRow
-		printer := row.Fields(sel.Cols()).Printer(sql.CsvFormat)
-		line := make([]byte, 64<<10) // 64KiB
-
+		row := &sql.SqlGoModuleRow{}
 		var mods []types.GoModule
 		i := 0
 
@@ -450,17 +814,11 @@ func (api APIv0) search(w http.ResponseWriter, r *http.Request) {
 			return nil
 		})
 		if err != nil {
-			api.serverError(w, err, "symbols save error")
-			return
+			return src, errors.Wrap(err, "symbols save error")
 		}
 
-		res := csvResponse{
-			SetUpRow: func() error {
-				return util.PanicHandler(func() {
-					where.WithRow(&row)
-				})
-			},
-			WriteHeader: writeHeader,
+		src = sql.Source{
+			Row: row,
 			Read: func() (err error) {
 				if len(mods) <= i {
 					return io.EOF
@@ -469,20 +827,133 @@ func (api APIv0) search(w http.ResponseWriter, r *http.Request) {
 				i++
 				return
 			},
-			Where: where.Bool,
-			Send: func() error {
-				n := printer(line)
-				line[n] = '\n'
-				_, err := w.Write(line[:n+1])
-				return err
+			NewRow: func() sql.SqlRow {
+				return &sql.SqlGoModuleRow{}
+			},
+			Save: func() interface{} {
+				return row.GoModule
+			},
+			Load: func(dst sql.SqlRow, v interface{}) {
+				dst.(*sql.SqlGoModuleRow).GoModule = v.(*types.GoModule)
+			},
+		}
+	case "funcstats":
+		row := &sql.SqlFuncStatsRow{Symbols: logobj.Symbols()}
+		i := 0
+
+		stats, ok := logobj.FuncStats()
+		if !ok {
+			return src, errFuncStatsNotAvailable
+		}
+
+		src = sql.Source{
+			Row: row,
+			Read: func() (err error) {
+				if len(stats) <= i {
+					return io.EOF
+				}
+				row.FuncStats = &stats[i]
+				i++
+				return
+			},
+			NewRow: func() sql.SqlRow {
+				return &sql.SqlFuncStatsRow{Symbols: logobj.Symbols()}
+			},
+			Save: func() interface{} {
+				return row.FuncStats
+			},
+			Load: func(dst sql.SqlRow, v interface{}) {
+				dst.(*sql.SqlFuncStatsRow).FuncStats = v.(*types.FuncStats)
+			},
+		}
+	case "calledges":
+		row := &sql.SqlCallEdgeRow{Symbols: logobj.Symbols()}
+		i := 0
+
+		edges, ok := logobj.CallEdges()
+		if !ok {
+			return src, errFuncStatsNotAvailable
+		}
+
+		src = sql.Source{
+			Row: row,
+			Read: func() (err error) {
+				if len(edges) <= i {
+					return io.EOF
+				}
+				row.CallEdge = &edges[i]
+				i++
+				return
+			},
+			NewRow: func() sql.SqlRow {
+				return &sql.SqlCallEdgeRow{Symbols: logobj.Symbols()}
+			},
+			Save: func() interface{} {
+				return row.CallEdge
+			},
+			Load: func(dst sql.SqlRow, v interface{}) {
+				dst.(*sql.SqlCallEdgeRow).CallEdge = v.(*types.CallEdge)
 			},
-			Offset: limitOffset,
-			Rows:   limitRows,
 		}
-		res.Run(w)
 	default:
-		log.Panicf("bug: tableName=%s", sel.From())
+		log.Panicf("bug: tableName=%s", table)
+	}
+	return t.query.wrapSource(src), nil
+}
+
+// searchRows は、src から読み出した行をSELECT文に従って処理し、p で指定した形式で w に書き出す。
+// ソートと集約のためにメモリ上に保持する行数は、q の上限を超えない。
+func searchRows(w http.ResponseWriter, sel *sql.SelectParser, src sql.Source, p SearchParams, q *query) {
+	where := sel.Where()
+	if where == nil {
+		where = sql.SqlBool(true)
+	}
+	limitOffset, limitRows := sel.Limit()
+
+	var rw *resultWriter
+	res := csvResponse{
+		SetUpRow: func() error {
+			return badQuery(util.PanicHandler(func() {
+				where.WithRow(src.Row)
+			}))
+		},
+		WriteHeader: func() error {
+			w.Header().Set("Content-Type", rw.ContentType())
+			declareQueryTrailer(w)
+			return rw.WriteHeader()
+		},
+		WriteFooter: func() error {
+			return rw.WriteFooter()
+		},
+		Read:   src.Read,
+		Where:  where.Bool,
+		Offset: limitOffset,
+		Rows:   limitRows,
+		Query:  q,
+	}
+
+	var row sql.SqlRow
+	var err error
+	if sel.Grouped() {
+		// 集約されたクエリは、グループごとに1行を返す。
+		row, err = res.groupBy(sel, src.Row)
+	} else {
+		row = src.Row
+		err = res.orderBy(sel, src.Row, src.NewRow, src.Save, src.Load)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	rw, err = newResultWriter(w, p, sel.ColNames(), func() sql.SqlFieldGetters {
+		return row.Fields(sel.Cols())
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
 	}
+	res.Send = rw.WriteRow
+	res.Run(w)
 }
 
 // TODO: テストを書く
@@ -503,6 +974,8 @@ func (api APIv0) funcCallSearch(w http.ResponseWriter, r *http.Request, format s
 		q.Get("limit"),
 		q.Get("sort"),
 		q.Get("order"),
+		q.Get("after"),
+		q.Get("before"),
 		q.Get("sql"),
 	)
 	if err != nil {
@@ -511,7 +984,7 @@ func (api APIv0) funcCallSearch(w http.ResponseWriter, r *http.Request, format s
 	}
 
 	if p.Sql != "" {
-		exclusiveParams := []string{"gid", "min-id", "max-id", "min-timestamp", "max-timestamp", "limit", "sort", "order"}
+		exclusiveParams := []string{"gid", "min-id", "max-id", "min-timestamp", "max-timestamp", "limit", "sort", "order", "after", "before"}
 		for _, param := range exclusiveParams {
 			if q.Get(param) != "" {
 				msg := fmt.Sprintf("sql parameter and %s parameter are mutually exclusive", param)
@@ -519,25 +992,70 @@ func (api APIv0) funcCallSearch(w http.ResponseWriter, r *http.Request, format s
 				return
 			}
 		}
-		api.funcCallSearchBySql(w, logobj, p.Sql, format)
+		api.funcCallSearchBySql(w, r, logobj, p.Sql, format)
 	} else {
-		api.funcCallSearchBySimpleParams(w, logobj, p, format)
+		api.funcCallSearchBySimpleParams(w, r, logobj, p, format)
 	}
 }
-func (api APIv0) funcCallSearchBySql(w http.ResponseWriter, logobj *storage.Log, sqlStmt string, format string) {
-	sel, err := sql.ParseSelect(sqlStmt)
+func (api APIv0) funcCallSearchBySql(w http.ResponseWriter, r *http.Request, logobj *storage.Log, sqlStmt string, format string) {
+	sel, err := sql.ParseSelectWithViews(sqlStmt, api.logViews(logobj))
 	if err != nil {
 		http.Error(w, "invalid sql statement\n"+err.Error(), http.StatusBadRequest)
 		return
 	}
-
-	var isFiltered func(fl *types.FuncLog) bool
-	where := sel.Where()
-	if where != nil {
-		row := sql.SqlFuncLogRow{
+	var p SearchParams
+	switch format {
+	case "json":
+		p.Format = funcLogFormat
+	case "csv":
+		p.Format = CsvFormat
+	default:
+		http.Error(w, fmt.Sprintf("%s format is not supported", format), http.StatusBadRequest)
+		return
+	}
+	q := api.startQuery(r, logobj, sqlStmt, 0)
+	defer q.done()
+	api.funcCallSearchBySelect(w, logobj, sel, p, q)
+}
+
+// funcLogFormat は、 funcCallSearchBySelect() で types.FuncLog をそのままJSON形式で返すときに指定する。
+const funcLogFormat SearchFormat = "funclog"
+
+// funcCallSearchBySelect は、calls テーブルを読み出すSELECT文をワーカーで実行する。
+// クエリは q の制限に従い、 q が中止されると実行を終了する。
+func (api APIv0) funcCallSearchBySelect(w http.ResponseWriter, logobj *storage.Log, sel *sql.SelectParser, p SearchParams, q *query) {
+	if sel.Grouped() {
+		// 集計結果は FuncLog として返せない。
+		http.Error(w, "GROUP BY, HAVING and aggregate functions are supported only by search.csv and search.json API", http.StatusBadRequest)
+		return
+	}
+	if sel.Joined() {
+		// JOINした行は FuncLog として返せない。
+		http.Error(w, "JOIN is supported only by search.csv and search.json API", http.StatusBadRequest)
+		return
+	}
+	if sel.HasSubquery() {
+		// サブクエリは、WHERE句を評価する前に実行しておく。
+		tables, err := api.snapshotTables(logobj, sel.TableNames(), q)
+		if err != nil {
+			api.serverError(w, err, "failed to create a snapshot")
+			return
+		}
+		if err := sel.Prepare(tables.open); err != nil {
+			queryError(w, badQuery(err), false)
+			return
+		}
+	}
+
+	lt := logTime(logobj)
+	var isFiltered func(fl *types.FuncLog) bool
+	where := sel.Where()
+	if where != nil {
+		row := sql.SqlFuncLogRow{
 			Symbols: logobj.Symbols(),
+			LogTime: lt,
 		}
-		err = util.PanicHandler(func() {
+		err := util.PanicHandler(func() {
 			where.WithRow(&row)
 		})
 		if err != nil {
@@ -553,79 +1071,112 @@ func (api APIv0) funcCallSearchBySql(w http.ResponseWriter, logobj *storage.Log,
 	}
 	offset, rows := sel.Limit()
 
+	// ORDER BY句が指定されていれば、sortAndLimitワーカーで上位offset+rows件だけを保持しながら並び替える。
+	var sortFn func(f1, f2 *types.FuncLog) bool
+	row1 := sql.SqlFuncLogRow{Symbols: logobj.Symbols(), LogTime: lt}
+	row2 := sql.SqlFuncLogRow{Symbols: logobj.Symbols(), LogTime: lt}
+	less, err := sel.Less(&row1, &row2)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if less != nil {
+		sortFn = func(f1, f2 *types.FuncLog) bool {
+			row1.FuncLog = f1
+			row2.FuncLog = f2
+			return less()
+		}
+	}
+
 	var send func(fl *types.FuncLog) error
-	switch format {
-	case "json":
+	var header, footer func() error
+	if p.Format == funcLogFormat {
 		enc := json.NewEncoder(w)
 		send = func(fl *types.FuncLog) error {
 			return enc.Encode(fl)
 		}
-	case "csv":
-		// write a header
-		if _, err := w.Write([]byte(strings.Join(sel.ColNames(), ",") + "\n")); err != nil {
-			log.Println(errors.Wrap(err, "write error"))
-			return
-		}
-		// build the send()
+	} else {
 		row := sql.SqlFuncLogRow{
 			Symbols: logobj.Symbols(),
+			LogTime: lt,
+		}
+		rw, err := newResultWriter(w, p, sel.ColNames(), func() sql.SqlFieldGetters {
+			return row.Fields(sel.Cols())
+		})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		header = func() error {
+			w.Header().Set("Content-Type", rw.ContentType())
+			return rw.WriteHeader()
 		}
-		printer := row.Fields(sel.Cols()).Printer(sql.CsvFormat)
-		line := make([]byte, 64<<10) // 64KiB
 		send = func(fl *types.FuncLog) error {
 			row.FuncLog = fl
-			n := printer(line)
-			line[n] = '\n'
-			_, err := w.Write(line[:n+1])
+			return rw.WriteRow()
+		}
+		footer = rw.WriteFooter
+	}
+
+	// ヘッダは、最初の行を送信する直前か、全ての行を送信した後で書き込む。
+	// ソート中にクエリが中止されたときに、エラーをステータスコードで返せるようにする。
+	headerWritten := false
+	writeHeader := func() error {
+		if headerWritten {
+			return nil
+		}
+		headerWritten = true
+		declareQueryTrailer(w)
+		if header != nil {
+			return header()
+		}
+		return nil
+	}
+	sendRow := send
+	send = func(fl *types.FuncLog) error {
+		if err := writeHeader(); err != nil {
 			return err
 		}
-	default:
-		http.Error(w, fmt.Sprintf("%s format is not supported", format), http.StatusBadRequest)
-		return
+		return sendRow(fl)
 	}
 
-	parentCtx := context.Background()
-	worker := api.worker(parentCtx, logobj)
-	fw := worker.readFuncLog(-1, -1)
+	worker := api.worker(q, logobj)
+	fw := worker.readFuncLogByPlan(sel)
 	fw = fw.filterFuncLog(isFiltered)
-	fw = fw.sortAndLimit(nil, offset, rows)
+	fw = fw.sortAndLimit(sortFn, offset, rows)
 	fw.sendTo(send)
 
-	if err := worker.wait(); err != nil {
+	err = worker.wait()
+	if err == nil {
+		err = q.Err()
+	}
+	if err != nil {
+		queryError(w, err, headerWritten)
 		log.Println(errors.Wrap(err, "funcCallSearch:"))
+		return
 	}
-}
-func (api APIv0) funcCallSearchBySimpleParams(w http.ResponseWriter, logobj *storage.Log, p SearchFuncLogParams, format string) {
-	var sortFn func(f1, f2 *types.FuncLog) bool
-	switch p.SortKey {
-	case SortByID:
-		sortFn = func(f1, f2 *types.FuncLog) bool {
-			return f1.ID < f2.ID
-		}
-	case SortByStartTime:
-		sortFn = func(f1, f2 *types.FuncLog) bool {
-			return f1.StartTime < f2.StartTime
-		}
-	case SortByEndTime:
-		sortFn = func(f1, f2 *types.FuncLog) bool {
-			return f1.EndTime < f2.EndTime
+	if err := writeHeader(); err != nil {
+		log.Println(errors.Wrap(err, "write error"))
+		return
+	}
+	if footer != nil {
+		if err := footer(); err != nil {
+			log.Println(errors.Wrap(err, "write error"))
 		}
-	case NoSortKey:
-	default:
-		log.Panic("bug")
 	}
-
-	switch p.SortOrder {
-	case AscendingSortOrder:
-		// 何もしない
-	case DescendingSortOrder:
-		// 降順にするために、大小を入れ替える。
-		oldSortFn := sortFn
+}
+func (api APIv0) funcCallSearchBySimpleParams(w http.ResponseWriter, r *http.Request, logobj *storage.Log, p SearchFuncLogParams, format string) {
+	pg, err := newPager(p.SortKey, p.SortOrder, p.Limit, p.After, p.Before)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	// レコードはIDの昇順に読み出すため、IDの昇順に並べる場合はソートしない。
+	var sortFn func(f1, f2 *types.FuncLog) bool
+	if pg.sortKey != SortByID || pg.sortOrder != AscendingSortOrder || pg.before != nil {
 		sortFn = func(f1, f2 *types.FuncLog) bool {
-			return oldSortFn(f2, f1)
+			return pg.readLess(funcLogPageKey(pg.sortKey, f1), funcLogPageKey(pg.sortKey, f2))
 		}
-	default:
-		log.Panic("bug")
 	}
 
 	// narrow the search range by ID and Timestamp.
@@ -669,34 +1220,47 @@ func (api APIv0) funcCallSearchBySimpleParams(w http.ResponseWriter, logobj *sto
 		p.MaxId = newMaxId
 	}
 
-	// evtが除外されるべきレコードなら、trueを返す。
-	var isFiltered func(evt *types.FuncLog) bool
-	if p.Gid >= 0 || p.MinId >= 0 || p.MaxId >= 0 || p.MinTimestamp >= 0 || p.MaxTimestamp >= 0 {
-		isFiltered = func(evt *types.FuncLog) bool {
-			if p.Gid >= 0 && evt.GID != p.Gid {
-				return true
-			}
-			if p.MinId >= 0 && evt.ID < p.MinId {
-				return true
-			}
-			if p.MaxId >= 0 && p.MaxId < evt.ID {
-				return true
-			}
-			if p.MinTimestamp >= 0 && (evt.StartTime < p.MinTimestamp && evt.EndTime < p.MinTimestamp) {
-				return true
-			}
-			if p.MaxTimestamp >= 0 && p.MaxTimestamp < evt.StartTime {
+	isFiltered := funcLogFilter(p)
+	readMinId := p.MinId
+	if pg.paging() {
+		// ページの範囲外にあるレコードを除外する。
+		filter := isFiltered
+		isFiltered = func(fl *types.FuncLog) bool {
+			if !pg.inRange(funcLogPageKey(pg.sortKey, fl)) {
 				return true
 			}
-			return false
+			return filter != nil && filter(fl)
+		}
+		if pg.after != nil && sortFn == nil && readMinId <= types.FuncLogID(pg.after.id) {
+			// IDの昇順に並べる場合は、カーソルより前のレコードを読み出さない。
+			readMinId = types.FuncLogID(pg.after.id) + 1
 		}
 	}
 
 	var send func(fl *types.FuncLog) error
-	switch format {
-	case "json":
+	sent := false
+	// ページングする場合に、送信を保留しているレコード。
+	var lines [][]byte
+	var keys []pageKey
+	switch {
+	case format == "json" && pg.limit > 0:
+		// 前後のページのカーソルをヘッダで返すため、1ページ分のレコードを読み出してから送信する。
+		send = func(fl *types.FuncLog) error {
+			js, err := json.Marshal(fl)
+			if err != nil {
+				return err
+			}
+			lines = append(lines, append(js, '\n'))
+			keys = append(keys, funcLogPageKey(pg.sortKey, fl))
+			return nil
+		}
+	case format == "json":
 		enc := json.NewEncoder(w)
 		send = func(fl *types.FuncLog) error {
+			if !sent {
+				declareQueryTrailer(w)
+				sent = true
+			}
 			return enc.Encode(fl)
 		}
 	default:
@@ -704,15 +1268,294 @@ func (api APIv0) funcCallSearchBySimpleParams(w http.ResponseWriter, logobj *sto
 		return
 	}
 
-	parentCtx := context.Background()
-	worker := api.worker(parentCtx, logobj)
-	fw := worker.readFuncLog(p.MinId, p.MaxId)
+	// SQL文の代わりに、検索条件を含むURLを実行中のクエリとして登録する。
+	q := api.startQuery(r, logobj, r.URL.RequestURI(), 0)
+	defer q.done()
+	worker := api.worker(q, logobj)
+	var ids []types.FuncLogID
+	useIndex := false
+	if p.Gid >= 0 {
+		ids, useIndex = logobj.FuncLogIDsByGID(p.Gid)
+	}
+	var fw *FuncLogAPIWorker
+	if useIndex {
+		// IDとTimestampの条件は、後続のフィルタで評価する。
+		fw = worker.readFuncLogByIDs(ids)
+	} else {
+		fw = worker.readFuncLog(readMinId, p.MaxId)
+	}
 	fw = fw.filterFuncLog(isFiltered)
-	fw = fw.sortAndLimit(sortFn, 0, p.Limit)
+	fw = fw.sortAndLimit(sortFn, 0, pg.rows())
 	fw.sendTo(send)
 
-	if err := worker.wait(); err != nil {
+	err = worker.wait()
+	if err == nil {
+		err = q.Err()
+	}
+	if err != nil {
+		queryError(w, err, sent)
 		log.Println(errors.Wrap(err, "funcCallSearch:"))
+		return
+	}
+	if pg.limit > 0 {
+		writePage(w, pg, lines, keys)
+	}
+}
+
+// writePage は、 pager.readLess() の順に並んだレコードから1ページ分を選んで送信する。
+// lines は各レコードをエンコードした行、 keys はそれらの pageKey である。
+func writePage(w http.ResponseWriter, pg *pager, lines [][]byte, keys []pageKey) {
+	n, next, prev := pg.result(keys)
+	lines = lines[:n]
+	if pg.before != nil {
+		for i, j := 0, len(lines)-1; i < j; i, j = i+1, j-1 {
+			lines[i], lines[j] = lines[j], lines[i]
+		}
+	}
+	setPageHeaders(w, next, prev)
+	for _, line := range lines {
+		if _, err := w.Write(line); err != nil {
+			log.Println(errors.Wrap(err, "write error"))
+			return
+		}
+	}
+}
+
+// funcLogFilter は、 p の条件を満たさないレコードに対してtrueを返す関数を返す。
+// 条件が指定されていなければ、nilを返す。
+func funcLogFilter(p SearchFuncLogParams) func(evt *types.FuncLog) bool {
+	if p.Gid < 0 && p.MinId < 0 && p.MaxId < 0 && p.MinTimestamp < 0 && p.MaxTimestamp < 0 {
+		return nil
+	}
+	return func(evt *types.FuncLog) bool {
+		if p.Gid >= 0 && evt.GID != p.Gid {
+			return true
+		}
+		if p.MinId >= 0 && evt.ID < p.MinId {
+			return true
+		}
+		if p.MaxId >= 0 && p.MaxId < evt.ID {
+			return true
+		}
+		if p.MinTimestamp >= 0 && (evt.StartTime < p.MinTimestamp && evt.EndTime < p.MinTimestamp) {
+			return true
+		}
+		if p.MaxTimestamp >= 0 && p.MaxTimestamp < evt.StartTime {
+			return true
+		}
+		return false
+	}
+}
+
+// streamPollInterval は、 funcCallStream がログの状態を確認する間隔である。
+// アプリケーションが切断したときはログの更新通知が届かないため、定期的に確認する。
+const streamPollInterval = time.Second
+
+// funcCallStream は、関数呼び出しのログを Server-Sent Events 形式で順次返す。
+// funcCallSearch と同じ条件でレコードを絞り込み、実行中の関数呼び出しは終了した後で出力する。
+// 各イベントのdataフィールドには、1つの FuncLog をJSON形式で格納する。
+//
+// レコードを読み出す度に、次に読み出すIDと出力を保留しているIDをイベントIDとして送信する (followCursor.String())。
+// 再接続したクライアントは、 Last-Event-ID ヘッダまたは from-id パラメータにこの値を指定すると続きから受信できる。
+// 最後のイベントIDより後に受信したレコードは再送されるため、クライアントはそれらのIDを無視しなければならない。
+//
+// アプリケーションが切断してログが更新されなくなるか、max-id までのレコードを全て出力したら終了する。
+func (api APIv0) funcCallStream(w http.ResponseWriter, r *http.Request) {
+	logobj, ok := api.getLog(w, r)
+	if !ok {
+		return
+	}
+
+	q := r.URL.Query()
+	for _, param := range []string{"limit", "sort", "order", "after", "before"} {
+		if q.Get(param) != "" {
+			http.Error(w, param+" parameter is not supported by the stream API", http.StatusBadRequest)
+			return
+		}
+	}
+	var p SearchFuncLogParams
+	invalidParamName, err := p.FromString(
+		q.Get("gid"),
+		q.Get("min-id"),
+		q.Get("max-id"),
+		q.Get("min-timestamp"),
+		q.Get("max-timestamp"),
+		"",
+		"",
+		"",
+		"",
+		"",
+		q.Get("sql"),
+	)
+	if err != nil {
+		http.Error(w, "invalid "+invalidParamName, http.StatusBadRequest)
+		return
+	}
+	var cursor followCursor
+	if token := resumeToken(r); token != "" {
+		if err := cursor.FromString(token); err != nil {
+			http.Error(w, "invalid from-id", http.StatusBadRequest)
+			return
+		}
+	}
+	if cursor.next < int64(p.MinId) {
+		cursor.next = int64(p.MinId)
+	}
+
+	stmt := r.URL.RequestURI()
+	isFiltered := funcLogFilter(p)
+	var sel *sql.SelectParser
+	if p.Sql != "" {
+		exclusiveParams := []string{"gid", "min-id", "max-id", "min-timestamp", "max-timestamp"}
+		for _, param := range exclusiveParams {
+			if q.Get(param) != "" {
+				msg := fmt.Sprintf("sql parameter and %s parameter are mutually exclusive", param)
+				http.Error(w, msg, http.StatusBadRequest)
+				return
+			}
+		}
+		stmt = p.Sql
+		sel, err = sql.ParseSelectWithViews(p.Sql, api.logViews(logobj))
+		if err != nil {
+			http.Error(w, "invalid sql statement\n"+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if sel.From() != "calls" {
+			http.Error(w, "the stream API supports only calls table", http.StatusBadRequest)
+			return
+		}
+		if err := sel.CheckFollow(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if where := sel.Where(); where != nil {
+			row := sql.SqlFuncLogRow{
+				Symbols: logobj.Symbols(),
+				LogTime: logTime(logobj),
+			}
+			err := util.PanicHandler(func() {
+				where.WithRow(&row)
+			})
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			isFiltered = func(fl *types.FuncLog) bool {
+				row.FuncLog = fl
+				return !where.Bool()
+			}
+		}
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+
+	// ストリームは終了しないため、サーバに設定された資源の上限は適用しない。
+	qry := api.queries.start(r, logobj.ID, stmt, QueryLimits{})
+	defer qry.done()
+
+	// 通知を見逃さないように、最初のスキャンよりも先にコールバック関数を登録する。
+	ctx := qry.ctx
+	notify := make(chan struct{}, 1)
+	go logobj.Watch(ctx, func(info *types.LogInfo) {
+		select {
+		case notify <- struct{}{}:
+		default:
+			// 前回の通知をまだ処理していない。
+		}
+	})
+	ticker := time.NewTicker(streamPollInterval)
+	defer ticker.Stop()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	declareQueryTrailer(w)
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	sw := sseWriter{w: w}
+	var lastID string
+	fl := &types.FuncLog{}
+	for first := true; ; first = false {
+		// スナップショットを作成する前に確認しておけば、アプリケーションが切断した後の最後のスキャンで全てのレコードを読み出せる。
+		live := api.SimulatorStore.Get(logobj.ID) != nil
+		snapshot, err := logobj.Snapshot()
+		if err != nil {
+			// ログが閉じられたため、これ以上レコードは追加されない。
+			return
+		}
+		end := snapshot.FuncLogRecords()
+		if p.MaxId >= 0 && int64(p.MaxId) < end {
+			end = int64(p.MaxId) + 1
+		}
+		var ids func() (int64, bool)
+		if first && sel != nil {
+			// 最初のスキャンでは、WHERE句を満たす可能性のあるレコードのみを読み出す。
+			next := funcLogPlan(logobj, snapshot, "calls", sel, true).Iterator()
+			start := cursor.next
+			ids = func() (int64, bool) {
+				for id, ok := next(); ok; id, ok = next() {
+					if start <= int64(id) && int64(id) < end {
+						return int64(id), true
+					}
+				}
+				return 0, false
+			}
+		}
+
+		var scanErr error
+		err = util.PanicHandler(func() {
+			scanErr = cursor.scan(ids, end, func(id int64) (bool, error) {
+				if err := qry.scan(); err != nil {
+					return false, err
+				}
+				if err := snapshot.FuncLog(types.FuncLogID(id), fl); err != nil {
+					return false, err
+				}
+				if !fl.IsEnded() {
+					return false, nil
+				}
+				if isFiltered != nil && isFiltered(fl) {
+					return true, nil
+				}
+				data, err := json.Marshal(fl)
+				if err != nil {
+					return true, err
+				}
+				return true, sw.writeData(data)
+			})
+		})
+		if err == nil {
+			err = scanErr
+		}
+		if err == nil && cursor.String() != lastID {
+			lastID = cursor.String()
+			err = sw.writeID(lastID)
+		}
+		if err != nil {
+			queryError(w, err, true)
+			api.Logger.Println(errors.Wrap(err, "funcCallStream"))
+			return
+		}
+		flusher.Flush()
+
+		if !live {
+			// 実行中の関数呼び出しは、これ以上終了しない。
+			return
+		}
+		if p.MaxId >= 0 && int64(p.MaxId) < cursor.next && len(cursor.pending) == 0 {
+			// max-id までのレコードを全て出力した。
+			return
+		}
+		select {
+		case <-ctx.Done():
+			queryError(w, qry.Err(), true)
+			return
+		case <-notify:
+		case <-ticker.C:
+		}
 	}
 }
 
@@ -734,40 +1577,483 @@ func (api APIv0) goroutineSearch(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "invalid max-timestamp", http.StatusBadRequest)
 		return
 	}
+	limit := int64(-1)
+	if s := q.Get("limit"); s != "" {
+		limit, err = strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			http.Error(w, "invalid limit", http.StatusBadRequest)
+			return
+		}
+	}
+	var sortKey SortKey
+	if err := sortKey.Parse(q.Get("sort")); err != nil {
+		http.Error(w, "invalid sort", http.StatusBadRequest)
+		return
+	}
+	var sortOrder SortOrder
+	if err := sortOrder.Parse(q.Get("order"), NoSortOrder); err != nil {
+		http.Error(w, "invalid order", http.StatusBadRequest)
+		return
+	}
+	pg, err := newPager(sortKey, sortOrder, limit, Cursor(q.Get("after")), Cursor(q.Get("before")))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// SQL文の代わりに、検索条件を含むURLを実行中のクエリとして登録する。
+	qry := api.startQuery(r, logobj, r.URL.RequestURI(), 0)
+	defer qry.done()
 
 	// read all records in the search range.
+	// クエリが中止されるかクライアントが切断したら、読み出しを中断する。
 	ch := make(chan types.Goroutine, 1<<20) // buffer size is 1M records
+	// readErr は、chがcloseされた後に参照できる。
+	var readErr error
 	go func() {
 		defer close(ch)
-		var err error
-		logobj.Goroutine(func(store *storage.GoroutineStore) {
-			n := store.Records()
+		readErr = func() error {
+			simGoroutines := simulatorGoroutines(api.SimulatorStore.Get(logobj.ID))
+			snapshot, err := logobj.Snapshot()
+			if err != nil {
+				return err
+			}
+			n := snapshot.GoroutineRecords()
+			live := newLiveGoroutines(simGoroutines, n)
+			match := func(g *types.Goroutine) bool {
+				return (minTs == -1 || minTs <= g.StartTime) && (maxTs == -1 || g.EndTime <= maxTs) &&
+					pg.inRange(goroutinePageKey(pg.sortKey, g))
+			}
+			send := func(g *types.Goroutine) error {
+				select {
+				case ch <- *g:
+					return nil
+				case <-qry.ctx.Done():
+					return qry.Err()
+				}
+			}
 			for i := int64(0); i < n; i++ {
+				if err := qry.scan(); err != nil {
+					return err
+				}
 				var g types.Goroutine
-				err = store.GetNolock(types.GID(i), &g)
+				err = snapshot.Goroutine(types.GID(i), &g)
 				if err != nil {
-					return
+					return errors.Wrap(err, "failed to read GoroutineFile")
 				}
+				live.overlay(&g)
 
-				if (minTs == -1 || minTs <= g.StartTime) && (maxTs == -1 || g.EndTime <= maxTs) {
-					ch <- g
+				if match(&g) {
+					if err := send(&g); err != nil {
+						return err
+					}
+				}
+			}
+			// まだファイルに書き出されていないgoroutine
+			for _, g := range live.added {
+				if err := qry.scan(); err != nil {
+					return err
+				}
+				if match(g) {
+					if err := send(g); err != nil {
+						return err
+					}
 				}
 			}
+			return nil
+		}()
+	}()
+
+	if pg.limit <= 0 && pg.sortKey == SortByID && pg.sortOrder == AscendingSortOrder {
+		// GIDの昇順に読み出すため、ソートせずに送信する。
+		// encode and send records to client.
+		enc := json.NewEncoder(w)
+		sent := false
+		for g := range ch {
+			if !sent {
+				declareQueryTrailer(w)
+				sent = true
+			}
+			if err := enc.Encode(g); err != nil {
+				api.Logger.Println(errors.Wrap(err, "failed to json.Encoder.Encode()"))
+				return
+			}
+		}
+		if readErr != nil {
+			queryError(w, readErr, sent)
+			api.Logger.Println(errors.Wrap(readErr, "goroutineSearch"))
+		}
+		return
+	}
+
+	var gs []types.Goroutine
+	for g := range ch {
+		gs = append(gs, g)
+		if err := qry.buffer(int64(len(gs))); err != nil {
+			queryError(w, err, false)
+			return
+		}
+	}
+	if readErr != nil {
+		queryError(w, readErr, false)
+		api.Logger.Println(errors.Wrap(readErr, "goroutineSearch"))
+		return
+	}
+	sort.Slice(gs, func(i, j int) bool {
+		return pg.readLess(goroutinePageKey(pg.sortKey, &gs[i]), goroutinePageKey(pg.sortKey, &gs[j]))
+	})
+	if rows := pg.rows(); rows > 0 && rows < int64(len(gs)) {
+		gs = gs[:rows]
+	}
+	lines := make([][]byte, len(gs))
+	keys := make([]pageKey, len(gs))
+	for i := range gs {
+		js, err := json.Marshal(gs[i])
+		if err != nil {
+			api.serverError(w, err, "failed to json.Marshal")
+			return
+		}
+		lines[i] = append(js, '\n')
+		keys[i] = goroutinePageKey(pg.sortKey, &gs[i])
+	}
+	writePage(w, pg, lines, keys)
+}
+
+// running は、書き込み中のログについて、goroutineごとに実行中の関数呼び出しのスタックを返す。
+// シミュレータから直接読み出すため、まだファイルに書き出されていない関数呼び出しも含まれる。
+func (api APIv0) running(w http.ResponseWriter, r *http.Request) {
+	logobj, ok := api.getLog(w, r)
+	if !ok {
+		return
+	}
+
+	res := RunningCalls{
+		Now:        types.NewTime(time.Now()),
+		Goroutines: []RunningGoroutine{},
+	}
+	ss := api.SimulatorStore.Get(logobj.ID)
+	if ss != nil {
+		res.Active = true
+		symbols := logobj.Symbols()
+		for gid, stack := range ss.Stacks() {
+			g := RunningGoroutine{
+				GID:   gid,
+				Calls: make([]RunningCall, len(stack)),
+			}
+			for i, fl := range stack {
+				g.Calls[i].FuncLog = *fl
+				if len(fl.Frames) > 0 {
+					if f, ok := symbols.GoFunc(fl.Frames[0]); ok {
+						g.Calls[i].Func = f.Name
+					}
+					g.Calls[i].Line = symbols.FileLine(fl.Frames[0])
+				}
+			}
+			res.Goroutines = append(res.Goroutines, g)
+		}
+		sort.Slice(res.Goroutines, func(i, j int) bool {
+			return res.Goroutines[i].GID < res.Goroutines[j].GID
 		})
+	}
+	api.writeObj(w, res)
+}
+
+// funcCallChildren は、指定した関数呼び出しから直接呼び出された関数呼び出しを、IDの昇順に返す。
+func (api APIv0) funcCallChildren(w http.ResponseWriter, r *http.Request) {
+	t, fl, ok := api.getCallTree(w, r)
+	if !ok {
+		return
+	}
+
+	children, err := t.children(&fl)
+	if err != nil {
+		api.serverError(w, err, "failed to read func-calls")
+		return
+	}
+	api.writeCallTreeNodes(w, t, children)
+}
+
+// funcCallAncestors は、指定した関数呼び出しの呼び出し元を、呼び出しツリーの根から順に返す。
+func (api APIv0) funcCallAncestors(w http.ResponseWriter, r *http.Request) {
+	t, fl, ok := api.getCallTree(w, r)
+	if !ok {
+		return
+	}
+
+	ancestors, err := t.ancestors(&fl)
+	if err != nil {
+		api.serverError(w, err, "failed to read func-calls")
+		return
+	}
+	api.writeCallTreeNodes(w, t, ancestors)
+}
+
+// funcCallTree は、指定した関数呼び出しを根とする呼び出しツリーを、depth パラメータで指定した深さまで展開して返す。
+func (api APIv0) funcCallTree(w http.ResponseWriter, r *http.Request) {
+	depth := defaultCallTreeDepth
+	if s := r.URL.Query().Get("depth"); s != "" {
+		var err error
+		depth, err = strconv.Atoi(s)
+		if err != nil || depth < 0 {
+			http.Error(w, "invalid depth", http.StatusBadRequest)
+			return
+		}
+	}
+	t, fl, ok := api.getCallTree(w, r)
+	if !ok {
+		return
+	}
+
+	node, err := t.subtree(&fl, depth)
+	if err != nil {
+		api.serverError(w, err, "failed to read func-calls")
+		return
+	}
+	api.writeObj(w, node)
+}
+
+// writeCallTreeNodes は、 fls を子ノードを展開していない CallTreeNode の一覧として書き出す。
+func (api APIv0) writeCallTreeNodes(w http.ResponseWriter, t *callTree, fls []types.FuncLog) {
+	res := CallTreeNodeList{
+		Nodes: make([]CallTreeNode, 0, len(fls)),
+	}
+	for i := range fls {
+		node, err := t.node(&fls[i])
 		if err != nil {
-			api.Logger.Println(errors.Wrap(err, "failed to read GoroutineFile"))
+			api.serverError(w, err, "failed to read func-calls")
 			return
 		}
-	}()
+		res.Nodes = append(res.Nodes, node)
+	}
+	api.writeObj(w, res)
+}
 
-	// encode and send records to client.
-	enc := json.NewEncoder(w)
-	for g := range ch {
-		if err := enc.Encode(g); err != nil {
-			api.Logger.Println(errors.Wrap(err, "failed to json.Encoder.Encode()"))
+// flameGraph は、条件を満たす関数呼び出しのスタックを集計したフレームグラフを返す。
+func (api APIv0) flameGraph(w http.ResponseWriter, r *http.Request) {
+	logobj, ok := api.getLog(w, r)
+	if !ok {
+		return
+	}
+
+	q := r.URL.Query()
+	var p FlameGraphParams
+	invalidParamName, err := p.FromString(
+		q.Get("gid"),
+		q.Get("min-timestamp"),
+		q.Get("max-timestamp"),
+		q.Get("sql"),
+		q.Get("format"),
+	)
+	if err != nil {
+		http.Error(w, "invalid "+invalidParamName, http.StatusBadRequest)
+		return
+	}
+
+	gids := make(map[types.GID]bool, len(p.Gids))
+	for _, gid := range p.Gids {
+		gids[gid] = true
+	}
+	timeFilter := funcLogFilter(SearchFuncLogParams{
+		Gid:          -1,
+		MinId:        -1,
+		MaxId:        -1,
+		MinTimestamp: p.MinTimestamp,
+		MaxTimestamp: p.MaxTimestamp,
+	})
+	var where func(fl *types.FuncLog) bool
+	var sel *sql.SelectParser
+	if p.Sql != "" {
+		sel, err = sql.ParseSelectWithViews(p.Sql, api.logViews(logobj))
+		if err != nil {
+			http.Error(w, "invalid sql statement\n"+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if sel.From() != "calls" {
+			http.Error(w, "the flamegraph API supports only calls table", http.StatusBadRequest)
+			return
+		}
+		if err := sel.CheckFollow(); err != nil {
+			http.Error(w, "the flamegraph API supports only WHERE clause", http.StatusBadRequest)
+			return
+		}
+		if expr := sel.Where(); expr != nil {
+			row := sql.SqlFuncLogRow{
+				Symbols: logobj.Symbols(),
+				LogTime: logTime(logobj),
+			}
+			err := util.PanicHandler(func() {
+				expr.WithRow(&row)
+			})
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			where = func(fl *types.FuncLog) bool {
+				row.FuncLog = fl
+				return expr.Bool()
+			}
+		}
+	}
+	isFiltered := func(fl *types.FuncLog) bool {
+		if len(gids) > 0 && !gids[fl.GID] {
+			return true
+		}
+		if timeFilter != nil && timeFilter(fl) {
+			return true
+		}
+		return where != nil && !where(fl)
+	}
+
+	// SQL文の代わりに、検索条件を含むURLを実行中のクエリとして登録する。
+	qry := api.startQuery(r, logobj, r.URL.RequestURI(), 0)
+	defer qry.done()
+	worker := api.worker(qry, logobj)
+	var fw *FuncLogAPIWorker
+	if sel != nil {
+		fw = worker.readFuncLogByPlan(sel)
+	} else if ids, ok := logobj.FuncLogIDsByGID(p.Gids...); ok && len(p.Gids) > 0 {
+		fw = worker.readFuncLogByIDs(ids)
+	} else {
+		fw = worker.readFuncLog(-1, -1)
+	}
+	fw = fw.filterFuncLog(isFiltered)
+	fg := newFlameGraph(logobj.Symbols())
+	fw.sendTo(func(fl *types.FuncLog) error {
+		fg.add(fl)
+		return nil
+	})
+
+	err = worker.wait()
+	if err == nil {
+		err = qry.Err()
+	}
+	if err != nil {
+		queryError(w, err, false)
+		log.Println(errors.Wrap(err, "flameGraph:"))
+		return
+	}
+	switch p.Format {
+	case SvgFlameGraph:
+		title := fmt.Sprintf("Flame Graph - %s", logobj.ID.Hex())
+		w.Header().Set("Content-Type", "image/svg+xml")
+		err = fg.writeSVG(w, title)
+	case FoldedFlameGraph:
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		err = fg.writeFolded(w)
+	}
+	if err != nil {
+		api.Logger.Println(errors.Wrap(err, "failed to write a flame graph"))
+	}
+}
+
+// leaks は、終了していないgoroutineを関数ごとに集計したレポートを返す。
+// baseline パラメータを指定した場合は、そのログのレポートと比較する。
+func (api APIv0) leaks(w http.ResponseWriter, r *http.Request) {
+	logobj, ok := api.getLog(w, r)
+	if !ok {
+		return
+	}
+
+	q := r.URL.Query()
+	var p LeakReportParams
+	if err := p.GroupBy.Parse(q.Get("group-by")); err != nil {
+		http.Error(w, "invalid group-by", http.StatusBadRequest)
+		return
+	}
+	p.Baseline = q.Get("baseline")
+
+	report, err := api.leakReport(logobj, p.GroupBy)
+	if err != nil {
+		api.serverError(w, err, "failed to create a leak report")
+		return
+	}
+	if p.Baseline != "" {
+		id, err := storage.LogID{}.Unhex(p.Baseline)
+		if err != nil {
+			http.Error(w, "invalid baseline", http.StatusBadRequest)
+			return
+		}
+		baseLog, ok := api.Storage.Log(id)
+		if !ok {
+			http.Error(w, "baseline log not found", http.StatusNotFound)
 			return
 		}
+		baseline, err := api.leakReport(baseLog, p.GroupBy)
+		if err != nil {
+			api.serverError(w, err, "failed to create a leak report")
+			return
+		}
+		report.Diff(p.Baseline, &baseline)
 	}
+	api.writeObj(w, report)
+}
+
+// leakReport は、ログの終了していないgoroutineを集計する。
+// 書き込み中のログであれば、シミュレータが保持している現在の状態を集計する。
+// そうでなければ、プロセスの終了時に生存していたgoroutineを集計する。
+func (api APIv0) leakReport(logobj *storage.Log, groupBy LeakGroupKey) (LeakReport, error) {
+	if ss := api.SimulatorStore.Get(logobj.ID); ss != nil {
+		var goroutines []types.Goroutine
+		for _, g := range ss.Goroutines() {
+			goroutines = append(goroutines, *g)
+		}
+		report := newLeakReport(goroutines, ss.Stacks(), logobj.Symbols(), types.NewTime(time.Now()), groupBy)
+		report.Active = true
+		return report, nil
+	}
+
+	snapshot, err := logobj.Snapshot()
+	if err != nil {
+		return LeakReport{}, err
+	}
+	var goroutines []types.Goroutine
+	var gids []types.GID
+	for i := int64(0); i < snapshot.GoroutineRecords(); i++ {
+		var g types.Goroutine
+		if err := snapshot.Goroutine(types.GID(i), &g); err != nil {
+			return LeakReport{}, err
+		}
+		if g.EndTime == types.NotEnded {
+			goroutines = append(goroutines, g)
+			gids = append(gids, g.GID)
+		}
+	}
+	stacks := map[types.GID][]*types.FuncLog{}
+	if len(gids) > 0 {
+		stacks, err = logobj.RunningFuncLogs(snapshot, gids...)
+		if err != nil {
+			return LeakReport{}, err
+		}
+	}
+	now := types.NewTime(logobj.LogInfo().Metadata.Timestamp)
+	return newLeakReport(goroutines, stacks, logobj.Symbols(), now, groupBy), nil
+}
+
+// events は、ウォッチドッグが検出したイベントを、検出した順に返す。
+func (api APIv0) events(w http.ResponseWriter, r *http.Request) {
+	logobj, ok := api.getLog(w, r)
+	if !ok {
+		return
+	}
+
+	api.writeObj(w, EventList{
+		Events: logobj.Events(),
+	})
+}
+func (api APIv0) funcStats(w http.ResponseWriter, r *http.Request) {
+	logobj, ok := api.getLog(w, r)
+	if !ok {
+		return
+	}
+
+	stats, ok := logobj.FuncStats()
+	if !ok {
+		http.Error(w, "function statistics are not available", http.StatusNotFound)
+		return
+	}
+	api.writeObj(w, FuncStatsList{
+		Funcs: stats,
+	})
 }
 func (api APIv0) symbols(w http.ResponseWriter, r *http.Request) {
 	logobj, ok := api.getLog(w, r)
@@ -826,8 +2112,83 @@ func (api APIv0) goLine(w http.ResponseWriter, r *http.Request) {
 	api.writeObj(w, l)
 }
 
-func (api APIv0) notImpl(w http.ResponseWriter, r *http.Request) {
-	http.Error(w, "not implemented", http.StatusInternalServerError)
+// views は、ビューの一覧を返す。
+// app-name パラメータを指定した場合は、そのアプリケーションから参照できるビューのみを返す。
+func (api APIv0) views(w http.ResponseWriter, r *http.Request) {
+	views, ok := api.getViews(w)
+	if !ok {
+		return
+	}
+	api.writeObj(w, ViewList{
+		Views: listViews(views, r.URL.Query().Get("app-name")),
+	})
+}
+
+func (api APIv0) view(w http.ResponseWriter, r *http.Request) {
+	views, ok := api.getViews(w)
+	if !ok {
+		return
+	}
+	app := mux.Vars(r)["app-name"]
+	name := mux.Vars(r)["name"]
+
+	switch r.Method {
+	case http.MethodGet:
+		v, ok := views.Get(app, name)
+		if !ok {
+			http.Error(w, "view not found", http.StatusNotFound)
+			return
+		}
+		api.writeObj(w, View{App: app, View: v})
+	case http.MethodPut:
+		var v View
+		if !api.readJson(r, &v) {
+			http.Error(w, "invalid request body", http.StatusBadRequest)
+			return
+		}
+		v.App = app
+		v.Name = name
+		if err := saveView(views, v); err != nil {
+			http.Error(w, "invalid view\n"+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := api.Config.SaveViews(); err != nil {
+			api.serverError(w, err, "failed to save views")
+			return
+		}
+		api.writeObj(w, v)
+	case http.MethodDelete:
+		if !views.Remove(app, name) {
+			http.Error(w, "view not found", http.StatusNotFound)
+			return
+		}
+		if err := api.Config.SaveViews(); err != nil {
+			api.serverError(w, err, "failed to save views")
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// runningQueries は、実行中のクエリの一覧を返す。
+func (api APIv0) runningQueries(w http.ResponseWriter, r *http.Request) {
+	api.writeObj(w, RunningQueries{
+		Queries: api.queries.list(),
+	})
+}
+
+// killQuery は、実行中のクエリを中止する。
+func (api APIv0) killQuery(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(mux.Vars(r)["query-id"], 10, 64)
+	if err != nil {
+		http.Error(w, "invalid query-id", http.StatusBadRequest)
+		return
+	}
+	if !api.queries.kill(QueryID(id)) {
+		http.Error(w, "query not found", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
 }
 
 func (api APIv0) getLog(w http.ResponseWriter, r *http.Request) (*storage.Log, bool) {
@@ -843,7 +2204,60 @@ func (api APIv0) getLog(w http.ResponseWriter, r *http.Request) (*storage.Log, b
 		http.Error(w, "log not found", http.StatusNotFound)
 		return nil, false
 	}
-	return logobj, true
+	return logobj, true
+}
+
+// getCallTree returns a callTree of the log and the FuncLog specified by the request.
+// If request is invalid, getCallTree writes the error message and returns false.
+func (api APIv0) getCallTree(w http.ResponseWriter, r *http.Request) (t *callTree, fl types.FuncLog, ok bool) {
+	logobj, ok := api.getLog(w, r)
+	if !ok {
+		return
+	}
+	ok = false
+
+	id, err := strconv.ParseInt(mux.Vars(r)["func-log-id"], 10, 64)
+	if err != nil {
+		http.Error(w, "invalid func-log-id", http.StatusBadRequest)
+		return
+	}
+	// シミュレータのレコードを取得してからスナップショットを作成する。
+	simFuncLogs := simulatorFuncLogs(api.SimulatorStore.Get(logobj.ID))
+	snapshot, err := logobj.Snapshot()
+	if err != nil {
+		api.serverError(w, err, "failed to read func-calls")
+		return
+	}
+	t = newCallTree(logobj, snapshot, newLiveFuncLogs(simFuncLogs, snapshot.FuncLogRecords()))
+	fl, err = t.read(types.FuncLogID(id))
+	if err == errFuncLogNotFound {
+		http.Error(w, "func-call not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		api.serverError(w, err, "failed to read func-calls")
+		return
+	}
+	ok = true
+	return
+}
+
+// getViews returns views stored in the config.
+// If views are not available, getViews writes the error message and returns false.
+func (api APIv0) getViews(w http.ResponseWriter) (*config.Views, bool) {
+	if api.Config == nil || api.Config.Views == nil {
+		http.Error(w, "views are not available", http.StatusNotFound)
+		return nil, false
+	}
+	return api.Config.Views, true
+}
+
+// logViews returns a sql.ViewFunc that resolves views available for the app of the log.
+// It returns nil if views are not available.
+func (api APIv0) logViews(logobj *storage.Log) sql.ViewFunc {
+	if api.Config == nil || api.Config.Views == nil {
+		return nil
+	}
+	return viewFunc(api.Config.Views, logobj.LogInfo().Metadata.AppName)
 }
 
 // getLogPC returns Log object and PC.
@@ -879,8 +2293,20 @@ func (api APIv0) writeJson(w io.Writer, v interface{}) {
 	}
 }
 
-func (api *APIv0) worker(parent context.Context, logobj *storage.Log) *APIWorker {
-	group, ctx := errgroup.WithContext(parent)
+// startQuery は、r で受け付けた logobj に対するクエリの実行を開始したことを登録する。
+// timeout が0より大きく、サーバに設定された上限よりも短ければ、 timeout を実行時間の上限にする。
+func (api APIv0) startQuery(r *http.Request, logobj *storage.Log, sqlStmt string, timeout time.Duration) *query {
+	limits := api.QueryLimits
+	if 0 < timeout && (limits.Timeout <= 0 || timeout < limits.Timeout) {
+		limits.Timeout = timeout
+	}
+	return api.queries.start(r, logobj.ID, sqlStmt, limits)
+}
+
+// worker は、q を実行する APIWorker を返す。
+// q が中止されると、全てのワーカーが終了する。
+func (api *APIv0) worker(q *query, logobj *storage.Log) *APIWorker {
+	group, ctx := errgroup.WithContext(q.ctx)
 	return &APIWorker{
 		Api:        api,
 		Args:       &api.RouterArgs,
@@ -889,7 +2315,56 @@ func (api *APIv0) worker(parent context.Context, logobj *storage.Log) *APIWorker
 		Logobj:     logobj,
 		group:      group,
 		ctx:        ctx,
+		query:      q,
+	}
+}
+
+// funcLogPlan は、スナップショットから calls テーブルまたは frames テーブルを読み出すプランを作成する。
+// live がtrueなら、書き込み中のログとして扱う。
+func funcLogPlan(logobj *storage.Log, snapshot *storage.LogSnapshot, table string, sel *sql.SelectParser, live bool) *sql.Plan {
+	stats := sql.PlanStats{
+		Records: snapshot.FuncLogRecords(),
+		Live:    live,
+		Lookup: func(hint sql.IndexHint) ([]types.FuncLogID, bool) {
+			return funcLogIDsByHint(logobj, hint)
+		},
+	}
+	logobj.Index(func(index *storage.Index) {
+		for i := int64(0); i < index.Len(); i++ {
+			stats.Index = append(stats.Index, index.Get(i))
+		}
+	})
+	return sql.NewFuncLogPlan(table, sel, stats)
+}
+
+// logTime は、インデックスから logobj に記録されている期間を求める。
+// まだファイルに書き出されていないレコードは含まない。
+func logTime(logobj *storage.Log) *sql.LogTime {
+	rec := storage.NewIndexRecord()
+	logobj.Index(func(index *storage.Index) {
+		for i := int64(0); i < index.Len(); i++ {
+			rec.Merge(index.Get(i))
+		}
+	})
+	lt := &sql.LogTime{}
+	if !rec.IsEmpty() {
+		lt.Start = rec.MinStart
+		lt.End = rec.MaxEnd
+		if lt.End < rec.MaxStart {
+			// 実行中の関数呼び出ししか無い。
+			lt.End = rec.MaxStart
+		}
+	}
+	return lt
+}
+
+// funcLogIDsByHint は、ヒントを満たす可能性のあるFuncLogのIDを、セカンダリインデックスを使用して求める。
+// ログのインデックスが無効な場合は、okがfalseになる。
+func funcLogIDsByHint(logobj *storage.Log, hint sql.IndexHint) (ids []types.FuncLogID, ok bool) {
+	if hint.GIDs != nil {
+		return logobj.FuncLogIDsByGID(hint.GIDs...)
 	}
+	return logobj.FuncLogIDsByFuncName(hint.Funcs...)
 }
 
 func (w *APIWorker) wait() error {
@@ -899,6 +2374,97 @@ func (w *APIWorker) wait() error {
 // readFuncLog は指定された範囲のレコードを読み出し、後続のフィルタに送る。
 // minId, maxId に負の値が指定された場合、全レコードを後続のフィルタへ送る。
 func (w *APIWorker) readFuncLog(minId, maxId types.FuncLogID) *FuncLogAPIWorker {
+	return w.readFuncLogWith(func(snapshot *storage.LogSnapshot, send func(fl *types.FuncLog) bool) (types.FuncLogID, error) {
+		n := snapshot.FuncLogRecords()
+		if minId < 0 {
+			minId = 0
+		}
+		if maxId < 0 || types.FuncLogID(n) < maxId {
+			maxId = types.FuncLogID(n)
+		}
+		log.Printf("readFuncLog: start")
+		log.Printf("readFuncLog: minId=%d maxId=%d", minId, maxId)
+		for id := minId; id < maxId; id++ {
+			fl := types.FuncLogPool.Get().(*types.FuncLog)
+			err := snapshot.FuncLog(id, fl)
+			if fl.Frames == nil {
+				log.Panic("fl.Frames is nil", fl)
+			}
+			if err != nil {
+				return maxId, err
+			}
+			if !send(fl) {
+				break
+			}
+		}
+		return maxId, nil
+	})
+}
+
+// readFuncLogByIDs は、セカンダリインデックスから得たIDのレコードのみを読み出し、後続のフィルタに送る。
+// idsは昇順にソートされていなければならない。
+// ファイルに書き出されていないレコードは、インデックスに含まれていないため全て後続のフィルタへ送る。
+func (w *APIWorker) readFuncLogByIDs(ids []types.FuncLogID) *FuncLogAPIWorker {
+	return w.readFuncLogWith(func(snapshot *storage.LogSnapshot, send func(fl *types.FuncLog) bool) (types.FuncLogID, error) {
+		n := types.FuncLogID(snapshot.FuncLogRecords())
+		log.Printf("readFuncLog: start")
+		log.Printf("readFuncLog: ids=%d", len(ids))
+		for _, id := range ids {
+			if n <= id {
+				break
+			}
+			fl := types.FuncLogPool.Get().(*types.FuncLog)
+			err := snapshot.FuncLog(id, fl)
+			if fl.Frames == nil {
+				log.Panic("fl.Frames is nil", fl)
+			}
+			if err != nil {
+				return n, err
+			}
+			if !send(fl) {
+				break
+			}
+		}
+		return n, nil
+	})
+}
+
+// readFuncLogByPlan は、クエリプランに従って読み出したレコードを後続のフィルタに送る。
+// WHERE句の範囲と重ならないFuncLogファイルは読み出さない。
+// ファイルに書き出されていないレコードは、インデックスに含まれていないため全て後続のフィルタへ送る。
+func (w *APIWorker) readFuncLogByPlan(sel *sql.SelectParser) *FuncLogAPIWorker {
+	live := w.Api.SimulatorStore.Get(w.Logobj.ID) != nil
+	return w.readFuncLogWith(func(snapshot *storage.LogSnapshot, send func(fl *types.FuncLog) bool) (types.FuncLogID, error) {
+		n := types.FuncLogID(snapshot.FuncLogRecords())
+		plan := funcLogPlan(w.Logobj, snapshot, sel.From(), sel, live)
+		log.Printf("readFuncLog: start")
+		log.Printf("readFuncLog: plan=%s", plan)
+		next := plan.Iterator()
+		for id, ok := next(); ok; id, ok = next() {
+			fl := types.FuncLogPool.Get().(*types.FuncLog)
+			err := snapshot.FuncLog(id, fl)
+			if fl.Frames == nil {
+				log.Panic("fl.Frames is nil", fl)
+			}
+			if err != nil {
+				return n, err
+			}
+			if !send(fl) {
+				break
+			}
+		}
+		return n, nil
+	})
+}
+
+// readFuncLogWith は、readFile()でスナップショットからレコードを読み出した後、シミュレータのみが保持しているレコードを後続のフィルタに送る。
+// readFile()は、シミュレータから読み出すレコードのIDの下限を返す。
+// スナップショットから読み出したレコードがシミュレータ上で更新されていた場合は、最新の状態に置き換えてから送る。
+// そのため、実行中の関数は EndTime が types.NotEnded のレコードとして送られる。
+//
+// シミュレータは、レコードをコミットした後でそのレコードを削除する。
+// レコードを見失わないように、シミュレータのレコードを取得してからスナップショットを作成する。
+func (w *APIWorker) readFuncLogWith(readFile func(snapshot *storage.LogSnapshot, send func(fl *types.FuncLog) bool) (types.FuncLogID, error)) *FuncLogAPIWorker {
 	ch := make(chan *types.FuncLog, w.BufferSize)
 	newctx, cancel := context.WithCancel(w.ctx)
 	fw := &FuncLogAPIWorker{
@@ -914,55 +2480,55 @@ func (w *APIWorker) readFuncLog(minId, maxId types.FuncLogID) *FuncLogAPIWorker
 		defer close(ch)
 		defer log.Print("readFuncLog: done")
 		log.Println("readFuncLog: read from file")
-		var err error
-		w.Logobj.FuncLog(func(store *storage.FuncLogStore) {
-			n := store.Records()
-			if minId < 0 {
-				minId = 0
-			}
-			if maxId < 0 || types.FuncLogID(n) < maxId {
-				maxId = types.FuncLogID(n)
+		var maxId types.FuncLogID
+		canceled := false
+		// 読み出した行数が上限を超えたときのエラー。
+		var scanErr error
+		send := func(fl *types.FuncLog) bool {
+			if scanErr = w.query.scan(); scanErr != nil {
+				return false
 			}
-			log.Printf("readFuncLog: start")
-			log.Printf("readFuncLog: minId=%d maxId=%d", minId, maxId)
-			for id := minId; id < maxId; id++ {
-				fl := types.FuncLogPool.Get().(*types.FuncLog)
-				err = store.GetNolock(id, fl)
-				if fl.Frames == nil {
-					log.Panic("fl.Frames is nil", fl)
-				}
-				if err != nil {
-					return
-				}
-				select {
-				case ch <- fl:
-				case <-fw.readCtx.Done():
-					return
-				}
+			select {
+			case ch <- fl:
+				return true
+			case <-fw.readCtx.Done():
+				canceled = true
+				return false
 			}
-		})
+		}
+
+		simFuncLogs := simulatorFuncLogs(w.Api.SimulatorStore.Get(w.Logobj.ID))
+		snapshot, err := w.Logobj.Snapshot()
+		var live liveFuncLogs
+		if err == nil {
+			live = newLiveFuncLogs(simFuncLogs, snapshot.FuncLogRecords())
+			maxId, err = readFile(snapshot, func(fl *types.FuncLog) bool {
+				live.overlay(fl)
+				return send(fl)
+			})
+		}
 		if err != nil {
 			w.Logger.Println(errors.Wrap(err, "failed to read FuncLogFile"))
 			return err
 		}
+		if scanErr != nil {
+			return scanErr
+		}
+		if canceled {
+			return nil
+		}
 
-		log.Println("readFuncLog: try to read from simulator")
-		ss := w.Api.SimulatorStore.Get(w.Logobj.ID)
-		if ss != nil {
-			log.Println("readFuncLog: read from simulator")
-			for _, fl := range ss.FuncLogs(true) {
-				if fl.Frames == nil {
-					log.Panic("fl.Frames is nil", fl)
-				}
-				if fl.ID < maxId {
-					// 既に出力済みなのでスキップする
-					continue
-				}
-				select {
-				case ch <- fl:
-				case <-fw.readCtx.Done():
-					return nil
-				}
+		log.Println("readFuncLog: read from simulator")
+		for _, fl := range live.added {
+			if fl.Frames == nil {
+				log.Panic("fl.Frames is nil", fl)
+			}
+			if fl.ID < maxId {
+				// 既に出力済みなのでスキップする
+				continue
+			}
+			if !send(fl) {
+				return scanErr
 			}
 		}
 		return nil
@@ -977,6 +2543,18 @@ func (w *FuncLogAPIWorker) nextWorker(inCh chan *types.FuncLog) *FuncLogAPIWorke
 	return worker
 }
 
+// evalWith は、SQLの式を評価する fn() を実行する。
+// 式の評価に失敗したときは sql.EvalError を返し、それ以外は fn() が返したエラーを返す。
+func evalWith(fn func() error) error {
+	var err error
+	if evalErr := sql.Eval(func() {
+		err = fn()
+	}); evalErr != nil {
+		return evalErr
+	}
+	return err
+}
+
 // filterFuncLog は、isFiltered()がtrueを返したレコードを除外する。
 func (w *FuncLogAPIWorker) filterFuncLog(isFiltered func(fl *types.FuncLog) bool) *FuncLogAPIWorker {
 	if isFiltered == nil {
@@ -988,25 +2566,28 @@ func (w *FuncLogAPIWorker) filterFuncLog(isFiltered func(fl *types.FuncLog) bool
 		log.Print("filterFuncLog: start")
 		defer close(ch)
 		defer log.Print("filterFuncLog: done")
-		for {
-			select {
-			case evt, ok := <-w.inCh:
-				if !ok {
-					return nil
-				}
-				if ok && !isFiltered(evt) {
-					select {
-					case ch <- evt:
-					case <-w.readCtx.Done():
-						return nil
+		// isFiltered() はWHERE句を評価するため、評価に失敗したらクエリを中止する。
+		return sql.Eval(func() {
+			for {
+				select {
+				case evt, ok := <-w.inCh:
+					if !ok {
+						return
 					}
-				} else {
-					types.FuncLogPool.Put(evt)
+					if !isFiltered(evt) {
+						select {
+						case ch <- evt:
+						case <-w.readCtx.Done():
+							return
+						}
+					} else {
+						types.FuncLogPool.Put(evt)
+					}
+				case <-w.readCtx.Done():
+					return
 				}
-			case <-w.readCtx.Done():
-				return nil
 			}
-		}
+		})
 	})
 	return w.nextWorker(ch)
 }
@@ -1064,107 +2645,116 @@ func (w *FuncLogAPIWorker) sortAndLimit(less func(f1, f2 *types.FuncLog) bool, o
 	}
 
 	w.api.group.Go(func() error {
-		log.Printf("sortAndLimit: start offset=%d rows=%d", offset, rows)
-		defer w.stopReader()
-		defer close(ch)
-		defer func() {
-			log.Printf("sortAndLimit: done exec-time=%s", time.Since(start).String())
-		}()
-		var items []*types.FuncLog
+		// less() はORDER BY句の列を評価するため、評価に失敗したらクエリを中止する。
+		return evalWith(func() error {
+			log.Printf("sortAndLimit: start offset=%d rows=%d", offset, rows)
+			defer w.stopReader()
+			defer close(ch)
+			defer func() {
+				log.Printf("sortAndLimit: done exec-time=%s", time.Since(start).String())
+			}()
+			var items []*types.FuncLog
+
+			// sort関数用の比較関数。
+			sortComparator := func(i, j int) bool {
+				return less(items[i], items[j])
+			}
+			// heap sortをするための比較関数。
+			// heap内の値がより小さくなるようにするために、heapの先頭は最も大きな値が来るようにする。
+			// そのため、比較関数のi, jを入れ替えている。
+			heapComparator := func(j, i int) bool {
+				return less(items[i], items[j])
+			}
 
-		// sort関数用の比較関数。
-		sortComparator := func(i, j int) bool {
-			return less(items[i], items[j])
-		}
-		// heap sortをするための比較関数。
-		// heap内の値がより小さくなるようにするために、heapの先頭は最も大きな値が来るようにする。
-		// そのため、比較関数のi, jを入れ替えている。
-		heapComparator := func(j, i int) bool {
-			return less(items[i], items[j])
-		}
+			if rows <= 0 {
+				// read all items from input.
+			ReadAllLoop:
+				for {
+					select {
+					case evt, ok := <-w.inCh:
+						if ok {
+							items = append(items, evt)
+							if err := w.api.query.buffer(int64(len(items))); err != nil {
+								return err
+							}
+						} else {
+							break ReadAllLoop
+						}
+					case <-w.sortCtx.Done():
+						return nil
+					}
+				}
+			} else {
+				// read limited items from input.
+				h := GenericHeap{
+					LenFn:  func() int { return len(items) },
+					LessFn: heapComparator,
+					SwapFn: func(i, j int) { items[i], items[j] = items[j], items[i] },
+					PushFn: func(x interface{}) { items = append(items, x.(*types.FuncLog)) },
+					PopFn: func() interface{} {
+						n := len(items)
+						last := items[n-1]
+						items = items[:n-1]
+						return last
+					},
+				}
 
-		if rows <= 0 {
-			// read all items from input.
-		ReadAllLoop:
-			for {
-				select {
-				case evt, ok := <-w.inCh:
-					if ok {
-						items = append(items, evt)
-					} else {
-						break ReadAllLoop
+				// fill the items slice from inCh.
+			FillItemsLoop:
+				for int64(len(items)) < offset+rows {
+					select {
+					case evt, ok := <-w.inCh:
+						if ok {
+							items = append(items, evt)
+							if err := w.api.query.buffer(int64(len(items))); err != nil {
+								return err
+							}
+						} else {
+							break FillItemsLoop
+						}
+					case <-w.sortCtx.Done():
+						return nil
 					}
-				case <-w.sortCtx.Done():
-					return nil
 				}
-			}
-		} else {
-			// read limited items from input.
-			h := GenericHeap{
-				LenFn:  func() int { return len(items) },
-				LessFn: heapComparator,
-				SwapFn: func(i, j int) { items[i], items[j] = items[j], items[i] },
-				PushFn: func(x interface{}) { items = append(items, x.(*types.FuncLog)) },
-				PopFn: func() interface{} {
-					n := len(items)
-					last := items[n-1]
-					items = items[:n-1]
-					return last
-				},
-			}
+				heap.Init(&h)
 
-			// fill the items slice from inCh.
-		FillItemsLoop:
-			for int64(len(items)) < offset+rows {
-				select {
-				case evt, ok := <-w.inCh:
-					if ok {
-						items = append(items, evt)
-					} else {
-						break FillItemsLoop
+			UpdateItemsLoop:
+				for {
+					select {
+					case evt, ok := <-w.inCh:
+						if ok {
+							if less(evt, items[0]) {
+								// replace a largest item with smaller item.
+								items[0] = evt
+								heap.Fix(&h, 0)
+							}
+						} else {
+							break UpdateItemsLoop
+						}
+					case <-w.sortCtx.Done():
+						return nil
 					}
-				case <-w.sortCtx.Done():
-					return nil
 				}
 			}
-			heap.Init(&h)
 
-		UpdateItemsLoop:
-			for {
+			// sort all items.
+			sort.Slice(items, sortComparator)
+			// skip some items.
+			if int64(len(items)) <= offset {
+				items = nil
+			} else {
+				items = items[offset:]
+			}
+			// send all items to next worker.
+			for i := range items {
 				select {
-				case evt, ok := <-w.inCh:
-					if ok {
-						if less(evt, items[0]) {
-							// replace a largest item with smaller item.
-							items[0] = evt
-							heap.Fix(&h, 0)
-						}
-					} else {
-						break UpdateItemsLoop
-					}
+				case ch <- items[i]:
 				case <-w.sortCtx.Done():
 					return nil
 				}
 			}
-		}
-
-		// sort all items.
-		sort.Slice(items, sortComparator)
-		// skip some items.
-		if int64(len(items)) <= offset {
-			items = nil
-		} else {
-			items = items[offset:]
-		}
-		// send all items to next worker.
-		for i := range items {
-			select {
-			case ch <- items[i]:
-			case <-w.sortCtx.Done():
-				return nil
-			}
-		}
-		return nil
+			return nil
+		})
 	})
 	return w.nextWorker(ch)
 }
@@ -1182,7 +2772,8 @@ func (w *FuncLogAPIWorker) sendTo(send func(fl *types.FuncLog) error) {
 			}
 		}()
 
-		return util.PanicHandler(func() {
+		// send() は出力する列の値を評価するため、評価に失敗したらクエリを中止する。
+		return evalWith(func() error {
 			for {
 				select {
 				case evt, ok := <-w.inCh:
@@ -1190,14 +2781,14 @@ func (w *FuncLogAPIWorker) sendTo(send func(fl *types.FuncLog) error) {
 						if err := send(evt); err != nil {
 							w.stopReader()
 							w.api.Logger.Println(errors.Wrap(err, "failed to send()"))
-							panic(err)
+							return err
 						}
 						types.FuncLogPool.Put(evt)
 					} else {
-						return
+						return nil
 					}
 				case <-w.sendCtx.Done():
-					return
+					return nil
 				}
 			}
 		})
@@ -1213,18 +2804,137 @@ func (h *GenericHeap) Pop() interface{}   { return h.PopFn() }
 type csvResponse struct {
 	SetUpRow    func() error
 	WriteHeader func() error
+	WriteFooter func() error
 	Read        func() error
 	Where       func() bool
 	Send        func() error
 
+	// ORDER BY句が指定されたときに使用する。
+	// Save は、現在の行のコピーを返す。
+	// Load は、Save で保存した行を現在の行にする。
+	// Less は、Save で保存した2つの行を比較する。
+	Save func() interface{}
+	Load func(v interface{})
+	Less func(a, b interface{}) bool
+
 	Offset, Rows int64
-	lineno       int64
+	// 実行中のクエリ。ソートと集約のためにメモリ上に保持する行数を報告する。
+	Query  *query
+	lineno int64
+	items  []interface{}
+}
+
+// sortedFrame は、ソート中のframesテーブルの1行を保持する。
+type sortedFrame struct {
+	FuncLog *types.FuncLog
+	Offset  int
+}
+
+// orderBy は、ORDER BY句に従って行を並び替えるように設定する。
+// newRow は、比較用の行を作成する。save と load は、row の現在の値を保存・復元する。
+// ORDER BY句が指定されていなければ、何もしない。
+func (r *csvResponse) orderBy(
+	sel *sql.SelectParser,
+	row sql.SqlRow,
+	newRow func() sql.SqlRow,
+	save func() interface{},
+	load func(row sql.SqlRow, v interface{}),
+) error {
+	a, b := newRow(), newRow()
+	less, err := sel.Less(a, b)
+	if err != nil {
+		return err
+	}
+	if less == nil {
+		return nil
+	}
+	r.Save = save
+	r.Load = func(v interface{}) {
+		load(row, v)
+	}
+	r.Less = func(x, y interface{}) bool {
+		load(a, x)
+		load(b, y)
+		return less()
+	}
+	return nil
+}
+
+// groupBy は、読み出した行をグループごとに集計して、集計結果を送信するように設定する。
+// 戻り値は、送信するグループを表す行である。
+func (r *csvResponse) groupBy(sel *sql.SelectParser, row sql.SqlRow) (sql.SqlRow, error) {
+	groups, err := sel.NewGroups(row)
+	if err != nil {
+		return nil, err
+	}
+	out := &sql.SqlGroupRow{
+		Groups: groups,
+		Index:  -1,
+	}
+	having := sel.Having()
+	if having == nil {
+		having = sql.SqlBool(true)
+	}
+	err = util.PanicHandler(func() {
+		having.WithRow(out)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	setUpRow, read, where := r.SetUpRow, r.Read, r.Where
+	// ヘッダを書き込む前に全ての行を集計する。
+	// 集計中に発生したエラーは、クライアントに返す。
+	r.SetUpRow = func() error {
+		if err := setUpRow(); err != nil {
+			return err
+		}
+		for {
+			err := read()
+			if err == io.EOF {
+				return nil
+			} else if err != nil {
+				return err
+			}
+			if where() {
+				if err := groups.Add(); err != nil {
+					return badQuery(err)
+				}
+				if err := r.Query.buffer(int64(groups.Len())); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	r.Read = func() error {
+		if groups.Len() <= out.Index+1 {
+			return io.EOF
+		}
+		out.Index++
+		return nil
+	}
+	r.Where = having.Bool
+
+	err = r.orderBy(sel, out, func() sql.SqlRow {
+		return &sql.SqlGroupRow{Groups: groups}
+	}, func() interface{} {
+		return out.Index
+	}, func(dst sql.SqlRow, v interface{}) {
+		dst.(*sql.SqlGroupRow).Index = v.(int)
+	})
+	return out, err
 }
 
 func (r *csvResponse) Run(w http.ResponseWriter) {
-	err := r.SetUpRow()
+	// 行を読み出しながらWHERE句や出力する列を評価するため、評価に失敗したらクエリを中止する。
+	err := evalWith(r.SetUpRow)
+	if err == nil && r.Less != nil {
+		// ソートする行は、ヘッダを書き込む前に全て読み出す。
+		// 読み出し中に発生したエラーは、クライアントに返す。
+		err = evalWith(r.readSorted)
+	}
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		queryError(w, err, false)
 		return
 	}
 	err = r.WriteHeader()
@@ -1232,33 +2942,128 @@ func (r *csvResponse) Run(w http.ResponseWriter) {
 		log.Println(errors.Wrap(err, "write error"))
 		return
 	}
+	if err := evalWith(r.sendRows); err != nil {
+		// ヘッダは送信済みなので、クエリを中止した理由はトレーラーで返す。
+		queryError(w, err, true)
+		log.Println(err)
+		return
+	}
+	if r.WriteFooter != nil {
+		if err := r.WriteFooter(); err != nil {
+			log.Println(errors.Wrap(err, "write error"))
+		}
+	}
+}
+
+// sendRows は、条件を満たす行を読み出して送信する。
+// ORDER BY句が指定されていれば、 readSorted() で読み出した行をソートして送信する。
+func (r *csvResponse) sendRows() error {
+	if r.Less != nil {
+		return r.sendSorted()
+	}
 	for {
 		err := r.Read()
 		if err != nil {
 			if err == io.EOF {
-				return
+				return nil
 			}
-			log.Println(errors.Wrap(err, "read error"))
-			return
+			return errors.Wrap(err, "read error")
 		}
 		if !r.Where() {
 			continue
 		}
 
 		r.lineno++
-		if r.lineno < r.Offset {
+		if r.lineno <= r.Offset {
 			continue
 		}
+		err = r.Send()
+		if err != nil {
+			return errors.Wrap(err, "write error")
+		}
 		if 0 < r.Rows && r.Offset+r.Rows <= r.lineno {
-			return
+			return nil
 		}
+	}
+}
 
-		err = r.Send()
+// readSorted は、条件を満たす全ての行を読み出して、ソート対象の行に追加する。
+func (r *csvResponse) readSorted() error {
+	for {
+		err := r.Read()
 		if err != nil {
-			log.Println(errors.Wrap(err, "write error"))
-			return
+			if err == io.EOF {
+				return nil
+			}
+			return errors.Wrap(err, "read error")
+		}
+		if !r.Where() {
+			continue
+		}
+		if err := r.push(r.Save()); err != nil {
+			return err
+		}
+	}
+}
+
+// push は、ソート対象の行を追加する。
+// LIMIT句が指定されているときは、先頭からOffset+Rows個の行だけをヒープに保持する。
+// 保持している行数が上限を超えたら、エラーを返す。
+func (r *csvResponse) push(v interface{}) error {
+	if r.Rows <= 0 || int64(len(r.items)) < r.Offset+r.Rows {
+		r.items = append(r.items, v)
+		if 0 < r.Rows && int64(len(r.items)) == r.Offset+r.Rows {
+			heap.Init(r.heap())
+		}
+		return r.Query.buffer(int64(len(r.items)))
+	}
+	if r.Less(v, r.items[0]) {
+		// replace a largest item with smaller item.
+		r.items[0] = v
+		heap.Fix(r.heap(), 0)
+	}
+	return nil
+}
+
+// heap は、heapの先頭に最も大きな値が来るようにした heap.Interface を返す。
+func (r *csvResponse) heap() heap.Interface {
+	return &GenericHeap{
+		LenFn: func() int { return len(r.items) },
+		LessFn: func(i, j int) bool {
+			return r.Less(r.items[j], r.items[i])
+		},
+		SwapFn: func(i, j int) { r.items[i], r.items[j] = r.items[j], r.items[i] },
+		PushFn: func(x interface{}) { r.items = append(r.items, x) },
+		PopFn: func() interface{} {
+			n := len(r.items)
+			last := r.items[n-1]
+			r.items = r.items[:n-1]
+			return last
+		},
+	}
+}
+
+// sendSorted は、ソートした行のうち、先頭からOffset個を除いた行を送信する。
+func (r *csvResponse) sendSorted() error {
+	sort.Slice(r.items, func(i, j int) bool {
+		return r.Less(r.items[i], r.items[j])
+	})
+	items := r.items
+	if int64(len(items)) <= r.Offset {
+		items = nil
+	} else {
+		items = items[r.Offset:]
+	}
+	if 0 < r.Rows && r.Rows < int64(len(items)) {
+		items = items[:r.Rows]
+	}
+	for _, v := range items {
+		r.Load(v)
+		if err := r.Send(); err != nil {
+			return errors.Wrap(err, "write error")
 		}
 	}
+	return nil
 }
 
 func parseTimestamp(value string, defaultValue types.Time) (types.Time, error) {
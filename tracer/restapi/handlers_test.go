@@ -0,0 +1,83 @@
+package restapi
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yuuki0xff/goapptrace/tracer/simulator"
+	"github.com/yuuki0xff/goapptrace/tracer/storage"
+	"github.com/yuuki0xff/goapptrace/tracer/types"
+)
+
+// withTestServer は、関数呼び出しとgoroutineを記録したログを持つAPIサーバを起動する。
+func withTestServer(t *testing.T, fn func(srv *httptest.Server, logobj *storage.Log)) {
+	a := assert.New(t)
+	tempdir, err := ioutil.TempDir("", ".goapptrace_restapi")
+	a.NoError(err)
+	defer func() {
+		a.NoError(os.RemoveAll(tempdir))
+	}()
+	st := &storage.Storage{Root: storage.DirLayout{Root: tempdir}}
+	a.NoError(st.Init())
+	defer st.Close() // nolint: errcheck
+	logobj, err := st.New()
+	a.NoError(err)
+
+	logobj.FuncLog(func(store *storage.FuncLogStore) {
+		for i := 0; i < 3; i++ {
+			fl := types.FuncLog{
+				ID:        types.FuncLogID(i),
+				StartTime: types.Time(i * 10),
+				EndTime:   types.Time(i*10 + 5),
+				ParentID:  types.NotFoundParent,
+				GID:       1,
+				Frames:    []uintptr{100},
+			}
+			a.NoError(store.SetNolock(&fl))
+			a.NoError(logobj.AddPostings(&fl))
+		}
+	})
+	logobj.Goroutine(func(store *storage.GoroutineStore) {
+		a.NoError(store.SetNolock(&types.Goroutine{GID: 1, StartTime: 0, EndTime: 30}))
+	})
+	a.NoError(logobj.Sync())
+
+	srv := httptest.NewServer(NewRouter(RouterArgs{
+		Storage:        st,
+		SimulatorStore: &simulator.StateSimulatorStore{},
+	}))
+	defer srv.Close()
+	fn(srv, logobj)
+}
+
+func TestAPIv0_divisionByZero(t *testing.T) {
+	withTestServer(t, func(srv *httptest.Server, logobj *storage.Log) {
+		get := func(path string, params url.Values) *http.Response {
+			a := assert.New(t)
+			res, err := http.Get(srv.URL + "/api/v0.1/log/" + logobj.ID.Hex() + path + "?" + params.Encode())
+			if !a.NoError(err) {
+				t.FailNow()
+			}
+			_, err = ioutil.ReadAll(res.Body)
+			a.NoError(err)
+			a.NoError(res.Body.Close())
+			return res
+		}
+
+		// ゼロ除算はクエリの誤りとして扱い、サーバを停止させない。
+		a := assert.New(t)
+		res := get("/func-call/search", url.Values{"sql": {"SELECT * FROM calls WHERE id/0 > 1"}})
+		a.Equal(http.StatusBadRequest, res.StatusCode)
+		res = get("/func-call/search", url.Values{"sql": {"SELECT * FROM calls ORDER BY id LIMIT 1"}})
+		a.Equal(http.StatusOK, res.StatusCode)
+		res = get("/search.csv", url.Values{"sql": {"SELECT gid FROM goroutines WHERE gid/0 > 1 ORDER BY gid"}})
+		a.Equal(http.StatusBadRequest, res.StatusCode)
+		res = get("/flamegraph", url.Values{"sql": {"SELECT * FROM calls WHERE id/0 > 1"}})
+		a.Equal(http.StatusBadRequest, res.StatusCode)
+	})
+}
@@ -0,0 +1,119 @@
+package restapi
+
+import (
+	"sort"
+
+	"github.com/yuuki0xff/goapptrace/tracer/types"
+)
+
+// newLeakReport は、終了していないgoroutineを集計したレポートを作成する。
+// stacks には、goroutineごとの実行中のFuncLogを、スタックの底から順に格納する。
+// now は、goroutineの生存期間を求めるときに使用する時刻である。
+func newLeakReport(goroutines []types.Goroutine, stacks map[types.GID][]*types.FuncLog, symbols *types.Symbols, now types.Time, groupBy LeakGroupKey) LeakReport {
+	report := LeakReport{
+		GroupBy: groupBy,
+		Now:     now,
+		Groups:  []LeakGroup{},
+	}
+	// GIDの昇順に処理し、グループ内のGIDも昇順に並ぶようにする。
+	goroutines = append([]types.Goroutine(nil), goroutines...)
+	sort.Slice(goroutines, func(i, j int) bool {
+		return goroutines[i].GID < goroutines[j].GID
+	})
+
+	groups := map[string]*LeakGroup{}
+	var keys []string
+	for _, g := range goroutines {
+		if g.EndTime != types.NotEnded {
+			continue
+		}
+		report.Total++
+
+		name := "?"
+		line := "?"
+		if stack := stacks[g.GID]; len(stack) > 0 {
+			fl := stack[0]
+			if groupBy == LeakGroupByTop {
+				fl = stack[len(stack)-1]
+			}
+			if len(fl.Frames) > 0 {
+				if f, ok := symbols.GoFunc(fl.Frames[0]); ok {
+					name = f.Name
+				}
+				line = symbols.FileLine(fl.Frames[0])
+			}
+		}
+
+		age := now - g.StartTime
+		group, ok := groups[name]
+		if !ok {
+			group = &LeakGroup{
+				Func:   name,
+				Line:   line,
+				MaxAge: age,
+				MinAge: age,
+			}
+			groups[name] = group
+			keys = append(keys, name)
+		}
+		group.Count++
+		group.GIDs = append(group.GIDs, g.GID)
+		if group.MaxAge < age {
+			group.MaxAge = age
+		}
+		if age < group.MinAge {
+			group.MinAge = age
+		}
+	}
+
+	for _, key := range keys {
+		group := groups[key]
+		group.Growth = group.Count
+		report.Groups = append(report.Groups, *group)
+	}
+	report.sortGroups()
+	return report
+}
+
+// Diff は、比較対象のログのレポートと比較し、グループごとのgoroutineの増加数を求める。
+// 比較対象のログにのみ存在するグループは、Countが0のグループとして追加される。
+func (r *LeakReport) Diff(baselineID string, baseline *LeakReport) {
+	r.Baseline = baselineID
+	r.BaselineTotal = baseline.Total
+
+	idx := make(map[string]int, len(r.Groups))
+	for i := range r.Groups {
+		idx[r.Groups[i].Func] = i
+		r.Groups[i].BaselineCount = 0
+		r.Groups[i].Growth = r.Groups[i].Count
+	}
+	for _, bg := range baseline.Groups {
+		i, ok := idx[bg.Func]
+		if !ok {
+			r.Groups = append(r.Groups, LeakGroup{
+				Func: bg.Func,
+				Line: bg.Line,
+				GIDs: []types.GID{},
+			})
+			i = len(r.Groups) - 1
+		}
+		r.Groups[i].BaselineCount = bg.Count
+		r.Groups[i].Growth = r.Groups[i].Count - bg.Count
+	}
+	r.sortGroups()
+}
+
+// sortGroups は、Growthの降順にグループを並び替える。
+// 比較対象のログが指定されていなければ、GrowthとCountは等しい。
+func (r *LeakReport) sortGroups() {
+	sort.SliceStable(r.Groups, func(i, j int) bool {
+		gi, gj := &r.Groups[i], &r.Groups[j]
+		if gi.Growth != gj.Growth {
+			return gi.Growth > gj.Growth
+		}
+		if gi.Count != gj.Count {
+			return gi.Count > gj.Count
+		}
+		return gi.Func < gj.Func
+	})
+}
@@ -0,0 +1,100 @@
+package restapi
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yuuki0xff/goapptrace/tracer/types"
+)
+
+func newLeakTestData() ([]types.Goroutine, map[types.GID][]*types.FuncLog, *types.Symbols) {
+	symbols := &types.Symbols{}
+	symbols.Load(types.SymbolsData{
+		Mods: []types.GoModule{
+			{Name: "main", MinPC: 100, MaxPC: 999},
+		},
+		Funcs: []types.GoFunc{
+			{Entry: 100, Name: "main.worker"},
+			{Entry: 200, Name: "main.wait"},
+			{Entry: 300, Name: "main.serve"},
+		},
+	})
+	goroutines := []types.Goroutine{
+		{GID: 3, StartTime: 50, EndTime: types.NotEnded},
+		{GID: 1, StartTime: 10, EndTime: types.NotEnded},
+		{GID: 2, StartTime: 20, EndTime: 30},
+		{GID: 4, StartTime: 60, EndTime: types.NotEnded},
+	}
+	stacks := map[types.GID][]*types.FuncLog{
+		1: {
+			{ID: 0, Frames: []uintptr{100}, GID: 1},
+			{ID: 1, Frames: []uintptr{200, 100}, GID: 1},
+		},
+		3: {
+			{ID: 5, Frames: []uintptr{100}, GID: 3},
+			{ID: 6, Frames: []uintptr{200, 100}, GID: 3},
+		},
+		4: {
+			{ID: 7, Frames: []uintptr{300}, GID: 4},
+			{ID: 8, Frames: []uintptr{200, 300}, GID: 4},
+		},
+	}
+	return goroutines, stacks, symbols
+}
+
+func TestNewLeakReport(t *testing.T) {
+	a := assert.New(t)
+	goroutines, stacks, symbols := newLeakTestData()
+
+	report := newLeakReport(goroutines, stacks, symbols, 100, LeakGroupByStart)
+	a.Equal(3, report.Total)
+	a.Len(report.Groups, 2)
+	a.Equal("main.worker", report.Groups[0].Func)
+	a.Equal(2, report.Groups[0].Count)
+	a.Equal([]types.GID{1, 3}, report.Groups[0].GIDs)
+	a.Equal(types.Time(90), report.Groups[0].MaxAge)
+	a.Equal(types.Time(50), report.Groups[0].MinAge)
+	a.Equal("main.serve", report.Groups[1].Func)
+	a.Equal(1, report.Groups[1].Count)
+
+	report = newLeakReport(goroutines, stacks, symbols, 100, LeakGroupByTop)
+	a.Len(report.Groups, 1)
+	a.Equal("main.wait", report.Groups[0].Func)
+	a.Equal(3, report.Groups[0].Count)
+}
+
+func TestLeakReport_Diff(t *testing.T) {
+	a := assert.New(t)
+	goroutines, stacks, symbols := newLeakTestData()
+	report := newLeakReport(goroutines, stacks, symbols, 100, LeakGroupByStart)
+	// main.serve を実行しているgoroutineのみが生存していた。
+	baseline := newLeakReport(goroutines[3:], stacks, symbols, 100, LeakGroupByStart)
+	baseline.Groups = append(baseline.Groups, LeakGroup{Func: "main.old", Count: 2})
+	baseline.Total += 2
+
+	report.Diff("base", &baseline)
+	a.Equal("base", report.Baseline)
+	a.Equal(3, report.BaselineTotal)
+	a.Len(report.Groups, 3)
+	// main.worker: 2 (baseline: 0)
+	a.Equal("main.worker", report.Groups[0].Func)
+	a.Equal(2, report.Groups[0].Growth)
+	// main.serve: 1 (baseline: 1)
+	a.Equal("main.serve", report.Groups[1].Func)
+	a.Equal(1, report.Groups[1].BaselineCount)
+	a.Equal(0, report.Groups[1].Growth)
+	// main.old: 0 (baseline: 2)
+	a.Equal("main.old", report.Groups[2].Func)
+	a.Equal(0, report.Groups[2].Count)
+	a.Equal(-2, report.Groups[2].Growth)
+}
+
+func TestLeakGroupKey_Parse(t *testing.T) {
+	a := assert.New(t)
+	var key LeakGroupKey
+	a.NoError(key.Parse(""))
+	a.Equal(LeakGroupByStart, key)
+	a.NoError(key.Parse("top"))
+	a.Equal(LeakGroupByTop, key)
+	a.Error(key.Parse("foo"))
+}
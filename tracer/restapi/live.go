@@ -0,0 +1,105 @@
+package restapi
+
+import (
+	"sort"
+
+	"github.com/yuuki0xff/goapptrace/tracer/simulator"
+	"github.com/yuuki0xff/goapptrace/tracer/types"
+)
+
+// liveFuncLogs は、シミュレータが保持しているFuncLogをスナップショットに重ね合わせるために使用する。
+// シミュレータのFuncLogは、スナップショットに含まれるFuncLogよりも新しい状態を表している。
+type liveFuncLogs struct {
+	// スナップショットに含まれるが、スナップショットの作成後に更新されたFuncLog。
+	updated map[types.FuncLogID]*types.FuncLog
+	// スナップショットに含まれないFuncLog。IDの昇順に並んでいる。
+	added []*types.FuncLog
+}
+
+// liveGoroutines は、シミュレータが保持しているGoroutineをスナップショットに重ね合わせるために使用する。
+type liveGoroutines struct {
+	updated map[types.GID]*types.Goroutine
+	// スナップショットに含まれないGoroutine。GIDの昇順に並んでいる。
+	added []*types.Goroutine
+}
+
+// newLiveFuncLogs は、シミュレータから取得したFuncLogを、スナップショットに含まれるものとそれ以外に分類する。
+// records は、スナップショットに含まれるFuncLogのレコード数である。
+func newLiveFuncLogs(funcLogs []*types.FuncLog, records int64) liveFuncLogs {
+	l := liveFuncLogs{
+		updated: map[types.FuncLogID]*types.FuncLog{},
+	}
+	for _, fl := range funcLogs {
+		if int64(fl.ID) < records {
+			l.updated[fl.ID] = fl
+		} else {
+			l.added = append(l.added, fl)
+		}
+	}
+	sort.Slice(l.added, func(i, j int) bool {
+		return l.added[i].ID < l.added[j].ID
+	})
+	return l
+}
+
+// overlay は、fl がシミュレータ上で更新されていれば、最新の状態に書き換える。
+func (l liveFuncLogs) overlay(fl *types.FuncLog) {
+	if newfl, ok := l.updated[fl.ID]; ok {
+		copyFuncLog(fl, newfl)
+	}
+}
+
+// newLiveGoroutines は、シミュレータから取得したGoroutineを、スナップショットに含まれるものとそれ以外に分類する。
+// records は、スナップショットに含まれるGoroutineのレコード数である。
+func newLiveGoroutines(goroutines []*types.Goroutine, records int64) liveGoroutines {
+	l := liveGoroutines{
+		updated: map[types.GID]*types.Goroutine{},
+	}
+	for _, g := range goroutines {
+		if int64(g.GID) < records {
+			l.updated[g.GID] = g
+		} else {
+			l.added = append(l.added, g)
+		}
+	}
+	sort.Slice(l.added, func(i, j int) bool {
+		return l.added[i].GID < l.added[j].GID
+	})
+	return l
+}
+
+// overlay は、g がシミュレータ上で更新されていれば、最新の状態に書き換える。
+func (l liveGoroutines) overlay(g *types.Goroutine) {
+	if newg, ok := l.updated[g.GID]; ok {
+		*g = *newg
+	}
+}
+
+// simulatorFuncLogs は、書き込み中のログについて、シミュレータが保持しているFuncLogのコピーを返す。
+// ログが書き込み中でない場合は、nilを返す。
+//
+// シミュレータは、レコードをコミットした後でそのレコードを削除する。
+// レコードを見失わないように、この関数を呼び出してからスナップショットを作成すること。
+func simulatorFuncLogs(ss *simulator.StateSimulator) []*types.FuncLog {
+	if ss == nil {
+		return nil
+	}
+	return ss.FuncLogs(true)
+}
+
+// simulatorGoroutines は、書き込み中のログについて、シミュレータが保持しているGoroutineのコピーを返す。
+// ログが書き込み中でない場合は、nilを返す。
+func simulatorGoroutines(ss *simulator.StateSimulator) []*types.Goroutine {
+	if ss == nil {
+		return nil
+	}
+	return ss.Goroutines()
+}
+
+// copyFuncLog は、dstのFramesスライスを再利用しながら src を dst にコピーする。
+func copyFuncLog(dst, src *types.FuncLog) {
+	frames := dst.Frames[:len(src.Frames)]
+	copy(frames, src.Frames)
+	*dst = *src
+	dst.Frames = frames
+}
@@ -0,0 +1,53 @@
+package restapi
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yuuki0xff/goapptrace/tracer/types"
+)
+
+func TestLiveFuncLogs(t *testing.T) {
+	a := assert.New(t)
+	live := newLiveFuncLogs([]*types.FuncLog{
+		{ID: 12, EndTime: types.NotEnded, Frames: []uintptr{3}},
+		{ID: 3, EndTime: 30, Frames: []uintptr{1, 2}},
+		{ID: 10, EndTime: types.NotEnded, Frames: []uintptr{2}},
+	}, 10)
+	a.Len(live.updated, 1)
+	a.Len(live.added, 2)
+	a.Equal(types.FuncLogID(10), live.added[0].ID)
+	a.Equal(types.FuncLogID(12), live.added[1].ID)
+
+	// スナップショット上では実行中だったが、シミュレータ上では終了している。
+	fl := types.FuncLogPool.Get().(*types.FuncLog)
+	defer types.FuncLogPool.Put(fl)
+	fl.ID = 3
+	fl.EndTime = types.NotEnded
+	fl.Frames = fl.Frames[:1]
+	live.overlay(fl)
+	a.Equal(types.Time(30), fl.EndTime)
+	a.Equal([]uintptr{1, 2}, fl.Frames)
+
+	// 更新されていないレコードは変更しない。
+	fl.ID = 4
+	fl.EndTime = 40
+	live.overlay(fl)
+	a.Equal(types.Time(40), fl.EndTime)
+}
+
+func TestLiveGoroutines(t *testing.T) {
+	a := assert.New(t)
+	live := newLiveGoroutines([]*types.Goroutine{
+		{GID: 5, EndTime: types.NotEnded},
+		{GID: 1, EndTime: types.NotEnded},
+		{GID: 2, EndTime: types.NotEnded},
+	}, 2)
+	a.Len(live.added, 2)
+	a.Equal(types.GID(2), live.added[0].GID)
+	a.Equal(types.GID(5), live.added[1].GID)
+
+	g := types.Goroutine{GID: 1, EndTime: 10}
+	live.overlay(&g)
+	a.Equal(types.NotEnded, g.EndTime)
+}
@@ -0,0 +1,342 @@
+package restapi
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/yuuki0xff/goapptrace/tracer/sql"
+	"github.com/yuuki0xff/goapptrace/tracer/types"
+)
+
+// QueryErrorTrailer は、レスポンスの送信中にクエリを中止したときに、理由を設定するHTTPトレーラーの名前である。
+// ステータスコードを送信した後では、エラーを返せないために使用する。
+const QueryErrorTrailer = "Goapptrace-Query-Error"
+
+// QueryLimits は、1つのクエリが使用できる資源の上限を表す。
+// 0の項目は、制限しない。
+type QueryLimits struct {
+	// 実行時間の上限。
+	Timeout time.Duration
+	// テーブルから読み出す行数の上限。JOINするテーブルやサブクエリで読み出した行も含む。
+	MaxScannedRows int64
+	// ソートと集約のためにメモリ上に保持する行数の上限。集約する場合はグループ数の上限になる。
+	MaxBufferedRows int64
+}
+
+// queryAbortedError は、資源の上限を超えたか、管理者によって中止されたクエリのエラーを表す。
+type queryAbortedError struct {
+	msg string
+}
+
+func (e *queryAbortedError) Error() string {
+	return e.msg
+}
+
+// isQueryAborted は、err がクエリを中止したことによるエラーであればtrueを返す。
+func isQueryAborted(err error) bool {
+	_, ok := errors.Cause(err).(*queryAbortedError)
+	return ok
+}
+
+// badQueryError は、クエリの誤りによるエラーを表す。
+// queryError() は、このエラーのみをクライアントの誤りとして扱う。
+type badQueryError struct {
+	err error
+}
+
+func (e *badQueryError) Error() string {
+	return e.err.Error()
+}
+
+func (e *badQueryError) Cause() error {
+	return e.err
+}
+
+// tableReadError は、テーブルからの行の読み出しに失敗したことによるエラーを表す。
+type tableReadError struct {
+	err error
+}
+
+func (e *tableReadError) Error() string {
+	return e.err.Error()
+}
+
+func (e *tableReadError) Cause() error {
+	return e.err
+}
+
+// badQuery は、SELECT文の準備中または評価中に発生した err を、クエリの誤りによるエラーに変換する。
+// テーブルの読み出しに失敗した場合は、クエリの誤りではないため err をそのまま返す。
+func badQuery(err error) error {
+	if err == nil || hasCause(err, func(err error) bool {
+		_, ok := err.(*tableReadError)
+		return ok
+	}) {
+		return err
+	}
+	return &badQueryError{err: err}
+}
+
+// isBadQuery は、err がクエリの誤りによるエラーであればtrueを返す。
+// 行に対して式を評価したときのエラー (sql.EvalError) も、クエリの誤りとして扱う。
+func isBadQuery(err error) bool {
+	return hasCause(err, func(err error) bool {
+		switch err.(type) {
+		case *badQueryError, *sql.EvalError:
+			return true
+		default:
+			return false
+		}
+	})
+}
+
+// hasCause は、err またはその原因となったエラーのいずれかが fn を満たせばtrueを返す。
+func hasCause(err error, fn func(err error) bool) bool {
+	for err != nil {
+		if fn(err) {
+			return true
+		}
+		cause, ok := err.(interface {
+			Cause() error
+		})
+		if !ok {
+			return false
+		}
+		err = cause.Cause()
+	}
+	return false
+}
+
+// queryManager は、実行中のクエリを管理する。
+type queryManager struct {
+	lock    sync.Mutex
+	lastID  QueryID
+	queries map[QueryID]*query
+}
+
+// query は、実行中の1つのクエリを表す。
+// 全てのメソッドは、並行して呼び出せる。
+// nilの query は、制限されず中止もされないクエリとして扱う。
+type query struct {
+	info   RunningQuery
+	limits QueryLimits
+	m      *queryManager
+
+	// ctx は、クエリが中止されるか、クライアントが切断するとキャンセルされる。
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	scanned  int64
+	buffered int64
+
+	lock sync.Mutex
+	// クエリを中止した理由。
+	err error
+}
+
+func newQueryManager() *queryManager {
+	return &queryManager{
+		queries: map[QueryID]*query{},
+	}
+}
+
+// start は、クエリの実行を開始したことを登録する。
+// クエリの実行が終了したら、 query.done() を呼び出さなければならない。
+func (m *queryManager) start(r *http.Request, logID types.LogID, sqlStmt string, limits QueryLimits) *query {
+	q := &query{
+		info: RunningQuery{
+			LogID:      logID,
+			Sql:        sqlStmt,
+			RemoteAddr: r.RemoteAddr,
+			StartTime:  types.NewTime(time.Now()),
+		},
+		limits: limits,
+		m:      m,
+	}
+	if limits.Timeout > 0 {
+		q.ctx, q.cancel = context.WithTimeout(r.Context(), limits.Timeout)
+	} else {
+		q.ctx, q.cancel = context.WithCancel(r.Context())
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.lastID++
+	q.info.ID = m.lastID
+	m.queries[q.info.ID] = q
+	return q
+}
+
+// list は、実行中のクエリをIDの昇順に返す。
+func (m *queryManager) list() []RunningQuery {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	queries := []RunningQuery{}
+	for _, q := range m.queries {
+		queries = append(queries, q.status())
+	}
+	sort.Slice(queries, func(i, j int) bool {
+		return queries[i].ID < queries[j].ID
+	})
+	return queries
+}
+
+// kill は、実行中のクエリを中止する。
+// クエリが見つからなければfalseを返す。
+func (m *queryManager) kill(id QueryID) bool {
+	m.lock.Lock()
+	q, ok := m.queries[id]
+	m.lock.Unlock()
+	if !ok {
+		return false
+	}
+	q.abort(&queryAbortedError{
+		msg: "query was killed by the administrator",
+	})
+	return true
+}
+
+// done は、クエリの実行が終了したことを登録する。
+func (q *query) done() {
+	q.cancel()
+	q.m.lock.Lock()
+	delete(q.m.queries, q.info.ID)
+	q.m.lock.Unlock()
+}
+
+// status は、クエリの現在の状態を返す。
+func (q *query) status() RunningQuery {
+	info := q.info
+	info.ScannedRows = atomic.LoadInt64(&q.scanned)
+	info.BufferedRows = atomic.LoadInt64(&q.buffered)
+	return info
+}
+
+// abort は、err を理由としてクエリを中止する。
+// 既に中止されていれば、何もしない。
+func (q *query) abort(err error) {
+	q.lock.Lock()
+	if q.err == nil {
+		q.err = err
+	}
+	q.lock.Unlock()
+	q.cancel()
+}
+
+// Err は、クエリが中止されていればその理由を返す。
+// 実行時間の上限を超えた場合は queryAbortedError を返し、クライアントが切断した場合は context.Canceled を返す。
+func (q *query) Err() error {
+	if q == nil {
+		return nil
+	}
+	select {
+	case <-q.ctx.Done():
+	default:
+		return nil
+	}
+	if q.ctx.Err() == context.DeadlineExceeded {
+		q.abort(&queryAbortedError{
+			msg: fmt.Sprintf("query exceeded the execution time limit (%s)", q.limits.Timeout),
+		})
+	}
+
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	if q.err != nil {
+		return q.err
+	}
+	return q.ctx.Err()
+}
+
+// scan は、テーブルから1行読み出す前に呼び出す。
+// 読み出した行数が上限を超えたか、クエリが中止されていればエラーを返す。
+func (q *query) scan() error {
+	if q == nil {
+		return nil
+	}
+	if err := q.Err(); err != nil {
+		return err
+	}
+	n := atomic.AddInt64(&q.scanned, 1)
+	if 0 < q.limits.MaxScannedRows && q.limits.MaxScannedRows < n {
+		err := &queryAbortedError{
+			msg: fmt.Sprintf("query scanned too many rows (limit is %d rows)", q.limits.MaxScannedRows),
+		}
+		q.abort(err)
+		return err
+	}
+	return nil
+}
+
+// buffer は、ソートまたは集約のためにメモリ上に保持している行数を n に更新する。
+// 行数が上限を超えたか、クエリが中止されていればエラーを返す。
+func (q *query) buffer(n int64) error {
+	if q == nil {
+		return nil
+	}
+	atomic.StoreInt64(&q.buffered, n)
+	if 0 < q.limits.MaxBufferedRows && q.limits.MaxBufferedRows < n {
+		err := &queryAbortedError{
+			msg: fmt.Sprintf("query used too much memory for sorting or grouping (limit is %d rows)", q.limits.MaxBufferedRows),
+		}
+		q.abort(err)
+		return err
+	}
+	return q.Err()
+}
+
+// wrapSource は、src から行を読み出すたびに q.scan() を呼び出す sql.Source を返す。
+// 読み出しに失敗したときは、 tableReadError を返す。
+func (q *query) wrapSource(src sql.Source) sql.Source {
+	read := src.Read
+	src.Read = func() error {
+		if err := q.scan(); err != nil {
+			return err
+		}
+		err := read()
+		if err != nil && err != io.EOF {
+			return &tableReadError{err: err}
+		}
+		return err
+	}
+	return src
+}
+
+// declareQueryTrailer は、レスポンスに QueryErrorTrailer を付ける可能性があることを宣言する。
+// トレーラーはchunked形式のレスポンスでしか送信できないため、ヘッダを書き込む前に呼び出さなければならない。
+func declareQueryTrailer(w http.ResponseWriter) {
+	w.Header().Set("Trailer", QueryErrorTrailer)
+}
+
+// queryError は、クエリの実行中に発生したエラーをクライアントに返す。
+// クエリの誤り (badQueryError) は400を、それ以外の予期しないエラーは500を返す。
+// レスポンスのヘッダを送信済みであれば、エラーの種類に関わらずHTTPトレーラーを使ってエラーを返す。
+// この場合は、事前に declareQueryTrailer() を呼び出しておく必要がある。
+// クライアントが切断したときは、何も返さない。
+func queryError(w http.ResponseWriter, err error, headerWritten bool) {
+	switch {
+	case errors.Cause(err) == context.Canceled:
+		return
+	case headerWritten:
+		if isQueryAborted(err) {
+			w.Header().Set(QueryErrorTrailer, errors.Cause(err).Error())
+		} else {
+			w.Header().Set(QueryErrorTrailer, err.Error())
+		}
+	case isQueryAborted(err):
+		http.Error(w, errors.Cause(err).Error(), http.StatusServiceUnavailable)
+	case errors.Cause(err) == errFuncStatsNotAvailable:
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case isBadQuery(err):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
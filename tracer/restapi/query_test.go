@@ -0,0 +1,125 @@
+package restapi
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/yuuki0xff/goapptrace/tracer/types"
+)
+
+func TestQueryManager(t *testing.T) {
+	a := assert.New(t)
+	m := newQueryManager()
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+
+	q1 := m.start(r, types.LogID{1}, "SELECT * FROM calls", QueryLimits{})
+	q2 := m.start(r, types.LogID{2}, "SELECT * FROM goroutines", QueryLimits{})
+	a.NoError(q1.scan())
+	a.NoError(q1.buffer(10))
+
+	queries := m.list()
+	if a.Len(queries, 2) {
+		a.Equal(q1.info.ID, queries[0].ID)
+		a.Equal("SELECT * FROM calls", queries[0].Sql)
+		a.Equal(int64(1), queries[0].ScannedRows)
+		a.Equal(int64(10), queries[0].BufferedRows)
+		a.Equal(q2.info.ID, queries[1].ID)
+	}
+
+	// 中止したクエリは、実行が終了するまで一覧に残る。
+	a.True(m.kill(q1.info.ID))
+	a.True(isQueryAborted(q1.Err()))
+	a.True(isQueryAborted(q1.scan()))
+	a.NoError(q2.Err())
+	a.Len(m.list(), 2)
+
+	q1.done()
+	a.Len(m.list(), 1)
+	a.False(m.kill(q1.info.ID))
+	q2.done()
+	a.Empty(m.list())
+}
+
+func TestQuery_Limits(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	t.Run("scanned-rows", func(t *testing.T) {
+		a := assert.New(t)
+		q := newQueryManager().start(r, types.LogID{}, "", QueryLimits{MaxScannedRows: 2})
+		defer q.done()
+		a.NoError(q.scan())
+		a.NoError(q.scan())
+		err := q.scan()
+		a.True(isQueryAborted(err))
+		a.Equal(err, q.Err())
+	})
+	t.Run("buffered-rows", func(t *testing.T) {
+		a := assert.New(t)
+		q := newQueryManager().start(r, types.LogID{}, "", QueryLimits{MaxBufferedRows: 2})
+		defer q.done()
+		a.NoError(q.buffer(2))
+		a.True(isQueryAborted(q.buffer(3)))
+		a.True(isQueryAborted(q.scan()))
+	})
+	t.Run("timeout", func(t *testing.T) {
+		a := assert.New(t)
+		q := newQueryManager().start(r, types.LogID{}, "", QueryLimits{Timeout: time.Millisecond})
+		defer q.done()
+		<-q.ctx.Done()
+		a.True(isQueryAborted(q.Err()))
+		a.Contains(q.Err().Error(), "time limit")
+	})
+	t.Run("disconnected", func(t *testing.T) {
+		a := assert.New(t)
+		ctx, cancel := context.WithCancel(context.Background())
+		q := newQueryManager().start(r.WithContext(ctx), types.LogID{}, "", QueryLimits{})
+		defer q.done()
+		cancel()
+		<-q.ctx.Done()
+		a.Equal(context.Canceled, q.Err())
+	})
+	t.Run("nil", func(t *testing.T) {
+		a := assert.New(t)
+		var q *query
+		a.NoError(q.scan())
+		a.NoError(q.buffer(100))
+		a.NoError(q.Err())
+	})
+}
+
+func TestQueryError(t *testing.T) {
+	aborted := &queryAbortedError{msg: "aborted"}
+	for _, tc := range []struct {
+		err           error
+		headerWritten bool
+		status        int
+		trailer       string
+	}{
+		{err: badQuery(errors.New("invalid query")), status: http.StatusBadRequest},
+		{err: errors.Wrap(badQuery(errors.New("invalid query")), "read error"), status: http.StatusBadRequest},
+		{err: errors.New("i/o error"), status: http.StatusInternalServerError},
+		{err: badQuery(&tableReadError{err: errors.New("i/o error")}), status: http.StatusInternalServerError},
+		{err: errFuncStatsNotAvailable, status: http.StatusNotFound},
+		{err: badQuery(errFuncStatsNotAvailable), status: http.StatusNotFound},
+		{err: errors.Wrap(aborted, "read error"), status: http.StatusServiceUnavailable},
+		{err: errors.Wrap(aborted, "read error"), headerWritten: true, status: http.StatusOK, trailer: "aborted"},
+		{err: errors.New("write error"), headerWritten: true, status: http.StatusOK, trailer: "write error"},
+		{err: errors.Wrap(badQuery(errors.New("invalid query")), "read error"), headerWritten: true, status: http.StatusOK, trailer: "read error: invalid query"},
+		{err: context.Canceled, status: http.StatusOK},
+	} {
+		a := assert.New(t)
+		w := httptest.NewRecorder()
+		if tc.headerWritten {
+			declareQueryTrailer(w)
+			w.WriteHeader(http.StatusOK)
+		}
+		queryError(w, tc.err, tc.headerWritten)
+		res := w.Result()
+		a.Equal(tc.status, res.StatusCode, tc.err.Error())
+		a.Equal(tc.trailer, res.Trailer.Get(QueryErrorTrailer), tc.err.Error())
+	}
+}
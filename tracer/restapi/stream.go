@@ -0,0 +1,110 @@
+package restapi
+
+import (
+	"bufio"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// LastEventIDHeader は、再接続したクライアントが最後に受け取ったイベントIDを送信するヘッダである。
+const LastEventIDHeader = "Last-Event-ID"
+
+// sseWriter は、Server-Sent Events 形式でイベントを書き出す。
+type sseWriter struct {
+	w io.Writer
+}
+
+// writeData は、data を1つのイベントとして書き出す。
+// data は改行を含んではならない。
+func (s sseWriter) writeData(data []byte) error {
+	buf := make([]byte, 0, len(data)+8)
+	buf = append(buf, "data: "...)
+	buf = append(buf, data...)
+	buf = append(buf, "\n\n"...)
+	_, err := s.w.Write(buf)
+	return err
+}
+
+// writeID は、データを持たないイベントを書き出して、クライアントが記録するイベントIDを id に更新する。
+// クライアントは、再接続するときに最後に受け取ったイベントIDを Last-Event-ID ヘッダで送信する。
+func (s sseWriter) writeID(id string) error {
+	_, err := io.WriteString(s.w, "id: "+id+"\n\n")
+	return err
+}
+
+// sseEvent は、Server-Sent Events の1つのイベントを表す。
+type sseEvent struct {
+	// イベントID。idフィールドを含まないイベントでは、HasIDがfalseになる。
+	ID    string
+	HasID bool
+	// dataフィールドの値。複数のdataフィールドは改行で連結する。
+	Data []byte
+}
+
+// sseReader は、Server-Sent Events 形式のストリームからイベントを読み出す。
+type sseReader struct {
+	r *bufio.Reader
+}
+
+func newSSEReader(r io.Reader) *sseReader {
+	return &sseReader{
+		r: bufio.NewReader(r),
+	}
+}
+
+// next は、次のイベントを返す。
+// イベントの区切りでストリームが終了したら io.EOF を、イベントの途中で終了したら io.ErrUnexpectedEOF を返す。
+func (s *sseReader) next() (sseEvent, error) {
+	var ev sseEvent
+	empty := true
+	for {
+		line, err := s.r.ReadString('\n')
+		if err != nil {
+			if err == io.EOF && empty && line == "" {
+				return ev, io.EOF
+			} else if err == io.EOF {
+				return ev, io.ErrUnexpectedEOF
+			}
+			return ev, err
+		}
+		line = strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r")
+		if line == "" {
+			if !empty {
+				return ev, nil
+			}
+			continue
+		}
+		if line[0] == ':' {
+			// コメント
+			continue
+		}
+		empty = false
+
+		field, value := line, ""
+		if i := strings.IndexByte(line, ':'); i >= 0 {
+			field = line[:i]
+			value = strings.TrimPrefix(line[i+1:], " ")
+		}
+		switch field {
+		case "id":
+			ev.ID = value
+			ev.HasID = true
+		case "data":
+			if ev.Data != nil {
+				ev.Data = append(ev.Data, '\n')
+			}
+			ev.Data = append(ev.Data, value...)
+		}
+	}
+}
+
+// resumeToken は、再接続したクライアントが指定したストリームの再開位置を返す。
+// 再開位置は、 Last-Event-ID ヘッダか from-id パラメータで指定する。
+// 指定されていなければ、空文字列を返す。
+func resumeToken(r *http.Request) string {
+	if s := r.Header.Get(LastEventIDHeader); s != "" {
+		return s
+	}
+	return r.URL.Query().Get("from-id")
+}
@@ -0,0 +1,79 @@
+package restapi
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yuuki0xff/goapptrace/tracer/types"
+)
+
+func TestSSE(t *testing.T) {
+	a := assert.New(t)
+	buf := &bytes.Buffer{}
+	sw := sseWriter{w: buf}
+	a.NoError(sw.writeData([]byte(`{"ID":1}`)))
+	a.NoError(sw.writeID("3,2"))
+	a.Equal("data: {\"ID\":1}\n\nid: 3,2\n\n", buf.String())
+
+	sr := newSSEReader(buf)
+	ev, err := sr.next()
+	a.NoError(err)
+	a.Equal(sseEvent{Data: []byte(`{"ID":1}`)}, ev)
+	ev, err = sr.next()
+	a.NoError(err)
+	a.Equal(sseEvent{ID: "3,2", HasID: true}, ev)
+	_, err = sr.next()
+	a.Equal(io.EOF, err)
+
+	// コメントと複数行のデータ
+	sr = newSSEReader(strings.NewReader(": comment\r\n\r\nid:1\ndata: a\ndata: b\n\ndata: c\n"))
+	ev, err = sr.next()
+	a.NoError(err)
+	a.Equal(sseEvent{ID: "1", HasID: true, Data: []byte("a\nb")}, ev)
+	// イベントの途中でストリームが終了した。
+	_, err = sr.next()
+	a.Equal(io.ErrUnexpectedEOF, err)
+}
+
+func TestClient_StreamFuncLogs(t *testing.T) {
+	a := assert.New(t)
+	var fromIDs []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		a.Equal("/api/v0.1/log/aa/func-call/stream", r.URL.Path)
+		a.Equal("2", r.URL.Query().Get("gid"))
+		fromIDs = append(fromIDs, r.URL.Query().Get("from-id"))
+		sw := sseWriter{w: w}
+		switch len(fromIDs) {
+		case 1:
+			sw.writeData([]byte(`{"ID":0}`)) // nolint: errcheck
+			sw.writeID("2,1")                // nolint: errcheck
+			sw.writeData([]byte(`{"ID":2}`)) // nolint: errcheck
+			w.(http.Flusher).Flush()
+			// レスポンスの途中で接続を切断する。
+			panic(http.ErrAbortHandler)
+		case 2:
+			// 最後のイベントID以降に送信したレコードは、再送される。
+			sw.writeData([]byte(`{"ID":2}`)) // nolint: errcheck
+			sw.writeData([]byte(`{"ID":1}`)) // nolint: errcheck
+			sw.writeID("3")                  // nolint: errcheck
+		}
+	}))
+	defer srv.Close()
+
+	c := Client{BaseUrl: srv.URL}
+	a.NoError(c.Init())
+	ch, eg := c.WithCtx(context.Background()).StreamFuncLogs("aa", SearchFuncLogParams{Gid: 2})
+	var ids []types.FuncLogID
+	for fl := range ch {
+		ids = append(ids, fl.ID)
+	}
+	a.NoError(eg.Wait())
+	a.Equal([]types.FuncLogID{0, 2, 1}, ids)
+	a.Equal([]string{"", "2,1"}, fromIDs)
+}
@@ -2,7 +2,10 @@ package restapi
 
 import (
 	"fmt"
+	"sort"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/yuuki0xff/goapptrace/config"
@@ -18,6 +21,430 @@ type Logs struct {
 	Logs []types.LogInfo `json:"logs"`
 }
 
+// SearchLogsParams は、ログの一覧を絞り込む条件と並び順を表す。
+type SearchLogsParams struct {
+	// 全てのラベルを持つログのみを返す。
+	Labels  types.Labels
+	AppName string
+	Host    string
+	// 最後のレコードのタイムスタンプの範囲。0の場合は制限しない。
+	MinTimestamp types.Time
+	MaxTimestamp types.Time
+	SortKey      LogSortKey
+	SortOrder    SortOrder
+}
+
+// LogSortKey は、ログの一覧の並び順を表す。
+// "label:<key>"形式の場合は、指定したラベルの値でソートする。
+type LogSortKey string
+
+const (
+	NoLogSortKey       LogSortKey = ""
+	LogSortByID        LogSortKey = "id"
+	LogSortByAppName   LogSortKey = "app-name"
+	LogSortByHost      LogSortKey = "host"
+	LogSortByTimestamp LogSortKey = "timestamp"
+	logSortByLabel                = "label:"
+)
+
+func (key *LogSortKey) Parse(s string) error {
+	switch {
+	case s == string(NoLogSortKey):
+		fallthrough
+	case s == string(LogSortByID):
+		fallthrough
+	case s == string(LogSortByAppName):
+		fallthrough
+	case s == string(LogSortByHost):
+		fallthrough
+	case s == string(LogSortByTimestamp):
+		*key = LogSortKey(s)
+		return nil
+	case strings.HasPrefix(s, logSortByLabel) && len(s) > len(logSortByLabel):
+		*key = LogSortKey(s)
+		return nil
+	default:
+		return fmt.Errorf("invalid sort key: %s", s)
+	}
+}
+
+// ToParamMap converts this to url parameters map.
+func (s SearchLogsParams) ToParamMap() map[string]string {
+	m := map[string]string{}
+	if len(s.Labels) > 0 {
+		m["label"] = s.Labels.String()
+	}
+	if s.AppName != "" {
+		m["app-name"] = s.AppName
+	}
+	if s.Host != "" {
+		m["host"] = s.Host
+	}
+	if s.MinTimestamp != 0 {
+		m["min-timestamp"] = s.MinTimestamp.NumberString()
+	}
+	if s.MaxTimestamp != 0 {
+		m["max-timestamp"] = s.MaxTimestamp.NumberString()
+	}
+	if s.SortKey != NoLogSortKey {
+		m["sort"] = string(s.SortKey)
+	}
+	if s.SortOrder != NoSortOrder {
+		m["order"] = string(s.SortOrder)
+	}
+	return m
+}
+
+func (s *SearchLogsParams) FromString(
+	label, appName, host, minTs, maxTs, sort, order string,
+) (invalidParamName string, err error) {
+	defer func() {
+		err = errors.Wrap(err, "invalid "+invalidParamName)
+	}()
+	tmp := SearchLogsParams{
+		AppName:   appName,
+		Host:      host,
+		SortOrder: AscendingSortOrder,
+	}
+	tmp.Labels, err = types.ParseLabels(label)
+	if err != nil {
+		invalidParamName = "label"
+		return
+	}
+	if minTs != "" {
+		err = tmp.MinTimestamp.FromNumberString(minTs)
+		if err != nil {
+			invalidParamName = "min-timestamp"
+			return
+		}
+	}
+	if maxTs != "" {
+		err = tmp.MaxTimestamp.FromNumberString(maxTs)
+		if err != nil {
+			invalidParamName = "max-timestamp"
+			return
+		}
+	}
+	if sort != "" {
+		err = tmp.SortKey.Parse(sort)
+		if err != nil {
+			invalidParamName = "sort"
+			return
+		}
+	}
+	if order != "" {
+		err = tmp.SortOrder.Parse(order, AscendingSortOrder)
+		if err != nil {
+			invalidParamName = "order"
+			return
+		}
+	}
+	*s = tmp
+	return
+}
+
+// Match は、infoが条件を満たしていればtrueを返す。
+func (s SearchLogsParams) Match(info types.LogInfo) bool {
+	if !info.Metadata.Labels.Match(s.Labels) {
+		return false
+	}
+	if s.AppName != "" && info.Metadata.AppName != s.AppName {
+		return false
+	}
+	if s.Host != "" && info.Metadata.Host != s.Host {
+		return false
+	}
+	ts := types.NewTime(info.Metadata.Timestamp)
+	if s.MinTimestamp != 0 && ts < s.MinTimestamp {
+		return false
+	}
+	if s.MaxTimestamp != 0 && s.MaxTimestamp < ts {
+		return false
+	}
+	return true
+}
+
+// Sort は、SortKeyとSortOrderに従ってlogsを並び替える。
+// SortKeyが指定されていない場合は何もしない。
+func (s SearchLogsParams) Sort(logs []types.LogInfo) {
+	var less func(l1, l2 *types.LogInfo) bool
+	switch {
+	case s.SortKey == NoLogSortKey:
+		return
+	case s.SortKey == LogSortByID:
+		less = func(l1, l2 *types.LogInfo) bool { return l1.ID < l2.ID }
+	case s.SortKey == LogSortByAppName:
+		less = func(l1, l2 *types.LogInfo) bool { return l1.Metadata.AppName < l2.Metadata.AppName }
+	case s.SortKey == LogSortByHost:
+		less = func(l1, l2 *types.LogInfo) bool { return l1.Metadata.Host < l2.Metadata.Host }
+	case s.SortKey == LogSortByTimestamp:
+		less = func(l1, l2 *types.LogInfo) bool { return l1.Metadata.Timestamp.Before(l2.Metadata.Timestamp) }
+	case strings.HasPrefix(string(s.SortKey), logSortByLabel):
+		key := strings.TrimPrefix(string(s.SortKey), logSortByLabel)
+		less = func(l1, l2 *types.LogInfo) bool { return l1.Metadata.Labels[key] < l2.Metadata.Labels[key] }
+	default:
+		panic(fmt.Errorf("bug: SortKey=%s", s.SortKey))
+	}
+
+	if s.SortOrder == DescendingSortOrder {
+		// 降順にするために、大小を入れ替える。
+		ascLess := less
+		less = func(l1, l2 *types.LogInfo) bool { return ascLess(l2, l1) }
+	}
+	sort.SliceStable(logs, func(i, j int) bool {
+		return less(&logs[i], &logs[j])
+	})
+}
+
+type FuncStatsList struct {
+	Funcs []types.FuncStats `json:"funcs"`
+}
+
+type EventList struct {
+	Events []types.Event `json:"events"`
+}
+
+// RunningCalls は、書き込み中のログについて、goroutineごとの実行中の関数呼び出しを表す。
+type RunningCalls struct {
+	// ログが書き込み中であればtrue。
+	// falseの場合、Goroutinesは常に空である。
+	Active bool `json:"active"`
+	// サーバがレスポンスを作成した時刻。
+	// 関数の実行時間を求めるときに使用する。
+	Now        types.Time         `json:"now"`
+	Goroutines []RunningGoroutine `json:"goroutines"`
+}
+
+// RunningGoroutine は、1つのgoroutineで実行中の関数呼び出しを表す。
+type RunningGoroutine struct {
+	GID types.GID `json:"gid"`
+	// スタックの底 (最初に呼び出された関数) から順に並んでいる。
+	Calls []RunningCall `json:"calls"`
+}
+
+// RunningCall は、実行中の関数呼び出しを表す。
+type RunningCall struct {
+	types.FuncLog
+	// 呼び出された関数の名前。不明な場合は空文字列。
+	Func string `json:"func"`
+	// 呼び出された関数のファイル名と行番号。
+	Line string `json:"line"`
+}
+
+// Elapsed は、 now の時点での関数の実行時間を返す。
+func (c *RunningCall) Elapsed(now types.Time) time.Duration {
+	return time.Duration(now - c.StartTime)
+}
+
+// CallTreeNode は、呼び出しツリーのノード (1つの関数呼び出し) を表す。
+type CallTreeNode struct {
+	types.FuncLog
+	// 呼び出された関数の名前。不明な場合は空文字列。
+	Func string `json:"func"`
+	// 呼び出された関数のファイル名と行番号。
+	Line string `json:"line"`
+	// この関数から直接呼び出された関数呼び出しの数。
+	ChildCount int `json:"child-count"`
+	// ChildCount のうち、実行中の関数呼び出しの数。
+	RunningChildCount int `json:"running-child-count"`
+	// 直接呼び出した関数の実行時間の合計。実行中の関数呼び出しは含まない。
+	ChildTime types.Time `json:"child-time"`
+	// 直接呼び出した関数呼び出しのノード。IDの昇順に並んでいる。
+	// 子ノードを展開しなかった場合はnilになる。
+	Children []CallTreeNode `json:"children,omitempty"`
+}
+
+// CallTreeNodeList は、子ノードを展開していない CallTreeNode の一覧である。
+type CallTreeNodeList struct {
+	Nodes []CallTreeNode `json:"nodes"`
+}
+
+// SearchFormat は、SQLクエリの結果の出力形式を表す。
+type SearchFormat string
+
+const (
+	// CSV形式で出力する。1行目はヘッダである。
+	CsvFormat SearchFormat = "csv"
+	// 1行に1つのJSONオブジェクトを出力する (JSON Lines)。
+	JsonFormat SearchFormat = "json"
+	// 全ての行を、JSONオブジェクトの配列として出力する。
+	JsonArrayFormat SearchFormat = "json-array"
+)
+
+// Parse は、文字列からSearchFormatを設定する。
+func (f *SearchFormat) Parse(s string) error {
+	switch SearchFormat(s) {
+	case CsvFormat, JsonFormat, JsonArrayFormat:
+		*f = SearchFormat(s)
+	default:
+		return fmt.Errorf("%s format is not supported", s)
+	}
+	return nil
+}
+
+// DatetimeFormat は、JSON形式で出力するときの日時の形式を表す。
+type DatetimeFormat string
+
+const (
+	// UNIX時間 (ナノ秒) の整数で出力する。
+	NsDatetimeFormat DatetimeFormat = "ns"
+	// RFC3339形式の文字列で出力する。終了していない関数やgoroutineの終了時刻はnullになる。
+	RFC3339DatetimeFormat DatetimeFormat = "rfc3339"
+)
+
+// Parse は、文字列からDatetimeFormatを設定する。空文字列の場合は NsDatetimeFormat になる。
+func (f *DatetimeFormat) Parse(s string) error {
+	switch DatetimeFormat(s) {
+	case "":
+		*f = NsDatetimeFormat
+	case NsDatetimeFormat, RFC3339DatetimeFormat:
+		*f = DatetimeFormat(s)
+	default:
+		return fmt.Errorf("invalid datetime format: %s", s)
+	}
+	return nil
+}
+
+// SearchParams は、SQLクエリの結果の出力方法を表す。
+type SearchParams struct {
+	Format SearchFormat
+	// JSON形式で出力するときの日時の形式。CSV形式では無視される。
+	Datetime DatetimeFormat
+	// クエリの実行時間の上限。0ならサーバの設定に従う。
+	// サーバに設定された上限よりも長い時間は指定できない。
+	Timeout time.Duration
+}
+
+// ToParamMap converts this to url parameters map.
+func (p SearchParams) ToParamMap() map[string]string {
+	m := map[string]string{}
+	if p.Format != "" {
+		m["format"] = string(p.Format)
+	}
+	if p.Datetime != "" {
+		m["datetime"] = string(p.Datetime)
+	}
+	if p.Timeout > 0 {
+		m["timeout"] = p.Timeout.String()
+	}
+	return m
+}
+
+// QueryID は、実行中のクエリを識別するIDである。
+type QueryID int64
+
+// RunningQuery は、サーバで実行中のクエリの状態を表す。
+type RunningQuery struct {
+	ID    QueryID     `json:"id"`
+	LogID types.LogID `json:"log-id"`
+	// 実行中のSQL文。
+	Sql string `json:"sql"`
+	// クエリを実行したクライアントのアドレス。
+	RemoteAddr string     `json:"remote-addr"`
+	StartTime  types.Time `json:"start-time"`
+	// これまでにテーブルから読み出した行数。
+	ScannedRows int64 `json:"scanned-rows"`
+	// ソートと集約のためにメモリ上に保持している行数。
+	BufferedRows int64 `json:"buffered-rows"`
+}
+
+type RunningQueries struct {
+	Queries []RunningQuery `json:"queries"`
+}
+
+// View は、SQLクエリからテーブルとして参照できる、保存されたSELECT文を表す。
+type View struct {
+	// ビューを参照できるアプリケーション名。
+	// config.ViewAnyApp なら、全てのアプリケーションから参照できる。
+	App string `json:"app"`
+	config.View
+}
+
+type ViewList struct {
+	Views []View `json:"views"`
+}
+
+// LeakGroupKey は、goroutineリークレポートでgoroutineをグループ化する方法を表す。
+type LeakGroupKey string
+
+const (
+	// goroutineの開始時に呼び出された関数でグループ化する。
+	// go文の位置は記録されていないため、goroutineの作成箇所の代わりに使用する。
+	LeakGroupByStart LeakGroupKey = "start"
+	// スタックトップの関数でグループ化する。
+	// goroutineがブロックしている箇所を探すときに使用する。
+	LeakGroupByTop LeakGroupKey = "top"
+)
+
+// Parse は、文字列からLeakGroupKeyを設定する。空文字列の場合は LeakGroupByStart になる。
+func (key *LeakGroupKey) Parse(s string) error {
+	switch LeakGroupKey(s) {
+	case "":
+		*key = LeakGroupByStart
+	case LeakGroupByStart, LeakGroupByTop:
+		*key = LeakGroupKey(s)
+	default:
+		return fmt.Errorf("invalid group key: %s", s)
+	}
+	return nil
+}
+
+// LeakReportParams は、goroutineリークレポートの作成方法を表す。
+type LeakReportParams struct {
+	GroupBy LeakGroupKey
+	// 比較対象のログのID。空文字列の場合は比較しない。
+	Baseline string
+}
+
+// ToParamMap converts this to url parameters map.
+func (p LeakReportParams) ToParamMap() map[string]string {
+	m := map[string]string{}
+	if p.GroupBy != "" {
+		m["group-by"] = string(p.GroupBy)
+	}
+	if p.Baseline != "" {
+		m["baseline"] = p.Baseline
+	}
+	return m
+}
+
+// LeakReport は、終了していないgoroutineをグループごとに集計した結果を表す。
+// 終了したログでは、プロセスの終了時に生存していたgoroutineがリークしたgoroutineである。
+type LeakReport struct {
+	// ログが書き込み中であればtrue。
+	// trueの場合、現在生存しているgoroutineを集計する。
+	Active  bool         `json:"active"`
+	GroupBy LeakGroupKey `json:"group-by"`
+	// goroutineの生存期間を求めるときに使用した時刻。
+	// 終了したログでは、最後のレコードのタイムスタンプである。
+	Now types.Time `json:"now"`
+	// 生存していたgoroutineの数
+	Total int `json:"total"`
+	// 比較対象のログのID。比較しなかった場合は空文字列。
+	Baseline      string `json:"baseline,omitempty"`
+	BaselineTotal int    `json:"baseline-total"`
+	// Groups は、goroutineの数の降順に並んでいる。
+	// 比較対象のログが指定されている場合は、増加数の降順に並んでいる。
+	Groups []LeakGroup `json:"groups"`
+}
+
+// LeakGroup は、同じ関数でグループ化したgoroutineの集計結果を表す。
+type LeakGroup struct {
+	// グループ化に使用した関数の名前。不明な場合は"?"。
+	Func string `json:"func"`
+	// グループ化に使用した関数のファイル名と行番号。
+	// グループ内の最初のgoroutineのものである。
+	Line  string      `json:"line"`
+	Count int         `json:"count"`
+	GIDs  []types.GID `json:"gids"`
+	// グループ内で最も古いgoroutineと、最も新しいgoroutineの生存期間。
+	MaxAge types.Time `json:"max-age"`
+	MinAge types.Time `json:"min-age"`
+	// 比較対象のログにおけるgoroutineの数と、そこからの増加数。
+	BaselineCount int `json:"baseline-count"`
+	Growth        int `json:"growth"`
+}
+
 type SortKey string
 
 func (key *SortKey) Parse(s string) error {
@@ -62,7 +489,11 @@ type SearchFuncLogParams struct {
 	Limit        int64
 	SortKey      SortKey
 	SortOrder    SortOrder
-	Sql          string
+	// After と Before は、ページングに使用するカーソルである。
+	// Afterを指定するとカーソルより後ろのレコードを、Beforeを指定するとカーソルより前のレコードを返す。
+	After  Cursor
+	Before Cursor
+	Sql    string
 }
 
 // ToParamMap converts this to url parameters map.
@@ -92,6 +523,12 @@ func (s SearchFuncLogParams) ToParamMap() map[string]string {
 	if s.SortOrder != NoSortOrder {
 		m["order"] = string(s.SortOrder)
 	}
+	if s.After != "" {
+		m["after"] = string(s.After)
+	}
+	if s.Before != "" {
+		m["before"] = string(s.Before)
+	}
 	if s.Sql != "" {
 		m["sql"] = s.Sql
 	}
@@ -99,7 +536,7 @@ func (s SearchFuncLogParams) ToParamMap() map[string]string {
 }
 
 func (s *SearchFuncLogParams) FromString(
-	gid, minId, maxId, minTs, maxTs, limit, sort, order, sql string,
+	gid, minId, maxId, minTs, maxTs, limit, sort, order, after, before, sql string,
 ) (invalidParamName string, err error) {
 	defer func() {
 		err = errors.Wrap(err, "invalid "+invalidParamName)
@@ -111,8 +548,10 @@ func (s *SearchFuncLogParams) FromString(
 		MinTimestamp: -1,
 		MaxTimestamp: -1,
 		Limit:        -1,
-		SortKey:      "",
-		SortOrder:    AscendingSortOrder,
+		SortKey:      NoSortKey,
+		SortOrder:    NoSortOrder,
+		After:        Cursor(after),
+		Before:       Cursor(before),
 		Sql:          sql,
 	}
 	if gid != "" {
@@ -165,7 +604,7 @@ func (s *SearchFuncLogParams) FromString(
 		}
 	}
 	if order != "" {
-		err = tmp.SortOrder.Parse(order, AscendingSortOrder)
+		err = tmp.SortOrder.Parse(order, NoSortOrder)
 		if err != nil {
 			invalidParamName = "order"
 			return
@@ -176,3 +615,167 @@ func (s *SearchFuncLogParams) FromString(
 	err = nil
 	return
 }
+
+// FuncLogPage は、関数呼び出しの検索結果の1ページである。
+type FuncLogPage struct {
+	Records []types.FuncLog
+	// 次のページと前のページを読み出すためのカーソル。
+	// ページが存在しなければ空文字列になる。
+	Next Cursor
+	Prev Cursor
+}
+
+// SearchGoroutinesParams は、goroutineの検索条件を表す。
+type SearchGoroutinesParams struct {
+	MinTimestamp types.Time
+	MaxTimestamp types.Time
+	Limit        int64
+	// SortByID を指定すると、GIDの順に並べる。
+	SortKey   SortKey
+	SortOrder SortOrder
+	// ページングに使用するカーソル。 SearchFuncLogParams と同じ。
+	After  Cursor
+	Before Cursor
+}
+
+// ToParamMap converts this to url parameters map.
+func (s SearchGoroutinesParams) ToParamMap() map[string]string {
+	m := map[string]string{}
+	if s.MinTimestamp != 0 {
+		m["min-timestamp"] = s.MinTimestamp.NumberString()
+	}
+	if s.MaxTimestamp != 0 {
+		m["max-timestamp"] = s.MaxTimestamp.NumberString()
+	}
+	if s.Limit != 0 {
+		m["limit"] = strconv.FormatInt(s.Limit, 10)
+	}
+	if s.SortKey != NoSortKey {
+		m["sort"] = string(s.SortKey)
+	}
+	if s.SortOrder != NoSortOrder {
+		m["order"] = string(s.SortOrder)
+	}
+	if s.After != "" {
+		m["after"] = string(s.After)
+	}
+	if s.Before != "" {
+		m["before"] = string(s.Before)
+	}
+	return m
+}
+
+// GoroutinePage は、goroutineの検索結果の1ページである。
+type GoroutinePage struct {
+	Goroutines []types.Goroutine
+	// 次のページと前のページを読み出すためのカーソル。
+	// ページが存在しなければ空文字列になる。
+	Next Cursor
+	Prev Cursor
+}
+
+// FlameGraphFormat は、フレームグラフの出力形式を表す。
+type FlameGraphFormat string
+
+const (
+	// 単体で閲覧できるインタラクティブなSVG画像。
+	SvgFlameGraph FlameGraphFormat = "svg"
+	// folded stacks形式。1行に1つのスタックとその重みを出力する。
+	// flamegraph.plなどの外部ツールで読み込める。
+	FoldedFlameGraph FlameGraphFormat = "folded"
+)
+
+// Parse は、文字列からFlameGraphFormatを設定する。空文字列の場合は SvgFlameGraph になる。
+func (format *FlameGraphFormat) Parse(s string) error {
+	switch FlameGraphFormat(s) {
+	case "":
+		*format = SvgFlameGraph
+	case SvgFlameGraph, FoldedFlameGraph:
+		*format = FlameGraphFormat(s)
+	default:
+		return fmt.Errorf("invalid format: %s", s)
+	}
+	return nil
+}
+
+// FlameGraphParams は、フレームグラフの作成方法を表す。
+// 全ての条件を満たす関数呼び出しを集計する。
+type FlameGraphParams struct {
+	// 集計するgoroutineのID。空なら全てのgoroutineを集計する。
+	Gids []types.GID
+	// 指定した期間に実行されていた関数呼び出しを集計する。負の値なら制限しない。
+	MinTimestamp types.Time
+	MaxTimestamp types.Time
+	// calls テーブルに対するWHERE句のみを持つSELECT文。
+	// WHERE句を満たす関数呼び出しを集計する。
+	Sql    string
+	Format FlameGraphFormat
+}
+
+// ToParamMap converts this to url parameters map.
+func (p FlameGraphParams) ToParamMap() map[string]string {
+	m := map[string]string{}
+	if len(p.Gids) > 0 {
+		gids := make([]string, len(p.Gids))
+		for i := range p.Gids {
+			gids[i] = p.Gids[i].String()
+		}
+		m["gid"] = strings.Join(gids, ",")
+	}
+	if p.MinTimestamp != 0 {
+		m["min-timestamp"] = p.MinTimestamp.NumberString()
+	}
+	if p.MaxTimestamp != 0 {
+		m["max-timestamp"] = p.MaxTimestamp.NumberString()
+	}
+	if p.Sql != "" {
+		m["sql"] = p.Sql
+	}
+	if p.Format != "" {
+		m["format"] = string(p.Format)
+	}
+	return m
+}
+
+// FromString は、URLパラメータの値から FlameGraphParams を設定する。
+// gids は、カンマ区切りのGIDの一覧である。
+func (p *FlameGraphParams) FromString(gids, minTs, maxTs, sql, format string) (invalidParamName string, err error) {
+	defer func() {
+		err = errors.Wrap(err, "invalid "+invalidParamName)
+	}()
+	tmp := FlameGraphParams{
+		MinTimestamp: -1,
+		MaxTimestamp: -1,
+		Sql:          sql,
+	}
+	if gids != "" {
+		for _, s := range strings.Split(gids, ",") {
+			var gid types.GID
+			if err = gid.FromString(s); err != nil {
+				invalidParamName = "gid"
+				return
+			}
+			tmp.Gids = append(tmp.Gids, gid)
+		}
+	}
+	if minTs != "" {
+		if err = tmp.MinTimestamp.FromNumberString(minTs); err != nil {
+			invalidParamName = "min-timestamp"
+			return
+		}
+	}
+	if maxTs != "" {
+		if err = tmp.MaxTimestamp.FromNumberString(maxTs); err != nil {
+			invalidParamName = "max-timestamp"
+			return
+		}
+	}
+	if err = tmp.Format.Parse(format); err != nil {
+		invalidParamName = "format"
+		return
+	}
+	*p = tmp
+	invalidParamName = ""
+	err = nil
+	return
+}
@@ -0,0 +1,60 @@
+package restapi
+
+import (
+	"sort"
+
+	"github.com/yuuki0xff/goapptrace/config"
+	"github.com/yuuki0xff/goapptrace/tracer/sql"
+)
+
+// viewFunc は、appName のアプリケーションから参照できるビューを返す sql.ViewFunc を返す。
+func viewFunc(views *config.Views, appName string) sql.ViewFunc {
+	return func(name string) (string, bool) {
+		v, ok := views.Lookup(appName, name)
+		return v.Query, ok
+	}
+}
+
+// listViews は、appName のアプリケーションから参照できるビューを名前順に返す。
+// アプリケーション固有のビューによって隠されたビューは含まない。
+// appName が空文字列なら、全てのアプリケーションで定義されたビューを、アプリケーション名の順に返す。
+func listViews(views *config.Views, appName string) []View {
+	res := []View{}
+	if appName == "" {
+		for _, app := range views.AppNames() {
+			for _, v := range views.List(app) {
+				res = append(res, View{App: app, View: v})
+			}
+		}
+		return res
+	}
+
+	names := map[string]bool{}
+	if appName != config.ViewAnyApp {
+		for _, v := range views.List(appName) {
+			names[v.Name] = true
+			res = append(res, View{App: appName, View: v})
+		}
+	}
+	for _, v := range views.List(config.ViewAnyApp) {
+		if !names[v.Name] {
+			res = append(res, View{App: config.ViewAnyApp, View: v})
+		}
+	}
+	sort.SliceStable(res, func(i, j int) bool {
+		return res[i].Name < res[j].Name
+	})
+	return res
+}
+
+// saveView は、ビューのクエリを検査してから views に追加する。
+// 同じ名前のビューが既に存在すれば、置き換える。
+func saveView(views *config.Views, v View) error {
+	if err := v.View.Validate(); err != nil {
+		return err
+	}
+	if err := sql.CheckView(v.Name, v.Query, viewFunc(views, v.App)); err != nil {
+		return err
+	}
+	return views.Set(v.App, v.View)
+}
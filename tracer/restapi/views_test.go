@@ -0,0 +1,62 @@
+package restapi
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yuuki0xff/goapptrace/config"
+)
+
+func TestListViews(t *testing.T) {
+	a := assert.New(t)
+	views := config.NewViews()
+	a.NoError(views.Set(config.ViewAnyApp, config.View{Name: "slow", Query: "SELECT * FROM calls WHERE exectime > 1000"}))
+	a.NoError(views.Set(config.ViewAnyApp, config.View{Name: "main", Query: "SELECT * FROM calls WHERE gid = 1"}))
+	a.NoError(views.Set("app", config.View{Name: "slow", Query: "SELECT * FROM calls WHERE exectime > 10"}))
+
+	names := func(vs []View) []string {
+		var res []string
+		for _, v := range vs {
+			res = append(res, v.App+":"+v.Name)
+		}
+		return res
+	}
+	a.Equal([]string{"*:main", "*:slow", "app:slow"}, names(listViews(views, "")))
+	a.Equal([]string{"*:main", "app:slow"}, names(listViews(views, "app")))
+	a.Equal([]string{"*:main", "*:slow"}, names(listViews(views, "other")))
+	a.Equal([]string{"*:main", "*:slow"}, names(listViews(views, config.ViewAnyApp)))
+
+	// アプリケーション固有のビューが優先される。
+	query, ok := viewFunc(views, "app")("slow")
+	a.True(ok)
+	a.Equal("SELECT * FROM calls WHERE exectime > 10", query)
+	_, ok = viewFunc(views, "app")("nosuch")
+	a.False(ok)
+}
+
+func TestSaveView(t *testing.T) {
+	a := assert.New(t)
+	views := config.NewViews()
+	a.NoError(saveView(views, View{
+		App:  config.ViewAnyApp,
+		View: config.View{Name: "slow", Query: "SELECT * FROM calls WHERE exectime > 1000"},
+	}))
+	a.NoError(saveView(views, View{
+		App:  "app",
+		View: config.View{Name: "slowg1", Query: "SELECT id FROM slow WHERE gid = 1"},
+	}))
+
+	for _, v := range []View{
+		{App: "app", View: config.View{Name: "bad name", Query: "SELECT * FROM calls"}},
+		{App: "app", View: config.View{Name: "calls", Query: "SELECT * FROM calls"}},
+		{App: "app", View: config.View{Name: "empty"}},
+		{App: "app", View: config.View{Name: "grouped", Query: "SELECT gid, COUNT(*) FROM calls GROUP BY gid"}},
+		{App: "app", View: config.View{Name: "self", Query: "SELECT * FROM self"}},
+		// 他のアプリケーションのビューは参照できない。
+		{App: "other", View: config.View{Name: "v", Query: "SELECT * FROM slowg1"}},
+	} {
+		a.Error(saveView(views, v), v.Name)
+		_, ok := views.Get(v.App, v.Name)
+		a.False(ok, v.Name)
+	}
+}
@@ -140,6 +140,42 @@ func (s *StateSimulator) Goroutines() []*types.Goroutine {
 	return goroutines
 }
 
+// goroutineごとに、実行中の関数のFuncLogを返す。
+// スライスはスタックの底 (最初に呼び出された関数) からスタックトップの順に並んでいる。
+// 実行中の関数が存在しないgoroutineは含まれない。
+// 返されるFuncLogオブジェクトは全てコピーされ、使用後は FuncLogPool に戻すことが可能である。
+func (s *StateSimulator) Stacks() map[types.GID][]*types.FuncLog {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	stacks := make(map[types.GID][]*types.FuncLog)
+
+	for gid, id := range s.stacks {
+		var stack []*types.FuncLog
+		for id != types.NotFoundParent {
+			fl, ok := s.funcLogs[id]
+			if !ok {
+				break
+			}
+			newfl := types.FuncLogPool.Get().(*types.FuncLog)
+			frames := newfl.Frames
+			*newfl = *fl
+			newfl.Frames = frames[:len(fl.Frames)]
+			copy(newfl.Frames, fl.Frames)
+			stack = append(stack, newfl)
+			id = fl.ParentID
+		}
+		if len(stack) == 0 {
+			continue
+		}
+		// スタックトップから辿ったので、逆順にする。
+		for i, j := 0, len(stack)-1; i < j; i, j = i+1, j-1 {
+			stack[i], stack[j] = stack[j], stack[i]
+		}
+		stacks[gid] = stack
+	}
+	return stacks
+}
+
 // 実行が終了した関数についてのログを削除する
 func (s *StateSimulator) Clear() {
 	s.lock.Lock()
@@ -253,3 +253,54 @@ func TestStateSimulator_Next_endlessFuncs(t *testing.T) {
 	}
 	testStateSimulatorHelper(t, nil, symbols, testData)
 }
+
+func TestStateSimulator_Stacks(t *testing.T) {
+	txids := []types.TxID{
+		types.NewTxID(),
+		types.NewTxID(),
+		types.NewTxID(),
+		types.NewTxID(),
+	}
+	testData := []types.RawFuncLog{
+		// gid=0: main() start
+		{Tag: types.FuncStart, Timestamp: 1, Frames: []uintptr{100}, GID: 0, TxID: txids[0]},
+		// gid=0: func1() start
+		{Tag: types.FuncStart, Timestamp: 2, Frames: []uintptr{200, 100}, GID: 0, TxID: txids[1]},
+		// gid=1: func2() start
+		{Tag: types.FuncStart, Timestamp: 3, Frames: []uintptr{300}, GID: 1, TxID: txids[2]},
+		// gid=1: func2() end
+		{Tag: types.FuncEnd, Timestamp: 4, Frames: []uintptr{300}, GID: 1, TxID: txids[2]},
+		// gid=0: func3() start
+		{Tag: types.FuncStart, Timestamp: 5, Frames: []uintptr{400, 100}, GID: 0, TxID: txids[3]},
+		// gid=0: func3() end
+		{Tag: types.FuncEnd, Timestamp: 6, Frames: []uintptr{400, 100}, GID: 0, TxID: txids[3]},
+	}
+	s := &StateSimulator{}
+	testStateSimulatorHelper(t, s, nil, testData)
+
+	stacks := s.Stacks()
+	if len(stacks) != 1 {
+		t.Fatalf("len(stacks) should be 1, but %d", len(stacks))
+	}
+	stack := stacks[0]
+	if len(stack) != 2 {
+		t.Fatalf("len(stack) should be 2, but %d", len(stack))
+	}
+	if stack[0].StartTime != 1 || stack[0].ParentID != types.NotFoundParent {
+		t.Errorf("stack[0] should be main(), but %+v", stack[0])
+	}
+	if stack[1].StartTime != 2 || stack[1].ParentID != stack[0].ID {
+		t.Errorf("stack[1] should be func1(), but %+v", stack[1])
+	}
+	for _, fl := range stack {
+		if fl.IsEnded() {
+			t.Errorf("FuncLog should not be ended: %+v", fl)
+		}
+	}
+
+	// 返されたFuncLogはコピーなので、シミュレータの状態に影響しない。
+	stack[1].Frames[0] = 999
+	if s.Stacks()[0][1].Frames[0] != 200 {
+		t.Error("Stacks() should return copies of FuncLogs")
+	}
+}
@@ -0,0 +1,320 @@
+package sql
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/xwb1989/sqlparser"
+)
+
+var aggregateFuncs = []SqlAggregateFunc{
+	{
+		Name: "COUNT",
+		Parse: func(agg *Aggregate, args ...SqlAny) {
+			if len(args) != 1 {
+				panic("invalid args")
+			}
+			agg.Arg = args[0]
+		},
+		New: func(agg *Aggregate) aggregateState { return &countState{} },
+	}, {
+		Name:  "SUM",
+		Parse: parseAggregateArg,
+		New:   func(agg *Aggregate) aggregateState { return &sumState{} },
+	}, {
+		Name:  "AVG",
+		Parse: parseAggregateArg,
+		New:   func(agg *Aggregate) aggregateState { return &avgState{} },
+	}, {
+		Name:  "MIN",
+		Parse: parseAggregateArg,
+		New:   func(agg *Aggregate) aggregateState { return &minMaxState{sign: 1} },
+	}, {
+		Name:  "MAX",
+		Parse: parseAggregateArg,
+		New:   func(agg *Aggregate) aggregateState { return &minMaxState{sign: -1} },
+	}, {
+		Name: "PERCENTILE",
+		Parse: func(agg *Aggregate, args ...SqlAny) {
+			if len(args) != 2 {
+				panic("invalid args")
+			}
+			p := args[1]
+			if !p.Const() || p.Type() != BigIntType {
+				panic(fmt.Errorf("%s: percentile must be an integer constant", agg.Func.Name))
+			}
+			if p.BigInt() < 0 || 100 < p.BigInt() {
+				panic(fmt.Errorf("%s: percentile must be between 0 and 100", agg.Func.Name))
+			}
+			agg.Arg = args[0]
+			agg.Percentile = p.BigInt()
+		},
+		New: func(agg *Aggregate) aggregateState { return &percentileState{percentile: agg.Percentile} },
+	},
+	percentileFunc("MEDIAN", 50),
+	percentileFunc("P90", 90),
+	percentileFunc("P95", 95),
+	percentileFunc("P99", 99),
+}
+
+// SqlAggregateFunc は、複数の行を1つの値に集約する関数を表す。
+type SqlAggregateFunc struct {
+	Name string
+	// 関数の引数を検証して、agg に設定する。
+	// COUNT(*) のときは、引数としてnilが渡される。
+	Parse func(agg *Aggregate, args ...SqlAny)
+	// 1つのグループの集計状態を作成する。
+	New func(agg *Aggregate) aggregateState
+}
+
+// Aggregate は、SELECT文に含まれる集約関数の呼び出しを表す。
+type Aggregate struct {
+	Func SqlAggregateFunc
+	// 集約結果を参照するときに使用するフィールド。
+	Field Field
+	// 集約する値。COUNT(*) のときはnil。
+	// 集約する行は、SqlAny.WithRow() で指定する。
+	Arg SqlAny
+	// PERCENTILE関数で求めるパーセンタイル (0-100)。
+	Percentile int64
+}
+
+// aggregateState は、1つのグループの集計状態を保持する。
+type aggregateState interface {
+	// v の現在の値を集計に加える。
+	add(v SqlAny)
+	// 集計結果を返す。
+	value() SqlAny
+}
+
+// findAggregateFunc finds an aggregate function by name.
+func findAggregateFunc(name sqlparser.ColIdent) (SqlAggregateFunc, bool) {
+	for i := range aggregateFuncs {
+		if name.EqualString(aggregateFuncs[i].Name) {
+			return aggregateFuncs[i], true
+		}
+	}
+	return SqlAggregateFunc{}, false
+}
+
+// isAggregate returns true if expr is an aggregate function call.
+func isAggregate(expr sqlparser.Expr) bool {
+	fn, ok := expr.(*sqlparser.FuncExpr)
+	if !ok || !fn.Qualifier.IsEmpty() {
+		return false
+	}
+	_, ok = findAggregateFunc(fn.Name)
+	return ok
+}
+
+// parseAggregate は、集約関数の呼び出しをパースして、集約結果を参照するためのフィールドを返す。
+// 同じ呼び出しが複数回出現した場合は、同じフィールドを返す。
+func (s *SelectParser) parseAggregate(expr *sqlparser.FuncExpr) Field {
+	if !expr.Qualifier.IsEmpty() {
+		panic(ErrFunctionQualifier)
+	}
+	if expr.Distinct {
+		panic(ErrDistinct)
+	}
+	fn, ok := findAggregateFunc(expr.Name)
+	if !ok {
+		panic(fmt.Errorf("not found %s aggregate function", expr.Name.String()))
+	}
+
+	name := strings.ToLower(fn.Name) + "(" + sqlparser.String(expr.Exprs) + ")"
+	for _, agg := range s.aggs {
+		if agg.Field.Name == name {
+			return agg.Field
+		}
+	}
+
+	// 集約関数の引数は、集約前の行を参照する。
+	aggregating := s.aggregating
+	s.aggregating = false
+	defer func() {
+		s.aggregating = aggregating
+	}()
+	var args []SqlAny
+	for _, arg := range expr.Exprs {
+		if _, ok := arg.(*sqlparser.StarExpr); ok && fn.Name == "COUNT" {
+			args = append(args, nil)
+			continue
+		}
+		args = append(args, s.parseSelectExpr(arg))
+	}
+
+	agg := &Aggregate{
+		Func: fn,
+		Field: Field{
+			Name:      name,
+			AliasName: sqlparser.String(expr),
+		},
+	}
+	fn.Parse(agg, args...)
+	s.aggs = append(s.aggs, agg)
+	return agg.Field
+}
+
+func parseAggregateArg(agg *Aggregate, args ...SqlAny) {
+	if len(args) != 1 || args[0] == nil {
+		panic("invalid args")
+	}
+	agg.Arg = args[0]
+}
+
+// percentileFunc returns an alias of PERCENTILE(expr, percentile).
+func percentileFunc(name string, percentile int64) SqlAggregateFunc {
+	return SqlAggregateFunc{
+		Name: name,
+		Parse: func(agg *Aggregate, args ...SqlAny) {
+			parseAggregateArg(agg, args...)
+			agg.Percentile = percentile
+		},
+		New: func(agg *Aggregate) aggregateState { return &percentileState{percentile: percentile} },
+	}
+}
+
+// int64Value は、数値として集計できる値を返す。
+// 値の型を返すので、集計結果を元の型に戻せる。
+func int64Value(v SqlAny) (int64, string) {
+	switch t := v.Type(); t {
+	case BigIntType, DurationType:
+		return v.BigInt(), t
+	case DatetimeType:
+		return int64(v.Datetime()), t
+	default:
+		panic(fmt.Errorf("%s type is not supported by aggregate functions", t))
+	}
+}
+
+// typedValue は、int64Value で変換した値を元の型に戻す。
+func typedValue(v int64, t string) SqlAny {
+	switch t {
+	case DatetimeType:
+		return SqlDatetime(v)
+	case DurationType:
+		return SqlDuration(v)
+	default:
+		return SqlBigInt(v)
+	}
+}
+
+// constValue は、v の現在の値を定数として返す。
+func constValue(v SqlAny) SqlAny {
+	switch t := v.Type(); t {
+	case BoolType:
+		return SqlBool(v.Bool())
+	case BigIntType:
+		return SqlBigInt(v.BigInt())
+	case DurationType:
+		return SqlDuration(v.BigInt())
+	case StringType:
+		return SqlString(v.String())
+	case DatetimeType:
+		return SqlDatetime(v.Datetime())
+	default:
+		panic(fmt.Errorf("bug: type=%s", t))
+	}
+}
+
+type countState struct {
+	n int64
+}
+
+func (s *countState) add(v SqlAny)  { s.n++ }
+func (s *countState) value() SqlAny { return SqlBigInt(s.n) }
+
+type sumState struct {
+	sum int64
+	typ string
+}
+
+func (s *sumState) add(v SqlAny) {
+	var x int64
+	x, s.typ = int64Value(v)
+	s.sum += x
+}
+func (s *sumState) value() SqlAny { return typedValue(s.sum, s.typ) }
+
+type avgState struct {
+	sum int64
+	n   int64
+	typ string
+}
+
+func (s *avgState) add(v SqlAny) {
+	var x int64
+	x, s.typ = int64Value(v)
+	s.sum += x
+	s.n++
+}
+func (s *avgState) value() SqlAny {
+	if s.n == 0 {
+		return SqlBigInt(0)
+	}
+	return typedValue(s.sum/s.n, s.typ)
+}
+
+// minMaxState は、MIN関数とMAX関数の集計状態を保持する。
+type minMaxState struct {
+	// 最小値を求めるなら1、最大値を求めるなら-1。
+	sign int
+	cur  SqlAny
+	next SqlAny
+	cmp  func() int
+}
+
+func (s *minMaxState) add(v SqlAny) {
+	s.next = constValue(v)
+	if s.cur == nil {
+		s.cur = s.next
+		s.cmp = typedCompareFn(
+			func() SqlAny { return s.cur },
+			func() SqlAny { return s.next },
+		)
+		return
+	}
+	if s.sign*s.cmp() > 0 {
+		s.cur = s.next
+	}
+}
+func (s *minMaxState) value() SqlAny {
+	if s.cur == nil {
+		return SqlBigInt(0)
+	}
+	return s.cur
+}
+
+// percentileState は、nearest-rank法でパーセンタイルを求める。
+// 全ての値を保持するため、メモリ使用量は行数に比例する。
+type percentileState struct {
+	percentile int64
+	values     []int64
+	sorted     bool
+	typ        string
+}
+
+func (s *percentileState) add(v SqlAny) {
+	var x int64
+	x, s.typ = int64Value(v)
+	s.values = append(s.values, x)
+	s.sorted = false
+}
+func (s *percentileState) value() SqlAny {
+	n := int64(len(s.values))
+	if n == 0 {
+		return SqlBigInt(0)
+	}
+	if !s.sorted {
+		sort.Slice(s.values, func(i, j int) bool {
+			return s.values[i] < s.values[j]
+		})
+		s.sorted = true
+	}
+	idx := (s.percentile*n+99)/100 - 1
+	if idx < 0 {
+		idx = 0
+	}
+	return typedValue(s.values[idx], s.typ)
+}
@@ -0,0 +1,47 @@
+package sql
+
+import (
+	"fmt"
+	"runtime"
+
+	"github.com/pkg/errors"
+)
+
+// EvalError は、行に対して式を評価したときに発生したエラーである。
+// ゼロ除算や、型の変換に失敗した場合などに発生する。
+type EvalError struct {
+	Err error
+}
+
+func (e *EvalError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *EvalError) Cause() error {
+	return e.Err
+}
+
+// Eval は、 fn() の中で式を評価する。
+// SqlAny のメソッドは評価に失敗すると panic するため、行を評価するときは必ずこの関数を経由すること。
+// 評価に失敗した場合は EvalError を返す。
+// ランタイムエラーはバグによるものなので、 EvalError ではないエラーとして返す。
+func Eval(fn func()) (err error) {
+	defer func() {
+		obj := recover()
+		if obj == nil {
+			return
+		}
+		switch v := obj.(type) {
+		case runtime.Error:
+			err = errors.Wrap(v, "bug: failed to evaluate an expression")
+		case *EvalError:
+			err = v
+		case error:
+			err = &EvalError{Err: v}
+		default:
+			err = &EvalError{Err: fmt.Errorf("%v", v)}
+		}
+	}()
+	fn()
+	return nil
+}
@@ -0,0 +1,156 @@
+package sql
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/xwb1989/sqlparser"
+)
+
+// ExplainColumns は、EXPLAIN文が返す列の名前。
+var ExplainColumns = []string{"depth", "operation", "table", "detail", "rows"}
+
+// ExplainRow は、EXPLAIN文が返す1つの処理を表す。
+// 処理は、実行する順に並んでいる。
+type ExplainRow struct {
+	// 処理の深さ。サブクエリの処理は、外側のクエリの処理よりも1つ深くなる。
+	Depth     int
+	Operation string
+	// 処理対象のテーブル。テーブルに別名が付いていれば、別名も含む。
+	Table  string
+	Detail string
+	// 処理する行数の見積もり。不明なら-1。
+	Rows int64
+}
+
+// Strings returns values of the row in the same order as ExplainColumns.
+func (r ExplainRow) Strings() []string {
+	rows := ""
+	if r.Rows >= 0 {
+		rows = strconv.FormatInt(r.Rows, 10)
+	}
+	return []string{strconv.Itoa(r.Depth), r.Operation, r.Table, r.Detail, rows}
+}
+
+// ParseQuery は、SELECT文または "EXPLAIN SELECT ..." 文をパースする。
+// EXPLAIN文であれば、explainはtrueになる。
+func ParseQuery(query string) (sel *SelectParser, explain bool, err error) {
+	return ParseQueryWithViews(query, nil)
+}
+
+// ParseQueryWithViews は、views で定義されたビューを展開してから ParseQuery() と同様にクエリをパースする。
+func ParseQueryWithViews(query string, views ViewFunc) (sel *SelectParser, explain bool, err error) {
+	q := strings.TrimSpace(query)
+	const keyword = "explain"
+	if len(q) > len(keyword) && strings.EqualFold(q[:len(keyword)], keyword) && unicode.IsSpace(rune(q[len(keyword)])) {
+		explain = true
+		q = q[len(keyword):]
+	}
+	sel, err = ParseSelectWithViews(q, views)
+	return
+}
+
+// Explain は、クエリの実行計画を返す。
+// テーブルを読み出す方法は、plan で決定する。
+func (s *SelectParser) Explain(plan PlanFunc) []ExplainRow {
+	return s.explain(plan, 0)
+}
+
+func (s *SelectParser) explain(plan PlanFunc, depth int) []ExplainRow {
+	var rows []ExplainRow
+	for _, op := range s.subqueries {
+		rows = append(rows, ExplainRow{
+			Depth:     depth,
+			Operation: "subquery",
+			Detail:    sqlparser.String(op.Subquery.Sel.Stmt),
+			Rows:      -1,
+		})
+		rows = append(rows, op.Subquery.Sel.explain(plan, depth+1)...)
+	}
+
+	p := plan(s.table.Name, s)
+	rows = append(rows, ExplainRow{
+		Depth:     depth,
+		Operation: "scan",
+		Table:     tableLabel(s.tables[0]),
+		Detail:    p.String(),
+		Rows:      p.EstimatedRows,
+	})
+	for _, join := range s.joins {
+		var conds []string
+		for i := range join.Left {
+			conds = append(conds, join.Left[i].LongName()+" = "+join.Table.Name()+"."+join.Right[i].Name)
+		}
+		rows = append(rows, ExplainRow{
+			Depth:     depth,
+			Operation: "hash join",
+			Table:     tableLabel(join.Table),
+			Detail:    "ON " + strings.Join(conds, " AND "),
+			Rows:      plan(join.Table.Table.Name, nil).EstimatedRows,
+		})
+	}
+	if s.Stmt.Where != nil {
+		rows = append(rows, ExplainRow{
+			Depth:     depth,
+			Operation: "filter",
+			Detail:    sqlparser.String(s.Stmt.Where.Expr),
+			Rows:      -1,
+		})
+	}
+	if s.Grouped() {
+		detail := "all rows"
+		if len(s.groupBy) > 0 {
+			var keys []string
+			for _, key := range s.groupBy {
+				keys = append(keys, key.LongName())
+			}
+			detail = "BY " + strings.Join(keys, ", ")
+		}
+		if s.Stmt.Having != nil {
+			detail += " HAVING " + sqlparser.String(s.Stmt.Having.Expr)
+		}
+		rows = append(rows, ExplainRow{
+			Depth:     depth,
+			Operation: "group",
+			Detail:    detail,
+			Rows:      -1,
+		})
+	}
+
+	offset, limit := s.Limit()
+	if len(s.orderBy) > 0 {
+		var keys []string
+		for _, key := range s.orderBy {
+			keys = append(keys, key.String())
+		}
+		detail := strings.Join(keys, ", ")
+		if s.Stmt.Limit != nil {
+			// 上位offset+rows件のみをヒープに保持する。
+			detail += fmt.Sprintf(" top-n=%d", offset+limit)
+		}
+		rows = append(rows, ExplainRow{
+			Depth:     depth,
+			Operation: "sort",
+			Detail:    detail,
+			Rows:      -1,
+		})
+	}
+	if s.Stmt.Limit != nil {
+		rows = append(rows, ExplainRow{
+			Depth:     depth,
+			Operation: "limit",
+			Detail:    fmt.Sprintf("offset=%d rows=%d", offset, limit),
+			Rows:      limit,
+		})
+	}
+	return rows
+}
+
+func tableLabel(ref TableRef) string {
+	if ref.Alias == "" {
+		return ref.Table.Name
+	}
+	return ref.Table.Name + " " + ref.Alias
+}
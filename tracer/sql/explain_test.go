@@ -0,0 +1,83 @@
+package sql
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseQuery(t *testing.T) {
+	a := assert.New(t)
+	sel, explain, err := ParseQuery("SELECT id FROM calls")
+	a.NoError(err)
+	a.False(explain)
+	a.Equal("calls", sel.From())
+
+	sel, explain, err = ParseQuery("  explain\n SELECT gid FROM goroutines")
+	a.NoError(err)
+	a.True(explain)
+	a.Equal("goroutines", sel.From())
+
+	_, _, err = ParseQuery("EXPLAINSELECT id FROM calls")
+	a.Error(err)
+	_, _, err = ParseQuery("EXPLAIN")
+	a.Error(err)
+}
+
+func TestSelectParser_Explain(t *testing.T) {
+	plan := func(table string, sel *SelectParser) *Plan {
+		if table == "calls" {
+			return NewFuncLogPlan(table, sel, PlanStats{Records: 100})
+		}
+		return FullScanPlan(table, 10)
+	}
+	explain := func(t *testing.T, query string) [][]string {
+		sel, explain, err := ParseQuery(query)
+		if !assert.NoError(t, err, query) || !assert.True(t, explain) {
+			return nil
+		}
+		var rows [][]string
+		for _, row := range sel.Explain(plan) {
+			rows = append(rows, row.Strings())
+		}
+		return rows
+	}
+
+	t.Run("scan", func(t *testing.T) {
+		assert.Equal(t, [][]string{
+			{"0", "scan", "calls", "ids=[0, 99]", "100"},
+		}, explain(t, "EXPLAIN SELECT * FROM calls"))
+		assert.Equal(t, [][]string{
+			{"0", "scan", "goroutines", "full scan", "10"},
+		}, explain(t, "EXPLAIN SELECT * FROM goroutines"))
+	})
+	t.Run("filter-sort-limit", func(t *testing.T) {
+		assert.Equal(t, [][]string{
+			{"0", "scan", "calls", "ids=[10, 99] id=[10, +inf]", "90"},
+			{"0", "filter", "", "id >= 10 and exectime > 5", ""},
+			{"0", "sort", "", "calls.exectime DESC top-n=15", ""},
+			{"0", "limit", "", "offset=5 rows=10", "10"},
+		}, explain(t, "EXPLAIN SELECT id FROM calls WHERE id >= 10 AND exectime > 5 ORDER BY exectime DESC LIMIT 5, 10"))
+	})
+	t.Run("group", func(t *testing.T) {
+		assert.Equal(t, [][]string{
+			{"0", "scan", "calls", "ids=[0, 99]", "100"},
+			{"0", "group", "", "BY calls.gid HAVING COUNT(*) > 1", ""},
+		}, explain(t, "EXPLAIN SELECT gid, COUNT(*) FROM calls GROUP BY gid HAVING COUNT(*) > 1"))
+	})
+	t.Run("join", func(t *testing.T) {
+		assert.Equal(t, [][]string{
+			{"0", "scan", "calls c", "ids=[0, 99]", "100"},
+			{"0", "hash join", "goroutines g", "ON c.gid = g.gid", "10"},
+		}, explain(t, "EXPLAIN SELECT c.id FROM calls c JOIN goroutines g ON c.gid = g.gid"))
+	})
+	t.Run("subquery", func(t *testing.T) {
+		assert.Equal(t, [][]string{
+			{"0", "subquery", "", "select gid from goroutines where exectime > 10", ""},
+			{"1", "scan", "goroutines", "full scan", "10"},
+			{"1", "filter", "", "exectime > 10", ""},
+			{"0", "scan", "calls", "ids=[0, 99]", "100"},
+			{"0", "filter", "", "gid in (select gid from goroutines where exectime > 10)", ""},
+		}, explain(t, "EXPLAIN SELECT id FROM calls WHERE gid IN (SELECT gid FROM goroutines WHERE exectime > 10)"))
+	})
+}
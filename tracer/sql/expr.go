@@ -0,0 +1,87 @@
+package sql
+
+import (
+	"fmt"
+
+	"github.com/xwb1989/sqlparser"
+	"github.com/yuuki0xff/goapptrace/tracer/util"
+)
+
+// exprCol は、SELECT句で指定された、列名と集約関数以外の式を表す。
+// 式の値は、SqlRow.Field() に式のフィールドを渡すことで参照できる。
+// GROUP BY句、HAVING句およびORDER BY句からは、式に付けた別名で参照できる。
+type exprCol struct {
+	sel *SelectParser
+	ast sqlparser.Expr
+}
+
+// parseExprCol は、式をパースして、式の値を参照するためのフィールドを返す。
+// 式に含まれる集約関数は、集約する対象として登録する。
+// 式が不正な場合はpanicする。
+func (s *SelectParser) parseExprCol(expr sqlparser.Expr) Field {
+	err := sqlparser.Walk(func(node sqlparser.SQLNode) (bool, error) {
+		switch node := node.(type) {
+		case *sqlparser.Subquery:
+			return false, ErrExprSubquery
+		case *sqlparser.FuncExpr:
+			if isAggregate(node) {
+				s.parseAggregate(node)
+				// 集約関数の引数は、集約関数をパースするときに検査する。
+				return false, nil
+			}
+		}
+		return true, nil
+	}, expr)
+	if err != nil {
+		panic(err)
+	}
+
+	e := &exprCol{
+		sel: s,
+		ast: expr,
+	}
+	s.exprs = append(s.exprs, e)
+	name := sqlparser.String(expr)
+	return Field{
+		Name:      name,
+		AliasName: name,
+		expr:      e,
+	}
+}
+
+// parse は、式をパースして SqlAny を返す。
+// aggregating がtrueなら、集約後の行 (SqlGroupRow) に対する式としてパースする。
+func (e *exprCol) parse(aggregating bool) SqlAny {
+	s := e.sel
+	oldAggregating, oldNoAlias := s.aggregating, s.noAlias
+	s.aggregating = aggregating
+	s.noAlias = true
+	defer func() {
+		s.aggregating, s.noAlias = oldAggregating, oldNoAlias
+	}()
+	return s.parseWhereExpr(e.ast)
+}
+
+// getter は、row の行に対する式の値を返す SqlFieldGetter を返す。
+func (e *exprCol) getter(row SqlRow) SqlFieldGetter {
+	_, aggregating := row.(*SqlGroupRow)
+	v := e.parse(aggregating)
+	v.WithRow(row)
+	return func() SqlAny { return v }
+}
+
+// checkExprs は、式が参照している列や関数が正しいかを検査する。
+// 集約されたクエリでは、GROUP BY句で指定した式を除き、集約関数とGROUP BY句で指定した列のみを参照できる。
+func (s *SelectParser) checkExprs() error {
+	for _, e := range s.exprs {
+		e := e
+		aggregating := s.Grouped() && !s.isGroupKey(Field{Name: sqlparser.String(e.ast)})
+		err := util.PanicHandler(func() {
+			e.parse(aggregating)
+		})
+		if err != nil {
+			return fmt.Errorf("%s: %s", sqlparser.String(e.ast), err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,167 @@
+package sql
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yuuki0xff/goapptrace/tracer/types"
+)
+
+func TestSelectParser_Expr(t *testing.T) {
+	fls := []types.FuncLog{
+		{ID: 0, GID: 1, StartTime: 0, EndTime: 3000000},
+		{ID: 1, GID: 2, StartTime: 1000000, EndTime: 1500000},
+	}
+	gs := []types.Goroutine{
+		{GID: 1, StartTime: 0, EndTime: 100},
+	}
+	open := memOpen(fls, gs)
+
+	t.Run("arithmetic", func(t *testing.T) {
+		assert.Equal(t, "id,ms,x\n0,3,-2\n1,0,-2",
+			queryCsv(t, "SELECT id, exectime/1000000 AS ms, (1 + 2) * -1 + 10 % 3 AS x FROM calls", open))
+	})
+	t.Run("datetime", func(t *testing.T) {
+		assert.Equal(t, "d,e\n3000000,"+types.Time(3000010).UnixTime().String(),
+			queryCsv(t, "SELECT endtime - starttime AS d, endtime + 10 AS e FROM calls WHERE id = 0", open))
+	})
+	t.Run("order-by-alias", func(t *testing.T) {
+		assert.Equal(t, "id,us\n1,500\n0,3000",
+			queryCsv(t, "SELECT id, MICROS(exectime) AS us FROM calls ORDER BY us", open))
+	})
+	t.Run("join", func(t *testing.T) {
+		assert.Equal(t, "c.id,total\n0,3000100",
+			queryCsv(t, "SELECT c.id, c.exectime + g.exectime AS total FROM calls c JOIN goroutines g ON c.gid = g.gid", open))
+	})
+	t.Run("name", func(t *testing.T) {
+		assert.Equal(t, []string{"id", "exectime / 1000", "LOWER('A')"},
+			parseCols(t, "SELECT id, exectime / 1000, LOWER('A') FROM calls"))
+	})
+	t.Run("error", func(t *testing.T) {
+		a := assert.New(t)
+		for _, query := range []string{
+			"SELECT id + 'a' FROM calls",
+			"SELECT foo + 1 FROM calls",
+			"SELECT NOSUCHFUNC(id) FROM calls",
+			"SELECT LOWER() FROM calls",
+			"SELECT id IN (SELECT gid FROM goroutines) FROM calls",
+		} {
+			sel, err := ParseSelect(query)
+			if err == nil {
+				// 型の不一致は、行を読み出すときに検出する。
+				err = catchPanic(func() {
+					row := &SqlFuncLogRow{FuncLog: &fls[0]}
+					row.Fields(sel.Cols())[0]().Type()
+				})
+			}
+			a.Error(err, query)
+		}
+	})
+}
+
+func TestSelectParser_ExprGroupBy(t *testing.T) {
+	fls := []types.FuncLog{
+		{ID: 0, GID: 1, StartTime: 0, EndTime: 10},
+		{ID: 1, GID: 2, StartTime: 0, EndTime: 40},
+		{ID: 2, GID: 1, StartTime: 10, EndTime: 40},
+		{ID: 3, GID: 3, StartTime: 0, EndTime: 5},
+	}
+	t.Run("aggregate", func(t *testing.T) {
+		assert.Equal(t, "gid,avg,x\n1,20,31\n2,40,41\n3,5,6",
+			groupCsv(t, "SELECT gid, SUM(exectime) / COUNT(*) AS avg, MAX(exectime) + 1 AS x FROM calls GROUP BY gid ORDER BY gid", fls))
+	})
+	t.Run("group-by-alias", func(t *testing.T) {
+		assert.Equal(t, "odd,COUNT(*)\n0,1\n1,3",
+			groupCsv(t, "SELECT gid % 2 AS odd, COUNT(*) FROM calls GROUP BY odd ORDER BY odd", fls))
+	})
+	t.Run("having", func(t *testing.T) {
+		assert.Equal(t, "gid,total\n1,40\n2,40",
+			groupCsv(t, "SELECT gid, SUM(exectime) * 1 AS total FROM calls GROUP BY gid HAVING total > 35", fls))
+	})
+	t.Run("error", func(t *testing.T) {
+		a := assert.New(t)
+		for _, query := range []string{
+			"SELECT id + 1, COUNT(*) FROM calls GROUP BY gid",
+			"SELECT COUNT(*) * 2 AS c FROM calls GROUP BY c",
+		} {
+			_, err := ParseSelect(query)
+			a.Error(err, query)
+		}
+	})
+}
+
+func TestScalarFuncs(t *testing.T) {
+	symbols := &types.Symbols{}
+	symbols.Load(types.SymbolsData{
+		Files: []string{"main.go"},
+		Mods: []types.GoModule{
+			{Name: "main", MinPC: 100, MaxPC: 500},
+		},
+		Funcs: []types.GoFunc{
+			{Entry: 200, Name: "example.com/foo/bar.Func"},
+		},
+		Lines: []types.GoLine{
+			{PC: 200, FileID: 0, Line: 10},
+		},
+	})
+	tm := time.Date(2006, 1, 2, 15, 4, 5, 123456789, time.Local)
+	fl := types.FuncLog{
+		ID:        1,
+		StartTime: types.NewTime(tm),
+		EndTime:   types.NewTime(tm.Add(1500 * time.Millisecond)),
+		Frames:    []uintptr{210},
+	}
+
+	for query, expected := range map[string]string{
+		"SELECT LOWER('aBc'), UPPER('aBc'), LENGTH('abc') FROM calls":                      "abc,ABC,3",
+		"SELECT CONCAT('id=', id, ' running=', running) FROM calls":                        "id=1 running=false",
+		"SELECT SUBSTR(func, 13), SUBSTRING(func, 13, 3), SUBSTR(func, -4, 2) FROM frames": "foo/bar.Func,foo,Fu",
+		"SELECT REPLACE('a.b.c', '.', '/'), TRIM('  a ') FROM calls":                       "a/b/c,a",
+		"SELECT SHORTNAME('example.com/foo/bar.Func.func1') FROM calls":                    "Func.func1",
+		"SELECT DATE_FORMAT(starttime, '%Y-%m-%d %T.%f %%') FROM calls":                    "2006-01-02 15:04:05.123456 %",
+		"SELECT UNIX_TIMESTAMP(FROM_UNIXTIME(1000)) FROM calls":                            "1000",
+		"SELECT MICROS(exectime), MILLIS(exectime), SECS(exectime) FROM calls":             "1500000,1500,1",
+		"SELECT FORMAT_DURATION(exectime) FROM calls":                                      "1.5s",
+		"SELECT FUNCNAME(pc), FILELINE(pc), FUNCNAME(1) FROM frames":                       "example.com/foo/bar.Func,main.go:10,?",
+	} {
+		a := assert.New(t)
+		sel, err := ParseSelect(query)
+		if !a.NoError(err, query) {
+			continue
+		}
+		row := &SqlFuncLogRow{
+			FuncLog: &fl,
+			Symbols: symbols,
+		}
+		var out string
+		err = catchPanic(func() {
+			buf := make([]byte, 1024)
+			n := row.Fields(sel.Cols()).Printer(CsvFormat)(buf)
+			out = string(buf[:n])
+		})
+		if a.NoError(err, query) {
+			a.Equal(expected, out, query)
+		}
+	}
+
+	t.Run("no-symbols", func(t *testing.T) {
+		sel, err := ParseSelect("SELECT FUNCNAME(gid) FROM goroutines")
+		if !assert.NoError(t, err) {
+			return
+		}
+		assert.Error(t, catchPanic(func() {
+			(&SqlGoroutineRow{}).Fields(sel.Cols())
+		}))
+	})
+}
+
+func catchPanic(fn func()) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = assert.AnError
+		}
+	}()
+	fn()
+	return
+}
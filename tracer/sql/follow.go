@@ -0,0 +1,23 @@
+package sql
+
+import "errors"
+
+var (
+	ErrFollowTable  = errors.New("continuous query supports only \"calls\" and \"goroutines\" tables")
+	ErrFollowClause = errors.New("continuous query supports only WHERE clause. GROUP BY, HAVING, ORDER BY, LIMIT, JOIN and subqueries are not supported")
+)
+
+// CheckFollow は、continuous query として実行できるクエリであるかを検査する。
+// continuous query は、calls テーブルまたは goroutines テーブルに対する、WHERE句のみを持つクエリである。
+// 各行は他の行に依存せずに出力できるため、新しく追加された行を順次出力できる。
+func (s *SelectParser) CheckFollow() error {
+	switch s.table.Name {
+	case "calls", "goroutines":
+	default:
+		return ErrFollowTable
+	}
+	if s.Grouped() || s.Joined() || s.HasSubquery() || len(s.orderBy) > 0 || s.Stmt.Limit != nil {
+		return ErrFollowClause
+	}
+	return nil
+}
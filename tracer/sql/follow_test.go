@@ -0,0 +1,35 @@
+package sql
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSelectParser_CheckFollow(t *testing.T) {
+	a := assert.New(t)
+	for _, query := range []string{
+		"SELECT * FROM calls",
+		"SELECT id, exectime FROM calls WHERE exectime > 1000 AND FRAME(func = 'main.main')",
+		"SELECT gid FROM goroutines WHERE gid IN (1, 2)",
+	} {
+		sel, err := ParseSelect(query)
+		if a.NoError(err, query) {
+			a.NoError(sel.CheckFollow(), query)
+		}
+	}
+	for query, expected := range map[string]error{
+		"SELECT * FROM frames":                                           ErrFollowTable,
+		"SELECT * FROM funcs":                                            ErrFollowTable,
+		"SELECT gid, COUNT(*) FROM calls GROUP BY gid":                   ErrFollowClause,
+		"SELECT id FROM calls ORDER BY exectime":                         ErrFollowClause,
+		"SELECT id FROM calls LIMIT 10":                                  ErrFollowClause,
+		"SELECT c.id FROM calls c JOIN goroutines g ON c.gid = g.gid":    ErrFollowClause,
+		"SELECT id FROM calls WHERE gid IN (SELECT gid FROM goroutines)": ErrFollowClause,
+	} {
+		sel, err := ParseSelect(query)
+		if a.NoError(err, query) {
+			a.Equal(expected, sel.CheckFollow(), query)
+		}
+	}
+}
@@ -1,12 +1,17 @@
 package sql
 
 import (
+	"fmt"
+	"strings"
 	"time"
 
+	"github.com/xwb1989/sqlparser"
+
 	"github.com/yuuki0xff/goapptrace/tracer/types"
 )
 
-var funcs = []SqlFunc{
+// funcs は、WHERE句などで使用できる関数の一覧である。
+var funcs = append([]SqlFunc{
 	{
 		Name:  "FRAME",
 		Table: "frames",
@@ -49,7 +54,10 @@ var funcs = []SqlFunc{
 			if len(args) != 2 {
 				panic("invalid args")
 			}
-			return &SqlFuncAddTime{}
+			return &SqlFuncAddTime{
+				Base: args[0],
+				Diff: coerce(args[1], DurationType),
+			}
 		},
 	}, {
 		Name: "SUBTIME",
@@ -57,9 +65,87 @@ var funcs = []SqlFunc{
 			if len(args) != 2 {
 				panic("invalid args")
 			}
-			return &SqlFuncSubTime{}
+			return &SqlFuncSubTime{
+				Base: args[0],
+				Diff: coerce(args[1], DurationType),
+			}
+		},
+	}, {
+		Name:  "DATE_ADD",
+		Parse: dateArithFunc(sqlparser.PlusStr),
+	}, {
+		Name:  "DATE_SUB",
+		Parse: dateArithFunc(sqlparser.MinusStr),
+	}, {
+		Name: "TIMESTAMPDIFF",
+		Unit: true,
+		Parse: func(args ...SqlAny) SqlAny {
+			if len(args) != 3 {
+				panic("invalid args")
+			}
+			// (end - start) / unit
+			return &ArithOp{
+				Operator: sqlparser.DivStr,
+				Left: &ArithOp{
+					Operator: sqlparser.MinusStr,
+					Left:     args[2],
+					Right:    args[1],
+				},
+				Right: args[0],
+			}
+		},
+	}, {
+		Name: "LOG_START",
+		Parse: func(args ...SqlAny) SqlAny {
+			if len(args) > 0 {
+				panic("too many args")
+			}
+			return &SqlFuncLogTime{}
+		},
+	}, {
+		Name: "LOG_END",
+		Parse: func(args ...SqlAny) SqlAny {
+			if len(args) > 0 {
+				panic("too many args")
+			}
+			return &SqlFuncLogTime{End: true}
 		},
 	},
+}, scalarFuncs...)
+
+// intervalUnits は、INTERVAL式と TIMESTAMPDIFF() で指定できる時間の単位である。
+// 月や年は長さが一定ではないため、サポートしていない。
+var intervalUnits = map[string]time.Duration{
+	"microsecond": time.Microsecond,
+	"second":      time.Second,
+	"minute":      time.Minute,
+	"hour":        time.Hour,
+	"day":         24 * time.Hour,
+	"week":        7 * 24 * time.Hour,
+}
+
+// intervalUnit は、時間の単位の名前を、その単位の長さに変換する。
+// サポートしていない単位であればpanicする。
+func intervalUnit(unit string) SqlDuration {
+	d, ok := intervalUnits[strings.ToLower(unit)]
+	if !ok {
+		panic(fmt.Errorf("not supported unit: %s", unit))
+	}
+	return SqlDuration(d)
+}
+
+// dateArithFunc は、DATE_ADD(datetime, interval) のように、日時に時間の長さを加減算する関数をパースする。
+func dateArithFunc(operator string) func(args ...SqlAny) SqlAny {
+	return func(args ...SqlAny) SqlAny {
+		if len(args) != 2 {
+			panic("invalid args")
+		}
+		return &ArithOp{
+			Operator: operator,
+			Left:     args[0],
+			Right:    coerce(args[1], DurationType),
+		}
+	}
 }
 
 type SqlFunc struct {
@@ -67,6 +153,9 @@ type SqlFunc struct {
 	// 関数の引数で、テーブル名が省略された場合に補完するテーブル名。
 	// 空の場合は、関数呼び出し元の設定が適用される。
 	Table string
+	// trueなら、最初の引数には時間の単位 (SECOND, MINUTE など) を指定する。
+	// 引数は、単位の長さを表す SqlDuration に変換してから Parse に渡す。
+	Unit  bool
 	Parse func(args ...SqlAny) SqlAny
 }
 
@@ -131,13 +220,18 @@ type SqlFuncAddTime struct {
 	// TODO: cacheを導入する
 }
 
-func (d *SqlFuncAddTime) Bool() bool           { panic(errSqlCast(DatetimeType, BoolType)) }
-func (d *SqlFuncAddTime) BigInt() int64        { panic(errSqlCast(DatetimeType, BigIntType)) }
-func (d *SqlFuncAddTime) String() string       { panic(errSqlCast(DatetimeType, StringType)) }
-func (d *SqlFuncAddTime) Datetime() types.Time { return d.Base.Datetime() + d.Diff.Datetime() }
-func (d *SqlFuncAddTime) Const() bool          { return false }
-func (d *SqlFuncAddTime) Type() string         { return DatetimeType }
-func (d *SqlFuncAddTime) WithRow(row SqlRow)   {}
+func (d *SqlFuncAddTime) Bool() bool     { panic(errSqlCast(DatetimeType, BoolType)) }
+func (d *SqlFuncAddTime) BigInt() int64  { panic(errSqlCast(DatetimeType, BigIntType)) }
+func (d *SqlFuncAddTime) String() string { panic(errSqlCast(DatetimeType, StringType)) }
+func (d *SqlFuncAddTime) Datetime() types.Time {
+	return d.Base.Datetime() + types.Time(d.Diff.BigInt())
+}
+func (d *SqlFuncAddTime) Const() bool  { return d.Base.Const() && d.Diff.Const() }
+func (d *SqlFuncAddTime) Type() string { return DatetimeType }
+func (d *SqlFuncAddTime) WithRow(row SqlRow) {
+	d.Base.WithRow(row)
+	d.Diff.WithRow(row)
+}
 
 type SqlFuncSubTime struct {
 	Base SqlAny
@@ -145,10 +239,42 @@ type SqlFuncSubTime struct {
 	// TODO: cacheを導入する
 }
 
-func (d *SqlFuncSubTime) Bool() bool           { panic(errSqlCast(DatetimeType, BoolType)) }
-func (d *SqlFuncSubTime) BigInt() int64        { panic(errSqlCast(DatetimeType, BigIntType)) }
-func (d *SqlFuncSubTime) String() string       { panic(errSqlCast(DatetimeType, StringType)) }
-func (d *SqlFuncSubTime) Datetime() types.Time { return d.Base.Datetime() - d.Diff.Datetime() }
-func (d *SqlFuncSubTime) Const() bool          { return false }
-func (d *SqlFuncSubTime) Type() string         { return DatetimeType }
-func (d *SqlFuncSubTime) WithRow(row SqlRow)   {}
+func (d *SqlFuncSubTime) Bool() bool     { panic(errSqlCast(DatetimeType, BoolType)) }
+func (d *SqlFuncSubTime) BigInt() int64  { panic(errSqlCast(DatetimeType, BigIntType)) }
+func (d *SqlFuncSubTime) String() string { panic(errSqlCast(DatetimeType, StringType)) }
+func (d *SqlFuncSubTime) Datetime() types.Time {
+	return d.Base.Datetime() - types.Time(d.Diff.BigInt())
+}
+func (d *SqlFuncSubTime) Const() bool  { return d.Base.Const() && d.Diff.Const() }
+func (d *SqlFuncSubTime) Type() string { return DatetimeType }
+func (d *SqlFuncSubTime) WithRow(row SqlRow) {
+	d.Base.WithRow(row)
+	d.Diff.WithRow(row)
+}
+
+// SqlFuncLogTime は、LOG_START() 関数と LOG_END() 関数を表す。
+// ログの期間は、関数を評価する行から取得する。
+type SqlFuncLogTime struct {
+	// trueなら LOG_END()、falseなら LOG_START() である。
+	End     bool
+	logTime *LogTime
+}
+
+func (d *SqlFuncLogTime) Bool() bool     { panic(errSqlCast(DatetimeType, BoolType)) }
+func (d *SqlFuncLogTime) BigInt() int64  { panic(errSqlCast(DatetimeType, BigIntType)) }
+func (d *SqlFuncLogTime) String() string { panic(errSqlCast(DatetimeType, StringType)) }
+func (d *SqlFuncLogTime) Datetime() types.Time {
+	if d.End {
+		return d.logTime.End
+	}
+	return d.logTime.Start
+}
+func (d *SqlFuncLogTime) Const() bool  { return false }
+func (d *SqlFuncLogTime) Type() string { return DatetimeType }
+func (d *SqlFuncLogTime) WithRow(row SqlRow) {
+	lr, ok := row.(logTimeRow)
+	if !ok || lr.logTime() == nil {
+		panic(fmt.Errorf("LOG_START() and LOG_END() functions are not available in this table"))
+	}
+	d.logTime = lr.logTime()
+}
@@ -0,0 +1,93 @@
+package sql
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yuuki0xff/goapptrace/tracer/types"
+)
+
+func TestTimeFuncs(t *testing.T) {
+	tm := time.Date(2006, 1, 2, 15, 4, 5, 0, time.Local)
+	fl := types.FuncLog{
+		ID:        1,
+		StartTime: types.NewTime(tm),
+		EndTime:   types.NewTime(tm.Add(1500 * time.Millisecond)),
+	}
+	lt := &LogTime{
+		Start: types.NewTime(tm.Add(-time.Minute)),
+		End:   types.NewTime(tm.Add(time.Hour)),
+	}
+	format := func(tm time.Time) string {
+		return types.NewTime(tm).UnixTime().String()
+	}
+
+	for query, expected := range map[string]string{
+		"SELECT exectime > '1s', exectime < '0:00:01', exectime BETWEEN '1s' AND '2s' FROM calls":                     "true,false,true",
+		"SELECT exectime * 2, exectime / '500ms', exectime - INTERVAL 1 SECOND FROM calls":                            "3000000000,3,500000000",
+		"SELECT starttime + INTERVAL 1 HOUR FROM calls":                                                               format(tm.Add(time.Hour)),
+		"SELECT DATE_ADD(starttime, INTERVAL 2 MINUTE) FROM calls":                                                    format(tm.Add(2 * time.Minute)),
+		"SELECT DATE_SUB(starttime, '1h') FROM calls":                                                                 format(tm.Add(-time.Hour)),
+		"SELECT ADDTIME(starttime, '0:00:10'), SUBTIME(starttime, exectime) FROM calls":                               format(tm.Add(10*time.Second)) + "," + format(tm.Add(-1500*time.Millisecond)),
+		"SELECT TIMESTAMPDIFF(MICROSECOND, starttime, endtime), TIMESTAMPDIFF(SECOND, starttime, endtime) FROM calls": "1500000,1",
+		"SELECT LOG_START(), LOG_END() FROM calls":                                                                    format(tm.Add(-time.Minute)) + "," + format(tm.Add(time.Hour)),
+		"SELECT startoffset, starttime - LOG_START() = startoffset FROM calls":                                        "60000000000,true",
+		"SELECT starttime > LOG_END() - INTERVAL 2 HOUR FROM calls":                                                   "true",
+		"SELECT FORMAT_DURATION(endtime - starttime), MILLIS(startoffset) FROM calls":                                 "1.5s,60000",
+	} {
+		a := assert.New(t)
+		sel, err := ParseSelect(query)
+		if !a.NoError(err, query) {
+			continue
+		}
+		row := &SqlFuncLogRow{
+			FuncLog: &fl,
+			LogTime: lt,
+		}
+		var out string
+		err = catchPanic(func() {
+			buf := make([]byte, 1024)
+			n := row.Fields(sel.Cols()).Printer(CsvFormat)(buf)
+			out = string(buf[:n])
+		})
+		if a.NoError(err, query) {
+			a.Equal(expected, out, query)
+		}
+	}
+
+	t.Run("error", func(t *testing.T) {
+		a := assert.New(t)
+		for _, query := range []string{
+			"SELECT starttime + starttime FROM calls",
+			"SELECT exectime > 'abc' FROM calls",
+			"SELECT DATE_ADD(starttime, INTERVAL 1 MONTH) FROM calls",
+			"SELECT TIMESTAMPDIFF(YEAR, starttime, endtime) FROM calls",
+			"SELECT exectime / 0 FROM calls",
+		} {
+			sel, err := ParseSelect(query)
+			if err == nil {
+				err = catchPanic(func() {
+					row := &SqlFuncLogRow{FuncLog: &fl, LogTime: lt}
+					row.Fields(sel.Cols())[0]().BigInt()
+				})
+			}
+			a.Error(err, query)
+		}
+	})
+	t.Run("no-logtime", func(t *testing.T) {
+		a := assert.New(t)
+		for _, query := range []string{
+			"SELECT LOG_START() FROM calls",
+			"SELECT startoffset FROM calls",
+		} {
+			sel, err := ParseSelect(query)
+			if !a.NoError(err, query) {
+				continue
+			}
+			a.Error(catchPanic(func() {
+				(&SqlFuncLogRow{FuncLog: &fl}).Fields(sel.Cols())[0]()
+			}), query)
+		}
+	})
+}
@@ -0,0 +1,241 @@
+package sql
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/xwb1989/sqlparser"
+	"github.com/yuuki0xff/goapptrace/tracer/types"
+	"github.com/yuuki0xff/goapptrace/tracer/util"
+)
+
+// Groups は、GROUP BY句で指定した列の値ごとに行を集計する。
+// 行は1つずつ Add() で追加するため、全ての行をメモリ上に保持する必要はない。
+// 集計結果は SqlGroupRow を使って参照する。
+type Groups struct {
+	sel *SelectParser
+	// 集計する行。
+	row  SqlRow
+	keys SqlFieldGetters
+	// グループのキーから、groups のインデックスへのマップ。
+	index  map[string]int
+	groups []*group
+	buf    []byte
+}
+
+type group struct {
+	keys   []SqlAny
+	states []aggregateState
+}
+
+// NewGroups は、row の行を集計する Groups を返す。
+// 集計する行を変更するときは、row が指す先を書き換えてから Groups.Add() を呼び出す。
+func (s *SelectParser) NewGroups(row SqlRow) (*Groups, error) {
+	g := &Groups{
+		sel:   s,
+		row:   row,
+		index: map[string]int{},
+	}
+	err := util.PanicHandler(func() {
+		g.keys = row.Fields(s.groupBy)
+		for _, agg := range s.aggs {
+			if agg.Arg != nil {
+				agg.Arg.WithRow(row)
+			}
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(s.groupBy) == 0 {
+		// GROUP BY句が無ければ、行が無くても1つのグループを返す。
+		g.index[""] = g.newGroup(nil)
+	}
+	return g, nil
+}
+
+// Add は、現在の行を集計に加える。
+func (g *Groups) Add() error {
+	return util.PanicHandler(g.add)
+}
+func (g *Groups) add() {
+	g.buf = g.buf[:0]
+	for _, key := range g.keys {
+		g.buf = appendKey(g.buf, key())
+	}
+	i, ok := g.index[string(g.buf)]
+	if !ok {
+		keys := make([]SqlAny, len(g.keys))
+		for j, key := range g.keys {
+			keys[j] = constValue(key())
+		}
+		i = g.newGroup(keys)
+		g.index[string(g.buf)] = i
+	}
+
+	grp := g.groups[i]
+	for j, agg := range g.sel.aggs {
+		grp.states[j].add(agg.Arg)
+	}
+}
+func (g *Groups) newGroup(keys []SqlAny) int {
+	grp := &group{
+		keys:   keys,
+		states: make([]aggregateState, len(g.sel.aggs)),
+	}
+	for j, agg := range g.sel.aggs {
+		grp.states[j] = agg.Func.New(agg)
+	}
+	g.groups = append(g.groups, grp)
+	return len(g.groups) - 1
+}
+
+// Len returns the number of groups.
+func (g *Groups) Len() int {
+	return len(g.groups)
+}
+
+// appendKey は、グループを識別するための文字列に変換した v を buf に追加する。
+func appendKey(buf []byte, v SqlAny) []byte {
+	switch t := v.Type(); t {
+	case BoolType:
+		buf = strconv.AppendBool(buf, v.Bool())
+	case BigIntType, DurationType:
+		buf = strconv.AppendInt(buf, v.BigInt(), 10)
+	case StringType:
+		buf = strconv.AppendQuote(buf, v.String())
+	case DatetimeType:
+		buf = strconv.AppendInt(buf, int64(v.Datetime()), 10)
+	default:
+		panic(fmt.Errorf("bug: type=%s", t))
+	}
+	return append(buf, ',')
+}
+
+// SqlGroupRow は、Groups で集計した1つのグループを表す。
+// GROUP BY句で指定した列と、集約関数の結果を参照できる。
+type SqlGroupRow struct {
+	Groups *Groups
+	// 処理対象のグループのインデックス。
+	Index int
+}
+
+func (r *SqlGroupRow) Field(field Field) SqlFieldGetter {
+	for i, key := range r.Groups.sel.groupBy {
+		if key.Table == field.Table && key.Name == field.Name {
+			return func() SqlAny { return r.Groups.groups[r.Index].keys[i] }
+		}
+	}
+	if field.expr != nil {
+		return field.expr.getter(r)
+	}
+	if field.Table == "" {
+		for j, agg := range r.Groups.sel.aggs {
+			if agg.Field.Name == field.Name {
+				return func() SqlAny { return r.Groups.groups[r.Index].states[j].value() }
+			}
+		}
+		panic(fmt.Errorf("not found %s aggregate function", field.String()))
+	}
+	panic(errNotGrouped(field))
+}
+func (r *SqlGroupRow) Fields(fields []Field) SqlFieldGetters {
+	gs := make(SqlFieldGetters, len(fields))
+	for i := range gs {
+		gs[i] = r.Field(fields[i])
+	}
+	return gs
+}
+func (r *SqlGroupRow) SetOffset(offset int) { panic("not supported") }
+func (r *SqlGroupRow) MaxOffset() int       { panic("not supported") }
+func (r *SqlGroupRow) logTime() *LogTime {
+	if lr, ok := r.Groups.row.(logTimeRow); ok {
+		return lr.logTime()
+	}
+	return nil
+}
+func (r *SqlGroupRow) symbols() *types.Symbols {
+	if sr, ok := r.Groups.row.(symbolsRow); ok {
+		return sr.symbols()
+	}
+	return nil
+}
+
+func errNotGrouped(field Field) error {
+	return fmt.Errorf("\"%s\" column must appear in the GROUP BY clause or be used in an aggregate function", field.String())
+}
+
+// parseGroupBy parses the GROUP BY clause.
+// Only column names are allowed as grouping keys.
+// SELECT句の式に別名を付けると、その式の値でグループ化できる。
+func (s *SelectParser) parseGroupBy(groupBy sqlparser.GroupBy) []Field {
+	keys := make([]Field, 0, len(groupBy))
+	for _, expr := range groupBy {
+		key := s.parseColumn(expr, "GROUP BY")
+		if key.expr != nil {
+			sqlparser.Walk(func(node sqlparser.SQLNode) (bool, error) { // nolint: errcheck
+				if fn, ok := node.(*sqlparser.FuncExpr); ok && isAggregate(fn) {
+					panic(fmt.Errorf("aggregate function is not allowed in GROUP BY: %s", sqlparser.String(expr)))
+				}
+				return true, nil
+			}, key.expr.ast)
+		}
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// parseHaving parses the HAVING clause.
+// HAVING句では、GROUP BY句で指定した列と集約関数を参照できる。
+func (s *SelectParser) parseHaving(having *sqlparser.Where) SqlAny {
+	if having.Type != sqlparser.HavingStr {
+		panic(fmt.Errorf("bug %#v", having))
+	}
+	s.aggregating = true
+	defer func() {
+		s.aggregating = false
+	}()
+	return s.parseWhereExpr(having.Expr)
+}
+
+// isGroupKey returns true if the field is specified in the GROUP BY clause.
+func (s *SelectParser) isGroupKey(field Field) bool {
+	for _, key := range s.groupBy {
+		if key.Table == field.Table && key.Name == field.Name {
+			return true
+		}
+	}
+	return false
+}
+
+// checkGrouped は、集約されたクエリで集約前の列を参照していないかチェックする。
+func (s *SelectParser) checkGrouped() error {
+	for _, f := range s.fields {
+		if f.Table != "" && !s.isGroupKey(f) {
+			return errNotGrouped(f)
+		}
+	}
+	for _, key := range s.orderBy {
+		if key.Field.Table != "" && !s.isGroupKey(key.Field) {
+			return errNotGrouped(key.Field)
+		}
+	}
+	return nil
+}
+
+// Grouped returns true if the query has GROUP BY clause, HAVING clause or aggregate functions.
+// In this case, use NewGroups() and SqlGroupRow to read the result.
+func (s *SelectParser) Grouped() bool {
+	return len(s.groupBy) > 0 || len(s.aggs) > 0 || s.having != nil
+}
+
+// GroupBy returns grouping keys of the GROUP BY clause.
+func (s *SelectParser) GroupBy() []Field {
+	return s.groupBy
+}
+
+// Having returns the condition of the HAVING clause.
+// The condition must be evaluated with SqlGroupRow.
+func (s *SelectParser) Having() SqlAny {
+	return s.having
+}
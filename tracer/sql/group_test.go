@@ -0,0 +1,150 @@
+package sql
+
+import (
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yuuki0xff/goapptrace/tracer/types"
+)
+
+// groupCsv は、fls を集計した結果をCSV形式で返す。
+func groupCsv(t *testing.T, query string, fls []types.FuncLog) string {
+	a := assert.New(t)
+	sel, err := ParseSelect(query)
+	if !a.NoError(err) {
+		return ""
+	}
+	a.True(sel.Grouped())
+
+	row := SqlFuncLogRow{}
+	where := sel.Where()
+	if where == nil {
+		where = SqlBool(true)
+	}
+	where.WithRow(&row)
+	groups, err := sel.NewGroups(&row)
+	if !a.NoError(err) {
+		return ""
+	}
+	for i := range fls {
+		row.FuncLog = &fls[i]
+		if where.Bool() {
+			a.NoError(groups.Add())
+		}
+	}
+
+	out := &SqlGroupRow{Groups: groups}
+	having := sel.Having()
+	if having == nil {
+		having = SqlBool(true)
+	}
+	having.WithRow(out)
+	var indexes []int
+	for i := 0; i < groups.Len(); i++ {
+		out.Index = i
+		if having.Bool() {
+			indexes = append(indexes, i)
+		}
+	}
+
+	r1 := &SqlGroupRow{Groups: groups}
+	r2 := &SqlGroupRow{Groups: groups}
+	less, err := sel.Less(r1, r2)
+	a.NoError(err)
+	if less != nil {
+		sort.Slice(indexes, func(i, j int) bool {
+			r1.Index = indexes[i]
+			r2.Index = indexes[j]
+			return less()
+		})
+	}
+
+	printer := out.Fields(sel.Cols()).Printer(CsvFormat)
+	buf := make([]byte, 1024)
+	lines := []string{strings.Join(sel.ColNames(), ",")}
+	for _, i := range indexes {
+		out.Index = i
+		n := printer(buf)
+		lines = append(lines, string(buf[:n]))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func TestSelectParser_GroupBy(t *testing.T) {
+	fls := []types.FuncLog{
+		{ID: 0, GID: 1, StartTime: 0, EndTime: 10},
+		{ID: 1, GID: 2, StartTime: 0, EndTime: 40},
+		{ID: 2, GID: 1, StartTime: 10, EndTime: 40},
+		{ID: 3, GID: 3, StartTime: 0, EndTime: 5},
+		{ID: 4, GID: 1, StartTime: 20, EndTime: 40},
+		{ID: 5, GID: 2, StartTime: 0, EndTime: 20},
+	}
+
+	t.Run("count", func(t *testing.T) {
+		assert.Equal(t, "gid,COUNT(*)\n1,3\n2,2\n3,1",
+			groupCsv(t, "SELECT gid, COUNT(*) FROM calls GROUP BY gid", fls))
+	})
+	t.Run("aggregates", func(t *testing.T) {
+		assert.Equal(t, "gid,SUM(exectime),AVG(exectime),MIN(exectime),MAX(exectime)\n1,60,20,10,30\n2,60,30,20,40\n3,5,5,5,5",
+			groupCsv(t, "SELECT gid, SUM(exectime), AVG(exectime), MIN(exectime), MAX(exectime) FROM calls GROUP BY gid", fls))
+	})
+	t.Run("percentile", func(t *testing.T) {
+		assert.Equal(t, "MEDIAN(exectime),P99(exectime),PERCENTILE(exectime, 0)\n20,40,5",
+			groupCsv(t, "SELECT MEDIAN(exectime), P99(exectime), PERCENTILE(exectime, 0) FROM calls", fls))
+	})
+	t.Run("where", func(t *testing.T) {
+		assert.Equal(t, "COUNT(1)\n4",
+			groupCsv(t, "SELECT COUNT(1) FROM calls WHERE exectime >= 20", fls))
+		// 行が存在しなくても、1行を返す。
+		assert.Equal(t, "COUNT(1)\n0",
+			groupCsv(t, "SELECT COUNT(1) FROM calls WHERE gid = 100", fls))
+	})
+	t.Run("having", func(t *testing.T) {
+		assert.Equal(t, "gid\n1\n2",
+			groupCsv(t, "SELECT gid FROM calls GROUP BY gid HAVING COUNT(*) > 1", fls))
+		assert.Equal(t, "gid,COUNT(*)\n2,2",
+			groupCsv(t, "SELECT gid, COUNT(*) FROM calls GROUP BY gid HAVING gid = 2", fls))
+	})
+	t.Run("order-by", func(t *testing.T) {
+		assert.Equal(t, "gid,MAX(exectime)\n2,40\n1,30\n3,5",
+			groupCsv(t, "SELECT gid, MAX(exectime) FROM calls GROUP BY gid ORDER BY MAX(exectime) DESC", fls))
+		assert.Equal(t, "gid\n3\n2\n1",
+			groupCsv(t, "SELECT gid FROM calls GROUP BY gid ORDER BY count(*), gid DESC", fls))
+	})
+	t.Run("multiple-keys", func(t *testing.T) {
+		assert.Equal(t, "gid,running,COUNT(*)\n1,false,3\n2,false,2\n3,false,1",
+			groupCsv(t, "SELECT gid, running, COUNT(*) FROM calls GROUP BY gid, running", fls))
+	})
+
+	t.Run("error", func(t *testing.T) {
+		a := assert.New(t)
+		for _, query := range []string{
+			"SELECT * FROM calls GROUP BY gid",
+			"SELECT id FROM calls GROUP BY gid",
+			"SELECT gid FROM calls GROUP BY gid ORDER BY id",
+			"SELECT gid FROM calls GROUP BY gid HAVING id > 1",
+			"SELECT gid FROM calls GROUP BY foo",
+			"SELECT gid FROM calls GROUP BY gid + 1",
+			"SELECT gid FROM calls WHERE COUNT(*) > 1 GROUP BY gid",
+			"SELECT SUM(*) FROM calls",
+			"SELECT SUM(COUNT(*)) FROM calls",
+			"SELECT PERCENTILE(exectime, 101) FROM calls",
+			"SELECT PERCENTILE(exectime, gid) FROM calls",
+		} {
+			_, err := ParseSelect(query)
+			a.Error(err, query)
+		}
+	})
+}
+
+func TestGroups_typeError(t *testing.T) {
+	a := assert.New(t)
+	sel, err := ParseSelect("SELECT SUM(running) FROM calls")
+	a.NoError(err)
+	row := SqlFuncLogRow{FuncLog: &types.FuncLog{}}
+	groups, err := sel.NewGroups(&row)
+	a.NoError(err)
+	a.Error(groups.Add())
+}
@@ -0,0 +1,130 @@
+package sql
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/xwb1989/sqlparser"
+	"github.com/yuuki0xff/goapptrace/tracer/types"
+)
+
+// IndexHint は、WHERE句を満たすレコードが持つべき条件のうち、セカンダリインデックスで絞り込めるものを表す。
+// GIDs と Funcs のうち、どちらか一方のみが設定される。
+type IndexHint struct {
+	// WHERE句を満たすレコードは、いずれかのGIDを持つ。
+	GIDs []types.GID
+	// WHERE句を満たすレコードは、いずれかの関数をフレームに含む。
+	Funcs []string
+}
+
+// IndexHint は、WHERE句からセカンダリインデックスで利用可能な条件を抽出する。
+// 利用可能な条件が存在しない場合、okはfalseになる。
+// 返された条件を満たさないレコードは、WHERE句を満たさないことが保証される。
+func (s *SelectParser) IndexHint() (hint IndexHint, ok bool) {
+	if s.where == nil {
+		return
+	}
+	switch s.table.Name {
+	case "calls", "frames":
+		return extractIndexHint(s.where, s.hintTable)
+	default:
+		return
+	}
+}
+
+// hintTable は、フィールドのテーブル名を実際のテーブル名に変換する。
+// JOINしたクエリでは、FROM句で指定したテーブル以外の列はインデックスで絞り込めないため、空文字列を返す。
+func (s *SelectParser) hintTable(name string) string {
+	if !s.joined() {
+		return name
+	}
+	if name == s.tables[0].Name() {
+		return s.table.Name
+	}
+	return ""
+}
+
+// extractIndexHint は、expr からインデックスで絞り込める条件を抽出する。
+// table は、フィールドのテーブル名を実際のテーブル名に変換する。
+func extractIndexHint(expr SqlAny, table func(string) string) (IndexHint, bool) {
+	switch expr := expr.(type) {
+	case *AndOp:
+		// どちらか一方の条件で絞り込めば良い。
+		if hint, ok := extractIndexHint(expr.Left, table); ok {
+			return hint, true
+		}
+		return extractIndexHint(expr.Right, table)
+	case *OrOp:
+		// 両方の条件が同じ種類のインデックスで絞り込める場合のみ、和集合を返す。
+		l, ok := extractIndexHint(expr.Left, table)
+		if !ok {
+			break
+		}
+		r, ok := extractIndexHint(expr.Right, table)
+		if !ok {
+			break
+		}
+		switch {
+		case l.GIDs != nil && r.GIDs != nil:
+			return IndexHint{GIDs: append(l.GIDs, r.GIDs...)}, true
+		case l.Funcs != nil && r.Funcs != nil:
+			return IndexHint{Funcs: append(l.Funcs, r.Funcs...)}, true
+		}
+	case *SqlFuncFrame:
+		// 引数は、FROM句で指定したテーブルとは別のテーブルとしてパースされている。
+		return extractIndexHint(expr.Expr, identTable)
+	case *SqlFuncCall:
+		return extractIndexHint(expr.Expr, identTable)
+	case *InOp:
+		// "calls.gid IN (1, 2, 3)" であれば、いずれかのGIDを持つ。
+		f, ok := expr.Left[0].(*SqlField)
+		if !ok || expr.Not || expr.Subquery != nil || table(f.Field.Table) != "calls" || f.Field.Name != "gid" {
+			break
+		}
+		gids := make([]types.GID, 0, len(expr.Values))
+		for _, v := range expr.Values {
+			if v.Type() != BigIntType {
+				return IndexHint{}, false
+			}
+			gids = append(gids, types.GID(v.BigInt()))
+		}
+		return IndexHint{GIDs: gids}, true
+	case *CompOp:
+		if expr.Operator != sqlparser.EqualStr {
+			break
+		}
+		field, val := expr.Left, expr.Right
+		if _, ok := field.(*SqlField); !ok {
+			field, val = val, field
+		}
+		f, ok := field.(*SqlField)
+		if !ok || !val.Const() {
+			break
+		}
+		switch {
+		case table(f.Field.Table) == "calls" && f.Field.Name == "gid" && val.Type() == BigIntType:
+			return IndexHint{GIDs: []types.GID{types.GID(val.BigInt())}}, true
+		case table(f.Field.Table) == "frames" && f.Field.Name == "func" && val.Type() == StringType:
+			return IndexHint{Funcs: []string{val.String()}}, true
+		}
+	}
+	return IndexHint{}, false
+}
+
+func identTable(name string) string {
+	return name
+}
+
+func (h IndexHint) String() string {
+	var values []string
+	if h.GIDs != nil {
+		for _, gid := range h.GIDs {
+			values = append(values, strconv.FormatInt(int64(gid), 10))
+		}
+		return "gid IN (" + strings.Join(values, ", ") + ")"
+	}
+	for _, name := range h.Funcs {
+		values = append(values, strconv.Quote(name))
+	}
+	return "func IN (" + strings.Join(values, ", ") + ")"
+}
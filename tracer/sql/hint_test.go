@@ -0,0 +1,44 @@
+package sql
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yuuki0xff/goapptrace/tracer/types"
+)
+
+func TestSelectParser_IndexHint(t *testing.T) {
+	do := func(t *testing.T, sql string, expected IndexHint, expectedOk bool) {
+		a := assert.New(t)
+		sel, err := ParseSelect(sql)
+		a.NoError(err)
+
+		hint, ok := sel.IndexHint()
+		a.Equal(expectedOk, ok)
+		a.Equal(expected, hint)
+	}
+	t.Run("no-where", func(t *testing.T) {
+		do(t, "SELECT * FROM calls", IndexHint{}, false)
+	})
+	t.Run("gid", func(t *testing.T) {
+		do(t, "SELECT * FROM calls WHERE gid = 10", IndexHint{GIDs: []types.GID{10}}, true)
+		do(t, "SELECT * FROM calls WHERE 10 = gid", IndexHint{GIDs: []types.GID{10}}, true)
+	})
+	t.Run("func", func(t *testing.T) {
+		do(t, "SELECT * FROM calls WHERE FRAME(func = 'main.main')", IndexHint{Funcs: []string{"main.main"}}, true)
+		do(t, "SELECT * FROM frames WHERE func = 'main.main'", IndexHint{Funcs: []string{"main.main"}}, true)
+	})
+	t.Run("and", func(t *testing.T) {
+		do(t, "SELECT * FROM calls WHERE id > 10 AND gid = 1", IndexHint{GIDs: []types.GID{1}}, true)
+	})
+	t.Run("or", func(t *testing.T) {
+		do(t, "SELECT * FROM calls WHERE gid = 1 OR gid = 2", IndexHint{GIDs: []types.GID{1, 2}}, true)
+		do(t, "SELECT * FROM calls WHERE gid = 1 OR id = 2", IndexHint{}, false)
+		do(t, "SELECT * FROM calls WHERE gid = 1 OR FRAME(func = 'main.main')", IndexHint{}, false)
+	})
+	t.Run("unsupported", func(t *testing.T) {
+		do(t, "SELECT * FROM calls WHERE gid > 1", IndexHint{}, false)
+		do(t, "SELECT * FROM calls WHERE NOT gid = 1", IndexHint{}, false)
+		do(t, "SELECT * FROM goroutines WHERE gid = 1", IndexHint{}, false)
+	})
+}
@@ -0,0 +1,494 @@
+package sql
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/xwb1989/sqlparser"
+	"github.com/yuuki0xff/goapptrace/tracer/types"
+	"github.com/yuuki0xff/goapptrace/tracer/util"
+)
+
+// TableRef は、FROM句またはJOIN句で指定されたテーブルを表す。
+type TableRef struct {
+	Table Table
+	// テーブルの別名。指定されていなければ空文字列。
+	Alias string
+}
+
+// Name は、クエリ内でテーブルを参照するときの名前を返す。
+func (r TableRef) Name() string {
+	if r.Alias != "" {
+		return r.Alias
+	}
+	return r.Table.Name
+}
+
+// Join は、"JOIN ... ON ..." で結合するテーブルを表す。
+// 結合するテーブルの Right の列の値と、先に結合したテーブルの Left の列の値が全て等しい行を結合する。
+type Join struct {
+	Table TableRef
+	// 先に結合したテーブルの列。テーブル名には別名を使う。
+	Left []Field
+	// 結合するテーブルの列。テーブル名には実際のテーブル名を使う。
+	Right []Field
+}
+
+// parseFrom parses the FROM clause and sets tables and joins.
+func (s *SelectParser) parseFrom(froms sqlparser.TableExprs) error {
+	if len(froms) < 1 {
+		panic("len(stmt.From) == 0")
+	}
+	if len(froms) > 1 {
+		// カンマ区切りの結合は結合条件を指定できないため、サポートしない。
+		return ErrJoin
+	}
+	return util.PanicHandler(func() {
+		s.parseTableExpr(froms[0])
+	})
+}
+
+func (s *SelectParser) parseTableExpr(expr sqlparser.TableExpr) {
+	switch expr := expr.(type) {
+	case *sqlparser.AliasedTableExpr:
+		s.tables = append(s.tables, s.parseAliasedTable(expr))
+	case *sqlparser.ParenTableExpr:
+		if len(expr.Exprs) != 1 {
+			panic(ErrJoin)
+		}
+		s.parseTableExpr(expr.Exprs[0])
+	case *sqlparser.JoinTableExpr:
+		if expr.Join != sqlparser.JoinStr && expr.Join != sqlparser.StraightJoinStr {
+			panic(fmt.Errorf("%s is not supported. use \"JOIN ... ON\" instead", strings.ToUpper(expr.Join)))
+		}
+		if expr.Condition.Using != nil || expr.Condition.On == nil {
+			panic(ErrJoin)
+		}
+		s.parseTableExpr(expr.LeftExpr)
+		ref := s.parseAliasedTable(expr.RightExpr)
+		s.tables = append(s.tables, ref)
+		s.joins = append(s.joins, s.parseJoinCond(ref, expr.Condition.On))
+	default:
+		panic(fmt.Errorf("bug from=%T", expr))
+	}
+}
+
+func (s *SelectParser) parseAliasedTable(expr sqlparser.TableExpr) TableRef {
+	aliased, ok := expr.(*sqlparser.AliasedTableExpr)
+	if !ok {
+		// "a JOIN (b JOIN c)" のような結合はサポートしない。
+		panic(ErrJoin)
+	}
+	table, ok := aliased.Expr.(sqlparser.TableName)
+	if !ok {
+		panic(ErrSubquery)
+	}
+	if !table.Qualifier.IsEmpty() {
+		panic(ErrDBQualifier)
+	}
+	t, ok := findTableByName(table.Name.String())
+	if !ok {
+		panic(ErrNotFoundTable)
+	}
+	ref := TableRef{
+		Table: t,
+		Alias: aliased.As.String(),
+	}
+	for _, r := range s.tables {
+		if r.Name() == ref.Name() {
+			panic(fmt.Errorf("not unique table name or alias: %s", ref.Name()))
+		}
+	}
+	return ref
+}
+
+// parseJoinCond は、ON句をパースする。
+// ON句には、結合するテーブルの列と先に結合したテーブルの列が等しいという条件を、AND演算子で繋げて指定する。
+func (s *SelectParser) parseJoinCond(ref TableRef, expr sqlparser.Expr) Join {
+	join := Join{
+		Table: ref,
+	}
+	for _, cond := range splitAnd(expr) {
+		err := fmt.Errorf("ON clause supports only equality conditions between a column of \"%s\" and a column of the preceding tables: %s", ref.Name(), sqlparser.String(cond))
+		comp, ok := cond.(*sqlparser.ComparisonExpr)
+		if !ok || comp.Operator != sqlparser.EqualStr {
+			panic(err)
+		}
+		lcol, lok := comp.Left.(*sqlparser.ColName)
+		rcol, rok := comp.Right.(*sqlparser.ColName)
+		if !lok || !rok {
+			panic(err)
+		}
+		l, lout := s.resolveColumn(lcol)
+		r, rout := s.resolveColumn(rcol)
+		if lout || rout {
+			panic(err)
+		}
+		if l.Table == ref.Name() {
+			l, r = r, l
+		}
+		if l.Table == ref.Name() || r.Table != ref.Name() {
+			panic(err)
+		}
+		for _, f := range []Field{l, r} {
+			if !s.hasField(f) {
+				panic(fmt.Errorf("not found \"%s\" column", f.LongName()))
+			}
+		}
+		join.Left = append(join.Left, l)
+		join.Right = append(join.Right, Field{
+			Table: ref.Table.Name,
+			Name:  r.Name,
+		})
+	}
+	return join
+}
+
+// splitAnd は、AND演算子で繋げられた条件を分割する。
+func splitAnd(expr sqlparser.Expr) []sqlparser.Expr {
+	switch e := expr.(type) {
+	case *sqlparser.AndExpr:
+		return append(splitAnd(e.Left), splitAnd(e.Right)...)
+	case *sqlparser.ParenExpr:
+		if _, ok := e.Expr.(*sqlparser.AndExpr); ok {
+			return splitAnd(e.Expr)
+		}
+	}
+	return []sqlparser.Expr{expr}
+}
+
+// joined returns true if the query has JOIN clauses.
+func (s *SelectParser) joined() bool {
+	return len(s.tables) > 1
+}
+
+// findTable は、"table.*" で指定されたテーブルを探す。
+// 返されるテーブル名は、フィールドのテーブル名として使用する。
+func (s *SelectParser) findTable(name string) (t Table, tname string, ok bool) {
+	if s.joined() {
+		for _, ref := range s.tables {
+			if ref.Name() == name {
+				return ref.Table, name, true
+			}
+		}
+		return
+	}
+	if name == s.tables[0].Name() {
+		return s.table, s.table.Name, true
+	}
+	if name != "" && name == s.table.ImplictJoin {
+		t, ok = findTableByName(name)
+		return t, name, ok
+	}
+	return
+}
+
+// qualifiedField は、"table.column" 形式で指定された列のフィールドを返す。
+// テーブルが見つからなければ、okはfalseになる。
+func (s *SelectParser) qualifiedField(table, name string) (f Field, ok bool) {
+	_, tname, ok := s.findTable(table)
+	if !ok {
+		return
+	}
+	return Field{
+		Table: tname,
+		Name:  name,
+	}, true
+}
+
+// findColumn は、name列を持つテーブルのフィールドを返す。
+func (s *SelectParser) findColumn(name string) []Field {
+	if !s.joined() {
+		if s.table.HasField(name) {
+			return []Field{{Table: s.table.Name, Name: name}}
+		}
+		return nil
+	}
+	var fields []Field
+	for _, ref := range s.tables {
+		if ref.Table.HasField(name) {
+			fields = append(fields, Field{
+				Table: ref.Name(),
+				Name:  name,
+			})
+		}
+	}
+	return fields
+}
+
+// resolveColumn は、列名が参照するフィールドを返す。
+// JOINしたクエリでは、フィールドのテーブル名にテーブルの別名を使う。
+// そうでなければ、実際のテーブル名を使う。
+// サブクエリ内で外側のクエリの列を参照していれば、outerはtrueになる。
+func (s *SelectParser) resolveColumn(col *sqlparser.ColName) (f Field, outer bool) {
+	if !col.Qualifier.Qualifier.IsEmpty() {
+		panic(ErrDBQualifier)
+	}
+	name := col.Name.String()
+
+	if !col.Qualifier.Name.IsEmpty() {
+		table := col.Qualifier.Name.String()
+		if f, ok := s.qualifiedField(table, name); ok {
+			return f, false
+		}
+		if s.outer != nil {
+			if f, ok := s.outer.qualifiedField(table, name); ok {
+				return f, true
+			}
+		}
+		if s.joined() || s.outer != nil {
+			panic(fmt.Errorf("not found \"%s\" table", table))
+		}
+		// 存在しない列は、行を読み出すときにエラーになる。
+		return Field{
+			Table: table,
+			Name:  name,
+		}, false
+	}
+
+	fields := s.findColumn(name)
+	switch len(fields) {
+	case 0:
+		if s.outer != nil {
+			if fields := s.outer.findColumn(name); len(fields) == 1 {
+				return fields[0], true
+			}
+		}
+		if s.joined() {
+			panic(fmt.Errorf("not found \"%s\" column", name))
+		}
+		return Field{
+			Table: s.table.Name,
+			Name:  name,
+		}, false
+	case 1:
+		return fields[0], false
+	default:
+		panic(fmt.Errorf("column \"%s\" is ambiguous", name))
+	}
+}
+
+// selectAlias は、SELECT句で指定した列の別名を探す。
+func (s *SelectParser) selectAlias(col *sqlparser.ColName) (Field, bool) {
+	if !col.Qualifier.IsEmpty() {
+		return Field{}, false
+	}
+	for _, f := range s.fields {
+		if f.AliasName == col.Name.String() {
+			// 別名は表示にのみ使用する。
+			f.AliasName = ""
+			return f, true
+		}
+	}
+	return Field{}, false
+}
+
+// Joined returns true if the query has JOIN clauses.
+// In this case, use Open() to read rows.
+func (s *SelectParser) Joined() bool {
+	return s.joined()
+}
+
+// Tables returns the tables specified in the FROM clause and JOIN clauses.
+func (s *SelectParser) Tables() []TableRef {
+	return s.tables
+}
+
+// SqlJoinRow は、JOINした複数のテーブルの行を1つの行として扱う。
+// フィールドのテーブル名には、テーブルの別名を指定する。
+type SqlJoinRow struct {
+	Tables []TableRef
+	// Tables と同じ順序で並んだ、各テーブルの行。
+	Rows []SqlRow
+}
+
+func (r *SqlJoinRow) Field(field Field) SqlFieldGetter {
+	if field.expr != nil {
+		return field.expr.getter(r)
+	}
+	for i, ref := range r.Tables {
+		if ref.Name() == field.Table {
+			return r.Rows[i].Field(Field{
+				Table: ref.Table.Name,
+				Name:  field.Name,
+			})
+		}
+	}
+	panic(fmt.Errorf("not found \"%s\" table", field.Table))
+}
+func (r *SqlJoinRow) Fields(fields []Field) SqlFieldGetters {
+	gs := make(SqlFieldGetters, len(fields))
+	for i := range gs {
+		gs[i] = r.Field(fields[i])
+	}
+	return gs
+}
+func (r *SqlJoinRow) SetOffset(offset int) { panic("not supported") }
+func (r *SqlJoinRow) MaxOffset() int       { panic("not supported") }
+
+// logTime は、ログの期間を参照できる最初のテーブルの行から、ログの期間を返す。
+func (r *SqlJoinRow) logTime() *LogTime {
+	for _, row := range r.Rows {
+		if lr, ok := row.(logTimeRow); ok && lr.logTime() != nil {
+			return lr.logTime()
+		}
+	}
+	return nil
+}
+
+// symbols は、シンボル情報を参照できる最初のテーブルの行から、シンボル情報を返す。
+func (r *SqlJoinRow) symbols() *types.Symbols {
+	for _, row := range r.Rows {
+		if sr, ok := row.(symbolsRow); ok && sr.symbols() != nil {
+			return sr.symbols()
+		}
+	}
+	return nil
+}
+
+// openJoin は、driver の行に、JOIN句で指定したテーブルの行を結合する Source を返す。
+// 結合するテーブルは全ての行を読み出して、結合条件の列の値をキーとするハッシュテーブルを作成する。
+func (s *SelectParser) openJoin(open OpenFunc, driver Source) (Source, error) {
+	row := &SqlJoinRow{
+		Tables: s.tables,
+		Rows:   make([]SqlRow, len(s.tables)),
+	}
+	row.Rows[0] = driver.Row
+	srcs := []Source{driver}
+	r := &joinReader{
+		driver: driver,
+		levels: make([]*joinLevel, len(s.joins)),
+	}
+	for i, join := range s.joins {
+		src, err := open(join.Table.Table.Name, nil)
+		if err != nil {
+			return Source{}, err
+		}
+		row.Rows[i+1] = src.Row
+		srcs = append(srcs, src)
+
+		lv := &joinLevel{
+			src:   src,
+			index: map[string][]interface{}{},
+		}
+		err = util.PanicHandler(func() {
+			right := src.Row.Fields(join.Right)
+			for {
+				err := src.Read()
+				if err == io.EOF {
+					break
+				} else if err != nil {
+					panic(err)
+				}
+				lv.buf = lv.buf[:0]
+				for _, get := range right {
+					lv.buf = appendKey(lv.buf, get())
+				}
+				lv.index[string(lv.buf)] = append(lv.index[string(lv.buf)], src.Save())
+			}
+			lv.left = row.Fields(join.Left)
+		})
+		if err != nil {
+			return Source{}, err
+		}
+		r.levels[i] = lv
+	}
+
+	return Source{
+		Row:  row,
+		Read: r.read,
+		NewRow: func() SqlRow {
+			rows := make([]SqlRow, len(srcs))
+			for i := range srcs {
+				rows[i] = srcs[i].NewRow()
+			}
+			return &SqlJoinRow{
+				Tables: s.tables,
+				Rows:   rows,
+			}
+		},
+		Save: func() interface{} {
+			vs := make([]interface{}, len(srcs))
+			vs[0] = driver.Save()
+			for i, lv := range r.levels {
+				vs[i+1] = lv.matches[lv.pos]
+			}
+			return vs
+		},
+		Load: func(dst SqlRow, v interface{}) {
+			rows := dst.(*SqlJoinRow).Rows
+			vs := v.([]interface{})
+			for i := range srcs {
+				srcs[i].Load(rows[i], vs[i])
+			}
+		},
+	}, nil
+}
+
+// joinReader は、結合条件を満たす行の組み合わせを1つずつ読み出す。
+type joinReader struct {
+	driver  Source
+	levels  []*joinLevel
+	started bool
+}
+
+// joinLevel は、JOIN句で結合する1つのテーブルの状態を保持する。
+type joinLevel struct {
+	src Source
+	// 先に結合したテーブルの、結合条件の列。
+	left SqlFieldGetters
+	// 結合条件の列の値から、Source.Save() で保存した行へのマップ。
+	index map[string][]interface{}
+	// 結合条件を満たす行と、現在の行の位置。
+	matches []interface{}
+	pos     int
+	buf     []byte
+}
+
+func (lv *joinLevel) lookup() []interface{} {
+	lv.buf = lv.buf[:0]
+	for _, get := range lv.left {
+		lv.buf = appendKey(lv.buf, get())
+	}
+	return lv.index[string(lv.buf)]
+}
+
+func (r *joinReader) read() error {
+	// 最後のテーブルから順に、次の組み合わせに進める。
+	i := len(r.levels) - 1
+	if !r.started {
+		r.started = true
+		i = -1
+	}
+	for {
+		if i < 0 {
+			if err := r.driver.Read(); err != nil {
+				return err
+			}
+		} else {
+			lv := r.levels[i]
+			lv.pos++
+			if len(lv.matches) <= lv.pos {
+				i--
+				continue
+			}
+			lv.src.Load(lv.src.Row, lv.matches[lv.pos])
+		}
+
+		// 後続のテーブルから、結合条件を満たす最初の行を探す。
+		for i+1 < len(r.levels) {
+			lv := r.levels[i+1]
+			lv.matches = lv.lookup()
+			if len(lv.matches) == 0 {
+				break
+			}
+			i++
+			lv.pos = 0
+			lv.src.Load(lv.src.Row, lv.matches[0])
+		}
+		if i == len(r.levels)-1 {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,219 @@
+package sql
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yuuki0xff/goapptrace/tracer/types"
+)
+
+// memOpen は、fls と gs を calls テーブルと goroutines テーブルとして読み出す OpenFunc を返す。
+func memOpen(fls []types.FuncLog, gs []types.Goroutine) OpenFunc {
+	return func(table string, sel *SelectParser) (Source, error) {
+		i := 0
+		switch table {
+		case "calls":
+			row := &SqlFuncLogRow{}
+			return Source{
+				Row: row,
+				Read: func() error {
+					if len(fls) <= i {
+						return io.EOF
+					}
+					row.FuncLog = &fls[i]
+					i++
+					return nil
+				},
+				NewRow: func() SqlRow { return &SqlFuncLogRow{} },
+				Save:   func() interface{} { return row.FuncLog },
+				Load: func(dst SqlRow, v interface{}) {
+					dst.(*SqlFuncLogRow).FuncLog = v.(*types.FuncLog)
+				},
+			}, nil
+		case "goroutines":
+			row := &SqlGoroutineRow{}
+			return Source{
+				Row: row,
+				Read: func() error {
+					if len(gs) <= i {
+						return io.EOF
+					}
+					row.Goroutine = gs[i]
+					i++
+					return nil
+				},
+				NewRow: func() SqlRow { return &SqlGoroutineRow{} },
+				Save: func() interface{} {
+					g := row.Goroutine
+					return &g
+				},
+				Load: func(dst SqlRow, v interface{}) {
+					dst.(*SqlGoroutineRow).Goroutine = *v.(*types.Goroutine)
+				},
+			}, nil
+		default:
+			return Source{}, fmt.Errorf("not found %s table", table)
+		}
+	}
+}
+
+// queryCsv は、open から読み出した行をクエリに従って処理し、CSV形式で返す。
+// GROUP BY句とLIMIT句は使用できない。
+func queryCsv(t *testing.T, query string, open OpenFunc) string {
+	return viewQueryCsv(t, query, nil, open)
+}
+
+// viewQueryCsv は、views で定義されたビューを展開してから queryCsv() と同様にクエリを処理する。
+func viewQueryCsv(t *testing.T, query string, views ViewFunc, open OpenFunc) string {
+	a := assert.New(t)
+	sel, err := ParseSelectWithViews(query, views)
+	if !a.NoError(err, query) {
+		return ""
+	}
+	src, err := sel.Open(open)
+	if !a.NoError(err, query) {
+		return ""
+	}
+
+	where := sel.Where()
+	if where == nil {
+		where = SqlBool(true)
+	}
+	where.WithRow(src.Row)
+	var saved []interface{}
+	for {
+		err := src.Read()
+		if err == io.EOF {
+			break
+		}
+		if !a.NoError(err) {
+			return ""
+		}
+		if where.Bool() {
+			saved = append(saved, src.Save())
+		}
+	}
+
+	r1 := src.NewRow()
+	r2 := src.NewRow()
+	less, err := sel.Less(r1, r2)
+	a.NoError(err)
+	if less != nil {
+		sort.SliceStable(saved, func(i, j int) bool {
+			src.Load(r1, saved[i])
+			src.Load(r2, saved[j])
+			return less()
+		})
+	}
+
+	out := src.NewRow()
+	printer := out.Fields(sel.Cols()).Printer(CsvFormat)
+	buf := make([]byte, 1024)
+	lines := []string{strings.Join(sel.ColNames(), ",")}
+	for _, v := range saved {
+		src.Load(out, v)
+		n := printer(buf)
+		lines = append(lines, string(buf[:n]))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func TestSelectParser_Join(t *testing.T) {
+	fls := []types.FuncLog{
+		{ID: 0, GID: 1, StartTime: 0, EndTime: 10},
+		{ID: 1, GID: 2, StartTime: 0, EndTime: 40},
+		{ID: 2, GID: 1, StartTime: 10, EndTime: 40},
+		{ID: 3, GID: 3, StartTime: 0, EndTime: 5},
+	}
+	gs := []types.Goroutine{
+		{GID: 1, StartTime: 0, EndTime: 100},
+		{GID: 2, StartTime: 0, EndTime: 50},
+	}
+	open := memOpen(fls, gs)
+
+	t.Run("inner-join", func(t *testing.T) {
+		assert.Equal(t, "c.id,g.exectime\n0,100\n1,50\n2,100",
+			queryCsv(t, "SELECT c.id, g.exectime FROM calls c JOIN goroutines g ON c.gid = g.gid", open))
+	})
+	t.Run("where", func(t *testing.T) {
+		assert.Equal(t, "id\n1",
+			queryCsv(t, "SELECT c.id AS id FROM calls AS c INNER JOIN goroutines AS g ON g.gid = c.gid WHERE g.exectime < 100", open))
+	})
+	t.Run("order-by-alias", func(t *testing.T) {
+		assert.Equal(t, "id,total\n1,50\n0,100\n2,100",
+			queryCsv(t, "SELECT c.id AS id, g.exectime AS total FROM calls c JOIN goroutines g ON c.gid = g.gid ORDER BY total, id", open))
+	})
+	t.Run("self-join", func(t *testing.T) {
+		assert.Equal(t, "a.id,b.id\n0,2\n2,0",
+			queryCsv(t, "SELECT a.id, b.id FROM calls a JOIN calls b ON a.gid = b.gid WHERE a.id <> b.id", open))
+	})
+	t.Run("multiple-joins", func(t *testing.T) {
+		assert.Equal(t, "c.id,b.id\n0,2\n2,0",
+			queryCsv(t, "SELECT c.id, b.id FROM calls c JOIN goroutines g ON c.gid = g.gid JOIN calls b ON b.gid = g.gid WHERE c.id <> b.id", open))
+	})
+	t.Run("star", func(t *testing.T) {
+		assert.Equal(t, "c.id,c.gid,c.starttime,c.endtime,c.exectime,c.running,c.startoffset,c.parent_id,goroutines.gid,goroutines.starttime,goroutines.endtime,goroutines.exectime,goroutines.running,goroutines.startoffset",
+			strings.Join(parseCols(t, "SELECT * FROM calls c JOIN goroutines ON c.gid = goroutines.gid"), ","))
+	})
+
+	t.Run("error", func(t *testing.T) {
+		a := assert.New(t)
+		for _, query := range []string{
+			"SELECT * FROM calls, goroutines",
+			"SELECT * FROM calls LEFT JOIN goroutines ON calls.gid = goroutines.gid",
+			"SELECT * FROM calls JOIN goroutines USING (gid)",
+			"SELECT * FROM calls JOIN goroutines",
+			"SELECT * FROM calls JOIN goroutines ON calls.gid > goroutines.gid",
+			"SELECT * FROM calls JOIN goroutines ON calls.gid = 1",
+			"SELECT * FROM calls JOIN calls ON calls.gid = calls.gid",
+			"SELECT gid FROM calls JOIN goroutines ON calls.gid = goroutines.gid",
+			"SELECT c.foo FROM calls c JOIN goroutines g ON c.gid = g.gid",
+			"SELECT calls.id FROM calls c JOIN goroutines g ON c.gid = g.gid",
+			"SELECT * FROM calls c JOIN goroutines g ON c.gid = g.gid WHERE FRAME(func = 'main.main')",
+		} {
+			_, err := ParseSelect(query)
+			a.Error(err, query)
+		}
+	})
+}
+
+func parseCols(t *testing.T, query string) []string {
+	sel, err := ParseSelect(query)
+	if !assert.NoError(t, err) {
+		return nil
+	}
+	return sel.ColNames()
+}
+
+func TestSelectParser_IndexHintWithJoin(t *testing.T) {
+	a := assert.New(t)
+	sel, err := ParseSelect("SELECT c.id FROM calls c JOIN goroutines g ON c.gid = g.gid WHERE c.gid = 1")
+	a.NoError(err)
+	hint, ok := sel.IndexHint()
+	a.True(ok)
+	a.Equal([]types.GID{1}, hint.GIDs)
+
+	// 結合したテーブルの列は、FROM句のテーブルのインデックスでは絞り込めない。
+	sel, err = ParseSelect("SELECT c.id FROM calls c JOIN calls d ON c.gid = d.gid WHERE d.gid = 1")
+	a.NoError(err)
+	_, ok = sel.IndexHint()
+	a.False(ok)
+}
+
+func TestSelectParser_ParentID(t *testing.T) {
+	fls := []types.FuncLog{
+		{ID: 0, ParentID: types.NotFoundParent, StartTime: 0, EndTime: 100},
+		{ID: 1, ParentID: 0, StartTime: 10, EndTime: 40},
+		{ID: 2, ParentID: 1, StartTime: 20, EndTime: 30},
+		{ID: 3, ParentID: 0, StartTime: 50, EndTime: 60},
+	}
+	open := memOpen(fls, nil)
+	assert.Equal(t, "id,parent_id\n0,-1\n1,0",
+		queryCsv(t, "SELECT id, parent_id FROM calls WHERE id < 2", open))
+	assert.Equal(t, "p.id,c.id\n0,1\n0,3\n1,2",
+		queryCsv(t, "SELECT p.id, c.id FROM calls c JOIN calls p ON c.parent_id = p.id ORDER BY p.id, c.id", open))
+}
@@ -10,6 +10,9 @@ import (
 	"github.com/yuuki0xff/goapptrace/tracer/types"
 )
 
+// ErrDivisionByZero は、0で除算したときに EvalError の原因として返される。
+var ErrDivisionByZero = errors.New("division by zero")
+
 type AndOp struct {
 	Left  SqlAny
 	Right SqlAny
@@ -88,10 +91,16 @@ func (o *CompOp) WithRow(row SqlRow) {
 	o.Right.WithRow(row)
 }
 func (o *CompOp) compareFn() func() bool {
+	o.Left = coerce(o.Left, o.Right.Type())
+	o.Right = coerce(o.Right, o.Left.Type())
 	t := o.Left.Type()
 	t2 := o.Right.Type()
 	if t != t2 {
-		panic(fmt.Errorf("mismatch type: %s %s %s", t, o.Operator, t2))
+		if !intLike(t) || !intLike(t2) {
+			panic(fmt.Errorf("mismatch type: %s %s %s", t, o.Operator, t2))
+		}
+		// 時間の長さは、ナノ秒単位の整数と比較できる。
+		t = BigIntType
 	}
 	switch t {
 	case BoolType:
@@ -111,22 +120,23 @@ func (o *CompOp) compareFn() func() bool {
 		default:
 			panic(fmt.Errorf("not supported operator: %s %s %s", t, o.Operator, t2))
 		}
-	case BigIntType:
+	case BigIntType, DurationType, DatetimeType:
+		l, r := int64Fn(o.Left), int64Fn(o.Right)
 		switch o.Operator {
 		case sqlparser.EqualStr:
-			return func() bool { return o.Left.BigInt() == o.Right.BigInt() }
+			return func() bool { return l() == r() }
 		case sqlparser.LessThanStr:
-			return func() bool { return o.Left.BigInt() < o.Right.BigInt() }
+			return func() bool { return l() < r() }
 		case sqlparser.GreaterThanStr:
-			return func() bool { return o.Left.BigInt() > o.Right.BigInt() }
+			return func() bool { return l() > r() }
 		case sqlparser.LessEqualStr:
-			return func() bool { return o.Left.BigInt() <= o.Right.BigInt() }
+			return func() bool { return l() <= r() }
 		case sqlparser.GreaterEqualStr:
-			return func() bool { return o.Left.BigInt() >= o.Right.BigInt() }
+			return func() bool { return l() >= r() }
 		case sqlparser.NotEqualStr:
-			return func() bool { return o.Left.BigInt() != o.Right.BigInt() }
+			return func() bool { return l() != r() }
 		case sqlparser.NullSafeEqualStr:
-			return func() bool { return o.Left.BigInt() == o.Right.BigInt() }
+			return func() bool { return l() == r() }
 		default:
 			panic(fmt.Errorf("not supported operator: %s %s %s", t, o.Operator, t2))
 		}
@@ -161,18 +171,150 @@ func (o *CompOp) compareFn() func() bool {
 	}
 }
 
+// ArithOp は、算術演算子 (+, -, *, /, DIV, %) を表す。
+// 整数と時間の長さの演算に加えて、日時同士の差と、日時に時間の長さを加減算した日時を計算できる。
+// 日時と演算する整数は、ナノ秒単位の時間の長さとして扱う。
+// 整数の除算は、小数点以下を切り捨てる。
+type ArithOp struct {
+	Operator string
+	Left     SqlAny
+	Right    SqlAny
+	typ      string
+	calc     func() int64
+}
+
+func (o *ArithOp) Bool() bool { panic(errSqlCast(o.Type(), BoolType)) }
+func (o *ArithOp) BigInt() int64 {
+	if t := o.Type(); !intLike(t) {
+		panic(errSqlCast(t, BigIntType))
+	}
+	return o.calc()
+}
+func (o *ArithOp) String() string { panic(errSqlCast(o.Type(), StringType)) }
+func (o *ArithOp) Datetime() types.Time {
+	if t := o.Type(); t != DatetimeType {
+		panic(errSqlCast(t, DatetimeType))
+	}
+	return types.Time(o.calc())
+}
+func (o *ArithOp) Const() bool { return o.Left.Const() && o.Right.Const() }
+func (o *ArithOp) Type() string {
+	if o.calc == nil {
+		o.typ, o.calc = o.calcFn()
+	}
+	return o.typ
+}
+func (o *ArithOp) WithRow(row SqlRow) {
+	o.Left.WithRow(row)
+	o.Right.WithRow(row)
+}
+func (o *ArithOp) calcFn() (string, func() int64) {
+	// 日時や時間の長さと演算する定数の文字列は、時間の長さとして扱う。
+	if isTimeType(o.Left.Type()) {
+		o.Right = coerce(o.Right, DurationType)
+	}
+	if isTimeType(o.Right.Type()) {
+		o.Left = coerce(o.Left, DurationType)
+	}
+	t := o.Left.Type()
+	t2 := o.Right.Type()
+	typ := arithType(t, o.Operator, t2)
+	if typ == "" {
+		panic(fmt.Errorf("not supported operator: %s %s %s", t, o.Operator, t2))
+	}
+
+	l, r := int64Fn(o.Left), int64Fn(o.Right)
+	switch o.Operator {
+	case sqlparser.PlusStr:
+		return typ, func() int64 { return l() + r() }
+	case sqlparser.MinusStr:
+		return typ, func() int64 { return l() - r() }
+	case sqlparser.MultStr:
+		return typ, func() int64 { return l() * r() }
+	case sqlparser.DivStr, sqlparser.IntDivStr:
+		return typ, func() int64 {
+			d := r()
+			if d == 0 {
+				panic(&EvalError{Err: ErrDivisionByZero})
+			}
+			return l() / d
+		}
+	default: // sqlparser.ModStr
+		return typ, func() int64 {
+			d := r()
+			if d == 0 {
+				panic(&EvalError{Err: ErrDivisionByZero})
+			}
+			return l() % d
+		}
+	}
+}
+
+// arithType は、t 型と t2 型の値を op で演算した結果の型を返す。
+// サポートしていない演算であれば、空文字列を返す。
+func arithType(t, op, t2 string) string {
+	switch op {
+	case sqlparser.PlusStr, sqlparser.MinusStr, sqlparser.MultStr, sqlparser.DivStr, sqlparser.IntDivStr, sqlparser.ModStr:
+	default:
+		return ""
+	}
+	additive := op == sqlparser.PlusStr || op == sqlparser.MinusStr
+	switch {
+	case t == BigIntType && t2 == BigIntType:
+		return BigIntType
+	case t == DatetimeType && t2 == DatetimeType:
+		if op == sqlparser.MinusStr {
+			return DurationType
+		}
+	case t == DatetimeType && intLike(t2):
+		if additive {
+			return DatetimeType
+		}
+	case intLike(t) && t2 == DatetimeType:
+		if op == sqlparser.PlusStr {
+			return DatetimeType
+		}
+	case t == DurationType && t2 == DurationType:
+		switch op {
+		case sqlparser.DivStr, sqlparser.IntDivStr:
+			return BigIntType
+		case sqlparser.MultStr:
+		default:
+			return DurationType
+		}
+	case t == DurationType && t2 == BigIntType:
+		return DurationType
+	case t == BigIntType && t2 == DurationType:
+		if additive || op == sqlparser.MultStr {
+			return DurationType
+		}
+	}
+	return ""
+}
+
+// isTimeType は、日時または時間の長さの型ならtrueを返す。
+func isTimeType(typ string) bool {
+	return typ == DatetimeType || typ == DurationType
+}
+
 type RangeOp struct {
 	Left SqlAny
 	From SqlAny
 	To   SqlAny
+	// 整数に変換した Left, From, To の値を返す。
+	left, from, to func() int64
 	// TODO: cacheを導入する
 }
 
 func (r *RangeOp) Bool() bool {
-	val := r.Left.BigInt()
-	from := r.From.BigInt()
-	to := r.To.BigInt()
-	return from <= val && val <= to
+	if r.left == nil {
+		t := r.Left.Type()
+		r.From = coerce(r.From, t)
+		r.To = coerce(r.To, t)
+		r.left, r.from, r.to = int64Fn(r.Left), int64Fn(r.From), int64Fn(r.To)
+	}
+	val := r.left()
+	return r.from() <= val && val <= r.to()
 }
 func (r *RangeOp) BigInt() int64        { panic(errSqlCast(BoolType, BigIntType)) }
 func (r *RangeOp) String() string       { panic(errSqlCast(BoolType, StringType)) }
@@ -0,0 +1,153 @@
+package sql
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/xwb1989/sqlparser"
+	"github.com/yuuki0xff/goapptrace/tracer/util"
+)
+
+// OrderBy は、ORDER BY句の1つのソートキーを表す。
+type OrderBy struct {
+	Field Field
+	// 降順に並べるならtrue。
+	Desc bool
+}
+
+func (o OrderBy) String() string {
+	if o.Desc {
+		return o.Field.String() + " DESC"
+	}
+	return o.Field.String() + " ASC"
+}
+
+// parseOrderBy parses the ORDER BY clause.
+// Only column names and aggregate functions are allowed as sort keys.
+func (s *SelectParser) parseOrderBy(orderBy sqlparser.OrderBy) []OrderBy {
+	keys := make([]OrderBy, 0, len(orderBy))
+	for _, order := range orderBy {
+		var f Field
+		if fn, ok := order.Expr.(*sqlparser.FuncExpr); ok && isAggregate(fn) {
+			f = s.parseAggregate(fn)
+		} else {
+			f = s.parseColumn(order.Expr, "ORDER BY")
+		}
+		keys = append(keys, OrderBy{
+			Field: f,
+			Desc:  strings.ToLower(order.Direction) == sqlparser.DescScr,
+		})
+	}
+	return keys
+}
+
+// parseColumn は、clause句に指定された列名をパースする。
+// SELECT句で指定した列の別名も参照できる。
+// 列名以外が指定された場合や、存在しない列が指定された場合はpanicする。
+func (s *SelectParser) parseColumn(expr sqlparser.Expr, clause string) Field {
+	col, ok := expr.(*sqlparser.ColName)
+	if !ok {
+		panic(fmt.Errorf("%s supports only column names: %s", clause, sqlparser.String(expr)))
+	}
+	if f, ok := s.selectAlias(col); ok {
+		return f
+	}
+	f, outer := s.resolveColumn(col)
+	if outer {
+		panic(fmt.Errorf("columns of the outer query are not allowed in %s: %s", clause, sqlparser.String(expr)))
+	}
+	if !s.hasField(f) {
+		panic(fmt.Errorf("not found \"%s\" column", f.LongName()))
+	}
+	return f
+}
+
+// OrderBy returns sort keys of the ORDER BY clause.
+// If ORDER BY clause is not specified, it returns nil.
+func (s *SelectParser) OrderBy() []OrderBy {
+	return s.orderBy
+}
+
+// Less は、ORDER BY句に従って2つの行を比較する関数を返す。
+// 返された関数は、aの行がbの行よりも前に並ぶならtrueを返す。
+// 比較する行を変更するときは、SqlRow.Field() の戻り値と同様に、aとbが指す先を書き換える。
+// ORDER BY句が指定されていなければ、nilを返す。
+func (s *SelectParser) Less(a, b SqlRow) (less func() bool, err error) {
+	if len(s.orderBy) == 0 {
+		return nil, nil
+	}
+	cmps := make([]func() int, len(s.orderBy))
+	err = util.PanicHandler(func() {
+		for i, key := range s.orderBy {
+			cmps[i] = compareFn(a.Field(key.Field), b.Field(key.Field), key.Desc)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return func() bool {
+		for _, cmp := range cmps {
+			if c := cmp(); c != 0 {
+				return c < 0
+			}
+		}
+		return false
+	}, nil
+}
+
+// compareFn は、2つのフィールドを比較する関数を返す。
+// 返された関数は、aがbより前に並ぶなら負の値、後に並ぶなら正の値、等しければ0を返す。
+// フィールドの型は、最初に比較したときに決定する。
+func compareFn(a, b SqlFieldGetter, desc bool) func() int {
+	var cmp func() int
+	return func() int {
+		if cmp == nil {
+			cmp = typedCompareFn(a, b)
+		}
+		if desc {
+			return -cmp()
+		}
+		return cmp()
+	}
+}
+func typedCompareFn(a, b SqlFieldGetter) func() int {
+	t := a().Type()
+	switch t {
+	case BoolType:
+		return func() int {
+			x, y := a().Bool(), b().Bool()
+			switch {
+			case x == y:
+				return 0
+			case !x:
+				return -1
+			default:
+				return 1
+			}
+		}
+	case BigIntType, DurationType:
+		return func() int {
+			return compareInt64(a().BigInt(), b().BigInt())
+		}
+	case DatetimeType:
+		return func() int {
+			return compareInt64(int64(a().Datetime()), int64(b().Datetime()))
+		}
+	case StringType:
+		return func() int {
+			return strings.Compare(a().String(), b().String())
+		}
+	default:
+		panic(fmt.Errorf("%s type is not comparable", t))
+	}
+}
+func compareInt64(x, y int64) int {
+	switch {
+	case x < y:
+		return -1
+	case x > y:
+		return 1
+	default:
+		return 0
+	}
+}
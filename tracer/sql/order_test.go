@@ -0,0 +1,78 @@
+package sql
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yuuki0xff/goapptrace/tracer/types"
+)
+
+func TestSelectParser_OrderBy(t *testing.T) {
+	do := func(t *testing.T, sql string, expected []OrderBy) {
+		a := assert.New(t)
+		sel, err := ParseSelect(sql)
+		if a.NoError(err) {
+			a.Equal(expected, sel.OrderBy())
+		}
+	}
+	t.Run("none", func(t *testing.T) {
+		do(t, "SELECT * FROM calls", nil)
+	})
+	t.Run("single", func(t *testing.T) {
+		do(t, "SELECT * FROM calls ORDER BY exectime", []OrderBy{
+			{Field: Field{Table: "calls", Name: "exectime"}},
+		})
+	})
+	t.Run("multiple", func(t *testing.T) {
+		do(t, "SELECT id FROM calls ORDER BY gid ASC, exectime DESC", []OrderBy{
+			{Field: Field{Table: "calls", Name: "gid"}},
+			{Field: Field{Table: "calls", Name: "exectime"}, Desc: true},
+		})
+	})
+	t.Run("implicit-join", func(t *testing.T) {
+		do(t, "SELECT * FROM frames ORDER BY calls.exectime DESC, line", []OrderBy{
+			{Field: Field{Table: "calls", Name: "exectime"}, Desc: true},
+			{Field: Field{Table: "frames", Name: "line"}},
+		})
+	})
+
+	t.Run("error", func(t *testing.T) {
+		a := assert.New(t)
+		_, err := ParseSelect("SELECT * FROM calls ORDER BY foo")
+		a.Error(err)
+		_, err = ParseSelect("SELECT * FROM calls ORDER BY frames.line")
+		a.Error(err)
+		_, err = ParseSelect("SELECT * FROM calls ORDER BY id + 1")
+		a.Error(err)
+	})
+}
+
+func TestSelectParser_Less(t *testing.T) {
+	a := assert.New(t)
+	sel, err := ParseSelect("SELECT * FROM goroutines ORDER BY running DESC, exectime")
+	a.NoError(err)
+
+	var r1, r2 SqlGoroutineRow
+	less, err := sel.Less(&r1, &r2)
+	a.NoError(err)
+	check := func(g1, g2 types.Goroutine) bool {
+		r1.Goroutine = g1
+		r2.Goroutine = g2
+		return less()
+	}
+
+	running := types.Goroutine{GID: 1, StartTime: 10, EndTime: types.NotEnded}
+	short := types.Goroutine{GID: 2, StartTime: 10, EndTime: 20}
+	long := types.Goroutine{GID: 3, StartTime: 10, EndTime: 50}
+	a.True(check(running, short))
+	a.False(check(short, running))
+	a.True(check(short, long))
+	a.False(check(long, short))
+	a.False(check(short, short))
+
+	sel, err = ParseSelect("SELECT * FROM goroutines")
+	a.NoError(err)
+	less, err = sel.Less(&r1, &r2)
+	a.NoError(err)
+	a.Nil(less)
+}
@@ -12,19 +12,15 @@ import (
 var (
 	ErrDistinct          = errors.New("DISTINCT is not supported")
 	ErrNotFoundTable     = errors.New("not found table")
-	ErrJoin              = errors.New("JOIN is not supported")
-	ErrTableAlias        = errors.New("table alias is not supported")
+	ErrJoin              = errors.New("this JOIN is not supported. use \"JOIN ... ON\" instead")
 	ErrTableQualifier    = errors.New("table qualifier is not supported")
 	ErrDBQualifier       = errors.New("database name qualifier is not supported")
-	ErrSubquery          = errors.New("subquery is not supported")
+	ErrSubquery          = errors.New("this subquery is not supported. use IN or EXISTS operator instead")
 	ErrStar              = errors.New("\"*\" and other columns are exclusive")
-	ErrColumnAlias       = errors.New("column alias is not supported")
 	ErrColumnQualifier   = errors.New("column qualifier is not supported")
 	ErrColumnList        = errors.New("column list MUST NOT contain anything other than field names")
+	ErrExprSubquery      = errors.New("subquery is not allowed in the column list")
 	ErrUnsupportedStmt   = errors.New("this statement is not supported")
-	ErrGroupBy           = errors.New("GROUP BY is not supported")
-	ErrHaving            = errors.New("HAVING is not supported")
-	ErrOrderBy           = errors.New("ORDER BY is not supported")
 	ErrLimit             = errors.New("LIMIT is not supported")
 	ErrFunctionQualifier = errors.New("function qualifier is not supported")
 
@@ -32,7 +28,7 @@ var (
 		{
 			Name: "calls",
 			Fields: []string{
-				"id", "gid", "starttime", "endtime", "exectime",
+				"id", "gid", "starttime", "endtime", "exectime", "running", "startoffset", "parent_id",
 			},
 		}, {
 			Name: "frames",
@@ -43,7 +39,7 @@ var (
 		}, {
 			Name: "goroutines",
 			Fields: []string{
-				"gid", "starttime", "endtime", "exectime",
+				"gid", "starttime", "endtime", "exectime", "running", "startoffset",
 			},
 		}, {
 			Name: "funcs",
@@ -55,6 +51,16 @@ var (
 			Fields: []string{
 				"module",
 			},
+		}, {
+			Name: "funcstats",
+			Fields: []string{
+				"name", "pc", "calls", "totaltime", "selftime", "avgtime", "mintime", "maxtime",
+			},
+		}, {
+			Name: "calledges",
+			Fields: []string{
+				"caller", "callerpc", "callee", "calleepc", "calls", "totaltime", "avgtime",
+			},
 		},
 	}
 )
@@ -86,15 +92,22 @@ func findTableByName(name string) (Table, bool) {
 }
 
 type Field struct {
-	// table name
+	// table name.
+	// It is empty if the field refers to a result of an aggregate function.
 	Table string
 	// field name
 	Name string
 	// display name
 	AliasName string
+	// SELECT句などで指定された式。列や集約関数を参照するフィールドであればnil。
+	// 式のフィールドの Table は空で、 Name は式の文字列表現である。
+	expr *exprCol
 }
 
 func (f Field) LongName() string {
+	if f.Table == "" {
+		return f.Name
+	}
 	return f.Table + "." + f.Name
 }
 func (f Field) String() string {
@@ -107,13 +120,36 @@ func (f Field) String() string {
 type SelectParser struct {
 	Stmt *sqlparser.Select
 
+	// FROM句で指定されたテーブル
 	table Table
+	// FROM句とJOIN句で指定されたテーブル。先頭は table と同じテーブルである。
+	tables []TableRef
+	joins  []Join
 	// フィールド名のリスト
 	fields []Field
 
-	where  SqlAny
-	offset int64
-	rows   int64
+	where   SqlAny
+	groupBy []Field
+	having  SqlAny
+	aggs    []*Aggregate
+	orderBy []OrderBy
+	offset  int64
+	rows    int64
+
+	// WHERE句とHAVING句に含まれるサブクエリ
+	subqueries []*InOp
+	// サブクエリであれば、外側のクエリ。
+	outer *SelectParser
+	// サブクエリのWHERE句に含まれる、外側のクエリの列との等価条件。
+	correlations []correlation
+
+	// SELECT句などで指定された式。
+	exprs []*exprCol
+
+	// trueなら、集約関数とGROUP BY句で指定した列を参照できる。
+	aggregating bool
+	// trueなら、SELECT句で指定した列の別名を参照できない。
+	noAlias bool
 }
 
 // parseSelect parses a "SELECT" statement.
@@ -121,16 +157,11 @@ func (s *SelectParser) Parse() error {
 	if s.Stmt.Distinct != "" {
 		return ErrDistinct
 	}
-	tname, err := s.parseFrom(s.Stmt.From)
+	err := s.parseFrom(s.Stmt.From)
 	if err != nil {
 		return err
 	}
-
-	table, ok := findTableByName(tname)
-	if !ok {
-		return ErrNotFoundTable
-	}
-	s.table = table
+	s.table = s.tables[0].Table
 
 	err = s.parseCols(s.Stmt.SelectExprs)
 	if err != nil {
@@ -147,13 +178,29 @@ func (s *SelectParser) Parse() error {
 	}
 
 	if s.Stmt.GroupBy != nil {
-		return ErrGroupBy
+		err = util.PanicHandler(func() {
+			s.groupBy = s.parseGroupBy(s.Stmt.GroupBy)
+		})
+		if err != nil {
+			return err
+		}
 	}
+
 	if s.Stmt.Having != nil {
-		return ErrHaving
+		err = util.PanicHandler(func() {
+			s.having = s.parseHaving(s.Stmt.Having)
+		})
+		if err != nil {
+			return err
+		}
 	}
 	if s.Stmt.OrderBy != nil {
-		return ErrOrderBy
+		err = util.PanicHandler(func() {
+			s.orderBy = s.parseOrderBy(s.Stmt.OrderBy)
+		})
+		if err != nil {
+			return err
+		}
 	}
 	if s.Stmt.Limit != nil {
 		err = util.PanicHandler(func() {
@@ -163,41 +210,14 @@ func (s *SelectParser) Parse() error {
 			return err
 		}
 	}
-	return nil
-}
-
-// parseFrom returns a table name.
-func (s *SelectParser) parseFrom(froms sqlparser.TableExprs) (string, error) {
-	if len(froms) < 1 {
-		panic("len(stmt.From) == 0")
+	err = s.checkExprs()
+	if err != nil {
+		return err
 	}
-	if len(froms) > 1 {
-		return "", ErrJoin
-	}
-
-	switch from := froms[0].(type) {
-	case *sqlparser.AliasedTableExpr:
-		if from.As.String() != "" {
-			return "", ErrDBQualifier
-		}
-		switch table := from.Expr.(type) {
-		case sqlparser.TableName:
-			if table.Qualifier.String() != "" {
-				return "", ErrDBQualifier
-			}
-			return table.Name.String(), nil
-		case *sqlparser.Subquery:
-			return "", ErrSubquery
-		default:
-			panic(fmt.Errorf("bug table=%T", table))
-		}
-	case *sqlparser.ParenTableExpr:
-		return "", ErrSubquery
-	case *sqlparser.JoinTableExpr:
-		return "", ErrJoin
-	default:
-		panic(fmt.Errorf("bug from=%T", from))
+	if s.Grouped() {
+		return s.checkGrouped()
 	}
+	return nil
 }
 
 // parseSelectCols parses columns and sets the SelectParser.field field.
@@ -210,16 +230,28 @@ func (s *SelectParser) parseCols(cols sqlparser.SelectExprs) error {
 				return ErrDBQualifier
 			}
 
+			if col.TableName.Name.IsEmpty() && s.joined() {
+				// JOINした全てのテーブルの列を追加。
+				for _, ref := range s.tables {
+					for _, name := range ref.Table.Fields {
+						fields = append(fields, Field{
+							Table: ref.Name(),
+							Name:  name,
+						})
+					}
+				}
+				continue
+			}
+
 			useAlias := true
 			t := s.table
 			tname := s.table.Name
 			if !col.TableName.Name.IsEmpty() {
 				useAlias = false
-				tname = col.TableName.Name.String()
 				var ok bool
-				t, ok = findTableByName(tname)
+				t, tname, ok = s.findTable(col.TableName.Name.String())
 				if !ok {
-					return fmt.Errorf("not found \"%s\" table", tname)
+					return fmt.Errorf("not found \"%s\" table", col.TableName.Name.String())
 				}
 			}
 			// "*" のみが指定されているため、テーブルの全ての列を追加。
@@ -235,53 +267,96 @@ func (s *SelectParser) parseCols(cols sqlparser.SelectExprs) error {
 				fields = append(fields, f)
 			}
 		case *sqlparser.AliasedExpr:
-			if col.As.String() != "" {
-				return ErrColumnAlias
-			}
-			switch col := col.Expr.(type) {
+			var f Field
+			switch expr := col.Expr.(type) {
 			case *sqlparser.ColName:
-				tname := col.Qualifier.Name.String()
-				if tname == "" {
-					tname = s.table.Name
+				var outer bool
+				err := util.PanicHandler(func() {
+					f, outer = s.resolveColumn(expr)
+				})
+				if err != nil {
+					return err
 				}
-				f := Field{
-					Table: tname,
-					Name:  col.Name.String(),
+				if outer {
+					return fmt.Errorf("columns of the outer query are not allowed here: %s", sqlparser.String(expr))
 				}
-				if col.Qualifier.Name.IsEmpty() {
-					f.AliasName = col.Name.String()
+				if expr.Qualifier.Name.IsEmpty() {
+					f.AliasName = expr.Name.String()
+				}
+			case *sqlparser.FuncExpr:
+				err := util.PanicHandler(func() {
+					if isAggregate(expr) {
+						f = s.parseAggregate(expr)
+					} else {
+						f = s.parseExprCol(expr)
+					}
+				})
+				if err != nil {
+					return err
 				}
-				fields = append(fields, f)
 			default:
-				return ErrColumnList
+				err := util.PanicHandler(func() {
+					f = s.parseExprCol(expr)
+				})
+				if err != nil {
+					return err
+				}
 			}
+			if !col.As.IsEmpty() {
+				f.AliasName = col.As.String()
+			}
+			fields = append(fields, f)
 		}
 	}
 
 	// 全てのフィールドが存在するかチェック。
 	// 存在しないフィールドを指定したときは、エラーを返す。
 	for _, field := range fields {
-		var found bool
-		if field.Table == s.table.Name {
-			found = s.table.HasField(field.Name)
-		} else if field.Table == s.table.ImplictJoin {
-			t, ok := findTableByName(field.Table)
-			if ok {
-				found = t.HasField(field.Name)
-			}
+		if field.Table == "" {
+			// 集約関数または式
+			continue
 		}
-		if !found {
+		if !s.hasField(field) {
 			return fmt.Errorf("not found \"%s\" column", field.String())
 		}
 	}
 	s.fields = fields
 	return nil
 }
+
+// hasField returns true if the field exists in the table or the implicitly joined table.
+func (s *SelectParser) hasField(field Field) bool {
+	if s.joined() {
+		for _, ref := range s.tables {
+			if ref.Name() == field.Table {
+				return ref.Table.HasField(field.Name)
+			}
+		}
+		return false
+	}
+	if field.Table == s.table.Name {
+		return s.table.HasField(field.Name)
+	} else if field.Table == s.table.ImplictJoin {
+		t, ok := findTableByName(field.Table)
+		if ok {
+			return t.HasField(field.Name)
+		}
+	}
+	return false
+}
 func (s *SelectParser) parseWhere(where *sqlparser.Where) SqlAny {
 	if where.Type != sqlparser.WhereStr {
 		panic(fmt.Errorf("bug %#v", where))
 	}
-	return s.parseWhereExpr(where.Expr)
+	expr := where.Expr
+	if s.outer != nil {
+		// 外側のクエリの列との等価条件は、外側のクエリで評価する。
+		expr = s.parseCorrelations(expr)
+		if expr == nil {
+			return nil
+		}
+	}
+	return s.parseWhereExpr(expr)
 }
 
 // parseWhereExpr parses expressions and sets comparesion function to SelectParser.where field.
@@ -303,7 +378,29 @@ func (s *SelectParser) parseWhereExpr(expr sqlparser.Expr) SqlAny {
 		}
 	case *sqlparser.ParenExpr:
 		return s.parseWhereExpr(expr.Expr)
+	case *sqlparser.BinaryExpr:
+		return &ArithOp{
+			Operator: expr.Operator,
+			Left:     s.parseWhereExpr(expr.Left),
+			Right:    s.parseWhereExpr(expr.Right),
+		}
+	case *sqlparser.UnaryExpr:
+		switch expr.Operator {
+		case sqlparser.UPlusStr:
+			return s.parseWhereExpr(expr.Expr)
+		case sqlparser.UMinusStr:
+			return &ArithOp{
+				Operator: sqlparser.MinusStr,
+				Left:     SqlBigInt(0),
+				Right:    s.parseWhereExpr(expr.Expr),
+			}
+		default:
+			panic(fmt.Errorf("not supported operator: %s", expr.Operator))
+		}
 	case *sqlparser.ComparisonExpr:
+		if expr.Operator == sqlparser.InStr || expr.Operator == sqlparser.NotInStr {
+			return s.parseIn(expr)
+		}
 		//if !supportedCompOps.Contains(expr.Operator) {
 		//	panic(fmt.Errorf("unsupported operator: %s", expr.Operator))
 		//}
@@ -343,21 +440,55 @@ func (s *SelectParser) parseWhereExpr(expr sqlparser.Expr) SqlAny {
 			panic("todo")
 		}
 	case *sqlparser.ColName:
-		table := s.table.Name
-		if expr.Qualifier.Name.String() != "" {
-			table = expr.Qualifier.Name.String()
+		if s.aggregating && !s.noAlias {
+			// HAVING句では、SELECT句で指定した列の別名を参照できる。
+			if f, ok := s.selectAlias(expr); ok {
+				return &SqlField{
+					Field: f,
+				}
+			}
+		}
+		f, outer := s.resolveColumn(expr)
+		if outer {
+			panic(fmt.Errorf("correlated subquery supports only equality conditions: %s", sqlparser.String(expr)))
+		}
+		if s.aggregating && !s.isGroupKey(f) {
+			panic(errNotGrouped(f))
 		}
 		return &SqlField{
-			Field: Field{
-				Table: table,
-				Name:  expr.Name.String(),
-			},
+			Field: f,
 		}
+	case *sqlparser.SubstrExpr:
+		// SUBSTR() の第1引数には、列名のみを指定できる。
+		args := []SqlAny{
+			s.parseWhereExpr(expr.Name),
+			s.parseWhereExpr(expr.From),
+		}
+		if expr.To != nil {
+			args = append(args, s.parseWhereExpr(expr.To))
+		}
+		return substrFunc.Parse(args...)
+	case *sqlparser.ExistsExpr:
+		return s.parseExists(expr)
+	case *sqlparser.Subquery:
+		panic(ErrSubquery)
 	case *sqlparser.IntervalExpr:
-		// TODO
-		panic("todo")
+		// INTERVAL n unit は、n * (単位の長さ) の時間の長さである。
+		return &ArithOp{
+			Operator: sqlparser.MultStr,
+			Left:     s.parseWhereExpr(expr.Expr),
+			Right:    intervalUnit(expr.Unit),
+		}
 
 	case *sqlparser.FuncExpr:
+		if isAggregate(expr) {
+			if !s.aggregating {
+				panic(fmt.Errorf("aggregate function is not allowed here: %s", sqlparser.String(expr)))
+			}
+			return &SqlField{
+				Field: s.parseAggregate(expr),
+			}
+		}
 		if !expr.Qualifier.IsEmpty() {
 			panic(ErrFunctionQualifier)
 		}
@@ -380,25 +511,47 @@ func (s *SelectParser) parseWhereExpr(expr sqlparser.Expr) SqlAny {
 		// 関数の引数をパースするは、補完されるテーブル名を SqlFunc で定義されたテーブル名に変更する。
 		parser := s
 		if sqlfunc.Table != "" {
+			if s.joined() {
+				// JOINした行は SqlFuncLogRow ではないため、フレームを列挙できない。
+				panic(fmt.Errorf("%s function is not allowed in a query with JOIN. join \"%s\" table instead", expr.Name.String(), sqlfunc.Table))
+			}
 			table, ok := findTableByName(sqlfunc.Table)
 			if !ok {
 				panic(fmt.Errorf("not found %s table", sqlfunc.Table))
 			}
 			parser = &SelectParser{
-				table: table,
+				table:  table,
+				tables: []TableRef{{Table: table}},
 			}
 		}
 
 		var fnargs []SqlAny
-		for _, arg := range expr.Exprs {
+		for i, arg := range expr.Exprs {
+			if i == 0 && sqlfunc.Unit {
+				fnargs = append(fnargs, parseUnitArg(arg))
+				continue
+			}
 			fnargs = append(fnargs, parser.parseSelectExpr(arg))
 		}
+		if parser != s {
+			s.subqueries = append(s.subqueries, parser.subqueries...)
+		}
 		return sqlfunc.Parse(fnargs...)
 	default:
 		panic("bug")
 	}
 	return nil
 }
+
+// parseUnitArg は、関数の引数に指定された時間の単位 (SECOND など) をパースする。
+func parseUnitArg(expr sqlparser.SelectExpr) SqlAny {
+	if e, ok := expr.(*sqlparser.AliasedExpr); ok {
+		if col, ok := e.Expr.(*sqlparser.ColName); ok && col.Qualifier.IsEmpty() {
+			return intervalUnit(col.Name.String())
+		}
+	}
+	panic(fmt.Errorf("invalid unit: %s", sqlparser.String(expr)))
+}
 func (s *SelectParser) parseSelectExpr(expr sqlparser.SelectExpr) SqlAny {
 	switch expr := expr.(type) {
 	case *sqlparser.StarExpr:
@@ -468,22 +621,5 @@ func (s *SelectParser) Limit() (offset, rows int64) {
 
 // ParseSelect parses the SELECT statement.
 func ParseSelect(sql string) (*SelectParser, error) {
-	stmt, err := sqlparser.Parse(sql)
-	if err != nil {
-		return nil, err
-	}
-
-	switch stmt := stmt.(type) {
-	case *sqlparser.Select:
-		sel := &SelectParser{
-			Stmt: stmt,
-		}
-		err = sel.Parse()
-		if err != nil {
-			return nil, err
-		}
-		return sel, nil
-	default:
-		return nil, ErrUnsupportedStmt
-	}
+	return ParseSelectWithViews(sql, nil)
 }
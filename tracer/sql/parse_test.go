@@ -38,5 +38,8 @@ func TestSelectParser_Parse(t *testing.T) {
 		t.Run("implicit-join", func(t *testing.T) {
 			do(t, "SELECT calls.*, frames.* FROM frames")
 		})
+		t.Run("funcstats", func(t *testing.T) {
+			do(t, "SELECT name, calls FROM funcstats WHERE totaltime > 1000")
+		})
 	})
 }
@@ -0,0 +1,513 @@
+package sql
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/xwb1989/sqlparser"
+	"github.com/yuuki0xff/goapptrace/tracer/storage"
+	"github.com/yuuki0xff/goapptrace/tracer/types"
+)
+
+// maxGIDRangeHint は、GIDの範囲をセカンダリインデックスで絞り込むときの、範囲の最大の幅。
+const maxGIDRangeHint = 1024
+
+// Range は、値の閉区間[Min, Max]を表す。
+// Max < Min であれば、空の区間を表す。
+type Range struct {
+	Min int64
+	Max int64
+}
+
+// FullRange returns a range that contains all values.
+func FullRange() Range {
+	return Range{Min: math.MinInt64, Max: math.MaxInt64}
+}
+
+func (r Range) IsFull() bool  { return r.Min == math.MinInt64 && r.Max == math.MaxInt64 }
+func (r Range) IsEmpty() bool { return r.Max < r.Min }
+
+// Len returns the number of values in the range.
+func (r Range) Len() int64 {
+	if r.IsEmpty() {
+		return 0
+	}
+	return r.Max - r.Min + 1
+}
+
+// Contains returns true if v is in the range.
+func (r Range) Contains(v int64) bool {
+	return r.Min <= v && v <= r.Max
+}
+
+// Overlaps returns true if the range overlaps with [min, max].
+func (r Range) Overlaps(min, max int64) bool {
+	return !r.IsEmpty() && min <= max && r.Min <= max && min <= r.Max
+}
+
+// Intersect returns the intersection of two ranges.
+func (r Range) Intersect(other Range) Range {
+	if other.Min > r.Min {
+		r.Min = other.Min
+	}
+	if other.Max < r.Max {
+		r.Max = other.Max
+	}
+	return r
+}
+
+// Union returns the smallest range that contains both ranges.
+func (r Range) Union(other Range) Range {
+	if r.IsEmpty() {
+		return other
+	}
+	if other.IsEmpty() {
+		return r
+	}
+	if other.Min < r.Min {
+		r.Min = other.Min
+	}
+	if other.Max > r.Max {
+		r.Max = other.Max
+	}
+	return r
+}
+
+func (r Range) String() string {
+	if r.IsEmpty() {
+		return "[]"
+	}
+	min := "-inf"
+	if r.Min != math.MinInt64 {
+		min = strconv.FormatInt(r.Min, 10)
+	}
+	max := "+inf"
+	if r.Max != math.MaxInt64 {
+		max = strconv.FormatInt(r.Max, 10)
+	}
+	return "[" + min + ", " + max + "]"
+}
+
+// Constraints は、WHERE句を満たす行が持つ calls テーブルの列の値の範囲を表す。
+// 範囲外の行がWHERE句を満たさないことは保証されるが、範囲内の行がWHERE句を満たすとは限らない。
+type Constraints struct {
+	ID        Range
+	GID       Range
+	StartTime Range
+	EndTime   Range
+}
+
+func fullConstraints() Constraints {
+	return Constraints{
+		ID:        FullRange(),
+		GID:       FullRange(),
+		StartTime: FullRange(),
+		EndTime:   FullRange(),
+	}
+}
+
+func (c Constraints) intersect(other Constraints) Constraints {
+	return Constraints{
+		ID:        c.ID.Intersect(other.ID),
+		GID:       c.GID.Intersect(other.GID),
+		StartTime: c.StartTime.Intersect(other.StartTime),
+		EndTime:   c.EndTime.Intersect(other.EndTime),
+	}
+}
+func (c Constraints) union(other Constraints) Constraints {
+	return Constraints{
+		ID:        c.ID.Union(other.ID),
+		GID:       c.GID.Union(other.GID),
+		StartTime: c.StartTime.Union(other.StartTime),
+		EndTime:   c.EndTime.Union(other.EndTime),
+	}
+}
+
+// IsEmpty returns true if no rows satisfy the constraints.
+func (c Constraints) IsEmpty() bool {
+	return c.ID.IsEmpty() || c.GID.IsEmpty() || c.StartTime.IsEmpty() || c.EndTime.IsEmpty()
+}
+
+func (c Constraints) String() string {
+	var parts []string
+	for _, r := range []struct {
+		name string
+		r    Range
+	}{
+		{"id", c.ID},
+		{"gid", c.GID},
+		{"starttime", c.StartTime},
+		{"endtime", c.EndTime},
+	} {
+		if !r.r.IsFull() {
+			parts = append(parts, r.name+"="+r.r.String())
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// Constraints は、WHERE句から calls テーブルの id, gid, starttime, endtime 列の値の範囲を抽出する。
+// calls テーブルと frames テーブル以外のテーブルでは、常に全範囲を返す。
+func (s *SelectParser) Constraints() Constraints {
+	if s.where == nil {
+		return fullConstraints()
+	}
+	switch s.table.Name {
+	case "calls", "frames":
+		return extractConstraints(s.where, s.hintTable)
+	default:
+		return fullConstraints()
+	}
+}
+
+// extractConstraints は、expr を満たす行が持つ列の値の範囲を返す。
+// table は、フィールドのテーブル名を実際のテーブル名に変換する。
+func extractConstraints(expr SqlAny, table func(string) string) Constraints {
+	c := fullConstraints()
+	switch expr := expr.(type) {
+	case *AndOp:
+		return extractConstraints(expr.Left, table).intersect(extractConstraints(expr.Right, table))
+	case *OrOp:
+		return extractConstraints(expr.Left, table).union(extractConstraints(expr.Right, table))
+	case *SqlFuncFrame:
+		// フレームは、同じ関数呼び出しの行である。
+		return extractConstraints(expr.Expr, identTable)
+	case *SqlFuncCall:
+		return extractConstraints(expr.Expr, identTable)
+	case *CompOp:
+		field, val := expr.Left, expr.Right
+		op := expr.Operator
+		if _, ok := field.(*SqlField); !ok {
+			field, val = val, field
+			op = swapOperator(op)
+		}
+		f, ok := field.(*SqlField)
+		if !ok || !val.Const() {
+			break
+		}
+		r := constraintRange(&c, f.Field, val.Type(), table)
+		if r == nil {
+			break
+		}
+		v := constInt64(val)
+		switch op {
+		case sqlparser.EqualStr:
+			*r = Range{Min: v, Max: v}
+		case sqlparser.LessThanStr:
+			if v == math.MinInt64 {
+				*r = Range{Min: 0, Max: -1}
+			} else {
+				r.Max = v - 1
+			}
+		case sqlparser.LessEqualStr:
+			r.Max = v
+		case sqlparser.GreaterThanStr:
+			if v == math.MaxInt64 {
+				*r = Range{Min: 0, Max: -1}
+			} else {
+				r.Min = v + 1
+			}
+		case sqlparser.GreaterEqualStr:
+			r.Min = v
+		}
+	case *RangeOp:
+		f, ok := expr.Left.(*SqlField)
+		if !ok || !expr.From.Const() || !expr.To.Const() || expr.From.Type() != expr.To.Type() {
+			break
+		}
+		r := constraintRange(&c, f.Field, expr.From.Type(), table)
+		if r == nil {
+			break
+		}
+		*r = Range{Min: constInt64(expr.From), Max: constInt64(expr.To)}
+	case *InOp:
+		f, ok := expr.Left[0].(*SqlField)
+		if !ok || expr.Not || expr.Subquery != nil || len(expr.Values) == 0 {
+			break
+		}
+		r := constraintRange(&c, f.Field, expr.Values[0].Type(), table)
+		if r == nil {
+			break
+		}
+		values := Range{Min: 0, Max: -1}
+		for _, v := range expr.Values {
+			if v.Type() != expr.Values[0].Type() {
+				return fullConstraints()
+			}
+			x := constInt64(v)
+			values = values.Union(Range{Min: x, Max: x})
+		}
+		*r = values
+	}
+	return c
+}
+
+// constraintRange は、field 列の値の範囲を格納する c のフィールドを返す。
+// 範囲を抽出できない列であれば、nilを返す。
+func constraintRange(c *Constraints, field Field, typ string, table func(string) string) *Range {
+	t := table(field.Table)
+	switch {
+	case (t == "calls" || t == "frames") && field.Name == "id" && typ == BigIntType:
+		return &c.ID
+	case t == "calls" && field.Name == "gid" && typ == BigIntType:
+		return &c.GID
+	case t == "calls" && field.Name == "starttime" && typ == DatetimeType:
+		return &c.StartTime
+	case t == "calls" && field.Name == "endtime" && typ == DatetimeType:
+		return &c.EndTime
+	}
+	return nil
+}
+
+func constInt64(v SqlAny) int64 {
+	if v.Type() == DatetimeType {
+		return int64(v.Datetime())
+	}
+	return v.BigInt()
+}
+
+// swapOperator は、左辺と右辺を入れ替えたときの比較演算子を返す。
+func swapOperator(op string) string {
+	switch op {
+	case sqlparser.LessThanStr:
+		return sqlparser.GreaterThanStr
+	case sqlparser.LessEqualStr:
+		return sqlparser.GreaterEqualStr
+	case sqlparser.GreaterThanStr:
+		return sqlparser.LessThanStr
+	case sqlparser.GreaterEqualStr:
+		return sqlparser.LessEqualStr
+	default:
+		return op
+	}
+}
+
+// PlanStats は、クエリプランの作成に使用するログの情報を表す。
+type PlanStats struct {
+	// スナップショットに含まれるFuncLogのレコード数。
+	Records int64
+	// FuncLogファイルごとの、IDと時刻の範囲。
+	Index []storage.IndexRecord
+	// trueなら、書き込み中のログである。
+	// 実行中の関数の終了時刻は後から変化するため、endtime列の条件ではファイルを除外しない。
+	Live bool
+	// Lookup は、セカンダリインデックスを使ってヒントを満たす可能性のあるFuncLogのIDを昇順に返す。
+	// インデックスが利用できなければ、okはfalseを返す。nilならインデックスを使用しない。
+	Lookup func(hint IndexHint) (ids []types.FuncLogID, ok bool)
+}
+
+// Plan は、テーブルから行を読み出す方法を表す。
+type Plan struct {
+	Table       string
+	Constraints Constraints
+	// 読み出すFuncLogのIDの範囲。昇順に並んでおり、重複しない。
+	// calls テーブルと frames テーブル以外では、nilである。
+	Ranges []Range
+	// セカンダリインデックスで絞り込んだ場合は、使用したヒントと読み出すFuncLogのID。
+	Hint *IndexHint
+	IDs  []types.FuncLogID
+	// FuncLogファイルの数と、そのうち読み出すファイルの数。
+	Files        int
+	ScannedFiles int
+	// テーブルのレコード数と、読み出すレコード数の見積もり。
+	// calls テーブルと frames テーブルでは、FuncLogのレコード数である。
+	TotalRows     int64
+	EstimatedRows int64
+}
+
+// PlanFunc は、table テーブルを読み出すプランを返す。
+// sel がnilなら、全ての行を読み出すプランを返す。
+type PlanFunc func(table string, sel *SelectParser) *Plan
+
+// FullScanPlan returns a plan that reads all rows of the table.
+func FullScanPlan(table string, rows int64) *Plan {
+	return &Plan{
+		Table:         table,
+		Constraints:   fullConstraints(),
+		TotalRows:     rows,
+		EstimatedRows: rows,
+	}
+}
+
+// NewFuncLogPlan は、calls テーブルまたは frames テーブルを読み出すプランを作成する。
+// WHERE句から抽出した範囲と重ならないFuncLogファイルは読み出さない。
+// セカンダリインデックスが利用できれば、インデックスで読み出すレコードを絞り込む。
+// sel がnilなら、全てのレコードを読み出す。
+func NewFuncLogPlan(table string, sel *SelectParser, stats PlanStats) *Plan {
+	p := &Plan{
+		Table:       table,
+		Constraints: fullConstraints(),
+		TotalRows:   stats.Records,
+	}
+	if sel != nil {
+		p.Constraints = sel.Constraints()
+	}
+	c := p.Constraints
+	ids := c.ID.Intersect(Range{Min: 0, Max: stats.Records - 1})
+	if c.IsEmpty() {
+		ids = Range{Min: 0, Max: -1}
+	}
+
+	records := make([]storage.IndexRecord, len(stats.Index))
+	copy(records, stats.Index)
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].MinID < records[j].MinID
+	})
+	// インデックスに含まれないレコードは、必ず読み出す。
+	covered := int64(-1)
+	var ranges []Range
+	for _, ir := range records {
+		if ir.IsEmpty() {
+			continue
+		}
+		p.Files++
+		if covered < ir.MaxID {
+			covered = ir.MaxID
+		}
+		if !ids.Overlaps(ir.MinID, ir.MaxID) || !c.StartTime.Overlaps(int64(ir.MinStart), int64(ir.MaxStart)) {
+			continue
+		}
+		if !stats.Live {
+			// 実行中の関数の終了時刻は types.NotEnded である。
+			minEnd := ir.MinEnd
+			if types.NotEnded < minEnd {
+				minEnd = types.NotEnded
+			}
+			if !c.EndTime.Overlaps(int64(minEnd), int64(ir.MaxEnd)) {
+				continue
+			}
+		}
+		p.ScannedFiles++
+		ranges = append(ranges, ids.Intersect(Range{Min: ir.MinID, Max: ir.MaxID}))
+	}
+	if r := ids.Intersect(Range{Min: covered + 1, Max: math.MaxInt64}); !r.IsEmpty() {
+		ranges = append(ranges, r)
+	}
+	p.Ranges = mergeRanges(ranges)
+	for _, r := range p.Ranges {
+		p.EstimatedRows += r.Len()
+	}
+
+	if sel == nil || stats.Lookup == nil || p.EstimatedRows == 0 {
+		return p
+	}
+	hint, ok := sel.IndexHint()
+	if !ok && c.GID.Min >= 0 && c.GID.Len() <= maxGIDRangeHint {
+		// GIDの範囲が狭ければ、範囲内の全てのGIDでインデックスを引く。
+		hint = IndexHint{}
+		for gid := c.GID.Min; gid <= c.GID.Max; gid++ {
+			hint.GIDs = append(hint.GIDs, types.GID(gid))
+		}
+		ok = true
+	}
+	if !ok {
+		return p
+	}
+	found, ok := stats.Lookup(hint)
+	if !ok {
+		return p
+	}
+	p.Hint = &hint
+	p.IDs = []types.FuncLogID{}
+	for _, id := range found {
+		if p.contains(int64(id)) {
+			p.IDs = append(p.IDs, id)
+		}
+	}
+	p.EstimatedRows = int64(len(p.IDs))
+	return p
+}
+
+// mergeRanges は、空の範囲を取り除き、重なる範囲や隣接する範囲を結合する。
+func mergeRanges(ranges []Range) []Range {
+	sort.Slice(ranges, func(i, j int) bool {
+		return ranges[i].Min < ranges[j].Min
+	})
+	merged := []Range{}
+	for _, r := range ranges {
+		if r.IsEmpty() {
+			continue
+		}
+		if n := len(merged); n > 0 && r.Min <= merged[n-1].Max+1 {
+			if merged[n-1].Max < r.Max {
+				merged[n-1].Max = r.Max
+			}
+			continue
+		}
+		merged = append(merged, r)
+	}
+	return merged
+}
+
+func (p *Plan) contains(id int64) bool {
+	i := sort.Search(len(p.Ranges), func(i int) bool {
+		return id <= p.Ranges[i].Max
+	})
+	return i < len(p.Ranges) && p.Ranges[i].Contains(id)
+}
+
+// Iterator は、読み出すFuncLogのIDを昇順に返す関数を返す。
+// 全てのIDを返し終えたら、okはfalseになる。
+func (p *Plan) Iterator() func() (id types.FuncLogID, ok bool) {
+	if p.IDs != nil {
+		i := -1
+		return func() (types.FuncLogID, bool) {
+			i++
+			if len(p.IDs) <= i {
+				return 0, false
+			}
+			return p.IDs[i], true
+		}
+	}
+	i := 0
+	next := int64(0)
+	if len(p.Ranges) > 0 {
+		next = p.Ranges[0].Min
+	}
+	return func() (types.FuncLogID, bool) {
+		for i < len(p.Ranges) {
+			if next <= p.Ranges[i].Max {
+				id := next
+				next++
+				return types.FuncLogID(id), true
+			}
+			i++
+			if i < len(p.Ranges) {
+				next = p.Ranges[i].Min
+			}
+		}
+		return 0, false
+	}
+}
+
+// String は、プランの概要を返す。
+func (p *Plan) String() string {
+	var parts []string
+	if p.Hint != nil {
+		parts = append(parts, "index="+p.Hint.String())
+	}
+	if p.Ranges != nil {
+		if p.Files > 0 {
+			parts = append(parts, fmt.Sprintf("files=%d/%d", p.ScannedFiles, p.Files))
+		}
+		var ranges []string
+		for i, r := range p.Ranges {
+			if i == 3 {
+				ranges = append(ranges, "...")
+				break
+			}
+			ranges = append(ranges, r.String())
+		}
+		parts = append(parts, "ids="+strings.Join(ranges, ""))
+	}
+	if s := p.Constraints.String(); s != "" {
+		parts = append(parts, s)
+	}
+	if len(parts) == 0 {
+		return "full scan"
+	}
+	return strings.Join(parts, " ")
+}
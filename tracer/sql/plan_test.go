@@ -0,0 +1,201 @@
+package sql
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yuuki0xff/goapptrace/tracer/storage"
+	"github.com/yuuki0xff/goapptrace/tracer/types"
+)
+
+func TestRange(t *testing.T) {
+	a := assert.New(t)
+	r := Range{Min: 10, Max: 20}
+	a.Equal(int64(11), r.Len())
+	a.True(r.Contains(10))
+	a.False(r.Contains(21))
+	a.True(r.Overlaps(20, 30))
+	a.False(r.Overlaps(21, 30))
+	a.Equal(Range{Min: 15, Max: 20}, r.Intersect(Range{Min: 15, Max: 100}))
+	a.True(r.Intersect(Range{Min: 30, Max: 40}).IsEmpty())
+	a.Equal(Range{Min: 0, Max: 20}, r.Union(Range{Min: 0, Max: 5}))
+	a.Equal(r, r.Union(Range{Min: 0, Max: -1}))
+	a.Equal("[10, 20]", r.String())
+	a.Equal("[-inf, 20]", Range{Min: math.MinInt64, Max: 20}.String())
+	a.True(FullRange().IsFull())
+}
+
+func TestSelectParser_Constraints(t *testing.T) {
+	do := func(t *testing.T, query string, expected Constraints) {
+		sel, err := ParseSelect(query)
+		if assert.NoError(t, err, query) {
+			assert.Equal(t, expected, sel.Constraints(), query)
+		}
+	}
+	withID := func(min, max int64) Constraints {
+		c := fullConstraints()
+		c.ID = Range{Min: min, Max: max}
+		return c
+	}
+	withGID := func(min, max int64) Constraints {
+		c := fullConstraints()
+		c.GID = Range{Min: min, Max: max}
+		return c
+	}
+
+	t.Run("no-where", func(t *testing.T) {
+		do(t, "SELECT * FROM calls", fullConstraints())
+	})
+	t.Run("comparison", func(t *testing.T) {
+		do(t, "SELECT * FROM calls WHERE id = 10", withID(10, 10))
+		do(t, "SELECT * FROM calls WHERE id < 10", withID(math.MinInt64, 9))
+		do(t, "SELECT * FROM calls WHERE 10 <= id", withID(10, math.MaxInt64))
+		do(t, "SELECT * FROM calls WHERE id BETWEEN 10 AND 20", withID(10, 20))
+		do(t, "SELECT * FROM calls WHERE gid IN (3, 1, 5)", withGID(1, 5))
+	})
+	t.Run("and-or", func(t *testing.T) {
+		do(t, "SELECT * FROM calls WHERE id >= 10 AND id < 20 AND exectime > 5", withID(10, 19))
+		do(t, "SELECT * FROM calls WHERE id < 10 OR id > 20", fullConstraints())
+		do(t, "SELECT * FROM calls WHERE id BETWEEN 0 AND 5 OR id BETWEEN 10 AND 15", withID(0, 15))
+		do(t, "SELECT * FROM calls WHERE id < 10 OR gid = 1", fullConstraints())
+		do(t, "SELECT * FROM calls WHERE id = 1 AND id = 2", withID(2, 1))
+	})
+	t.Run("not-extracted", func(t *testing.T) {
+		do(t, "SELECT * FROM calls WHERE id <> 10", fullConstraints())
+		do(t, "SELECT * FROM calls WHERE NOT id = 10", fullConstraints())
+		do(t, "SELECT * FROM calls WHERE gid NOT IN (1, 2)", fullConstraints())
+		do(t, "SELECT * FROM goroutines WHERE gid = 1", fullConstraints())
+		do(t, "SELECT c.id FROM calls c JOIN calls d ON c.gid = d.gid WHERE d.id = 1", fullConstraints())
+	})
+	t.Run("frame", func(t *testing.T) {
+		do(t, "SELECT * FROM calls WHERE FRAME(id = 3)", withID(3, 3))
+	})
+	t.Run("datetime", func(t *testing.T) {
+		a := assert.New(t)
+		expr := &AndOp{
+			Left:  &CompOp{Operator: ">=", Left: &SqlField{Field: Field{Table: "calls", Name: "starttime"}}, Right: SqlDatetime(100)},
+			Right: &CompOp{Operator: ">", Left: SqlDatetime(200), Right: &SqlField{Field: Field{Table: "calls", Name: "endtime"}}},
+		}
+		c := extractConstraints(expr, identTable)
+		a.Equal(Range{Min: 100, Max: math.MaxInt64}, c.StartTime)
+		a.Equal(Range{Min: math.MinInt64, Max: 199}, c.EndTime)
+		a.Equal("starttime=[100, +inf] endtime=[-inf, 199]", c.String())
+	})
+}
+
+func TestNewFuncLogPlan(t *testing.T) {
+	// 3つのファイルに分割されたログ。ID 30 以降のレコードは、まだインデックスに含まれていない。
+	index := []storage.IndexRecord{
+		{MinID: 0, MaxID: 9, MinStart: 0, MaxStart: 90, MinEnd: 5, MaxEnd: 100},
+		{MinID: 10, MaxID: 19, MinStart: 100, MaxStart: 190, MinEnd: 105, MaxEnd: 200},
+		{MinID: 20, MaxID: 29, MinStart: 200, MaxStart: 290, MinEnd: 205, MaxEnd: 300},
+	}
+	stats := PlanStats{
+		Records: 35,
+		Index:   index,
+	}
+	plan := func(t *testing.T, query string, stats PlanStats) *Plan {
+		sel, err := ParseSelect(query)
+		if !assert.NoError(t, err, query) {
+			t.FailNow()
+		}
+		return NewFuncLogPlan(sel.From(), sel, stats)
+	}
+	ids := func(p *Plan) []types.FuncLogID {
+		var ids []types.FuncLogID
+		next := p.Iterator()
+		for id, ok := next(); ok; id, ok = next() {
+			ids = append(ids, id)
+		}
+		return ids
+	}
+
+	t.Run("full-scan", func(t *testing.T) {
+		a := assert.New(t)
+		p := plan(t, "SELECT * FROM calls", stats)
+		a.Equal([]Range{{Min: 0, Max: 34}}, p.Ranges)
+		a.Equal(3, p.Files)
+		a.Equal(3, p.ScannedFiles)
+		a.Equal(int64(35), p.EstimatedRows)
+		a.Equal("files=3/3 ids=[0, 34]", p.String())
+
+		p = NewFuncLogPlan("calls", nil, stats)
+		a.Equal(int64(35), p.EstimatedRows)
+	})
+	t.Run("id", func(t *testing.T) {
+		a := assert.New(t)
+		p := plan(t, "SELECT * FROM calls WHERE id BETWEEN 12 AND 14", stats)
+		a.Equal([]Range{{Min: 12, Max: 14}}, p.Ranges)
+		a.Equal(1, p.ScannedFiles)
+		a.Equal([]types.FuncLogID{12, 13, 14}, ids(p))
+
+		p = plan(t, "SELECT * FROM calls WHERE id > 1000", stats)
+		a.Empty(p.Ranges)
+		a.Equal(int64(0), p.EstimatedRows)
+		a.Nil(ids(p))
+	})
+	t.Run("starttime", func(t *testing.T) {
+		a := assert.New(t)
+		sel, err := ParseSelect("SELECT * FROM calls")
+		a.NoError(err)
+		sel.where = &CompOp{Operator: ">=", Left: &SqlField{Field: Field{Table: "calls", Name: "starttime"}}, Right: SqlDatetime(150)}
+		p := NewFuncLogPlan("calls", sel, stats)
+		// インデックスに含まれないレコードは、常に読み出す。
+		a.Equal([]Range{{Min: 10, Max: 34}}, p.Ranges)
+		a.Equal(2, p.ScannedFiles)
+	})
+	t.Run("endtime", func(t *testing.T) {
+		a := assert.New(t)
+		sel, err := ParseSelect("SELECT * FROM calls")
+		a.NoError(err)
+		sel.where = &CompOp{Operator: "<", Left: &SqlField{Field: Field{Table: "calls", Name: "endtime"}}, Right: SqlDatetime(0)}
+		p := NewFuncLogPlan("calls", sel, stats)
+		// 実行中の関数の終了時刻は types.NotEnded なので、全てのファイルが条件を満たす可能性がある。
+		a.Equal(3, p.ScannedFiles)
+
+		sel.where = &CompOp{Operator: ">", Left: &SqlField{Field: Field{Table: "calls", Name: "endtime"}}, Right: SqlDatetime(250)}
+		p = NewFuncLogPlan("calls", sel, stats)
+		a.Equal([]Range{{Min: 20, Max: 34}}, p.Ranges)
+
+		live := stats
+		live.Live = true
+		p = NewFuncLogPlan("calls", sel, live)
+		a.Equal([]Range{{Min: 0, Max: 34}}, p.Ranges)
+	})
+	t.Run("index-hint", func(t *testing.T) {
+		a := assert.New(t)
+		var lookup []IndexHint
+		withIndex := stats
+		withIndex.Lookup = func(hint IndexHint) ([]types.FuncLogID, bool) {
+			lookup = append(lookup, hint)
+			return []types.FuncLogID{1, 11, 21, 31}, true
+		}
+		p := plan(t, "SELECT * FROM calls WHERE gid = 5 AND id >= 10", withIndex)
+		a.Equal([]IndexHint{{GIDs: []types.GID{5}}}, lookup)
+		a.Equal([]types.FuncLogID{11, 21, 31}, ids(p))
+		a.Equal(int64(3), p.EstimatedRows)
+		a.Equal("index=gid IN (5) files=2/3 ids=[10, 34] id=[10, +inf] gid=[5, 5]", p.String())
+
+		lookup = nil
+		p = plan(t, "SELECT * FROM calls WHERE gid BETWEEN 2 AND 4", withIndex)
+		a.Equal([]IndexHint{{GIDs: []types.GID{2, 3, 4}}}, lookup)
+		a.NotNil(p.Hint)
+
+		lookup = nil
+		p = plan(t, "SELECT * FROM calls WHERE gid > 2", withIndex)
+		a.Nil(lookup)
+		a.Nil(p.Hint)
+		a.Equal(int64(35), p.EstimatedRows)
+	})
+	t.Run("index-disabled", func(t *testing.T) {
+		a := assert.New(t)
+		noIndex := stats
+		noIndex.Lookup = func(hint IndexHint) ([]types.FuncLogID, bool) {
+			return nil, false
+		}
+		p := plan(t, "SELECT * FROM calls WHERE gid = 5", noIndex)
+		a.Nil(p.Hint)
+		a.Len(ids(p), 35)
+	})
+}
@@ -1,9 +1,14 @@
 package sql
 
 import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
 	"fmt"
 	"reflect"
 	"strconv"
+	"strings"
+	"time"
 	"unsafe"
 
 	"github.com/yuuki0xff/goapptrace/tracer/types"
@@ -11,6 +16,11 @@ import (
 
 const (
 	CsvFormat OutputFormat = iota
+	// JsonFormat は、値をJSONで出力する。日時はナノ秒単位の整数になる。
+	JsonFormat
+	// JsonRFC3339Format は、日時をRFC3339形式の文字列で出力する点を除き、 JsonFormat と同じである。
+	// 終了していない関数やgoroutineの終了時刻はnullになる。
+	JsonRFC3339Format
 )
 
 // SqlFieldGetter は SqlAny.WithRow() で指定した行の特定のフィールドを返す。
@@ -61,21 +71,50 @@ func (g SqlFieldGetter) Printer(format OutputFormat) SqlFieldPrinter {
 						return 5
 					}
 				}
-			case BigIntType:
+			case BigIntType, DurationType:
+				// 時間の長さは、ナノ秒単位の整数として出力する。
 				conv = func(buf []byte) int64 {
 					val := g().BigInt()
 					s := strconv.FormatInt(val, 10)
 					return strFastcopy(buf, &s)
 				}
 			case StringType:
+				if format == CsvFormat {
+					conv = func(buf []byte) int64 {
+						s := csvString(g().String())
+						return strFastcopy(buf, &s)
+					}
+					break
+				}
 				conv = func(buf []byte) int64 {
-					s := g().String()
-					return strFastcopy(buf, &s)
+					return int64(copy(buf, jsonString(g().String())))
 				}
 			case DatetimeType:
-				conv = func(buf []byte) int64 {
-					s := g().Datetime().UnixTime().String()
-					return strFastcopy(buf, &s)
+				switch format {
+				case CsvFormat:
+					conv = func(buf []byte) int64 {
+						s := g().Datetime().UnixTime().String()
+						return strFastcopy(buf, &s)
+					}
+				case JsonFormat:
+					conv = func(buf []byte) int64 {
+						s := g().Datetime().NumberString()
+						return strFastcopy(buf, &s)
+					}
+				case JsonRFC3339Format:
+					conv = func(buf []byte) int64 {
+						t := g().Datetime()
+						if t == types.NotEnded {
+							return int64(copy(buf, "null"))
+						}
+						buf[0] = '"'
+						s := t.UnixTime().Format(time.RFC3339Nano)
+						n := strFastcopy(buf[1:], &s)
+						buf[n+1] = '"'
+						return n + 2
+					}
+				default:
+					panic(fmt.Errorf("OutputFormat(%d) is not supported", format))
 				}
 			default:
 				panic(fmt.Errorf("%s type is not supported", coltype))
@@ -84,36 +123,83 @@ func (g SqlFieldGetter) Printer(format OutputFormat) SqlFieldPrinter {
 		return conv(buf)
 	}
 }
-func (gs SqlFieldGetters) Printer(format OutputFormat) (p SqlFieldPrinter) {
+
+// Printer は、全てのフィールドを format 形式で出力する SqlFieldPrinter を返す。
+// CsvFormat ならカンマ区切りで、JSON形式ならJSONの配列として出力する。
+func (gs SqlFieldGetters) Printer(format OutputFormat) SqlFieldPrinter {
 	switch format {
 	case CsvFormat:
-		for i := len(gs) - 1; i >= 0; i-- {
-			g := gs[i]
-			var colp SqlFieldPrinter
-			if p == nil {
-				p = func(buf []byte) int64 {
-					if colp == nil {
-						colp = g.Printer(format)
-					}
-					return colp(buf)
-				}
-			} else {
-				oldp := p
-				p = func(buf []byte) int64 {
-					if colp == nil {
-						colp = g.Printer(format)
-					}
-					n := colp(buf)
-					buf[n] = ','
-					n2 := oldp(buf[n+1:])
-					return n + 1 + n2
-				}
-			}
-		}
-		return
+		return gs.printer(format, nil, "", "")
+	case JsonFormat, JsonRFC3339Format:
+		return gs.printer(format, nil, "[", "]")
+	default:
+		panic(fmt.Errorf("OutputFormat(%d) is not supported", format))
+	}
+}
+
+// ObjectPrinter は、列名を names にしたJSONオブジェクトとして全てのフィールドを出力する SqlFieldPrinter を返す。
+// format には、JSON形式のみを指定できる。
+func (gs SqlFieldGetters) ObjectPrinter(names []string, format OutputFormat) SqlFieldPrinter {
+	switch format {
+	case JsonFormat, JsonRFC3339Format:
 	default:
 		panic(fmt.Errorf("OutputFormat(%d) is not supported", format))
 	}
+	if len(names) != len(gs) {
+		panic(fmt.Errorf("mismatch the number of names: expected %d, but %d", len(gs), len(names)))
+	}
+	keys := make([]string, len(names))
+	for i, name := range names {
+		keys[i] = jsonString(name) + ":"
+	}
+	return gs.printer(format, keys, "{", "}")
+}
+
+// printer は、 prefix に続けて全てのフィールドをカンマ区切りで出力し、最後に suffix を出力する SqlFieldPrinter を返す。
+// keys がnilでなければ、各フィールドの前に keys[i] を出力する。
+func (gs SqlFieldGetters) printer(format OutputFormat, keys []string, prefix, suffix string) SqlFieldPrinter {
+	colps := make([]SqlFieldPrinter, len(gs))
+	return func(buf []byte) int64 {
+		n := int64(copy(buf, prefix))
+		for i, g := range gs {
+			if i > 0 {
+				buf[n] = ','
+				n++
+			}
+			if keys != nil {
+				n += int64(copy(buf[n:], keys[i]))
+			}
+			if colps[i] == nil {
+				colps[i] = g.Printer(format)
+			}
+			n += colps[i](buf[n:])
+		}
+		n += int64(copy(buf[n:], suffix))
+		return n
+	}
+}
+
+// csvString は、s をCSVのフィールドに変換する。
+// 区切り文字、引用符または改行を含む場合は、引用符で囲む。
+func csvString(s string) string {
+	if !strings.ContainsAny(s, ",\"\r\n") && !strings.HasPrefix(s, " ") && !strings.HasPrefix(s, "\t") {
+		return s
+	}
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	w.Write([]string{s}) // nolint: errcheck
+	w.Flush()
+	return strings.TrimSuffix(buf.String(), "\n")
+}
+
+// jsonString は、s をJSONの文字列リテラルに変換する。
+func jsonString(s string) string {
+	b, err := json.Marshal(s)
+	if err != nil {
+		// 文字列のエンコードは失敗しない。
+		panic(err)
+	}
+	return string(b)
 }
 
 // SqlRow は処理対象の1つの行を表すデータ型。
@@ -130,16 +216,53 @@ type SqlRow interface {
 	MaxOffset() int
 }
 
+// symbolsRow は、シンボル情報を参照できる行である。
+// FUNCNAME() などの関数は、この行からシンボル情報を取得する。
+type symbolsRow interface {
+	symbols() *types.Symbols
+}
+
+// LogTime は、ログに記録されている期間を表す。
+// LOG_START() 関数と LOG_END() 関数、および startoffset 列は、この値を基準にする。
+type LogTime struct {
+	// 最初の関数呼び出しの開始時刻。
+	Start types.Time
+	// 最後の関数呼び出しの終了時刻。
+	End types.Time
+}
+
+// execTime は、 start から end までの実行時間を返す。
+// 実行中 (end が NotEnded) であれば、ログに記録されている最後の時刻 (LOG_END()) までの経過時間を返す。
+// ログの期間が分からないか、最後の時刻よりも後に開始していれば0を返す。
+func execTime(start, end types.Time, lt *LogTime) SqlDuration {
+	if end == types.NotEnded {
+		if lt == nil || lt.End < start {
+			return 0
+		}
+		end = lt.End
+	}
+	return SqlDuration(end - start)
+}
+
+// logTimeRow は、ログに記録されている期間を参照できる行である。
+type logTimeRow interface {
+	logTime() *LogTime
+}
+
 type SqlFuncLogRow struct {
 	// 処理対象の FuncLog へのポインタ。
 	// このポインタ、またはその先のデータを書き換えることで、 SqlFieldGetter が返す値を変更できる。
 	FuncLog *types.FuncLog
 	Symbols *types.Symbols
+	LogTime *LogTime
 	// 処理対象のframeを指定する。
 	offset int
 }
 
 func (r *SqlFuncLogRow) Field(field Field) SqlFieldGetter {
+	if field.expr != nil {
+		return field.expr.getter(r)
+	}
 	table := field.Table
 	col := field.Name
 	switch table {
@@ -154,7 +277,17 @@ func (r *SqlFuncLogRow) Field(field Field) SqlFieldGetter {
 		case "endtime":
 			return func() SqlAny { return SqlDatetime(r.FuncLog.EndTime) }
 		case "exectime":
-			return func() SqlAny { return SqlBigInt(r.FuncLog.EndTime - r.FuncLog.StartTime) }
+			return func() SqlAny { return execTime(r.FuncLog.StartTime, r.FuncLog.EndTime, r.LogTime) }
+		case "running":
+			return func() SqlAny { return SqlBool(!r.FuncLog.IsEnded()) }
+		case "startoffset":
+			if r.LogTime == nil {
+				panic(fmt.Errorf("%s.%s column is not available", table, col))
+			}
+			return func() SqlAny { return SqlDuration(r.FuncLog.StartTime - r.LogTime.Start) }
+		case "parent_id":
+			// 親関数が記録されていなければ -1 になる。
+			return func() SqlAny { return SqlBigInt(r.FuncLog.ParentID) }
 		default:
 			panic(fmt.Errorf("not found %s.%s column", table, col))
 		}
@@ -212,12 +345,18 @@ func (r *SqlFuncLogRow) SetOffset(offset int) {
 func (r *SqlFuncLogRow) MaxOffset() int {
 	return len(r.FuncLog.Frames)
 }
+func (r *SqlFuncLogRow) symbols() *types.Symbols { return r.Symbols }
+func (r *SqlFuncLogRow) logTime() *LogTime       { return r.LogTime }
 
 type SqlGoroutineRow struct {
 	types.Goroutine
+	LogTime *LogTime
 }
 
 func (r *SqlGoroutineRow) Field(field Field) SqlFieldGetter {
+	if field.expr != nil {
+		return field.expr.getter(r)
+	}
 	table := field.Table
 	col := field.Name
 	switch table {
@@ -230,7 +369,14 @@ func (r *SqlGoroutineRow) Field(field Field) SqlFieldGetter {
 		case "endtime":
 			return func() SqlAny { return SqlDatetime(r.EndTime) }
 		case "exectime":
-			return func() SqlAny { return SqlBigInt(r.EndTime - r.StartTime) }
+			return func() SqlAny { return execTime(r.StartTime, r.EndTime, r.LogTime) }
+		case "running":
+			return func() SqlAny { return SqlBool(r.EndTime == types.NotEnded) }
+		case "startoffset":
+			if r.LogTime == nil {
+				panic(fmt.Errorf("%s.%s column is not available", table, col))
+			}
+			return func() SqlAny { return SqlDuration(r.StartTime - r.LogTime.Start) }
 		default:
 			panic(fmt.Errorf("not found %s.%s column", table, col))
 		}
@@ -247,6 +393,7 @@ func (r *SqlGoroutineRow) Fields(fields []Field) SqlFieldGetters {
 }
 func (r *SqlGoroutineRow) SetOffset(offset int) { panic("not supported") }
 func (r *SqlGoroutineRow) MaxOffset() int       { panic("not supported") }
+func (r *SqlGoroutineRow) logTime() *LogTime    { return r.LogTime }
 
 type SqlGoFuncRow struct {
 	GoFunc  *types.GoFunc
@@ -254,6 +401,9 @@ type SqlGoFuncRow struct {
 }
 
 func (r *SqlGoFuncRow) Field(field Field) SqlFieldGetter {
+	if field.expr != nil {
+		return field.expr.getter(r)
+	}
 	table := field.Table
 	col := field.Name
 	switch table {
@@ -289,14 +439,18 @@ func (r *SqlGoFuncRow) Fields(fields []Field) SqlFieldGetters {
 	}
 	return gs
 }
-func (r *SqlGoFuncRow) SetOffset(offset int) { panic("not supported") }
-func (r *SqlGoFuncRow) MaxOffset() int       { panic("not supported") }
+func (r *SqlGoFuncRow) SetOffset(offset int)    { panic("not supported") }
+func (r *SqlGoFuncRow) MaxOffset() int          { panic("not supported") }
+func (r *SqlGoFuncRow) symbols() *types.Symbols { return r.Symbols }
 
 type SqlGoModuleRow struct {
 	*types.GoModule
 }
 
 func (r *SqlGoModuleRow) Field(field Field) SqlFieldGetter {
+	if field.expr != nil {
+		return field.expr.getter(r)
+	}
 	table := field.Table
 	col := field.Name
 	switch table {
@@ -322,3 +476,97 @@ func (r *SqlGoModuleRow) Fields(fields []Field) SqlFieldGetters {
 }
 func (r *SqlGoModuleRow) SetOffset(offset int) { panic("not supported") }
 func (r *SqlGoModuleRow) MaxOffset() int       { panic("not supported") }
+
+type SqlFuncStatsRow struct {
+	*types.FuncStats
+	Symbols *types.Symbols
+}
+
+func (r *SqlFuncStatsRow) Field(field Field) SqlFieldGetter {
+	if field.expr != nil {
+		return field.expr.getter(r)
+	}
+	table := field.Table
+	col := field.Name
+	switch table {
+	case "funcstats":
+		switch col {
+		case "name":
+			return func() SqlAny { return SqlString(r.Name) }
+		case "pc":
+			return func() SqlAny { return SqlBigInt(r.PC) }
+		case "calls":
+			return func() SqlAny { return SqlBigInt(r.Calls) }
+		case "totaltime":
+			return func() SqlAny { return SqlDuration(r.TotalTime) }
+		case "selftime":
+			return func() SqlAny { return SqlDuration(r.SelfTime) }
+		case "avgtime":
+			return func() SqlAny { return SqlDuration(r.AvgTime()) }
+		case "mintime":
+			return func() SqlAny { return SqlDuration(r.MinTime) }
+		case "maxtime":
+			return func() SqlAny { return SqlDuration(r.MaxTime) }
+		default:
+			panic(fmt.Errorf("not found %s.%s column", table, col))
+		}
+	default:
+		panic(fmt.Errorf("invalid table: %s.%s column", table, col))
+	}
+}
+func (r *SqlFuncStatsRow) Fields(fields []Field) SqlFieldGetters {
+	gs := make(SqlFieldGetters, len(fields))
+	for i := range gs {
+		gs[i] = r.Field(fields[i])
+	}
+	return gs
+}
+func (r *SqlFuncStatsRow) SetOffset(offset int)    { panic("not supported") }
+func (r *SqlFuncStatsRow) MaxOffset() int          { panic("not supported") }
+func (r *SqlFuncStatsRow) symbols() *types.Symbols { return r.Symbols }
+
+type SqlCallEdgeRow struct {
+	*types.CallEdge
+	Symbols *types.Symbols
+}
+
+func (r *SqlCallEdgeRow) Field(field Field) SqlFieldGetter {
+	if field.expr != nil {
+		return field.expr.getter(r)
+	}
+	table := field.Table
+	col := field.Name
+	switch table {
+	case "calledges":
+		switch col {
+		case "caller":
+			return func() SqlAny { return SqlString(r.CallerName) }
+		case "callerpc":
+			return func() SqlAny { return SqlBigInt(r.CallerPC) }
+		case "callee":
+			return func() SqlAny { return SqlString(r.CalleeName) }
+		case "calleepc":
+			return func() SqlAny { return SqlBigInt(r.CalleePC) }
+		case "calls":
+			return func() SqlAny { return SqlBigInt(r.Calls) }
+		case "totaltime":
+			return func() SqlAny { return SqlDuration(r.TotalTime) }
+		case "avgtime":
+			return func() SqlAny { return SqlDuration(r.AvgTime()) }
+		default:
+			panic(fmt.Errorf("not found %s.%s column", table, col))
+		}
+	default:
+		panic(fmt.Errorf("invalid table: %s.%s column", table, col))
+	}
+}
+func (r *SqlCallEdgeRow) Fields(fields []Field) SqlFieldGetters {
+	gs := make(SqlFieldGetters, len(fields))
+	for i := range gs {
+		gs[i] = r.Field(fields[i])
+	}
+	return gs
+}
+func (r *SqlCallEdgeRow) SetOffset(offset int)    { panic("not supported") }
+func (r *SqlCallEdgeRow) MaxOffset() int          { panic("not supported") }
+func (r *SqlCallEdgeRow) symbols() *types.Symbols { return r.Symbols }
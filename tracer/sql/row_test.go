@@ -0,0 +1,64 @@
+package sql
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yuuki0xff/goapptrace/tracer/types"
+)
+
+func TestSqlFieldGetters_Printer(t *testing.T) {
+	tm := types.Time(1500000000)
+	gs := SqlFieldGetters{
+		func() SqlAny { return SqlBigInt(1) },
+		func() SqlAny { return SqlString("a\"b") },
+		func() SqlAny { return SqlDatetime(tm) },
+		func() SqlAny { return SqlDatetime(types.NotEnded) },
+		func() SqlAny { return SqlBool(true) },
+	}
+	names := []string{"id", "name", "start", "end", "ok"}
+	out := func(p SqlFieldPrinter) string {
+		buf := make([]byte, 1024)
+		return string(buf[:p(buf)])
+	}
+
+	a := assert.New(t)
+	a.Equal(`1,"a""b",`+tm.UnixTime().String()+`,`+types.NotEnded.UnixTime().String()+`,true`,
+		out(gs.Printer(CsvFormat)))
+	a.Equal(`[1,"a\"b",1500000000,-1,true]`, out(gs.Printer(JsonFormat)))
+	a.Equal(`{"id":1,"name":"a\"b","start":1500000000,"end":-1,"ok":true}`,
+		out(gs.ObjectPrinter(names, JsonFormat)))
+	a.Equal(`{"id":1,"name":"a\"b","start":"`+tm.UnixTime().Format(time.RFC3339Nano)+`","end":null,"ok":true}`,
+		out(gs.ObjectPrinter(names, JsonRFC3339Format)))
+
+	a.Panics(func() {
+		gs.ObjectPrinter(names, CsvFormat)
+	})
+	a.Panics(func() {
+		gs.ObjectPrinter(names[:1], JsonFormat)
+	})
+}
+
+func TestSqlCallEdgeRow(t *testing.T) {
+	a := assert.New(t)
+	sel, err := ParseSelect("SELECT caller, callee, calls, totaltime, avgtime FROM calledges WHERE callerpc = 100 AND calleepc = 200")
+	if !a.NoError(err) {
+		return
+	}
+	row := &SqlCallEdgeRow{
+		CallEdge: &types.CallEdge{
+			CallerName: "main.main",
+			CallerPC:   100,
+			CalleeName: "main.foo",
+			CalleePC:   200,
+			Calls:      4,
+			TotalTime:  1000,
+		},
+	}
+	sel.Where().WithRow(row)
+	a.True(sel.Where().Bool())
+	buf := make([]byte, 1024)
+	n := row.Fields(sel.Cols()).Printer(CsvFormat)(buf)
+	a.Equal("main.main,main.foo,4,1000,250", string(buf[:n]))
+}
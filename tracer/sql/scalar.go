@@ -0,0 +1,263 @@
+package sql
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/yuuki0xff/goapptrace/tracer/types"
+)
+
+// scalarFuncs は、行ごとに1つの値を計算するスカラー関数の一覧である。
+// SELECT句、WHERE句、GROUP BY句、HAVING句およびORDER BY句で使用できる。
+var scalarFuncs = []SqlFunc{
+	// 文字列
+	scalarFunc("LOWER", StringType, 1, 1, func(f *SqlScalarFunc) SqlAny {
+		return SqlString(strings.ToLower(f.Args[0].String()))
+	}),
+	scalarFunc("UPPER", StringType, 1, 1, func(f *SqlScalarFunc) SqlAny {
+		return SqlString(strings.ToUpper(f.Args[0].String()))
+	}),
+	scalarFunc("LENGTH", BigIntType, 1, 1, func(f *SqlScalarFunc) SqlAny {
+		return SqlBigInt(len(f.Args[0].String()))
+	}),
+	scalarFunc("CONCAT", StringType, 1, -1, func(f *SqlScalarFunc) SqlAny {
+		var buf []byte
+		for _, arg := range f.Args {
+			buf = append(buf, toString(arg)...)
+		}
+		return SqlString(buf)
+	}),
+	scalarFunc("REPLACE", StringType, 3, 3, func(f *SqlScalarFunc) SqlAny {
+		return SqlString(strings.Replace(f.Args[0].String(), f.Args[1].String(), f.Args[2].String(), -1))
+	}),
+	scalarFunc("TRIM", StringType, 1, 1, func(f *SqlScalarFunc) SqlAny {
+		return SqlString(strings.TrimSpace(f.Args[0].String()))
+	}),
+	scalarFunc("SHORTNAME", StringType, 1, 1, func(f *SqlScalarFunc) SqlAny {
+		fn := types.GoFunc{Name: f.Args[0].String()}
+		return SqlString(fn.ShortName())
+	}),
+
+	// 日時
+	scalarFunc("DATE_FORMAT", StringType, 2, 2, func(f *SqlScalarFunc) SqlAny {
+		return SqlString(dateFormat(f.Args[0].Datetime().UnixTime(), f.Args[1].String()))
+	}),
+	scalarFunc("UNIX_TIMESTAMP", BigIntType, 1, 1, func(f *SqlScalarFunc) SqlAny {
+		return SqlBigInt(f.Args[0].Datetime().UnixTime().Unix())
+	}),
+	scalarFunc("FROM_UNIXTIME", DatetimeType, 1, 1, func(f *SqlScalarFunc) SqlAny {
+		return SqlDatetime(types.NewTime(time.Unix(f.Args[0].BigInt(), 0)))
+	}),
+
+	// 実行時間 (ナノ秒)
+	scalarFunc("MICROS", BigIntType, 1, 1, func(f *SqlScalarFunc) SqlAny {
+		return SqlBigInt(f.Args[0].BigInt() / int64(time.Microsecond))
+	}),
+	scalarFunc("MILLIS", BigIntType, 1, 1, func(f *SqlScalarFunc) SqlAny {
+		return SqlBigInt(f.Args[0].BigInt() / int64(time.Millisecond))
+	}),
+	scalarFunc("SECS", BigIntType, 1, 1, func(f *SqlScalarFunc) SqlAny {
+		return SqlBigInt(f.Args[0].BigInt() / int64(time.Second))
+	}),
+	scalarFunc("FORMAT_DURATION", StringType, 1, 1, func(f *SqlScalarFunc) SqlAny {
+		return SqlString(time.Duration(f.Args[0].BigInt()).String())
+	}),
+
+	// シンボル
+	symbolFunc("FUNCNAME", func(symbols *types.Symbols, pc uintptr) string {
+		fn, ok := symbols.GoFunc(pc)
+		if !ok {
+			return "?"
+		}
+		return fn.Name
+	}),
+	symbolFunc("FILELINE", func(symbols *types.Symbols, pc uintptr) string {
+		return symbols.FileLine(pc)
+	}),
+}
+
+// substrFunc は、SUBSTR() と SUBSTRING() を表す。
+// これらの関数は構文が特殊であるため、 scalarFuncs には含めずに parseWhereExpr() で処理する。
+var substrFunc = scalarFunc("SUBSTR", StringType, 2, 3, func(f *SqlScalarFunc) SqlAny {
+	length := int64(-1)
+	if len(f.Args) == 3 {
+		length = f.Args[2].BigInt()
+	}
+	return SqlString(substr(f.Args[0].String(), f.Args[1].BigInt(), length))
+})
+
+// scalarFunc は、min 個以上 max 個以下の引数を取り、typ 型の値を返すスカラー関数を定義する。
+// max が負なら、引数の数に上限はない。
+func scalarFunc(name, typ string, min, max int, eval func(f *SqlScalarFunc) SqlAny) SqlFunc {
+	return SqlFunc{
+		Name: name,
+		Parse: func(args ...SqlAny) SqlAny {
+			if len(args) < min {
+				panic(fmt.Errorf("%s: missing args", name))
+			}
+			if 0 <= max && max < len(args) {
+				panic(fmt.Errorf("%s: too many args", name))
+			}
+			return &SqlScalarFunc{
+				Name: name,
+				Args: args,
+				typ:  typ,
+				eval: eval,
+			}
+		},
+	}
+}
+
+// symbolFunc は、pc に対応するシンボル情報を文字列で返すスカラー関数を定義する。
+// シンボル情報は、関数を評価する行から取得する。
+func symbolFunc(name string, lookup func(symbols *types.Symbols, pc uintptr) string) SqlFunc {
+	sqlfunc := scalarFunc(name, StringType, 1, 1, func(f *SqlScalarFunc) SqlAny {
+		return SqlString(lookup(f.symbols, uintptr(f.Args[0].BigInt())))
+	})
+	parse := sqlfunc.Parse
+	sqlfunc.Parse = func(args ...SqlAny) SqlAny {
+		f := parse(args...).(*SqlScalarFunc)
+		f.useSymbols = true
+		return f
+	}
+	return sqlfunc
+}
+
+// SqlScalarFunc は、スカラー関数の呼び出しを表す。
+// 関数の値は、参照されるたびに引数の値から計算する。
+type SqlScalarFunc struct {
+	Name string
+	Args []SqlAny
+	typ  string
+	eval func(f *SqlScalarFunc) SqlAny
+	// シンボル情報を参照する関数ならtrue。
+	useSymbols bool
+	symbols    *types.Symbols
+	// TODO: cacheを導入する
+}
+
+func (f *SqlScalarFunc) Bool() bool           { return f.eval(f).Bool() }
+func (f *SqlScalarFunc) BigInt() int64        { return f.eval(f).BigInt() }
+func (f *SqlScalarFunc) String() string       { return f.eval(f).String() }
+func (f *SqlScalarFunc) Datetime() types.Time { return f.eval(f).Datetime() }
+func (f *SqlScalarFunc) Const() bool {
+	if f.useSymbols {
+		return false
+	}
+	for _, arg := range f.Args {
+		if !arg.Const() {
+			return false
+		}
+	}
+	return true
+}
+func (f *SqlScalarFunc) Type() string { return f.typ }
+func (f *SqlScalarFunc) WithRow(row SqlRow) {
+	for _, arg := range f.Args {
+		arg.WithRow(row)
+	}
+	if f.useSymbols {
+		sr, ok := row.(symbolsRow)
+		if !ok || sr.symbols() == nil {
+			panic(fmt.Errorf("%s function is not available in this table", f.Name))
+		}
+		f.symbols = sr.symbols()
+	}
+}
+
+// toString は、v をCSV形式で出力するときと同じ文字列に変換する。
+func toString(v SqlAny) string {
+	switch t := v.Type(); t {
+	case BoolType:
+		return strconv.FormatBool(v.Bool())
+	case BigIntType, DurationType:
+		return strconv.FormatInt(v.BigInt(), 10)
+	case StringType:
+		return v.String()
+	case DatetimeType:
+		return v.Datetime().UnixTime().String()
+	default:
+		panic(fmt.Errorf("%s type is not supported", t))
+	}
+}
+
+// substr は、s の pos 文字目から length 文字を返す。
+// pos は1から数え、負の値なら末尾から数える。length が負なら、末尾までを返す。
+func substr(s string, pos, length int64) string {
+	runes := []rune(s)
+	n := int64(len(runes))
+	switch {
+	case pos > 0:
+		pos--
+	case pos < 0:
+		pos += n
+	default:
+		return ""
+	}
+	if pos < 0 || n <= pos {
+		return ""
+	}
+	end := n
+	if 0 <= length && pos+length < n {
+		end = pos + length
+	}
+	return string(runes[pos:end])
+}
+
+// dateFormat は、MySQLの DATE_FORMAT() と同じ書式指定子を使って t を文字列に変換する。
+// サポートしている書式指定子は %Y, %y, %m, %c, %d, %e, %H, %k, %i, %s, %S, %f, %T と %% である。
+func dateFormat(t time.Time, format string) string {
+	buf := make([]byte, 0, len(format)*2)
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' || i+1 == len(format) {
+			buf = append(buf, format[i])
+			continue
+		}
+		i++
+		switch format[i] {
+		case 'Y':
+			buf = appendInt(buf, t.Year(), 4)
+		case 'y':
+			buf = appendInt(buf, t.Year()%100, 2)
+		case 'm':
+			buf = appendInt(buf, int(t.Month()), 2)
+		case 'c':
+			buf = appendInt(buf, int(t.Month()), 0)
+		case 'd':
+			buf = appendInt(buf, t.Day(), 2)
+		case 'e':
+			buf = appendInt(buf, t.Day(), 0)
+		case 'H':
+			buf = appendInt(buf, t.Hour(), 2)
+		case 'k':
+			buf = appendInt(buf, t.Hour(), 0)
+		case 'i':
+			buf = appendInt(buf, t.Minute(), 2)
+		case 's', 'S':
+			buf = appendInt(buf, t.Second(), 2)
+		case 'f':
+			buf = appendInt(buf, t.Nanosecond()/1000, 6)
+		case 'T':
+			buf = appendInt(buf, t.Hour(), 2)
+			buf = append(buf, ':')
+			buf = appendInt(buf, t.Minute(), 2)
+			buf = append(buf, ':')
+			buf = appendInt(buf, t.Second(), 2)
+		default:
+			// "%%" や未知の書式指定子は、"%" の次の文字をそのまま出力する。
+			buf = append(buf, format[i])
+		}
+	}
+	return string(buf)
+}
+
+// appendInt は、width 桁になるまで0で埋めた v を buf に追加する。
+func appendInt(buf []byte, v, width int) []byte {
+	s := strconv.Itoa(v)
+	for i := len(s); i < width; i++ {
+		buf = append(buf, '0')
+	}
+	return append(buf, s...)
+}
@@ -0,0 +1,75 @@
+package sql
+
+// Source は、テーブルから行を読み出す方法を表す。
+type Source struct {
+	// 読み出した行。Read() を呼び出すと、この行が指す先が書き換えられる。
+	Row SqlRow
+	// 次の行を Row に読み出す。全ての行を読み終えたら io.EOF を返す。
+	Read func() error
+
+	// 以下は、行を並び替えるときやJOINするときに使用する。
+
+	// NewRow は、Row と同じ型の行を作成する。
+	NewRow func() SqlRow
+	// Save は、Row の現在の値のコピーを返す。
+	Save func() interface{}
+	// Load は、Save() で保存した値を dst に設定する。
+	Load func(dst SqlRow, v interface{})
+}
+
+// OpenFunc は、tableテーブルの全ての行を読み出す Source を返す。
+// sel がnilでなければ、sel.IndexHint() を使って読み出す行を絞り込んでも良い。
+type OpenFunc func(table string, sel *SelectParser) (Source, error)
+
+// Prepare は、WHERE句とHAVING句に含まれるサブクエリを実行する。
+// サブクエリを含むクエリは、WHERE句を評価する前にこれを呼び出す必要がある。
+func (s *SelectParser) Prepare(open OpenFunc) error {
+	for _, op := range s.subqueries {
+		if op.set != nil {
+			// 実行済み
+			continue
+		}
+		set, err := op.Subquery.run(open)
+		if err != nil {
+			return err
+		}
+		op.set = set
+	}
+	return nil
+}
+
+// Open は、FROM句とJOIN句で指定したテーブルの行を読み出す Source を返す。
+// WHERE句による絞り込みは、呼び出し元で行う必要がある。
+// サブクエリとJOINするテーブルは、この関数内で全ての行を読み出す。
+func (s *SelectParser) Open(open OpenFunc) (Source, error) {
+	if err := s.Prepare(open); err != nil {
+		return Source{}, err
+	}
+	driver, err := open(s.table.Name, s)
+	if err != nil || !s.joined() {
+		return driver, err
+	}
+	return s.openJoin(open, driver)
+}
+
+// TableNames returns names of all tables used in the query, including JOIN clauses and subqueries.
+func (s *SelectParser) TableNames() []string {
+	var names []string
+	add := func(name string) {
+		for _, n := range names {
+			if n == name {
+				return
+			}
+		}
+		names = append(names, name)
+	}
+	for _, ref := range s.tables {
+		add(ref.Table.Name)
+	}
+	for _, op := range s.subqueries {
+		for _, name := range op.Subquery.Sel.TableNames() {
+			add(name)
+		}
+	}
+	return names
+}
@@ -0,0 +1,294 @@
+package sql
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/pkg/errors"
+	"github.com/xwb1989/sqlparser"
+	"github.com/yuuki0xff/goapptrace/tracer/types"
+	"github.com/yuuki0xff/goapptrace/tracer/util"
+)
+
+// InOp は、IN演算子とEXISTS演算子を表す。
+// 右辺には、定数のリストまたはサブクエリを指定できる。
+type InOp struct {
+	// 左辺の値。相関サブクエリであれば、外側のクエリの列が続く。
+	Left []SqlAny
+	// 右辺の定数のリスト。
+	Values []SqlAny
+	// 右辺のサブクエリ。
+	Subquery *Subquery
+	// trueなら、NOT IN演算子。
+	Not bool
+
+	// 右辺の値の集合。キーは appendKey() で作成する。
+	set map[string]struct{}
+	buf []byte
+}
+
+func (o *InOp) Bool() bool {
+	if o.set == nil {
+		if o.Subquery != nil {
+			panic(errors.New("bug: subquery is not executed. call SelectParser.Prepare() before evaluating"))
+		}
+		o.set = o.valueSet()
+	}
+	o.buf = o.buf[:0]
+	for _, v := range o.Left {
+		o.buf = appendKey(o.buf, v)
+	}
+	_, ok := o.set[string(o.buf)]
+	return ok != o.Not
+}
+func (o *InOp) BigInt() int64        { panic(errSqlCast(BoolType, BigIntType)) }
+func (o *InOp) String() string       { panic(errSqlCast(BoolType, StringType)) }
+func (o *InOp) Datetime() types.Time { panic(errSqlCast(BoolType, DatetimeType)) }
+func (o *InOp) Const() bool {
+	if o.Subquery != nil {
+		return false
+	}
+	for _, v := range o.Left {
+		if !v.Const() {
+			return false
+		}
+	}
+	return true
+}
+func (o *InOp) Type() string { return BoolType }
+func (o *InOp) WithRow(row SqlRow) {
+	for _, v := range o.Left {
+		v.WithRow(row)
+	}
+}
+func (o *InOp) valueSet() map[string]struct{} {
+	t := o.Left[0].Type()
+	set := make(map[string]struct{}, len(o.Values))
+	for _, v := range o.Values {
+		if t2 := v.Type(); t != t2 {
+			panic(fmt.Errorf("mismatch type: %s IN (%s)", t, t2))
+		}
+		set[string(appendKey(nil, v))] = struct{}{}
+	}
+	return set
+}
+
+// Subquery は、IN演算子やEXISTS演算子に指定されたサブクエリを表す。
+// サブクエリは外側のクエリよりも先に1回だけ実行し、結果を集合として保持する。
+type Subquery struct {
+	Sel *SelectParser
+	// 結果の集合のキーとなる列。
+	// IN演算子であれば、SELECT句の列が先頭になる。
+	// 相関サブクエリであれば、外側のクエリの列と比較する列が続く。
+	Keys []Field
+}
+
+// correlation は、相関サブクエリの "inner = outer" という条件を表す。
+type correlation struct {
+	// サブクエリのテーブルの列。
+	Inner Field
+	// 外側のクエリのテーブルの列。
+	Outer Field
+}
+
+// run は、サブクエリを実行して、結果の集合を返す。
+func (q *Subquery) run(open OpenFunc) (map[string]struct{}, error) {
+	src, err := q.Sel.Open(open)
+	if err != nil {
+		return nil, err
+	}
+
+	set := map[string]struct{}{}
+	var buf []byte
+	add := func(keys SqlFieldGetters) {
+		buf = buf[:0]
+		for _, key := range keys {
+			buf = appendKey(buf, key())
+		}
+		set[string(buf)] = struct{}{}
+	}
+	read := func(fn func()) {
+		for {
+			err := src.Read()
+			if err == io.EOF {
+				return
+			} else if err != nil {
+				panic(err)
+			}
+			fn()
+		}
+	}
+
+	err = util.PanicHandler(func() {
+		where := q.Sel.where
+		if where == nil {
+			where = SqlBool(true)
+		}
+		where.WithRow(src.Row)
+
+		if !q.Sel.Grouped() {
+			keys := src.Row.Fields(q.Keys)
+			read(func() {
+				if where.Bool() {
+					add(keys)
+				}
+			})
+			return
+		}
+
+		groups, err := q.Sel.NewGroups(src.Row)
+		if err != nil {
+			panic(err)
+		}
+		read(func() {
+			if where.Bool() {
+				if err := groups.Add(); err != nil {
+					panic(err)
+				}
+			}
+		})
+		out := &SqlGroupRow{Groups: groups}
+		having := q.Sel.having
+		if having == nil {
+			having = SqlBool(true)
+		}
+		having.WithRow(out)
+		keys := out.Fields(q.Keys)
+		for i := 0; i < groups.Len(); i++ {
+			out.Index = i
+			if having.Bool() {
+				add(keys)
+			}
+		}
+	})
+	return set, err
+}
+
+// parseIn parses "expr IN (...)" and "expr NOT IN (...)".
+func (s *SelectParser) parseIn(expr *sqlparser.ComparisonExpr) SqlAny {
+	op := &InOp{
+		Left: []SqlAny{s.parseWhereExpr(expr.Left)},
+		Not:  expr.Operator == sqlparser.NotInStr,
+	}
+	switch right := expr.Right.(type) {
+	case sqlparser.ValTuple:
+		for _, e := range right {
+			v := s.parseWhereExpr(e)
+			if !v.Const() {
+				panic(fmt.Errorf("IN operator supports only constant values or a subquery: %s", sqlparser.String(e)))
+			}
+			op.Values = append(op.Values, v)
+		}
+	case *sqlparser.Subquery:
+		q, outer := s.parseSubquery(right)
+		if len(q.Sel.fields) != 1 {
+			panic(errors.New("subquery must return only one column"))
+		}
+		q.Keys = append([]Field{q.Sel.fields[0]}, q.Keys...)
+		op.Left = append(op.Left, outer...)
+		op.Subquery = q
+		s.subqueries = append(s.subqueries, op)
+	default:
+		panic(fmt.Errorf("bug: %T", right))
+	}
+	return op
+}
+
+// parseExists parses "EXISTS (SELECT ...)".
+// "NOT EXISTS" は NotOp としてパースされる。
+func (s *SelectParser) parseExists(expr *sqlparser.ExistsExpr) SqlAny {
+	q, outer := s.parseSubquery(expr.Subquery)
+	op := &InOp{
+		Left:     outer,
+		Subquery: q,
+	}
+	s.subqueries = append(s.subqueries, op)
+	return op
+}
+
+// parseSubquery は、サブクエリをパースする。
+// 相関サブクエリであれば、外側のクエリの列を返す。
+func (s *SelectParser) parseSubquery(sq *sqlparser.Subquery) (*Subquery, []SqlAny) {
+	stmt, ok := sq.Select.(*sqlparser.Select)
+	if !ok {
+		panic(ErrUnsupportedStmt)
+	}
+	if stmt.OrderBy != nil || stmt.Limit != nil {
+		panic(errors.New("ORDER BY and LIMIT are not supported in subqueries"))
+	}
+	sub := &SelectParser{
+		Stmt:  stmt,
+		outer: s,
+	}
+	if err := sub.Parse(); err != nil {
+		panic(err)
+	}
+
+	q := &Subquery{
+		Sel: sub,
+	}
+	var outer []SqlAny
+	for _, c := range sub.correlations {
+		if !sub.hasField(c.Inner) {
+			panic(fmt.Errorf("not found \"%s\" column", c.Inner.LongName()))
+		}
+		if sub.Grouped() && !sub.isGroupKey(c.Inner) {
+			panic(errNotGrouped(c.Inner))
+		}
+		if s.aggregating && !s.isGroupKey(c.Outer) {
+			panic(errNotGrouped(c.Outer))
+		}
+		q.Keys = append(q.Keys, c.Inner)
+		outer = append(outer, &SqlField{Field: c.Outer})
+	}
+	return q, outer
+}
+
+// parseCorrelations は、サブクエリのWHERE句から外側のクエリの列との等価条件を取り除く。
+// 取り除いた条件は correlations に追加し、残りの条件を返す。
+// 全ての条件を取り除いた場合は、nilを返す。
+func (s *SelectParser) parseCorrelations(expr sqlparser.Expr) sqlparser.Expr {
+	var rest sqlparser.Expr
+	for _, cond := range splitAnd(expr) {
+		if c, ok := s.parseCorrelation(cond); ok {
+			s.correlations = append(s.correlations, c)
+			continue
+		}
+		if rest == nil {
+			rest = cond
+		} else {
+			rest = &sqlparser.AndExpr{
+				Left:  rest,
+				Right: cond,
+			}
+		}
+	}
+	return rest
+}
+
+func (s *SelectParser) parseCorrelation(cond sqlparser.Expr) (correlation, bool) {
+	comp, ok := cond.(*sqlparser.ComparisonExpr)
+	if !ok || comp.Operator != sqlparser.EqualStr {
+		return correlation{}, false
+	}
+	lcol, lok := comp.Left.(*sqlparser.ColName)
+	rcol, rok := comp.Right.(*sqlparser.ColName)
+	if !lok || !rok {
+		return correlation{}, false
+	}
+	l, lout := s.resolveColumn(lcol)
+	r, rout := s.resolveColumn(rcol)
+	switch {
+	case !lout && rout:
+		return correlation{Inner: l, Outer: r}, true
+	case lout && !rout:
+		return correlation{Inner: r, Outer: l}, true
+	}
+	return correlation{}, false
+}
+
+// HasSubquery returns true if the query has subqueries.
+// In this case, call Prepare() before evaluating the WHERE clause.
+func (s *SelectParser) HasSubquery() bool {
+	return len(s.subqueries) > 0
+}
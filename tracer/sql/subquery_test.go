@@ -0,0 +1,103 @@
+package sql
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yuuki0xff/goapptrace/tracer/types"
+)
+
+func TestSelectParser_Subquery(t *testing.T) {
+	fls := []types.FuncLog{
+		{ID: 0, GID: 1, StartTime: 0, EndTime: 10},
+		{ID: 1, GID: 2, StartTime: 0, EndTime: 40},
+		{ID: 2, GID: 1, StartTime: 10, EndTime: 40},
+		{ID: 3, GID: 3, StartTime: 0, EndTime: 5},
+	}
+	gs := []types.Goroutine{
+		{GID: 1, StartTime: 0, EndTime: 100},
+		{GID: 2, StartTime: 0, EndTime: 50},
+		{GID: 3, StartTime: 0, EndTime: 20},
+	}
+	open := memOpen(fls, gs)
+
+	t.Run("in-values", func(t *testing.T) {
+		assert.Equal(t, "id\n1\n3",
+			queryCsv(t, "SELECT id FROM calls WHERE gid IN (2, 3)", open))
+		assert.Equal(t, "id\n0\n2",
+			queryCsv(t, "SELECT id FROM calls WHERE gid NOT IN (2, 3)", open))
+	})
+	t.Run("in-subquery", func(t *testing.T) {
+		assert.Equal(t, "id\n0\n1\n2",
+			queryCsv(t, "SELECT id FROM calls WHERE gid IN (SELECT gid FROM goroutines WHERE exectime >= 50)", open))
+		assert.Equal(t, "id\n3",
+			queryCsv(t, "SELECT id FROM calls WHERE gid NOT IN (SELECT gid FROM goroutines WHERE exectime >= 50)", open))
+	})
+	t.Run("grouped-subquery", func(t *testing.T) {
+		assert.Equal(t, "gid\n1",
+			queryCsv(t, "SELECT gid FROM goroutines WHERE gid IN (SELECT gid FROM calls GROUP BY gid HAVING COUNT(*) > 1)", open))
+	})
+	t.Run("exists", func(t *testing.T) {
+		assert.Equal(t, "gid\n1\n2\n3",
+			queryCsv(t, "SELECT gid FROM goroutines WHERE EXISTS (SELECT * FROM calls)", open))
+		assert.Equal(t, "gid",
+			queryCsv(t, "SELECT gid FROM goroutines WHERE EXISTS (SELECT * FROM calls WHERE id > 100)", open))
+	})
+	t.Run("correlated", func(t *testing.T) {
+		assert.Equal(t, "gid\n2",
+			queryCsv(t, "SELECT gid FROM goroutines g WHERE EXISTS (SELECT * FROM calls c WHERE c.gid = g.gid AND c.exectime > 35)", open))
+		assert.Equal(t, "gid\n1\n3",
+			queryCsv(t, "SELECT gid FROM goroutines g WHERE NOT EXISTS (SELECT * FROM calls WHERE gid = g.gid AND exectime > 35)", open))
+		assert.Equal(t, "id\n1\n3",
+			queryCsv(t, "SELECT id FROM calls c WHERE c.id IN (SELECT MAX(id) FROM calls WHERE gid = c.gid GROUP BY gid) AND c.gid > 1", open))
+	})
+	t.Run("join-and-subquery", func(t *testing.T) {
+		assert.Equal(t, "c.id\n1",
+			queryCsv(t, "SELECT c.id FROM calls c JOIN goroutines g ON c.gid = g.gid WHERE g.exectime > 30 AND c.gid IN (SELECT gid FROM calls WHERE exectime = 40 AND id = 1)", open))
+	})
+
+	t.Run("error", func(t *testing.T) {
+		a := assert.New(t)
+		for _, query := range []string{
+			"SELECT id FROM calls WHERE gid = (SELECT gid FROM goroutines)",
+			"SELECT id FROM (SELECT * FROM calls) t",
+			"SELECT id FROM calls WHERE gid IN (SELECT gid, exectime FROM goroutines)",
+			"SELECT id FROM calls WHERE gid IN (SELECT gid FROM goroutines ORDER BY gid)",
+			"SELECT id FROM calls WHERE gid IN (SELECT gid FROM goroutines LIMIT 1)",
+			"SELECT id FROM calls WHERE gid IN (gid, 1)",
+			"SELECT id FROM calls c WHERE EXISTS (SELECT * FROM goroutines g WHERE g.gid < c.gid)",
+			"SELECT id FROM calls c WHERE EXISTS (SELECT c.id FROM goroutines g)",
+			"SELECT id FROM calls c WHERE EXISTS (SELECT * FROM goroutines g WHERE g.foo = c.gid)",
+		} {
+			_, err := ParseSelect(query)
+			a.Error(err, query)
+		}
+	})
+	t.Run("not-prepared", func(t *testing.T) {
+		a := assert.New(t)
+		sel, err := ParseSelect("SELECT id FROM calls WHERE gid IN (SELECT gid FROM goroutines)")
+		a.NoError(err)
+		a.True(sel.HasSubquery())
+		a.Equal([]string{"calls", "goroutines"}, sel.TableNames())
+		row := &SqlFuncLogRow{FuncLog: &fls[0]}
+		sel.Where().WithRow(row)
+		a.Panics(func() { sel.Where().Bool() })
+
+		a.NoError(sel.Prepare(open))
+		a.True(sel.Where().Bool())
+	})
+}
+
+func TestSelectParser_IndexHintIn(t *testing.T) {
+	a := assert.New(t)
+	sel, err := ParseSelect("SELECT id FROM calls WHERE gid IN (1, 2)")
+	a.NoError(err)
+	hint, ok := sel.IndexHint()
+	a.True(ok)
+	a.Equal([]types.GID{1, 2}, hint.GIDs)
+
+	sel, err = ParseSelect("SELECT id FROM calls WHERE gid NOT IN (1, 2)")
+	a.NoError(err)
+	_, ok = sel.IndexHint()
+	a.False(ok)
+}
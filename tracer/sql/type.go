@@ -2,6 +2,9 @@ package sql
 
 import (
 	"fmt"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/yuuki0xff/goapptrace/tracer/types"
 )
@@ -11,6 +14,9 @@ const (
 	BigIntType   = "bigint"
 	StringType   = "string"
 	DatetimeType = "datetime"
+	// DurationType は、ナノ秒単位の時間の長さを表す型である。
+	// 値は BigInt() でナノ秒単位の整数として参照する。
+	DurationType = "duration"
 )
 
 func errSqlCast(from, to string) error {
@@ -76,6 +82,89 @@ func (d SqlDatetime) Const() bool          { return true }
 func (d SqlDatetime) Type() string         { return DatetimeType }
 func (d SqlDatetime) WithRow(row SqlRow)   {}
 
+// SqlDuration は、ナノ秒単位の時間の長さを表す。
+// '250ms' のような定数の文字列は、時間の長さと比較したり、日時に加減算するときに SqlDuration に変換する。
+type SqlDuration int64
+
+func (d SqlDuration) Bool() bool           { panic(errSqlCast(DurationType, BoolType)) }
+func (d SqlDuration) BigInt() int64        { return int64(d) }
+func (d SqlDuration) String() string       { panic(errSqlCast(DurationType, StringType)) }
+func (d SqlDuration) Datetime() types.Time { panic(errSqlCast(DurationType, DatetimeType)) }
+func (d SqlDuration) Const() bool          { return true }
+func (d SqlDuration) Type() string         { return DurationType }
+func (d SqlDuration) WithRow(row SqlRow)   {}
+
+// ParseDuration は、文字列を時間の長さに変換する。
+// '250ms' や '1h30m' のような time.ParseDuration() の形式と、'10:00:00' のような "[-]時:分[:秒]" の形式を指定できる。
+func ParseDuration(s string) (time.Duration, error) {
+	if d, err := time.ParseDuration(s); err == nil {
+		return d, nil
+	}
+	invalid := fmt.Errorf("invalid duration \"%s\": use a format like '250ms', '1h30m' or '10:00:00'", s)
+
+	str := s
+	neg := strings.HasPrefix(str, "-")
+	if neg {
+		str = str[1:]
+	}
+	parts := strings.Split(str, ":")
+	if len(parts) < 2 || 3 < len(parts) {
+		return 0, invalid
+	}
+	var d time.Duration
+	units := []time.Duration{time.Hour, time.Minute}
+	for i, part := range parts {
+		if i == 2 {
+			// 秒には小数を指定できる。
+			sec, err := strconv.ParseFloat(part, 64)
+			if err != nil || sec < 0 {
+				return 0, invalid
+			}
+			d += time.Duration(sec * float64(time.Second))
+			continue
+		}
+		n, err := strconv.ParseInt(part, 10, 64)
+		if err != nil || n < 0 {
+			return 0, invalid
+		}
+		d += time.Duration(n) * units[i]
+	}
+	if neg {
+		d = -d
+	}
+	return d, nil
+}
+
+// intLike は、typ 型の値をナノ秒単位の整数として扱えるならtrueを返す。
+func intLike(typ string) bool {
+	return typ == BigIntType || typ == DurationType
+}
+
+// int64Fn は、v の値を整数として返す関数を返す。日時はナノ秒単位の整数になる。
+func int64Fn(v SqlAny) func() int64 {
+	switch t := v.Type(); t {
+	case BigIntType, DurationType:
+		return v.BigInt
+	case DatetimeType:
+		return func() int64 { return int64(v.Datetime()) }
+	default:
+		panic(fmt.Errorf("%s type is not a number", t))
+	}
+}
+
+// coerce は、v が定数の文字列であれば、比較や演算の相手の型 typ に変換する。
+// 現時点では、時間の長さへの変換のみをサポートしている。それ以外の場合は、v をそのまま返す。
+func coerce(v SqlAny, typ string) SqlAny {
+	if typ != DurationType || !v.Const() || v.Type() != StringType {
+		return v
+	}
+	d, err := ParseDuration(v.String())
+	if err != nil {
+		panic(err)
+	}
+	return SqlDuration(d)
+}
+
 // テーブルの1つのフィールドを表す。
 // これの値を取得するときは、先にWithRow()で処理対象の行を指定すること。
 type SqlField struct {
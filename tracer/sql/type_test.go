@@ -2,6 +2,7 @@ package sql
 
 import (
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -32,3 +33,33 @@ func TestSqlBool_WithRow(t *testing.T) {
 		SqlBool(false).WithRow(nil)
 	})
 }
+
+func TestParseDuration(t *testing.T) {
+	a := assert.New(t)
+	for s, expected := range map[string]time.Duration{
+		"250ms":      250 * time.Millisecond,
+		"1h30m":      90 * time.Minute,
+		"10:00":      10 * time.Hour,
+		"1:02:03":    time.Hour + 2*time.Minute + 3*time.Second,
+		"0:00:01.5":  1500 * time.Millisecond,
+		"-0:00:00.1": -100 * time.Millisecond,
+	} {
+		d, err := ParseDuration(s)
+		if a.NoError(err, s) {
+			a.Equal(expected, d, s)
+		}
+	}
+	for _, s := range []string{"", "1", "1:2:3:4", "a:00", "1:-1", "1:00:x"} {
+		_, err := ParseDuration(s)
+		a.Error(err, s)
+	}
+}
+func TestSqlDuration(t *testing.T) {
+	a := assert.New(t)
+	a.Equal(int64(1000), SqlDuration(1000).BigInt())
+	a.Equal(DurationType, SqlDuration(0).Type())
+	a.True(SqlDuration(0).Const())
+	a.Panics(func() {
+		_ = SqlDuration(0).String()
+	})
+}
@@ -0,0 +1,411 @@
+package sql
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/xwb1989/sqlparser"
+)
+
+var (
+	ErrViewClause    = errors.New("view supports only WHERE clause. GROUP BY, HAVING, ORDER BY, LIMIT, JOIN and DISTINCT are not supported")
+	ErrViewColumn    = errors.New("column list of the view MUST contain only \"*\" or column names without alias")
+	ErrViewRecursion = errors.New("too many nested views. the view may refer to itself")
+	ErrViewName      = errors.New("view name MUST NOT be the same as a table name")
+)
+
+// maxViewDepth は、ビューの入れ子の深さの上限である。
+// 自分自身を参照しているビューを展開しようとしたときに、無限ループを防ぐために使用する。
+const maxViewDepth = 16
+
+// ViewFunc は、name という名前のビューを定義しているSELECT文を返す。
+// ビューが存在しなければ、okはfalseになる。
+type ViewFunc func(name string) (query string, ok bool)
+
+// view は、展開中のビューを表す。
+type view struct {
+	stmt *sqlparser.Select
+	// ビューが参照しているテーブルの名前と別名。
+	table TableRef
+	// ビューのSELECT句で指定された列名。"*" が指定されていればnil。
+	cols []string
+}
+
+// viewRef は、FROM句とJOIN句で指定されたテーブルを表す。
+type viewRef struct {
+	// テーブルの別名。別名が無ければテーブル名。
+	name string
+	// ビューを展開したテーブルであれば、ビューの定義。
+	view *view
+}
+
+// IsTableName は、name がテーブル名であればtrueを返す。
+// テーブル名は、ビューの名前として使用できない。
+func IsTableName(name string) bool {
+	_, ok := findTableByName(name)
+	return ok
+}
+
+// ParseSelectWithViews は、views で定義されたビューを展開してからSELECT文をパースする。
+// views がnilなら、 ParseSelect() と同じである。
+func ParseSelectWithViews(sql string, views ViewFunc) (*SelectParser, error) {
+	stmt, err := sqlparser.Parse(sql)
+	if err != nil {
+		return nil, err
+	}
+
+	switch stmt := stmt.(type) {
+	case *sqlparser.Select:
+		if views != nil {
+			if err := expandViews(stmt, views, 0); err != nil {
+				return nil, err
+			}
+		}
+		sel := &SelectParser{
+			Stmt: stmt,
+		}
+		err = sel.Parse()
+		if err != nil {
+			return nil, err
+		}
+		return sel, nil
+	default:
+		return nil, ErrUnsupportedStmt
+	}
+}
+
+// CheckView は、query がビューとして使用できるSELECT文であるかを検査する。
+// ビューは、1つのテーブルに対してWHERE句のみを指定したSELECT文である。
+// SELECT句には、"*" または別名の無い列名のみを指定できる。
+// query が参照している他のビューは、 views で解決する。
+func CheckView(name, query string, views ViewFunc) error {
+	if IsTableName(name) {
+		return ErrViewName
+	}
+	// ビューを参照するクエリを実際にパースして、ビューの定義に誤りがないか検査する。
+	resolve := func(n string) (string, bool) {
+		if n == name {
+			return query, true
+		}
+		if views == nil {
+			return "", false
+		}
+		return views(n)
+	}
+	_, err := ParseSelectWithViews("SELECT * FROM "+name, resolve)
+	return err
+}
+
+// expandViews は、stmt のFROM句、JOIN句およびサブクエリで参照しているビューを、ビューが参照しているテーブルに置き換える。
+// ビューのWHERE句は、stmt のWHERE句に追加する。
+// stmt のSELECT句に "*" が含まれていれば、ビューのSELECT句で指定された列に置き換える。
+// depth は、ビューの入れ子の深さである。
+func expandViews(stmt *sqlparser.Select, views ViewFunc, depth int) error {
+	if depth > maxViewDepth {
+		return ErrViewRecursion
+	}
+
+	// サブクエリ内のビューを展開する。
+	// ビューのWHERE句を追加する前に展開するため、展開済みのサブクエリを再度展開することはない。
+	err := sqlparser.Walk(func(node sqlparser.SQLNode) (bool, error) {
+		subquery, ok := node.(*sqlparser.Subquery)
+		if !ok {
+			return true, nil
+		}
+		if sel, ok := subquery.Select.(*sqlparser.Select); ok {
+			if err := expandViews(sel, views, depth); err != nil {
+				return false, err
+			}
+		}
+		return false, nil
+	}, stmt.SelectExprs, stmt.Where, stmt.Having)
+	if err != nil {
+		return err
+	}
+
+	var refs []viewRef
+	var conds []sqlparser.Expr
+	var expand func(expr sqlparser.TableExpr) error
+	expand = func(expr sqlparser.TableExpr) error {
+		switch expr := expr.(type) {
+		case *sqlparser.AliasedTableExpr:
+			table, ok := expr.Expr.(sqlparser.TableName)
+			if !ok || !table.Qualifier.IsEmpty() {
+				// 不正なテーブルは、パース時にエラーになる。
+				return nil
+			}
+			name := table.Name.String()
+			alias := expr.As.String()
+			if alias == "" {
+				alias = name
+			}
+			ref := viewRef{name: alias}
+			if !IsTableName(name) {
+				query, ok := views(name)
+				if ok {
+					v, err := loadView(name, query, views, depth)
+					if err != nil {
+						return err
+					}
+					expr.Expr = sqlparser.TableName{Name: sqlparser.NewTableIdent(v.table.Table.Name)}
+					expr.As = sqlparser.NewTableIdent(alias)
+					if v.stmt.Where != nil {
+						cond := v.stmt.Where.Expr
+						requalify(cond, v.table.Names(), alias, true)
+						conds = append(conds, cond)
+					}
+					ref.view = v
+				}
+			}
+			refs = append(refs, ref)
+		case *sqlparser.ParenTableExpr:
+			for _, e := range expr.Exprs {
+				if err := expand(e); err != nil {
+					return err
+				}
+			}
+		case *sqlparser.JoinTableExpr:
+			if err := expand(expr.LeftExpr); err != nil {
+				return err
+			}
+			return expand(expr.RightExpr)
+		}
+		return nil
+	}
+	for _, from := range stmt.From {
+		if err := expand(from); err != nil {
+			return err
+		}
+	}
+
+	// ビューの条件は、元のWHERE句よりも先に評価する。
+	for i := len(conds) - 1; i >= 0; i-- {
+		if stmt.Where == nil {
+			stmt.Where = sqlparser.NewWhere(sqlparser.WhereStr, conds[i])
+			continue
+		}
+		stmt.Where.Expr = &sqlparser.AndExpr{
+			Left:  &sqlparser.ParenExpr{Expr: conds[i]},
+			Right: &sqlparser.ParenExpr{Expr: stmt.Where.Expr},
+		}
+	}
+	stmt.SelectExprs = expandStar(stmt.SelectExprs, refs)
+	return nil
+}
+
+// loadView は、name という名前のビューをパースする。
+// ビューが参照している他のビューは、展開してから返す。
+func loadView(name, query string, views ViewFunc, depth int) (*view, error) {
+	stmt, err := sqlparser.Parse(query)
+	if err != nil {
+		return nil, fmt.Errorf("%s view: %s", name, err)
+	}
+	sel, ok := stmt.(*sqlparser.Select)
+	if !ok {
+		return nil, fmt.Errorf("%s view: %s", name, ErrUnsupportedStmt)
+	}
+	if err := expandViews(sel, views, depth+1); err != nil {
+		if err == ErrViewRecursion {
+			return nil, err
+		}
+		return nil, fmt.Errorf("%s view: %s", name, err)
+	}
+	v, err := newView(sel)
+	if err != nil {
+		return nil, fmt.Errorf("%s view: %s", name, err)
+	}
+	return v, nil
+}
+
+// newView は、ビューを定義しているSELECT文を検査して view を返す。
+// stmt が参照しているビューは、展開済みでなければならない。
+func newView(stmt *sqlparser.Select) (*view, error) {
+	if stmt.Distinct != "" || len(stmt.GroupBy) > 0 || stmt.Having != nil || len(stmt.OrderBy) > 0 || stmt.Limit != nil {
+		return nil, ErrViewClause
+	}
+	if len(stmt.From) != 1 {
+		return nil, ErrViewClause
+	}
+	aliased, ok := stmt.From[0].(*sqlparser.AliasedTableExpr)
+	if !ok {
+		return nil, ErrViewClause
+	}
+	table, ok := aliased.Expr.(sqlparser.TableName)
+	if !ok {
+		return nil, ErrSubquery
+	}
+	t, ok := findTableByName(table.Name.String())
+	if !ok || !table.Qualifier.IsEmpty() {
+		return nil, ErrNotFoundTable
+	}
+	v := &view{
+		stmt: stmt,
+		table: TableRef{
+			Table: t,
+			Alias: aliased.As.String(),
+		},
+	}
+
+	var star bool
+	for _, expr := range stmt.SelectExprs {
+		switch expr := expr.(type) {
+		case *sqlparser.StarExpr:
+			if !expr.TableName.Name.IsEmpty() && !v.table.Names()[expr.TableName.Name.String()] {
+				return nil, fmt.Errorf("not found \"%s\" table", expr.TableName.Name.String())
+			}
+			star = true
+		case *sqlparser.AliasedExpr:
+			col, ok := expr.Expr.(*sqlparser.ColName)
+			if !ok || !expr.As.IsEmpty() {
+				return nil, ErrViewColumn
+			}
+			if !col.Qualifier.IsEmpty() && !v.table.Names()[col.Qualifier.Name.String()] {
+				return nil, fmt.Errorf("not found \"%s\" table", col.Qualifier.Name.String())
+			}
+			if !t.HasField(col.Name.String()) {
+				return nil, fmt.Errorf("not found \"%s\" column", sqlparser.String(col))
+			}
+			v.cols = append(v.cols, col.Name.String())
+		default:
+			return nil, ErrViewColumn
+		}
+	}
+	if star {
+		if len(v.cols) > 0 {
+			return nil, ErrStar
+		}
+		v.cols = nil
+	}
+	return v, nil
+}
+
+// Names は、テーブルを参照するときに使用できる名前を返す。
+func (r TableRef) Names() map[string]bool {
+	names := map[string]bool{
+		r.Table.Name: true,
+	}
+	if r.Alias != "" {
+		names[r.Alias] = true
+	}
+	return names
+}
+
+// expandStar は、SELECT句に含まれる "*" のうち、列が指定されたビューに対する "*" を、ビューの列に置き換える。
+func expandStar(exprs sqlparser.SelectExprs, refs []viewRef) sqlparser.SelectExprs {
+	var hasCols bool
+	for _, ref := range refs {
+		if ref.view != nil && ref.view.cols != nil {
+			hasCols = true
+		}
+	}
+	if !hasCols {
+		return exprs
+	}
+
+	// colExprs は、ref の列を返す。qualify がtrueなら、列名をテーブルの別名で修飾する。
+	colExprs := func(ref viewRef, qualify bool) sqlparser.SelectExprs {
+		if ref.view == nil || ref.view.cols == nil {
+			star := &sqlparser.StarExpr{}
+			if qualify {
+				star.TableName.Name = sqlparser.NewTableIdent(ref.name)
+			}
+			return sqlparser.SelectExprs{star}
+		}
+		var cols sqlparser.SelectExprs
+		for _, name := range ref.view.cols {
+			col := &sqlparser.ColName{Name: sqlparser.NewColIdent(name)}
+			if qualify {
+				col.Qualifier.Name = sqlparser.NewTableIdent(ref.name)
+			}
+			cols = append(cols, &sqlparser.AliasedExpr{Expr: col})
+		}
+		return cols
+	}
+
+	var newExprs sqlparser.SelectExprs
+	for _, expr := range exprs {
+		star, ok := expr.(*sqlparser.StarExpr)
+		if !ok || !star.TableName.Qualifier.IsEmpty() {
+			newExprs = append(newExprs, expr)
+			continue
+		}
+		if star.TableName.Name.IsEmpty() {
+			if len(refs) == 1 {
+				newExprs = append(newExprs, colExprs(refs[0], false)...)
+			} else {
+				for _, ref := range refs {
+					newExprs = append(newExprs, colExprs(ref, true)...)
+				}
+			}
+			continue
+		}
+		found := false
+		for _, ref := range refs {
+			if ref.name == star.TableName.Name.String() {
+				newExprs = append(newExprs, colExprs(ref, true)...)
+				found = true
+				break
+			}
+		}
+		if !found {
+			newExprs = append(newExprs, expr)
+		}
+	}
+	return newExprs
+}
+
+// requalify は、ビューのWHERE句の式 expr が参照している列を、alias で修飾した列に置き換える。
+// names は、ビューの中でテーブルを参照するときに使用されていた名前である。
+// unqualified がtrueなら、修飾されていない列も置き換える。
+func requalify(expr sqlparser.SQLNode, names map[string]bool, alias string, unqualified bool) {
+	sqlparser.Walk(func(node sqlparser.SQLNode) (bool, error) {
+		switch node := node.(type) {
+		case *sqlparser.ColName:
+			q := node.Qualifier.Name.String()
+			if node.Qualifier.Qualifier.IsEmpty() && ((q == "" && unqualified) || names[q]) {
+				node.Qualifier = sqlparser.TableName{Name: sqlparser.NewTableIdent(alias)}
+			}
+		case *sqlparser.Subquery:
+			sel, ok := node.Select.(*sqlparser.Select)
+			if !ok {
+				return false, nil
+			}
+			// サブクエリのFROM句で再定義された名前は、サブクエリ内のテーブルを指す。
+			shadowed := map[string]bool{}
+			for name := range names {
+				shadowed[name] = true
+			}
+			sqlparser.Walk(func(node sqlparser.SQLNode) (bool, error) {
+				if aliased, ok := node.(*sqlparser.AliasedTableExpr); ok {
+					if table, ok := aliased.Expr.(sqlparser.TableName); ok {
+						delete(shadowed, table.Name.String())
+					}
+					delete(shadowed, aliased.As.String())
+					return false, nil
+				}
+				return true, nil
+			}, sel.From)
+			requalify(sel, shadowed, alias, false)
+			return false, nil
+		case *sqlparser.FuncExpr:
+			if isTableFunc(node) {
+				// FRAME() などの引数は、関数が定義しているテーブルの列を参照する。
+				for _, arg := range node.Exprs {
+					requalify(arg, names, alias, false)
+				}
+				return false, nil
+			}
+		}
+		return true, nil
+	}, expr)
+}
+
+// isTableFunc は、引数が SqlFunc.Table の列を参照する関数であればtrueを返す。
+func isTableFunc(expr *sqlparser.FuncExpr) bool {
+	for i := range funcs {
+		if expr.Name.EqualString(funcs[i].Name) {
+			return funcs[i].Table != ""
+		}
+	}
+	return false
+}
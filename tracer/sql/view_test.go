@@ -0,0 +1,120 @@
+package sql
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/xwb1989/sqlparser"
+	"github.com/yuuki0xff/goapptrace/tracer/types"
+)
+
+func mapViews(views map[string]string) ViewFunc {
+	return func(name string) (string, bool) {
+		query, ok := views[name]
+		return query, ok
+	}
+}
+
+func TestParseSelectWithViews(t *testing.T) {
+	fls := []types.FuncLog{
+		{ID: 0, GID: 1, StartTime: 0, EndTime: 10},
+		{ID: 1, GID: 2, StartTime: 0, EndTime: 40},
+		{ID: 2, GID: 1, StartTime: 10, EndTime: 40},
+		{ID: 3, GID: 3, StartTime: 0, EndTime: 5},
+	}
+	gs := []types.Goroutine{
+		{GID: 1, StartTime: 0, EndTime: 100},
+		{GID: 2, StartTime: 0, EndTime: 50},
+	}
+	open := memOpen(fls, gs)
+	views := mapViews(map[string]string{
+		"slow":   "SELECT * FROM calls WHERE exectime > 20",
+		"g1":     "SELECT id, gid FROM calls WHERE gid = 1",
+		"slowg1": "SELECT * FROM g1 WHERE exectime > 20",
+		"first":  "SELECT * FROM goroutines g WHERE g.gid = 1",
+		"main":   "SELECT * FROM calls WHERE FRAME(func = 'main.main')",
+		"loop":   "SELECT * FROM loop",
+		"bad":    "SELECT gid, COUNT(*) FROM calls GROUP BY gid",
+	})
+
+	t.Run("where", func(t *testing.T) {
+		a := assert.New(t)
+		a.Equal("id\n1\n2", viewQueryCsv(t, "SELECT id FROM slow", views, open))
+		a.Equal("id\n2", viewQueryCsv(t, "SELECT id FROM slow WHERE gid = 1", views, open))
+		a.Equal("id\n2", viewQueryCsv(t, "SELECT id FROM slow s WHERE s.gid = 1", views, open))
+	})
+	t.Run("columns", func(t *testing.T) {
+		a := assert.New(t)
+		a.Equal("id,gid\n0,1\n2,1", viewQueryCsv(t, "SELECT * FROM g1", views, open))
+		a.Equal("id,gid\n2,1", viewQueryCsv(t, "SELECT * FROM slowg1", views, open))
+	})
+	t.Run("join", func(t *testing.T) {
+		a := assert.New(t)
+		a.Equal("s.id,g.gid\n2,1",
+			viewQueryCsv(t, "SELECT s.id, g.gid FROM slow s JOIN first g ON s.gid = g.gid", views, open))
+		sel, err := ParseSelectWithViews("SELECT * FROM g1 c JOIN goroutines g ON c.gid = g.gid", views)
+		if a.NoError(err) {
+			a.Equal([]string{
+				"c.id", "c.gid",
+				"g.gid", "g.starttime", "g.endtime", "g.exectime", "g.running", "g.startoffset",
+			}, sel.ColNames())
+		}
+	})
+	t.Run("subquery", func(t *testing.T) {
+		assert.Equal(t, "id\n0\n2",
+			viewQueryCsv(t, "SELECT id FROM calls WHERE gid IN (SELECT gid FROM first)", views, open))
+	})
+	t.Run("rewrite", func(t *testing.T) {
+		a := assert.New(t)
+		for query, expected := range map[string]string{
+			"SELECT id FROM slow WHERE gid = 1":        "select id from calls as slow where (slow.exectime > 20) and (gid = 1)",
+			"SELECT * FROM first f":                    "select * from goroutines as f where f.gid = 1",
+			"SELECT id FROM main":                      "select id from calls as main where FRAME(func = 'main.main')",
+			"SELECT id FROM calls WHERE gid IN (1, 2)": "select id from calls where gid in (1, 2)",
+		} {
+			sel, err := ParseSelectWithViews(query, views)
+			if a.NoError(err, query) {
+				a.Equal(expected, sqlparser.String(sel.Stmt), query)
+			}
+		}
+	})
+	t.Run("error", func(t *testing.T) {
+		a := assert.New(t)
+		_, err := ParseSelectWithViews("SELECT * FROM loop", views)
+		a.Equal(ErrViewRecursion, err)
+		_, err = ParseSelectWithViews("SELECT * FROM bad", views)
+		a.Error(err)
+		_, err = ParseSelectWithViews("SELECT * FROM nosuch", views)
+		a.Equal(ErrNotFoundTable, err)
+		_, err = ParseSelect("SELECT * FROM slow")
+		a.Equal(ErrNotFoundTable, err)
+	})
+}
+
+func TestCheckView(t *testing.T) {
+	a := assert.New(t)
+	views := mapViews(map[string]string{
+		"slow": "SELECT * FROM calls WHERE exectime > 20",
+	})
+	for name, query := range map[string]string{
+		"v1": "SELECT * FROM calls",
+		"v2": "SELECT id, c.gid FROM calls c WHERE c.gid IN (SELECT gid FROM goroutines)",
+		"v3": "SELECT id FROM slow WHERE gid = 1",
+		// 既存のビューを置き換える。
+		"slow": "SELECT * FROM calls WHERE exectime > 30",
+	} {
+		a.NoError(CheckView(name, query, views), query)
+	}
+	for name, query := range map[string]string{
+		"calls": "SELECT * FROM calls",
+		"v1":    "SELECT id AS x FROM calls",
+		"v2":    "SELECT id + 1 FROM calls",
+		"v3":    "SELECT * FROM calls ORDER BY id",
+		"v4":    "SELECT c.id FROM calls c JOIN goroutines g ON c.gid = g.gid",
+		"v5":    "SELECT * FROM v5",
+		"v6":    "SELECT nosuch FROM calls",
+		"v7":    "SELECT * FROM nosuch",
+	} {
+		a.Error(CheckView(name, query, views), query)
+	}
+}
@@ -43,36 +43,19 @@ func (d DirLayout) Init() error {
 
 	if d.InfoFile().Exists() {
 		// check whether that data format have compatible.
-		data, err := d.InfoFile().ReadAll()
+		info, err := d.ReadInfo()
 		if err != nil {
 			return err
 		}
-		var info Info
-		if err := json.Unmarshal(data, &info); err != nil {
-			return err
-		}
 		if !info.IsCompatible() {
-			return errors.New("data format is not compatible")
+			if info.Older(CurrentInfo()) {
+				return errors.Wrapf(ErrNeedMigration, "data format version is %s, but required %s", info, CurrentInfo())
+			}
+			return fmt.Errorf("data format is not compatible: version %s is newer than %s", info, CurrentInfo())
 		}
 	} else {
 		// write the current data format version.
-		info := Info{
-			MajorVersion: MajorVersion,
-			MinorVersion: MinorVersion,
-		}
-		data, err := json.Marshal(&info)
-		if err != nil {
-			return err
-		}
-
-		w, err := d.InfoFile().OpenWriteOnly()
-		if err != nil {
-			return err
-		}
-		if _, err := w.Write(data); err != nil {
-			return err
-		}
-		if err := w.Close(); err != nil {
+		if err := d.WriteInfo(CurrentInfo()); err != nil {
 			return err
 		}
 	}
@@ -87,6 +70,27 @@ func (d DirLayout) Init() error {
 	return nil
 }
 
+// infoファイルを読み込み、ファイルフォーマットのバージョンを返す。
+func (d DirLayout) ReadInfo() (Info, error) {
+	var info Info
+	data, err := d.InfoFile().ReadAll()
+	if err != nil {
+		return info, err
+	}
+	err = json.Unmarshal(data, &info)
+	return info, err
+}
+
+// infoファイルにファイルフォーマットのバージョンを書き込む。
+// 書き込みはatomicに行われる。
+func (d DirLayout) WriteInfo(info Info) error {
+	data, err := json.Marshal(&info)
+	if err != nil {
+		return err
+	}
+	return d.InfoFile().WriteAll(data)
+}
+
 // infoファイルを返す
 func (d DirLayout) InfoFile() File {
 	return File(path.Join(d.Root, "info.json"))
@@ -155,6 +159,31 @@ func (d DirLayout) IndexFile(id LogID) File {
 	return File(path.Join(d.DataDir(), fmt.Sprintf("%s.index", id.Hex())))
 }
 
+// 指定したLogIDの、GIDからFuncLogIDを引くためのインデックスファイルを返す。
+func (d DirLayout) GoroutineIndexFile(id LogID) File {
+	return File(path.Join(d.DataDir(), fmt.Sprintf("%s.gid.index", id.Hex())))
+}
+
+// 指定したLogIDの、関数のPCからFuncLogIDを引くためのインデックスファイルを返す。
+func (d DirLayout) FuncIndexFile(id LogID) File {
+	return File(path.Join(d.DataDir(), fmt.Sprintf("%s.func.index", id.Hex())))
+}
+
+// 指定したLogIDの、呼び出し元のFuncLogIDから呼び出し先のFuncLogIDを引くためのインデックスファイルを返す。
+func (d DirLayout) ParentIndexFile(id LogID) File {
+	return File(path.Join(d.DataDir(), fmt.Sprintf("%s.parent.index", id.Hex())))
+}
+
+// 指定したLogIDの、関数ごとの統計情報を保存するファイルを返す。
+func (d DirLayout) FuncStatsFile(id LogID) File {
+	return File(path.Join(d.DataDir(), fmt.Sprintf("%s.funcstats", id.Hex())))
+}
+
+// 指定したLogIDの、ウォッチドッグが検出したイベントを保存するファイルを返す。
+func (d DirLayout) EventFile(id LogID) File {
+	return File(path.Join(d.DataDir(), fmt.Sprintf("%s.events.json", id.Hex())))
+}
+
 func (d DirLayout) mkdir(dir string) error {
 	return os.MkdirAll(dir, config.DefaultDirPerm)
 }
@@ -211,19 +240,40 @@ func (f File) ReadAll() ([]byte, error) {
 	if err != nil {
 		return nil, err
 	}
+	defer file.Close() // nolint: errcheck
 	return ioutil.ReadAll(file)
 }
 
 // ファイルにdataを書き込む。書き込みはatomicに行われる。
+// rename前にfsyncするため、クラッシュしても書き込み途中のファイルが残ることはない。
 func (f File) WriteAll(data []byte) error {
 	newf := f.new()
-	err := ioutil.WriteFile(string(newf), data, 0600)
+	w, err := f.openFile(string(newf), os.O_CREATE|os.O_WRONLY|os.O_TRUNC)
 	if err != nil {
 		return err
 	}
+	if _, err := w.Write(data); err != nil {
+		w.Close()     // nolint: errcheck
+		newf.Remove() // nolint: errcheck
+		return err
+	}
+	if err := w.Sync(); err != nil {
+		w.Close()     // nolint: errcheck
+		newf.Remove() // nolint: errcheck
+		return err
+	}
+	if err := w.Close(); err != nil {
+		newf.Remove() // nolint: errcheck
+		return err
+	}
 	return newf.RenameTo(f)
 }
 
+// ファイルサイズをsizeバイトに切り詰める。
+func (f File) Truncate(size int64) error {
+	return os.Truncate(string(f), size)
+}
+
 func (f File) openFile(name string, flag int) (*os.File, error) {
 	return os.OpenFile(name, flag, config.DefaultFilePerm)
 }
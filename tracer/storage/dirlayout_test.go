@@ -89,3 +89,23 @@ func TestDirLayout_IndexFile(t *testing.T) {
 	a := assert.New(t)
 	a.Equal(File("/tmp/.goapptrace/logs/data/"+goodStrID+".index"), dr.IndexFile(goodLogID))
 }
+
+func TestDirLayout_GoroutineIndexFile(t *testing.T) {
+	a := assert.New(t)
+	a.Equal(File("/tmp/.goapptrace/logs/data/"+goodStrID+".gid.index"), dr.GoroutineIndexFile(goodLogID))
+}
+
+func TestDirLayout_FuncIndexFile(t *testing.T) {
+	a := assert.New(t)
+	a.Equal(File("/tmp/.goapptrace/logs/data/"+goodStrID+".func.index"), dr.FuncIndexFile(goodLogID))
+}
+
+func TestDirLayout_FuncStatsFile(t *testing.T) {
+	a := assert.New(t)
+	a.Equal(File("/tmp/.goapptrace/logs/data/"+goodStrID+".funcstats"), dr.FuncStatsFile(goodLogID))
+}
+
+func TestDirLayout_EventFile(t *testing.T) {
+	a := assert.New(t)
+	a.Equal(File("/tmp/.goapptrace/logs/data/"+goodStrID+".events.json"), dr.EventFile(goodLogID))
+}
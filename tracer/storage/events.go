@@ -0,0 +1,89 @@
+package storage
+
+import (
+	"encoding/json"
+	"sync"
+
+	"github.com/yuuki0xff/goapptrace/tracer/types"
+)
+
+// EventStore は、ウォッチドッグが検出したイベントを管理する。
+// イベントの数は少ないため、全てのイベントをメモリ上に保持し、保存時にファイル全体を書き換える。
+// スレッドセーフである。
+type EventStore struct {
+	File     File
+	ReadOnly bool
+
+	lock   sync.RWMutex
+	events []types.Event
+	// ファイルに書き出されていない変更があればtrue。
+	dirty bool
+}
+
+// ファイルから読み込む。
+// ファイルが存在しないときは、エラーを返す。
+func (s *EventStore) Load() error {
+	raw, err := s.File.ReadAll()
+	if err != nil {
+		return err
+	}
+	var events []types.Event
+	if err := json.Unmarshal(raw, &events); err != nil {
+		return err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.events = events
+	s.dirty = false
+	return nil
+}
+
+// 変更されていれば、ファイルに書き込む。書き込みはatomicに行われる。
+func (s *EventStore) Save() error {
+	if s.ReadOnly {
+		return ErrReadOnly
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if !s.dirty {
+		return nil
+	}
+
+	data, err := json.Marshal(s.events)
+	if err != nil {
+		return err
+	}
+	if err := s.File.WriteAll(data); err != nil {
+		return err
+	}
+	s.dirty = false
+	return nil
+}
+
+// Add は、イベントを追加する。
+// 各イベントのIDは、追加した順に割り当てられる。
+func (s *EventStore) Add(events ...types.Event) error {
+	if s.ReadOnly {
+		return ErrReadOnly
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for _, e := range events {
+		e.ID = int64(len(s.events))
+		s.events = append(s.events, e)
+	}
+	if len(events) > 0 {
+		s.dirty = true
+	}
+	return nil
+}
+
+// Events は、全てのイベントを追加した順に返す。
+func (s *EventStore) Events() []types.Event {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	events := make([]types.Event, len(s.events))
+	copy(events, s.events)
+	return events
+}
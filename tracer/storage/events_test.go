@@ -0,0 +1,85 @@
+package storage
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yuuki0xff/goapptrace/tracer/types"
+)
+
+func TestEventStore(t *testing.T) {
+	a := assert.New(t)
+	tempdir, err := ioutil.TempDir("", ".goapptrace_storage")
+	a.NoError(err)
+	defer func() {
+		a.NoError(os.RemoveAll(tempdir))
+	}()
+	file := File(tempdir + "/test.events.json")
+
+	s := &EventStore{File: file}
+	a.Len(s.Events(), 0)
+	a.NoError(s.Add(
+		types.Event{Kind: types.SlowCallEvent, Rule: "slow", Func: "main.foo", FuncLogID: 10, Duration: 500},
+		types.Event{Kind: types.TooManyGoroutinesEvent, Rule: "many", Func: "main.bar", Goroutines: 5},
+	))
+	a.NoError(s.Add())
+	a.NoError(s.Save())
+
+	// 保存したデータを読み込んでから、イベントを追加する。
+	s = &EventStore{File: file}
+	a.NoError(s.Load())
+	a.NoError(s.Add(types.Event{Kind: types.SlowCallEvent, Rule: "slow", Func: "main.foo", FuncLogID: 20}))
+	a.NoError(s.Save())
+
+	s = &EventStore{File: file, ReadOnly: true}
+	a.NoError(s.Load())
+	events := s.Events()
+	if a.Len(events, 3) {
+		a.Equal(int64(0), events[0].ID)
+		a.Equal(types.FuncLogID(10), events[0].FuncLogID)
+		a.Equal(types.Time(500), events[0].Duration)
+		a.Equal(int64(1), events[1].ID)
+		a.Equal(5, events[1].Goroutines)
+		a.Equal(int64(2), events[2].ID)
+		a.Equal(types.FuncLogID(20), events[2].FuncLogID)
+	}
+
+	// 読み込み専用のときは、変更できない。
+	a.Equal(ErrReadOnly, s.Add(types.Event{}))
+	a.Equal(ErrReadOnly, s.Save())
+}
+
+func TestLog_Events(t *testing.T) {
+	a := assert.New(t)
+	tempdir, err := ioutil.TempDir("", ".goapptrace_storage")
+	a.NoError(err)
+	defer func() {
+		a.NoError(os.RemoveAll(tempdir))
+	}()
+	dirlayout := DirLayout{Root: tempdir}
+	a.NoError(dirlayout.Init())
+
+	l := &Log{
+		ID:       LogID{},
+		Root:     dirlayout,
+		Metadata: &types.LogMetadata{},
+	}
+	a.NoError(l.Open())
+	a.Len(l.Events(), 0)
+	a.NoError(l.AddEvents(types.Event{Kind: types.SlowCallEvent, Rule: "slow"}))
+	a.NoError(l.Close())
+
+	l = &Log{
+		ID:       LogID{},
+		Root:     dirlayout,
+		ReadOnly: true,
+	}
+	a.NoError(l.Open())
+	events := l.Events()
+	if a.Len(events, 1) {
+		a.Equal("slow", events[0].Rule)
+	}
+	a.NoError(l.Close())
+}
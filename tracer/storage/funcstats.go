@@ -0,0 +1,388 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/gob"
+	"sort"
+	"sync"
+
+	"github.com/yuuki0xff/goapptrace/tracer/types"
+)
+
+// funcStatsMagic は、FuncStatsStoreのファイルの先頭に書き込まれる識別子である。
+const funcStatsMagic = "GAFSTATv1"
+
+// FuncStatsStore は、関数ごとの統計情報 (呼び出し回数や実行時間など) を管理する。
+// 統計情報は、関数呼び出し時のPC (FuncLog.Frames[0]) ごとに集計する。
+// 呼び出し元と呼び出し先の関数の組ごとの統計情報 (コールグラフのエッジ) も、PCの組ごとに集計する。
+// スレッドセーフである。
+//
+// ファイルは追記型であり、保存するたびに、前回の保存以降に変更された統計情報のみをセグメントとして末尾に追記する。
+// 同じPCやエッジの統計情報が複数のセグメントに含まれる場合は、後のセグメントの値が有効である。
+type FuncStatsStore struct {
+	File     File
+	ReadOnly bool
+
+	lock  sync.RWMutex
+	stats map[uintptr]types.FuncStats
+	// 呼び出し元と呼び出し先のPCの組ごとの統計情報。
+	edges map[callEdgeKey]types.CallEdge
+	// ファイルに書き出されていない変更があったPCとエッジ
+	dirtyStats map[uintptr]bool
+	dirtyEdges map[callEdgeKey]bool
+
+	// 以下のフィールドは、実行中の親関数ごとの集計途中の値である。
+	// 親関数のFuncLogが追加されたときに削除し、ファイルには書き出さない。
+	// 実行が終了しない親関数の値は、実行中の関数呼び出しと同じ数だけ残る。
+
+	// 実行が終了した子関数の実行時間の合計。
+	// 親関数のself timeを計算するために、親関数の実行が終了するまで保持する。
+	childTime map[types.FuncLogID]types.Time
+	// 実行が終了した子関数の、呼び出し先のPCごとの統計情報。
+	// 呼び出し元のPCは親関数のFuncLogが追加されるまで分からないため、それまで保持する。
+	childCalls map[types.FuncLogID]map[uintptr]types.CallEdge
+}
+
+// funcStatsSegment は、1つのセグメントに書き出されるデータである。
+type funcStatsSegment struct {
+	Stats []types.FuncStats
+	Edges []types.CallEdge
+}
+
+// callEdgeKey は、コールグラフのエッジを識別する。
+type callEdgeKey struct {
+	Caller uintptr
+	Callee uintptr
+}
+
+// ファイルから読み込む。
+// ファイルが存在しないときは、エラーを返す。
+// 書き込み途中の末尾のセグメントは無視する。書き込み可能なら、そのセグメントを切り捨てる。
+func (s *FuncStatsStore) Load() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.stats = nil
+	s.edges = nil
+	s.dirtyStats = nil
+	s.dirtyEdges = nil
+	s.childTime = nil
+	s.childCalls = nil
+	s.init()
+
+	return readSegments(s.File, funcStatsMagic, !s.ReadOnly, func(payload []byte) error {
+		var seg funcStatsSegment
+		if err := gob.NewDecoder(bytes.NewReader(payload)).Decode(&seg); err != nil {
+			return err
+		}
+		for _, st := range seg.Stats {
+			s.stats[st.PC] = st
+		}
+		for _, e := range seg.Edges {
+			s.edges[callEdgeKey{Caller: e.CallerPC, Callee: e.CalleePC}] = e
+		}
+		return nil
+	})
+}
+
+// 変更されていれば、ファイルに書き込む。
+// ファイルが存在すれば、前回の保存以降に変更された統計情報のみを追記する。
+// ファイルが存在しなければ、全ての統計情報をatomicに書き込む。
+func (s *FuncStatsStore) Save() error {
+	if s.ReadOnly {
+		return ErrReadOnly
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.init()
+	if !s.File.Exists() {
+		return s.saveAll()
+	}
+	if len(s.dirtyStats) == 0 && len(s.dirtyEdges) == 0 {
+		return nil
+	}
+
+	var seg funcStatsSegment
+	for pc := range s.dirtyStats {
+		seg.Stats = append(seg.Stats, s.stats[pc])
+	}
+	for key := range s.dirtyEdges {
+		seg.Edges = append(seg.Edges, s.edges[key])
+	}
+	payload, err := encodeFuncStatsSegment(&seg)
+	if err != nil {
+		return err
+	}
+	if err := appendSegment(s.File, payload); err != nil {
+		return err
+	}
+	s.dirtyStats = map[uintptr]bool{}
+	s.dirtyEdges = map[callEdgeKey]bool{}
+	return nil
+}
+
+// Compact は、全ての統計情報を1つのセグメントとしてファイルに書き込み、追記されたセグメントをまとめる。
+// 書き込みはatomicに行われる。
+func (s *FuncStatsStore) Compact() error {
+	if s.ReadOnly {
+		return ErrReadOnly
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.init()
+	return s.saveAll()
+}
+
+// saveAll は、全ての統計情報を1つのセグメントとしてファイルに書き込む。
+// 呼び出し元は、ロックを取得していなければならない。
+func (s *FuncStatsStore) saveAll() error {
+	seg := funcStatsSegment{
+		Stats: make([]types.FuncStats, 0, len(s.stats)),
+		Edges: make([]types.CallEdge, 0, len(s.edges)),
+	}
+	for _, st := range s.stats {
+		seg.Stats = append(seg.Stats, st)
+	}
+	for _, e := range s.edges {
+		seg.Edges = append(seg.Edges, e)
+	}
+	payload, err := encodeFuncStatsSegment(&seg)
+	if err != nil {
+		return err
+	}
+	if err := writeSegment(s.File, funcStatsMagic, payload); err != nil {
+		return err
+	}
+	s.dirtyStats = map[uintptr]bool{}
+	s.dirtyEdges = map[callEdgeKey]bool{}
+	return nil
+}
+
+func encodeFuncStatsSegment(seg *funcStatsSegment) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(seg); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// AddFuncLogs は、実行が終了したFuncLogを統計情報に追加する。
+// 実行中のFuncLogは無視する。同じFuncLogを2回以上追加してはならない。
+// 子関数のFuncLogは、親関数のFuncLogと同時か、それよりも前に追加しなければならない。
+func (s *FuncStatsStore) AddFuncLogs(fls []*types.FuncLog) error {
+	if s.ReadOnly {
+		return ErrReadOnly
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.init()
+
+	// 親関数のself timeを求めるために、先に子関数の実行時間を集計する。
+	for _, fl := range fls {
+		s.addChildTimeNolock(fl)
+	}
+	for _, fl := range fls {
+		s.addFuncLogNolock(fl)
+	}
+	return nil
+}
+
+// Stats は、PCごとの統計情報を返す。
+// 返される統計情報の順序は、PCの昇順である。
+func (s *FuncStatsStore) Stats() []types.FuncStats {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	stats := make([]types.FuncStats, 0, len(s.stats))
+	for _, st := range s.stats {
+		stats = append(stats, st)
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].PC < stats[j].PC })
+	return stats
+}
+
+// Edges は、呼び出し元と呼び出し先のPCの組ごとの統計情報を返す。
+// 返される統計情報の順序は、呼び出し元のPCの昇順、呼び出し先のPCの昇順である。
+func (s *FuncStatsStore) Edges() []types.CallEdge {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	edges := make([]types.CallEdge, 0, len(s.edges))
+	for _, e := range s.edges {
+		edges = append(edges, e)
+	}
+	sortCallEdges(edges)
+	return edges
+}
+
+func (s *FuncStatsStore) init() {
+	if s.stats == nil {
+		s.stats = map[uintptr]types.FuncStats{}
+	}
+	if s.edges == nil {
+		s.edges = map[callEdgeKey]types.CallEdge{}
+	}
+	if s.dirtyStats == nil {
+		s.dirtyStats = map[uintptr]bool{}
+	}
+	if s.dirtyEdges == nil {
+		s.dirtyEdges = map[callEdgeKey]bool{}
+	}
+	if s.childTime == nil {
+		s.childTime = map[types.FuncLogID]types.Time{}
+	}
+	if s.childCalls == nil {
+		s.childCalls = map[types.FuncLogID]map[uintptr]types.CallEdge{}
+	}
+}
+
+func (s *FuncStatsStore) addChildTimeNolock(fl *types.FuncLog) {
+	if !fl.IsEnded() || fl.ParentID == types.NotFoundParent {
+		return
+	}
+	total := fl.EndTime - fl.StartTime
+	s.childTime[fl.ParentID] += total
+
+	if len(fl.Frames) > 0 {
+		calls := s.childCalls[fl.ParentID]
+		if calls == nil {
+			calls = map[uintptr]types.CallEdge{}
+			s.childCalls[fl.ParentID] = calls
+		}
+		pc := fl.Frames[0]
+		e := calls[pc]
+		e.CalleePC = pc
+		e.Add(total)
+		calls[pc] = e
+	}
+}
+
+func (s *FuncStatsStore) addFuncLogNolock(fl *types.FuncLog) {
+	if !fl.IsEnded() {
+		return
+	}
+	// 親関数の実行が終了したため、集計途中の値は不要になる。
+	childTime := s.childTime[fl.ID]
+	childCalls := s.childCalls[fl.ID]
+	delete(s.childTime, fl.ID)
+	delete(s.childCalls, fl.ID)
+	if len(fl.Frames) == 0 {
+		return
+	}
+	total := fl.EndTime - fl.StartTime
+	self := total - childTime
+
+	pc := fl.Frames[0]
+	st := s.stats[pc]
+	st.PC = pc
+	st.Add(total, self)
+	s.stats[pc] = st
+	s.dirtyStats[pc] = true
+
+	// 子関数の呼び出しを、この関数からのエッジとして集計する。
+	for _, child := range childCalls {
+		key := callEdgeKey{Caller: pc, Callee: child.CalleePC}
+		e := s.edges[key]
+		e.CallerPC = key.Caller
+		e.CalleePC = key.Callee
+		e.Merge(child)
+		s.edges[key] = e
+		s.dirtyEdges[key] = true
+	}
+}
+
+// MergeFuncStats は、PCごとの統計情報を関数ごとに集計する。
+// 関数が不明なPCの統計情報は、そのまま返す。
+// 返される統計情報の順序は、関数のエントリポイントの昇順である。
+func MergeFuncStats(stats []types.FuncStats, symbols *types.Symbols) []types.FuncStats {
+	m := map[uintptr]*types.FuncStats{}
+	for _, st := range stats {
+		key := st.PC
+		name := ""
+		if f, ok := symbols.GoFunc(st.PC); ok {
+			key = f.Entry
+			name = f.Name
+		}
+		merged, ok := m[key]
+		if !ok {
+			merged = &types.FuncStats{
+				Name: name,
+				PC:   key,
+			}
+			m[key] = merged
+		}
+		merged.Merge(st)
+	}
+
+	result := make([]types.FuncStats, 0, len(m))
+	for _, st := range m {
+		result = append(result, *st)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].PC < result[j].PC })
+	return result
+}
+
+// MergeCallEdges は、PCの組ごとの統計情報を関数の組ごとに集計する。
+// 関数が不明なPCは、そのまま使用する。
+// 返される統計情報の順序は、呼び出し元の関数のエントリポイントの昇順、呼び出し先の関数のエントリポイントの昇順である。
+func MergeCallEdges(edges []types.CallEdge, symbols *types.Symbols) []types.CallEdge {
+	lookup := func(pc uintptr) (uintptr, string) {
+		if f, ok := symbols.GoFunc(pc); ok {
+			return f.Entry, f.Name
+		}
+		return pc, ""
+	}
+
+	m := map[callEdgeKey]*types.CallEdge{}
+	for _, e := range edges {
+		var merged types.CallEdge
+		merged.CallerPC, merged.CallerName = lookup(e.CallerPC)
+		merged.CalleePC, merged.CalleeName = lookup(e.CalleePC)
+		key := callEdgeKey{Caller: merged.CallerPC, Callee: merged.CalleePC}
+		if m[key] == nil {
+			m[key] = &merged
+		}
+		m[key].Merge(e)
+	}
+
+	result := make([]types.CallEdge, 0, len(m))
+	for _, e := range m {
+		result = append(result, *e)
+	}
+	sortCallEdges(result)
+	return result
+}
+
+func sortCallEdges(edges []types.CallEdge) {
+	sort.Slice(edges, func(i, j int) bool {
+		if edges[i].CallerPC != edges[j].CallerPC {
+			return edges[i].CallerPC < edges[j].CallerPC
+		}
+		return edges[i].CalleePC < edges[j].CalleePC
+	})
+}
+
+// BuildFuncStats は、FuncLogファイルから関数ごとの統計情報を再構築する。
+// 既存の統計情報ファイルは上書きされる。
+// 対象のログを他のプロセスが開いていてはならない。
+func BuildFuncStats(d DirLayout, id LogID) error {
+	s := &FuncStatsStore{File: d.FuncStatsFile(id)}
+	s.init()
+
+	// 子関数は親関数よりも後に記録されているため、2回に分けて読み込む。
+	err := scanFuncLogs(d, id, func(fl *types.FuncLog) error {
+		s.addChildTimeNolock(fl)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	err = scanFuncLogs(d, id, func(fl *types.FuncLog) error {
+		s.addFuncLogNolock(fl)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return s.saveAll()
+}
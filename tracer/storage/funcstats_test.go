@@ -0,0 +1,217 @@
+package storage
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yuuki0xff/goapptrace/tracer/types"
+)
+
+func TestFuncStatsStore(t *testing.T) {
+	a := assert.New(t)
+	tempdir, err := ioutil.TempDir("", ".goapptrace_storage")
+	a.NoError(err)
+	defer func() {
+		a.NoError(os.RemoveAll(tempdir))
+	}()
+	file := File(tempdir + "/test.funcstats")
+
+	// main (pc=300) -> foo (pc=100) -> bar (pc=200)
+	//               -> foo (pc=100)
+	s := &FuncStatsStore{File: file}
+	a.NoError(s.AddFuncLogs([]*types.FuncLog{
+		{ID: 0, ParentID: types.NotFoundParent, StartTime: 0, EndTime: types.NotEnded, Frames: []uintptr{300}},
+		{ID: 2, ParentID: 1, StartTime: 20, EndTime: 30, Frames: []uintptr{200, 100, 300}},
+		{ID: 1, ParentID: 0, StartTime: 10, EndTime: 50, Frames: []uintptr{100, 300}},
+	}))
+	a.NoError(s.AddFuncLogs([]*types.FuncLog{
+		{ID: 3, ParentID: 0, StartTime: 60, EndTime: 70, Frames: []uintptr{100, 300}},
+	}))
+	a.NoError(s.AddFuncLogs([]*types.FuncLog{
+		{ID: 0, ParentID: types.NotFoundParent, StartTime: 0, EndTime: 100, Frames: []uintptr{300}},
+	}))
+
+	stats := s.Stats()
+	a.Len(stats, 3)
+	foo, bar, main := stats[0], stats[1], stats[2]
+	a.Equal(uintptr(100), foo.PC)
+	a.Equal(int64(2), foo.Calls)
+	a.Equal(types.Time(50), foo.TotalTime)
+	a.Equal(types.Time(40), foo.SelfTime)
+	a.Equal(types.Time(10), foo.MinTime)
+	a.Equal(types.Time(40), foo.MaxTime)
+
+	a.Equal(uintptr(200), bar.PC)
+	a.Equal(int64(1), bar.Calls)
+	a.Equal(types.Time(10), bar.TotalTime)
+	a.Equal(types.Time(10), bar.SelfTime)
+
+	a.Equal(uintptr(300), main.PC)
+	a.Equal(int64(1), main.Calls)
+	a.Equal(types.Time(100), main.TotalTime)
+	a.Equal(types.Time(50), main.SelfTime)
+	a.Len(s.childTime, 0)
+
+	edges := s.Edges()
+	a.Equal([]types.CallEdge{
+		{CallerPC: 100, CalleePC: 200, Calls: 1, TotalTime: 10},
+		{CallerPC: 300, CalleePC: 100, Calls: 2, TotalTime: 50},
+	}, edges)
+	a.Len(s.childCalls, 0)
+
+	ro := &FuncStatsStore{File: file, ReadOnly: true}
+	a.Equal(ErrReadOnly, ro.AddFuncLogs(nil))
+}
+
+func TestFuncStatsStore_Save(t *testing.T) {
+	a := assert.New(t)
+	tempdir, err := ioutil.TempDir("", ".goapptrace_storage")
+	a.NoError(err)
+	defer func() {
+		a.NoError(os.RemoveAll(tempdir))
+	}()
+	file := File(tempdir + "/test.funcstats")
+
+	s := &FuncStatsStore{File: file}
+	a.NoError(s.AddFuncLogs([]*types.FuncLog{
+		{ID: 1, ParentID: 0, StartTime: 10, EndTime: 20, Frames: []uintptr{100, 300}},
+		{ID: 2, ParentID: 0, StartTime: 30, EndTime: 40, Frames: []uintptr{200, 300}},
+	}))
+	a.NoError(s.Save())
+	size, err := file.Size()
+	a.NoError(err)
+	a.NoError(s.Save())
+	size2, err := file.Size()
+	a.NoError(err)
+	a.Equal(size, size2)
+
+	// 変更された統計情報のみを追記する。
+	a.NoError(s.AddFuncLogs([]*types.FuncLog{
+		{ID: 3, ParentID: 0, StartTime: 50, EndTime: 80, Frames: []uintptr{100, 300}},
+	}))
+	a.NoError(s.Save())
+	s2 := &FuncStatsStore{File: file, ReadOnly: true}
+	a.NoError(s2.Load())
+	a.Equal(s.Stats(), s2.Stats())
+	a.Equal(int64(2), s2.Stats()[0].Calls)
+	a.Equal(types.Time(40), s2.Stats()[0].TotalTime)
+	// 実行中の親関数の集計途中の値は、ファイルに書き出さない。
+	a.Len(s.childTime, 1)
+	a.Len(s2.childTime, 0)
+
+	// 親関数の実行が終了したら、集計途中の値を削除する。
+	// Framesが無い関数呼び出しも同様である。
+	a.NoError(s.AddFuncLogs([]*types.FuncLog{
+		{ID: 0, ParentID: types.NotFoundParent, StartTime: 0, EndTime: 100},
+	}))
+	a.Len(s.childTime, 0)
+	a.Len(s.childCalls, 0)
+
+	a.NoError(s.Compact())
+	s2 = &FuncStatsStore{File: file, ReadOnly: true}
+	a.NoError(s2.Load())
+	a.Equal(s.Stats(), s2.Stats())
+
+	// 古い形式のファイルは読み込めない。
+	a.NoError(file.WriteAll([]byte("\x0e\xff\x81\x04\x01\x02\xff\x82")))
+	a.Error(s2.Load())
+}
+
+func TestMergeFuncStats(t *testing.T) {
+	a := assert.New(t)
+	symbols := &types.Symbols{}
+	symbols.Init()
+	symbols.Load(types.SymbolsData{
+		Files: []string{"main.go"},
+		Mods: []types.GoModule{
+			{Name: "main", MinPC: 100, MaxPC: 299},
+		},
+		Funcs: []types.GoFunc{
+			{Entry: 100, Name: "main.foo"},
+			{Entry: 200, Name: "main.bar"},
+		},
+		Lines: []types.GoLine{
+			{PC: 100, FileID: 0, Line: 1},
+			{PC: 200, FileID: 0, Line: 2},
+		},
+	})
+
+	var foo1, foo2, bar, unknown types.FuncStats
+	foo1.PC = 110
+	foo1.Add(10, 10)
+	foo2.PC = 120
+	foo2.Add(20, 20)
+	bar.PC = 210
+	bar.Add(30, 30)
+	unknown.PC = 500
+	unknown.Add(40, 40)
+
+	stats := MergeFuncStats([]types.FuncStats{bar, foo1, unknown, foo2}, symbols)
+	a.Len(stats, 3)
+	a.Equal("main.foo", stats[0].Name)
+	a.Equal(uintptr(100), stats[0].PC)
+	a.Equal(int64(2), stats[0].Calls)
+	a.Equal(types.Time(30), stats[0].TotalTime)
+	a.Equal("main.bar", stats[1].Name)
+	a.Equal(int64(1), stats[1].Calls)
+	a.Equal("", stats[2].Name)
+	a.Equal(uintptr(500), stats[2].PC)
+}
+
+func TestMergeCallEdges(t *testing.T) {
+	a := assert.New(t)
+	symbols := &types.Symbols{}
+	symbols.Init()
+	symbols.Load(types.SymbolsData{
+		Files: []string{"main.go"},
+		Mods: []types.GoModule{
+			{Name: "main", MinPC: 100, MaxPC: 299},
+		},
+		Funcs: []types.GoFunc{
+			{Entry: 100, Name: "main.foo"},
+			{Entry: 200, Name: "main.bar"},
+		},
+		Lines: []types.GoLine{
+			{PC: 100, FileID: 0, Line: 1},
+			{PC: 200, FileID: 0, Line: 2},
+		},
+	})
+
+	edges := MergeCallEdges([]types.CallEdge{
+		{CallerPC: 210, CalleePC: 110, Calls: 1, TotalTime: 10},
+		{CallerPC: 220, CalleePC: 120, Calls: 2, TotalTime: 30},
+		{CallerPC: 500, CalleePC: 210, Calls: 1, TotalTime: 40},
+		{CallerPC: 110, CalleePC: 210, Calls: 3, TotalTime: 60},
+	}, symbols)
+	a.Equal([]types.CallEdge{
+		{CallerName: "main.foo", CallerPC: 100, CalleeName: "main.bar", CalleePC: 200, Calls: 3, TotalTime: 60},
+		{CallerName: "main.bar", CallerPC: 200, CalleeName: "main.foo", CalleePC: 100, Calls: 3, TotalTime: 40},
+		{CallerName: "", CallerPC: 500, CalleeName: "main.bar", CalleePC: 200, Calls: 1, TotalTime: 40},
+	}, edges)
+}
+
+func TestBuildFuncStats(t *testing.T) {
+	withBrokenLog(t, func(d DirLayout, id LogID) {
+		assert.NoError(t, d.FuncStatsFile(id).Remove())
+	}, func(d DirLayout, id LogID) {
+		a := assert.New(t)
+		a.NoError(BuildFuncStats(d, id))
+		a.Error(BuildFuncStats(d, LogID{2}))
+
+		l := Log{
+			ID:       id,
+			Root:     d,
+			ReadOnly: true,
+		}
+		a.NoError(l.Open())
+		stats, ok := l.FuncStats()
+		a.True(ok)
+		a.Len(stats, 1)
+		a.Equal(int64(10), stats[0].Calls)
+		a.Equal(types.Time(1000), stats[0].TotalTime)
+		a.Equal(types.Time(1000), stats[0].SelfTime)
+		a.NoError(l.Close())
+	})
+}
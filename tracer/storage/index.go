@@ -1,6 +1,7 @@
 package storage
 
 import (
+	"bytes"
 	"encoding/gob"
 	"errors"
 	"io"
@@ -32,6 +33,18 @@ type IndexRecord struct {
 	MaxEnd   types.Time
 }
 
+// NewIndexRecord は、FuncLogを1つも含まないIndexRecordを返す。
+func NewIndexRecord() IndexRecord {
+	return IndexRecord{
+		MinID:    math.MaxInt64,
+		MaxID:    math.MinInt64,
+		MinStart: math.MaxInt64,
+		MaxStart: math.MinInt64,
+		MinEnd:   math.MaxInt64,
+		MaxEnd:   math.MinInt64,
+	}
+}
+
 func (idx *Index) Open() error {
 	return nil
 }
@@ -62,27 +75,28 @@ func (idx *Index) Load() error {
 	return gob.NewDecoder(r).Decode(&idx.records)
 }
 
+// ファイルに書き込む。書き込みはatomicに行われる。
 func (idx *Index) Save() error {
 	if idx.ReadOnly {
 		return ErrReadOnly
 	}
-	if idx.records == nil {
-		return nil
-	}
+	idx.mustLoad()
 
-	if idx.File.Exists() {
-		// ファイルが存在した場合は、先に削除してから書き込む。
-		err := idx.File.Remove()
-		if err != nil {
-			return err
-		}
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(idx.records); err != nil {
+		return err
 	}
+	return idx.File.WriteAll(buf.Bytes())
+}
 
-	w, err := idx.File.OpenWriteOnly()
-	if err != nil {
-		return err
+// 全てのIndexRecordを置き換える。
+func (idx *Index) Reset(records []IndexRecord) error {
+	if idx.ReadOnly {
+		return ErrReadOnly
 	}
-	return gob.NewEncoder(w).Encode(idx.records)
+	idx.records = make([]IndexRecord, len(records))
+	copy(idx.records, records)
+	return nil
 }
 
 // 指定したIndexのIndexRecordを返す。
@@ -165,6 +179,57 @@ func (idx *Index) IDRangeByTime(start, end types.Time) (int64, int64) {
 	return 0, 0
 }
 
+// flを含むように範囲を広げる。
+// 終了していない関数は、開始時刻を終了時刻とみなす。
+func (ir *IndexRecord) Add(fl *types.FuncLog) {
+	end := fl.EndTime
+	if !fl.IsEnded() {
+		end = fl.StartTime
+	}
+	ir.Merge(IndexRecord{
+		MinID:    int64(fl.ID),
+		MaxID:    int64(fl.ID),
+		MinStart: fl.StartTime,
+		MaxStart: fl.StartTime,
+		MinEnd:   end,
+		MaxEnd:   end,
+	})
+}
+
+// otherを含むように範囲を広げる。
+func (ir *IndexRecord) Merge(other IndexRecord) {
+	if other.MinID < ir.MinID {
+		ir.MinID = other.MinID
+	}
+	if ir.MaxID < other.MaxID {
+		ir.MaxID = other.MaxID
+	}
+	if other.MinStart < ir.MinStart {
+		ir.MinStart = other.MinStart
+	}
+	if ir.MaxStart < other.MaxStart {
+		ir.MaxStart = other.MaxStart
+	}
+	if other.MinEnd < ir.MinEnd {
+		ir.MinEnd = other.MinEnd
+	}
+	if ir.MaxEnd < other.MaxEnd {
+		ir.MaxEnd = other.MaxEnd
+	}
+}
+
+// FuncLogを1つも含んでいなければtrueを返す。
+func (ir *IndexRecord) IsEmpty() bool {
+	return ir.MaxID < ir.MinID
+}
+
+// otherの範囲を全て含んでいればtrueを返す。
+func (ir *IndexRecord) Covers(other IndexRecord) bool {
+	return ir.MinID <= other.MinID && other.MaxID <= ir.MaxID &&
+		ir.MinStart <= other.MinStart && other.MaxStart <= ir.MaxStart &&
+		ir.MinEnd <= other.MinEnd && other.MaxEnd <= ir.MaxEnd
+}
+
 func (ir *IndexRecord) IsOverlapID(start, end int64) bool {
 	return isOverlap(ir.MinID, ir.MaxID, start, end)
 }
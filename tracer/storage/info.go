@@ -1,11 +1,18 @@
 package storage
 
+import "fmt"
+
 type Version uint64
 
 // このプログラムが対応しているファイルフォーマットのバージョン
+// ファイルの構成やフォーマットを変更したときは、バージョンを上げて MigrationSteps に変換処理を追加すること。
+// 古いバージョンのままでも開けるのであれば MinorVersion を、開けないのであれば MajorVersion を上げる。
+//
+//	0.0: 初期のフォーマット
+//	0.1: セカンダリインデックス (*.gid.index, *.func.index, *.parent.index) と関数の統計情報 (*.funcstats) を追加
 const (
 	MajorVersion Version = 0
-	MinorVersion Version = 0
+	MinorVersion Version = 1
 )
 
 // 現在参照しているファイルフォーマットのバージョン
@@ -14,7 +21,27 @@ type Info struct {
 	MinorVersion Version
 }
 
+// CurrentInfo returns the version of file format that supported by this program.
+func CurrentInfo() Info {
+	return Info{
+		MajorVersion: MajorVersion,
+		MinorVersion: MinorVersion,
+	}
+}
+
 // このプログラムが対応しているバージョンであればtrueを返す。
 func (i Info) IsCompatible() bool {
 	return i.MajorVersion == MajorVersion
 }
+
+// iがotherよりも古いバージョンであればtrueを返す。
+func (i Info) Older(other Info) bool {
+	if i.MajorVersion != other.MajorVersion {
+		return i.MajorVersion < other.MajorVersion
+	}
+	return i.MinorVersion < other.MinorVersion
+}
+
+func (i Info) String() string {
+	return fmt.Sprintf("%d.%d", i.MajorVersion, i.MinorVersion)
+}
@@ -5,8 +5,10 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"math"
 	"math/rand"
 	"os"
+	"sort"
 	"sync"
 	"time"
 
@@ -22,7 +24,9 @@ const (
 )
 
 // 指定したLogIDに対応するログの作成・読み書き・削除を行う。
-// 現時点では完全なスレッドセーフではない。読み書きを複数のgoroutineから同時に行うのは推薦しない。
+// FuncLogとGoroutineの書き込みは、1つのgoroutineから行わなければならない。
+// 書き込みと並行して読み出す場合は、Snapshot()で作成したスナップショットを使用すること。
+// スナップショットからは、Sync()によってコミットされたレコードのみを読み出せる。
 // Open()するとMaxFileSize程度のオンメモリキャッシュが確保される。メモリ使用量に注意。
 //
 // ログは下記の5つから構成されている。RawFuncLogに関しては、MaxFileSizeに収まるようにファイルをローテーションされる。
@@ -45,6 +49,7 @@ type Log struct {
 	MaxFileSize int64
 	ReadOnly    bool
 
+	// 以下のフィールドは、Open()で置き換えられるため、lockを取得してからアクセスすること。
 	lock   sync.RWMutex
 	ctx    context.Context
 	cancel context.CancelFunc
@@ -55,10 +60,26 @@ type Log struct {
 
 	index   *Index
 	symbols *types.Symbols
-
-	funcLog      FuncLogStore
-	rawFuncLog   RawFuncLogStore
-	goroutineLog GoroutineStore
+	// symbolsがファイルに書き出されていなければtrue。
+	symbolsDirty bool
+	// セカンダリインデックス。
+	// インデックスファイルが存在しない場合はnilになる。
+	gidIndex  *PostingsIndex
+	funcIndex *PostingsIndex
+	// 呼び出し元から呼び出し先を引くインデックス。
+	// gidIndex, funcIndex よりも後に追加されたため、これらとは独立して有効/無効が決まる。
+	parentIndex *PostingsIndex
+	// 関数ごとの統計情報。
+	// 統計情報ファイルが存在しない場合はnilになる。
+	funcStats *FuncStatsStore
+	// ウォッチドッグが検出したイベント。
+	events *EventStore
+
+	// Open()するたびに新しいストアを作成する。
+	// スナップショットは作成時のストアを参照し続けるため、既存のストアを書き換えてはいけない。
+	funcLog      *FuncLogStore
+	rawFuncLog   *RawFuncLogStore
+	goroutineLog *GoroutineStore
 
 	// LogInfoが更新されたことを通知する
 	event logEvent
@@ -153,22 +174,82 @@ func (l *Log) Open() error {
 		}
 	}
 
+	// load secondary indexes
+	l.gidIndex = &PostingsIndex{
+		File:     l.Root.GoroutineIndexFile(l.ID),
+		ReadOnly: l.ReadOnly,
+	}
+	l.funcIndex = &PostingsIndex{
+		File:     l.Root.FuncIndexFile(l.ID),
+		ReadOnly: l.ReadOnly,
+	}
+	if l.gidIndex.File.Exists() && l.funcIndex.File.Exists() {
+		if err := l.gidIndex.Load(); err != nil {
+			return errors.Wrap(err, "failed to load GoroutineIndex")
+		}
+		if err := l.funcIndex.Load(); err != nil {
+			return errors.Wrap(err, "failed to load FuncIndex")
+		}
+	} else if l.ReadOnly || status != LogNotCreated {
+		// 既存のログにはインデックスが存在しない場合がある。
+		// 途中からインデックスを作成すると不完全なインデックスになってしまうため、インデックスを無効にする。
+		l.gidIndex = nil
+		l.funcIndex = nil
+	}
+	l.parentIndex = &PostingsIndex{
+		File:     l.Root.ParentIndexFile(l.ID),
+		ReadOnly: l.ReadOnly,
+	}
+	if l.parentIndex.File.Exists() {
+		if err := l.parentIndex.Load(); err != nil {
+			return errors.Wrap(err, "failed to load ParentIndex")
+		}
+	} else if l.ReadOnly || status != LogNotCreated {
+		l.parentIndex = nil
+	}
+
+	// load function statistics
+	l.funcStats = &FuncStatsStore{
+		File:     l.Root.FuncStatsFile(l.ID),
+		ReadOnly: l.ReadOnly,
+	}
+	if l.funcStats.File.Exists() {
+		if err := l.funcStats.Load(); err != nil {
+			return errors.Wrap(err, "failed to load FuncStats")
+		}
+	} else if l.ReadOnly || status != LogNotCreated {
+		// セカンダリインデックスと同様に、途中から集計すると不正確な統計情報になるため無効にする。
+		l.funcStats = nil
+	}
+
+	// load events
+	// イベントは途中から記録しても問題ないため、ファイルが存在しなくても有効にする。
+	l.events = &EventStore{
+		File:     l.Root.EventFile(l.ID),
+		ReadOnly: l.ReadOnly,
+	}
+	if l.events.File.Exists() {
+		if err := l.events.Load(); err != nil {
+			return errors.Wrap(err, "failed to load Events")
+		}
+	}
+
 	// open log files
-	l.funcLog = FuncLogStore{
+	l.funcLog = &FuncLogStore{
 		Store: Store{
 			File:       l.Root.FuncLogFile(l.ID, 0),
 			RecordSize: int(encoding.SizeFuncLog()),
 			ReadOnly:   l.ReadOnly,
 		},
 	}
-	l.rawFuncLog = RawFuncLogStore{
+	l.rawFuncLog = &RawFuncLogStore{
 		Store: Store{
 			File:       l.Root.RawFuncLogFile(l.ID, 0),
 			RecordSize: int(encoding.SizeRawFuncLog()),
 			ReadOnly:   l.ReadOnly,
 		},
 	}
-	l.goroutineLog = GoroutineStore{
+	l.goroutineLog = &GoroutineStore{
 		Store: Store{
 			File:       l.Root.GoroutineLogFile(l.ID, 0),
 			RecordSize: int(encoding.SizeGoroutine()),
@@ -185,6 +266,13 @@ func (l *Log) Open() error {
 	if err := l.goroutineLog.Open(); err != nil {
 		return err
 	}
+	if !l.ReadOnly && status == LogNotCreated {
+		// 全てのファイルを作成しておく。
+		// これにより、Close()する前にクラッシュしてもログを開くことができる。
+		if err := l.saveNolock(); err != nil {
+			return err
+		}
+	}
 
 	if !l.ReadOnly {
 		// 書き込み可能なので、定期的にMetadataのタイムスタンプを更新する必要がある。。
@@ -201,6 +289,23 @@ func (l *Log) Close() error {
 
 	l.wg.Wait()
 
+	if err := l.closeFiles(); err != nil {
+		return err
+	}
+	// 書き込み中のgoroutineは、ストアのロックを保持したまま AddPostings() などを呼び出す。
+	// デッドロックを避けるため、ストアはlockを解放してから閉じる。
+	funcLog, rawFuncLog, goroutineLog := l.stores()
+	if err := funcLog.Close(); err != nil {
+		return err
+	}
+	if err := rawFuncLog.Close(); err != nil {
+		return err
+	}
+	return goroutineLog.Close()
+}
+
+// closeFiles は、ストア以外のファイルを書き出して閉じる。
+func (l *Log) closeFiles() error {
 	l.lock.Lock()
 	defer l.lock.Unlock()
 	l.closed = true
@@ -208,6 +313,30 @@ func (l *Log) Close() error {
 	if err := l.index.Close(); err != nil {
 		return err
 	}
+	if !l.ReadOnly && l.gidIndex != nil {
+		if err := l.gidIndex.Save(); err != nil {
+			return err
+		}
+		if err := l.funcIndex.Save(); err != nil {
+			return err
+		}
+	}
+	if !l.ReadOnly && l.parentIndex != nil {
+		if err := l.parentIndex.Save(); err != nil {
+			return err
+		}
+	}
+	if !l.ReadOnly && l.funcStats != nil {
+		// 同じ統計情報が何度も追記されているため、1つのセグメントにまとめる。
+		if err := l.funcStats.Compact(); err != nil {
+			return err
+		}
+	}
+	if !l.ReadOnly {
+		if err := l.events.Save(); err != nil {
+			return err
+		}
+	}
 	// 書き込み可能ならClose()する。
 	// 読み込み専用のときは、l.symbolsWriter==nilなのでClose()しない。
 	if !l.ReadOnly {
@@ -215,26 +344,86 @@ func (l *Log) Close() error {
 			return err
 		}
 	}
-	if err := l.funcLog.Close(); err != nil {
-		return err
+	return l.saveMetadataNolock()
+}
+
+// バッファリングされているデータを書き出し、ストレージと同期する。
+// Sync()が完了した時点までに書き込まれたデータは、プロセスがクラッシュしても失われない。
+func (l *Log) Sync() error {
+	if l.ReadOnly {
+		return nil
 	}
-	if err := l.rawFuncLog.Close(); err != nil {
-		return err
+	funcLog, rawFuncLog, goroutineLog := l.stores()
+	if err := funcLog.Sync(); err != nil {
+		return errors.Wrap(err, "failed to sync FuncLog")
 	}
-	if err := l.goroutineLog.Close(); err != nil {
-		return err
+	if err := rawFuncLog.Sync(); err != nil {
+		return errors.Wrap(err, "failed to sync RawFuncLog")
+	}
+	if err := goroutineLog.Sync(); err != nil {
+		return errors.Wrap(err, "failed to sync Goroutine")
+	}
+	// 書き込んだレコードをスナップショットから読み出せるようにする。
+	if err := funcLog.Commit(); err != nil {
+		return errors.Wrap(err, "failed to commit FuncLog")
+	}
+	if err := goroutineLog.Commit(); err != nil {
+		return errors.Wrap(err, "failed to commit Goroutine")
 	}
 
-	// write MetaData
-	w, err := l.Root.MetaFile(l.ID).OpenWriteOnly()
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if l.closed {
+		return os.ErrClosed
+	}
+	return l.saveNolock()
+}
+
+// Index, Symbols, Metadataをファイルへ書き出す。
+// 各ファイルはatomicに更新される。
+func (l *Log) saveNolock() error {
+	if err := l.index.Save(); err != nil {
+		return errors.Wrap(err, "failed to save Index")
+	}
+	if l.symbolsDirty || !l.Root.SymbolFile(l.ID).Exists() {
+		if err := l.symbolsStore().Write(l.symbols); err != nil {
+			return err
+		}
+		l.symbolsDirty = false
+	}
+	if l.gidIndex != nil {
+		if err := l.gidIndex.Save(); err != nil {
+			return errors.Wrap(err, "failed to save GoroutineIndex")
+		}
+		if err := l.funcIndex.Save(); err != nil {
+			return errors.Wrap(err, "failed to save FuncIndex")
+		}
+	}
+	if l.parentIndex != nil {
+		if err := l.parentIndex.Save(); err != nil {
+			return errors.Wrap(err, "failed to save ParentIndex")
+		}
+	}
+	if l.funcStats != nil {
+		if err := l.funcStats.Save(); err != nil {
+			return errors.Wrap(err, "failed to save FuncStats")
+		}
+	}
+	if err := l.events.Save(); err != nil {
+		return errors.Wrap(err, "failed to save Events")
+	}
+	return l.saveMetadataNolock()
+}
+
+func (l *Log) saveMetadataNolock() error {
+	data, err := json.Marshal(l.Metadata)
 	if err != nil {
-		return errors.New("can not open meta data file: " + err.Error())
+		return errors.New("can not encode meta data: " + err.Error())
 	}
-	if err := json.NewEncoder(w).Encode(l.Metadata); err != nil {
-		w.Close() // nolint: errcheck
+	if err := l.Root.MetaFile(l.ID).WriteAll(data); err != nil {
 		return errors.New("can not write meta data file: " + err.Error())
 	}
-	return w.Close()
+	return nil
 }
 
 // Logの状態を確認する。
@@ -283,29 +472,54 @@ func (l *Log) Remove() error {
 	if err := l.Root.SymbolFile(l.ID).Remove(); err != nil {
 		return fmt.Errorf("failed to remove the Symbol(%s): %s", l.ID, err.Error())
 	}
+	for _, file := range []File{l.Root.GoroutineIndexFile(l.ID), l.Root.FuncIndexFile(l.ID), l.Root.ParentIndexFile(l.ID)} {
+		if !file.Exists() {
+			continue
+		}
+		if err := file.Remove(); err != nil {
+			return fmt.Errorf("failed to remove the secondary index(%s): %s", l.ID, err.Error())
+		}
+	}
+	if file := l.Root.FuncStatsFile(l.ID); file.Exists() {
+		if err := file.Remove(); err != nil {
+			return fmt.Errorf("failed to remove the FuncStats(%s): %s", l.ID, err.Error())
+		}
+	}
+	if file := l.Root.EventFile(l.ID); file.Exists() {
+		if err := file.Remove(); err != nil {
+			return fmt.Errorf("failed to remove the Events(%s): %s", l.ID, err.Error())
+		}
+	}
 	return nil
 }
 
 // 指定した期間のFuncLogを返す。
-// この操作を実行中、他の操作はブロックされる。
+// スナップショットから読み出すため、書き込み処理をブロックしない。
 func (l *Log) SearchFuncLog(start, end types.Time, fn func(fl types.FuncLog) error) error {
-	l.lock.RLock()
-	defer l.lock.RUnlock()
+	snapshot, err := l.Snapshot()
+	if err != nil {
+		return err
+	}
 
-	startIdx, endIdx := l.index.IDRangeByTime(start, end)
-	if endIdx == 0 {
-		endIdx = l.funcLog.Records()
+	var startIdx, endIdx int64
+	l.Index(func(index *Index) {
+		startIdx, endIdx = index.IDRangeByTime(start, end)
+	})
+	if endIdx == 0 || snapshot.FuncLogRecords() <= endIdx {
+		endIdx = snapshot.FuncLogRecords()
+	} else {
+		// IDRangeByTime()が返す範囲は閉区間なので、endIdxのレコードも含める。
+		endIdx++
 	}
 
-	l.funcLog.Lock()
-	defer l.funcLog.Unlock()
 	for i := startIdx; i < endIdx; i++ {
-		var fl types.FuncLog
-		err := l.funcLog.Get(types.FuncLogID(i), &fl)
+		// fnがレコードを保持し続ける可能性があるため、FuncLogPoolには返却しない。
+		fl := types.FuncLogPool.Get().(*types.FuncLog)
+		err := snapshot.FuncLog(types.FuncLogID(i), fl)
 		if err != nil {
 			return err
 		}
-		err = fn(fl)
+		err = fn(*fl)
 		if err != nil {
 			return err
 		}
@@ -313,22 +527,88 @@ func (l *Log) SearchFuncLog(start, end types.Time, fn func(fl types.FuncLog) err
 	return nil
 }
 
+// RunningFuncLogs は、スナップショットに含まれる実行中のFuncLogを、goroutineごとに返す。
+// スライスはスタックの底 (最初に呼び出された関数) から順に並んでいる。
+// gidsを指定した場合は、それらのgoroutineのFuncLogのみを返す。
+// セカンダリインデックスが有効であれば、読み出すレコードをインデックスで絞り込む。
+func (l *Log) RunningFuncLogs(snapshot *LogSnapshot, gids ...types.GID) (map[types.GID][]*types.FuncLog, error) {
+	targets := make(map[types.GID]bool, len(gids))
+	for _, gid := range gids {
+		targets[gid] = true
+	}
+	ids, ok := []types.FuncLogID(nil), false
+	if len(gids) > 0 {
+		ids, ok = l.FuncLogIDsByGID(gids...)
+	}
+	if !ok {
+		// 全てのレコードを読み出す。
+		ids = make([]types.FuncLogID, snapshot.FuncLogRecords())
+		for i := range ids {
+			ids[i] = types.FuncLogID(i)
+		}
+	}
+
+	stacks := map[types.GID][]*types.FuncLog{}
+	for _, id := range ids {
+		if snapshot.FuncLogRecords() <= int64(id) {
+			// インデックスには、スナップショットの作成後に追加されたレコードが含まれる場合がある。
+			break
+		}
+		fl := types.FuncLogPool.Get().(*types.FuncLog)
+		if err := snapshot.FuncLog(id, fl); err != nil {
+			types.FuncLogPool.Put(fl)
+			return nil, err
+		}
+		if fl.IsEnded() || (len(targets) > 0 && !targets[fl.GID]) {
+			types.FuncLogPool.Put(fl)
+			continue
+		}
+		// 呼び出し先の関数は、呼び出し元の関数よりも大きなIDを持つ。
+		// IDの昇順に追加すれば、スタックの底から順に並ぶ。
+		stacks[fl.GID] = append(stacks[fl.GID], fl)
+	}
+	return stacks, nil
+}
+
+// Snapshot は、現時点でコミットされているレコードを読み出すスナップショットを作成する。
+func (l *Log) Snapshot() (*LogSnapshot, error) {
+	l.lock.RLock()
+	defer l.lock.RUnlock()
+	if l.closed {
+		return nil, os.ErrClosed
+	}
+	return &LogSnapshot{
+		funcLog:      newSnapshotReader(&l.funcLog.Store),
+		goroutineLog: newSnapshotReader(&l.goroutineLog.Store),
+	}, nil
+}
+
+// stores は、現在開いているストアを返す。
+func (l *Log) stores() (*FuncLogStore, *RawFuncLogStore, *GoroutineStore) {
+	l.lock.RLock()
+	defer l.lock.RUnlock()
+	return l.funcLog, l.rawFuncLog, l.goroutineLog
+}
+
 func (l *Log) FuncLog(fn func(store *FuncLogStore)) {
-	l.funcLog.Lock()
-	defer l.funcLog.Unlock()
-	fn(&l.funcLog)
+	store, _, _ := l.stores()
+	store.Lock()
+	defer store.Unlock()
+	fn(store)
 }
 
 func (l *Log) RawFuncLog(fn func(store *RawFuncLogStore)) {
-	l.rawFuncLog.Lock()
-	defer l.rawFuncLog.Unlock()
-	fn(&l.rawFuncLog)
+	_, store, _ := l.stores()
+	store.Lock()
+	defer store.Unlock()
+	fn(store)
 }
 
 func (l *Log) Goroutine(fn func(store *GoroutineStore)) {
-	l.goroutineLog.Lock()
-	defer l.goroutineLog.Unlock()
-	fn(&l.goroutineLog)
+	_, _, store := l.stores()
+	store.Lock()
+	defer store.Unlock()
+	fn(store)
 }
 
 func (l *Log) Index(fn func(index *Index)) {
@@ -337,6 +617,25 @@ func (l *Log) Index(fn func(index *Index)) {
 	fn(l.index)
 }
 
+// 書き込んだFuncLogの範囲をIndexに反映する。
+// 現在はFuncLogファイルが1つしかないため、IndexRecordは常に1つである。
+func (l *Log) MergeIndex(ir IndexRecord) error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if l.closed {
+		return os.ErrClosed
+	}
+	if ir.IsEmpty() {
+		return nil
+	}
+	if l.index.Len() == 0 {
+		return l.index.Append(ir)
+	}
+	last := l.index.Last()
+	last.Merge(ir)
+	return l.index.UpdateLast(last)
+}
+
 func (l *Log) IndexLen() int64 {
 	l.lock.RLock()
 	defer l.lock.RUnlock()
@@ -352,10 +651,150 @@ func (l *Log) SetSymbolsData(data *types.SymbolsData) error {
 	}
 
 	l.symbols.Load(*data)
+	l.symbolsDirty = true
+	return nil
+}
+
+// FuncLogをセカンダリインデックスに追加する。
+// インデックスが無効な場合は何もしない。
+func (l *Log) AddPostings(fl *types.FuncLog) error {
+	l.lock.RLock()
+	defer l.lock.RUnlock()
+	if l.gidIndex != nil {
+		if err := AddFuncLogPostings(l.gidIndex, l.funcIndex, fl); err != nil {
+			return err
+		}
+	}
+	if l.parentIndex != nil {
+		return AddParentPostings(l.parentIndex, fl)
+	}
 	return nil
 }
 
+// 指定したFuncLogから直接呼び出されたFuncLogのIDを、昇順に並べて返す。
+// 呼び出し元のインデックスが無効な場合は、okがfalseになる。
+func (l *Log) ChildFuncLogIDs(parent types.FuncLogID) (ids []types.FuncLogID, ok bool) {
+	l.lock.RLock()
+	defer l.lock.RUnlock()
+	if l.parentIndex == nil {
+		return nil, false
+	}
+	return l.parentIndex.Get(uint64(parent)), true
+}
+
+// 指定したGoroutineのいずれかで実行されたFuncLogのIDを、昇順に並べて返す。
+// セカンダリインデックスが無効な場合は、okがfalseになる。
+func (l *Log) FuncLogIDsByGID(gids ...types.GID) (ids []types.FuncLogID, ok bool) {
+	l.lock.RLock()
+	defer l.lock.RUnlock()
+	if l.gidIndex == nil {
+		return nil, false
+	}
+	keys := make([]uint64, len(gids))
+	for i := range gids {
+		keys[i] = uint64(gids[i])
+	}
+	return l.gidIndex.Get(keys...), true
+}
+
+// 指定した関数のいずれかをフレームに含むFuncLogのIDを、昇順に並べて返す。
+// セカンダリインデックスが無効な場合は、okがfalseになる。
+func (l *Log) FuncLogIDsByFuncName(names ...string) (ids []types.FuncLogID, ok bool) {
+	l.lock.RLock()
+	defer l.lock.RUnlock()
+	if l.funcIndex == nil {
+		return nil, false
+	}
+
+	// 関数名から、その関数に含まれるPCの範囲を求める。
+	// Symbols.GoFunc() と同じく、関数は次の関数のエントリポイントか、モジュールの終端までの範囲に含まれる。
+	type pcRange struct{ min, max uint64 }
+	var ranges []pcRange
+	l.symbols.Save(func(data types.SymbolsData) error { // nolint: errcheck
+		// Funcsがエントリポイント順に並んでいるとは限らないため、ソートしたコピーを使用する。
+		funcs := make([]types.GoFunc, len(data.Funcs))
+		copy(funcs, data.Funcs)
+		sort.Slice(funcs, func(i, j int) bool {
+			return funcs[i].Entry < funcs[j].Entry
+		})
+		for i, f := range funcs {
+			for _, name := range names {
+				if f.Name != name {
+					continue
+				}
+				r := pcRange{min: uint64(f.Entry), max: math.MaxUint64}
+				if i+1 < len(funcs) {
+					r.max = uint64(funcs[i+1].Entry) - 1
+				}
+				for _, m := range data.Mods {
+					if m.MinPC <= f.Entry && f.Entry <= m.MaxPC && uint64(m.MaxPC) < r.max {
+						r.max = uint64(m.MaxPC)
+					}
+				}
+				ranges = append(ranges, r)
+			}
+		}
+		return nil
+	})
+
+	var lists [][]types.FuncLogID
+	for _, r := range ranges {
+		lists = append(lists, l.funcIndex.GetRange(r.min, r.max))
+	}
+	return mergePostings(lists), true
+}
+
+// 実行が終了したFuncLogを、関数ごとの統計情報に追加する。
+// 統計情報が無効な場合は何もしない。
+func (l *Log) AddFuncStats(fls []*types.FuncLog) error {
+	l.lock.RLock()
+	defer l.lock.RUnlock()
+	if l.funcStats == nil {
+		return nil
+	}
+	return l.funcStats.AddFuncLogs(fls)
+}
+
+// 関数ごとの統計情報を返す。
+// 統計情報が無効な場合は、okがfalseになる。
+func (l *Log) FuncStats() (stats []types.FuncStats, ok bool) {
+	l.lock.RLock()
+	defer l.lock.RUnlock()
+	if l.funcStats == nil {
+		return nil, false
+	}
+	return MergeFuncStats(l.funcStats.Stats(), l.symbols), true
+}
+
+// 呼び出し元と呼び出し先の関数の組ごとの統計情報を返す。
+// 統計情報が無効な場合は、okがfalseになる。
+func (l *Log) CallEdges() (edges []types.CallEdge, ok bool) {
+	l.lock.RLock()
+	defer l.lock.RUnlock()
+	if l.funcStats == nil {
+		return nil, false
+	}
+	return MergeCallEdges(l.funcStats.Edges(), l.symbols), true
+}
+
+// ウォッチドッグが検出したイベントを追加する。
+// 追加したイベントは、Sync()またはClose()を呼び出したときにファイルへ書き出される。
+func (l *Log) AddEvents(events ...types.Event) error {
+	l.lock.RLock()
+	defer l.lock.RUnlock()
+	return l.events.Add(events...)
+}
+
+// ウォッチドッグが検出したイベントを、検出した順に返す。
+func (l *Log) Events() []types.Event {
+	l.lock.RLock()
+	defer l.lock.RUnlock()
+	return l.events.Events()
+}
+
 func (l *Log) Symbols() *types.Symbols {
+	l.lock.RLock()
+	defer l.lock.RUnlock()
 	return l.symbols
 }
 
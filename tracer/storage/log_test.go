@@ -4,6 +4,8 @@ import (
 	"io/ioutil"
 	"math/rand"
 	"os"
+	"sync"
+	"sync/atomic"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -92,13 +94,17 @@ func TestLog_AppendRawFuncLog(t *testing.T) {
 	//   xxxx.0.rawfunc.log
 	//   xxxx.0.goroutine.log
 	//   xxxx.index
+	//   xxxx.gid.index
+	//   xxxx.func.index
+	//   xxxx.parent.index
+	//   xxxx.funcstats
 	//   xxxx.symbol
 	files, err := ioutil.ReadDir(dirlayout.DataDir())
 	a.NoError(err)
 	for i := range files {
 		t.Logf("files[%d] = %s", i, files[i].Name())
 	}
-	a.Len(files, 5)
+	a.Len(files, 9)
 }
 
 // Logで書き込みながら、Logで正しく読み込めるかテスト。
@@ -146,3 +152,100 @@ func TestLog_ReadDuringWriting(t *testing.T) {
 	})
 	a.NoError(l.Close())
 }
+
+// 書き込みと再オープンの最中に、インデックスとスナップショットを使って検索できるか。
+func TestLog_SearchDuringReopen(t *testing.T) {
+	a := assert.New(t)
+	tempdir, err := ioutil.TempDir("", ".goapptrace_storage")
+	a.NoError(err)
+	defer a.NoError(os.RemoveAll(tempdir))
+	dirlayout := DirLayout{Root: tempdir}
+	a.NoError(dirlayout.Init())
+
+	l := Log{
+		ID:       LogID{},
+		Root:     dirlayout,
+		Metadata: &types.LogMetadata{},
+	}
+	a.NoError(l.Open())
+
+	// 再オープン中は奇数になる。
+	var generation int64
+	var wg sync.WaitGroup
+	done := make(chan struct{})
+	search := func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			gen := atomic.LoadInt64(&generation)
+			err := func() error {
+				snapshot, err := l.Snapshot()
+				if err != nil {
+					return err
+				}
+				ids, _ := l.FuncLogIDsByGID(1)
+				for _, id := range ids {
+					if snapshot.FuncLogRecords() <= int64(id) {
+						break
+					}
+					fl := types.FuncLogPool.Get().(*types.FuncLog)
+					if err := snapshot.FuncLog(id, fl); err != nil {
+						return err
+					}
+					a.Equal(types.GID(1), fl.GID)
+					types.FuncLogPool.Put(fl)
+				}
+				l.FuncStats()
+				l.Events()
+				return nil
+			}()
+			if err != nil && gen%2 == 0 && gen == atomic.LoadInt64(&generation) {
+				// 再オープンしていないときは、エラーが発生してはいけない。
+				a.NoError(err)
+				return
+			}
+		}
+	}
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go search()
+	}
+
+	for i := 0; i < 1000; i++ {
+		fl := types.FuncLog{
+			ID:        types.FuncLogID(i),
+			StartTime: types.Time(i),
+			EndTime:   types.Time(i + 1),
+			ParentID:  types.NotFoundParent,
+			GID:       types.GID(i%2 + 1),
+			Frames:    []uintptr{100},
+		}
+		l.FuncLog(func(store *FuncLogStore) {
+			a.NoError(store.SetNolock(&fl))
+			a.NoError(l.AddPostings(&fl))
+		})
+		a.NoError(l.AddFuncStats([]*types.FuncLog{&fl}))
+		if i%100 == 99 {
+			a.NoError(l.Sync())
+		}
+	}
+
+	for i := 0; i < 3; i++ {
+		atomic.AddInt64(&generation, 1)
+		a.NoError(l.Close())
+		l.ReadOnly = true
+		a.NoError(l.Open())
+		atomic.AddInt64(&generation, 1)
+	}
+	close(done)
+	wg.Wait()
+
+	ids, ok := l.FuncLogIDsByGID(1)
+	a.True(ok)
+	a.Len(ids, 500)
+	a.NoError(l.Close())
+}
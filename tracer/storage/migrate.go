@@ -0,0 +1,210 @@
+package storage
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/yuuki0xff/goapptrace/config"
+)
+
+var (
+	ErrNeedMigration    = errors.New("data format is old. please run 'goapptrace server migrate'")
+	ErrNoMigrationPath  = errors.New("migration path not found")
+	ErrBackupDirExists  = errors.New("backup directory already exists")
+	ErrBackupDirInvalid = errors.New("backup directory must not be inside of the storage directory")
+)
+
+// MigrationStep は、ファイルフォーマットを From から To へ変換する処理である。
+// To は From よりも新しいバージョンでなければならない。
+type MigrationStep struct {
+	From Info
+	To   Info
+	// 変換処理の概要。dry-runの出力に使用する。
+	Description string
+	// ディレクトリ内のファイルを変換する。
+	// info.jsonの更新はMigratorが行うため、この関数内で更新する必要はない。
+	Migrate func(d DirLayout) error
+}
+
+// MigrationSteps は、過去のファイルフォーマットから現在のフォーマットへ変換するための処理の一覧である。
+// ファイルフォーマットを変更したときは、ここに変換処理を追加すること。
+var MigrationSteps = []MigrationStep{
+	{
+		From:        Info{MajorVersion: 0, MinorVersion: 0},
+		To:          Info{MajorVersion: 0, MinorVersion: 1},
+		Description: "build secondary indexes and function statistics of all logs",
+		Migrate: func(d DirLayout) error {
+			return forEachLog(d, func(id LogID) error {
+				if err := BuildPostings(d, id); err != nil {
+					return errors.Wrapf(err, "failed to build indexes of Log(%s)", id.Hex())
+				}
+				if err := BuildFuncStats(d, id); err != nil {
+					return errors.Wrapf(err, "failed to build function statistics of Log(%s)", id.Hex())
+				}
+				return nil
+			})
+		},
+	},
+}
+
+// Migrator は、古いファイルフォーマットのディレクトリを新しいフォーマットへ変換する。
+type Migrator struct {
+	Root DirLayout
+	// 使用する変換処理の一覧。nilの場合は MigrationSteps を使用する。
+	Steps []MigrationStep
+	// 変換後のバージョン。ゼロ値の場合は CurrentInfo() を使用する。
+	Target Info
+	// trueの場合、変換処理の計画だけを行い、ファイルを変更しない。
+	DryRun bool
+	// 空文字列でない場合、変換を始める前にRoot以下の全てのファイルをこのディレクトリへコピーする。
+	BackupDir string
+}
+
+// Plan は、現在のバージョンからTargetまでに実行する変換処理の一覧を返す。
+// 変換の必要がない場合は、空のスライスを返す。
+func (m *Migrator) Plan() ([]MigrationStep, error) {
+	info, err := m.Root.ReadInfo()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read info file")
+	}
+	return m.plan(info)
+}
+
+// Migrate は、ファイルフォーマットをTargetまで変換し、実行した変換処理の一覧を返す。
+// DryRunが有効な場合は、実行される予定の変換処理の一覧を返す。
+func (m *Migrator) Migrate() ([]MigrationStep, error) {
+	steps, err := m.Plan()
+	if err != nil {
+		return nil, err
+	}
+	if m.DryRun || len(steps) == 0 {
+		return steps, nil
+	}
+
+	if m.BackupDir != "" {
+		if err := m.backup(); err != nil {
+			return nil, errors.Wrap(err, "failed to backup")
+		}
+	}
+	for i, step := range steps {
+		if err := step.Migrate(m.Root); err != nil {
+			return steps[:i], errors.Wrapf(err, "failed to migrate from %s to %s", step.From, step.To)
+		}
+		// 途中で失敗しても再開できるように、1ステップ毎にバージョンを記録する。
+		if err := m.Root.WriteInfo(step.To); err != nil {
+			return steps[:i], errors.Wrap(err, "failed to update info file")
+		}
+	}
+	return steps, nil
+}
+
+func (m *Migrator) plan(info Info) ([]MigrationStep, error) {
+	target := m.target()
+	all := m.Steps
+	if all == nil {
+		all = MigrationSteps
+	}
+
+	var steps []MigrationStep
+	for info.Older(target) {
+		found := false
+		for _, step := range all {
+			if step.From == info {
+				steps = append(steps, step)
+				info = step.To
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, errors.Wrapf(ErrNoMigrationPath, "from %s to %s", info, target)
+		}
+	}
+	if info != target {
+		return nil, errors.Wrapf(ErrNoMigrationPath, "from %s to %s", info, target)
+	}
+	return steps, nil
+}
+
+func (m *Migrator) target() Info {
+	if m.Target == (Info{}) {
+		return CurrentInfo()
+	}
+	return m.Target
+}
+
+// backup は、Root以下の全てのファイルをBackupDirにコピーする。
+func (m *Migrator) backup() error {
+	src, err := filepath.Abs(m.Root.Root)
+	if err != nil {
+		return err
+	}
+	dst, err := filepath.Abs(m.BackupDir)
+	if err != nil {
+		return err
+	}
+	if dst == src || strings.HasPrefix(dst, src+string(filepath.Separator)) {
+		return ErrBackupDirInvalid
+	}
+	if _, err := os.Stat(dst); err == nil {
+		return errors.Wrap(ErrBackupDirExists, dst)
+	}
+
+	return filepath.Walk(src, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, p)
+		if err != nil {
+			return err
+		}
+		to := filepath.Join(dst, rel)
+		if info.IsDir() {
+			return os.MkdirAll(to, config.DefaultDirPerm)
+		}
+		return copyFile(p, to)
+	})
+}
+
+// forEachLog は、ディレクトリ内の全てのログのIDをfn()に渡す。
+func forEachLog(d DirLayout, fn func(id LogID) error) error {
+	files, err := ioutil.ReadDir(d.MetaDir())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	for _, finfo := range files {
+		id, ok := d.Fname2LogID(finfo.Name())
+		if !ok {
+			continue
+		}
+		if err := fn(id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func copyFile(from, to string) error {
+	r, err := os.Open(from)
+	if err != nil {
+		return err
+	}
+	defer r.Close() // nolint: errcheck
+
+	w, err := os.OpenFile(to, os.O_CREATE|os.O_WRONLY|os.O_EXCL, config.DefaultFilePerm)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(w, r); err != nil {
+		w.Close() // nolint: errcheck
+		return err
+	}
+	return w.Close()
+}
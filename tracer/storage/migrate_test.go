@@ -0,0 +1,217 @@
+package storage
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/yuuki0xff/goapptrace/tracer/types"
+)
+
+// testdata/v0.0 は、v0.0のgoapptraceで記録したログである。
+// 1つのログが含まれており、main.main()から main.foo() を2回呼び出している。
+// また、別のgoroutineで main.bar() を2回呼び出しており、2回目の呼び出しは実行中である。
+const fixtureDir = "testdata/v0.0"
+
+var fixtureLogID = func() LogID {
+	id, ok := DirLayout{}.Fname2LogID("7e76e209ee33d047c6e159b9d11b13cd.meta.json")
+	if !ok {
+		panic("invalid log id")
+	}
+	return id
+}()
+
+// withFixture は、testdata/v0.0 をコピーし、指定したバージョンのディレクトリを作成する。
+func withFixture(t *testing.T, info Info, fn func(d DirLayout)) {
+	a := assert.New(t)
+	tempdir, err := ioutil.TempDir("", ".goapptrace_storage")
+	a.NoError(err)
+	defer func() {
+		a.NoError(os.RemoveAll(tempdir))
+	}()
+
+	d := DirLayout{Root: path.Join(tempdir, "logs")}
+	a.NoError(copyDir(fixtureDir, d.Root))
+	a.NoError(d.WriteInfo(info))
+	fn(d)
+}
+
+func copyDir(from, to string) error {
+	return filepath.Walk(from, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(from, p)
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return os.MkdirAll(path.Join(to, rel), 0700)
+		}
+		return copyFile(p, path.Join(to, rel))
+	})
+}
+
+// hasSecondaryIndexes は、v0.1で追加されたファイルが全て存在する場合にtrueを返す。
+func hasSecondaryIndexes(d DirLayout, id LogID) bool {
+	return d.GoroutineIndexFile(id).Exists() &&
+		d.FuncIndexFile(id).Exists() &&
+		d.ParentIndexFile(id).Exists() &&
+		d.FuncStatsFile(id).Exists()
+}
+
+func TestMigrationSteps(t *testing.T) {
+	withFixture(t, Info{}, func(d DirLayout) {
+		a := assert.New(t)
+		id := fixtureLogID
+
+		// マイナーバージョンが古いだけなので、変換しなくても開くことができる。
+		// ただし、セカンダリインデックスと統計情報は使用できない。
+		a.NoError(d.Init())
+		l := Log{ID: id, Root: d, ReadOnly: true}
+		a.NoError(l.Open())
+		_, ok := l.FuncLogIDsByGID(1)
+		a.False(ok)
+		_, ok = l.FuncStats()
+		a.False(ok)
+		a.NoError(l.Close())
+
+		m := Migrator{Root: d}
+		steps, err := m.Migrate()
+		a.NoError(err)
+		a.Len(steps, 1)
+		info, err := d.ReadInfo()
+		a.NoError(err)
+		a.Equal(CurrentInfo(), info)
+		a.True(hasSecondaryIndexes(d, id))
+
+		l = Log{ID: id, Root: d, ReadOnly: true}
+		a.NoError(l.Open())
+		defer func() {
+			a.NoError(l.Close())
+		}()
+		ids, ok := l.FuncLogIDsByGID(1)
+		a.True(ok)
+		a.Equal([]types.FuncLogID{0, 1, 2}, ids)
+		ids, ok = l.FuncLogIDsByGID(2)
+		a.True(ok)
+		a.Equal([]types.FuncLogID{3, 4}, ids)
+		ids, ok = l.FuncLogIDsByFuncName("main.foo")
+		a.True(ok)
+		a.Equal([]types.FuncLogID{1, 2}, ids)
+		ids, ok = l.ChildFuncLogIDs(0)
+		a.True(ok)
+		a.Equal([]types.FuncLogID{1, 2}, ids)
+
+		// 実行中の関数呼び出しは集計されない。
+		stats, ok := l.FuncStats()
+		a.True(ok)
+		a.Len(stats, 3)
+		byName := map[string]types.FuncStats{}
+		for _, st := range stats {
+			byName[st.Name] = st
+		}
+		a.Equal(int64(1), byName["main.main"].Calls)
+		a.Equal(types.Time(90), byName["main.main"].TotalTime)
+		a.Equal(types.Time(30), byName["main.main"].SelfTime)
+		a.Equal(int64(2), byName["main.foo"].Calls)
+		a.Equal(types.Time(60), byName["main.foo"].TotalTime)
+		a.Equal(types.Time(60), byName["main.foo"].SelfTime)
+		a.Equal(int64(1), byName["main.bar"].Calls)
+		a.Equal(types.Time(10), byName["main.bar"].TotalTime)
+		edges, ok := l.CallEdges()
+		a.True(ok)
+		a.Len(edges, 1)
+		a.Equal("main.main", edges[0].CallerName)
+		a.Equal("main.foo", edges[0].CalleeName)
+		a.Equal(int64(2), edges[0].Calls)
+	})
+}
+
+func TestMigrator_Migrate(t *testing.T) {
+	t.Run("up-to-date", func(t *testing.T) {
+		withFixture(t, CurrentInfo(), func(d DirLayout) {
+			a := assert.New(t)
+			m := Migrator{Root: d}
+			steps, err := m.Migrate()
+			a.NoError(err)
+			a.Len(steps, 0)
+			a.False(d.FuncStatsFile(fixtureLogID).Exists())
+		})
+	})
+	t.Run("dry-run", func(t *testing.T) {
+		withFixture(t, Info{}, func(d DirLayout) {
+			a := assert.New(t)
+			m := Migrator{
+				Root:   d,
+				DryRun: true,
+			}
+			steps, err := m.Migrate()
+			a.NoError(err)
+			a.Len(steps, 1)
+
+			info, err := d.ReadInfo()
+			a.NoError(err)
+			a.Equal(Info{}, info)
+			a.False(d.GoroutineIndexFile(fixtureLogID).Exists())
+			a.False(d.FuncStatsFile(fixtureLogID).Exists())
+		})
+	})
+	t.Run("backup", func(t *testing.T) {
+		withFixture(t, Info{}, func(d DirLayout) {
+			a := assert.New(t)
+			backup := path.Join(path.Dir(d.Root), "backup")
+			m := Migrator{
+				Root:      d,
+				BackupDir: backup,
+			}
+			_, err := m.Migrate()
+			a.NoError(err)
+			a.True(hasSecondaryIndexes(d, fixtureLogID))
+
+			bd := DirLayout{Root: backup}
+			info, err := bd.ReadInfo()
+			a.NoError(err)
+			a.Equal(Info{}, info)
+			a.True(bd.FuncLogFile(fixtureLogID, 0).Exists())
+			a.False(bd.GoroutineIndexFile(fixtureLogID).Exists())
+			a.False(bd.FuncStatsFile(fixtureLogID).Exists())
+
+			// バックアップ先が既に存在する場合は失敗する。
+			a.NoError(d.WriteInfo(Info{}))
+			_, err = m.Migrate()
+			a.Error(err)
+			a.Equal(ErrBackupDirExists, errors.Cause(err))
+		})
+	})
+	t.Run("no-path", func(t *testing.T) {
+		withFixture(t, Info{MajorVersion: 0, MinorVersion: 5}, func(d DirLayout) {
+			a := assert.New(t)
+			m := Migrator{Root: d}
+			_, err := m.Migrate()
+			a.Error(err)
+			a.Equal(ErrNoMigrationPath, errors.Cause(err))
+		})
+	})
+}
+
+func TestDirLayout_Init(t *testing.T) {
+	t.Run("newer-version", func(t *testing.T) {
+		withFixture(t, Info{MajorVersion: MajorVersion + 1}, func(d DirLayout) {
+			a := assert.New(t)
+			err := d.Init()
+			a.Error(err)
+			a.NotEqual(ErrNeedMigration, errors.Cause(err))
+		})
+	})
+	t.Run("current-version", func(t *testing.T) {
+		withFixture(t, CurrentInfo(), func(d DirLayout) {
+			a := assert.New(t)
+			a.NoError(d.Init())
+		})
+	})
+}
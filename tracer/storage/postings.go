@@ -0,0 +1,352 @@
+package storage
+
+import (
+	"encoding/binary"
+	"sort"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/yuuki0xff/goapptrace/tracer/encoding"
+	"github.com/yuuki0xff/goapptrace/tracer/types"
+	"github.com/yuuki0xff/goapptrace/tracer/util"
+)
+
+// postingsMagic は、PostingsIndexのファイルの先頭に書き込まれる識別子である。
+const postingsMagic = "GAPOSTv1"
+
+// postingsEntry は、posting listに追加された1つのFuncLogIDである。
+type postingsEntry struct {
+	key uint64
+	id  types.FuncLogID
+}
+
+// PostingsIndex は、キーからFuncLogIDの一覧 (posting list) への対応を管理するセカンダリインデックスである。
+// キーには、GIDや関数のPCなどを使用する。
+// スレッドセーフである。
+//
+// ファイルは追記型であり、保存するたびに、前回の保存以降に追加されたエントリのみをセグメントとして末尾に追記する。
+type PostingsIndex struct {
+	File     File
+	ReadOnly bool
+
+	lock sync.RWMutex
+	// キーに対応するFuncLogIDの一覧。FuncLogIDは昇順にソートされており、重複はない。
+	postings map[uint64][]types.FuncLogID
+	// ファイルに書き出されていないエントリ
+	pending []postingsEntry
+	// ファイルに書き出されていない変更があればtrue。
+	dirty bool
+}
+
+// ファイルから読み込む。
+// ファイルが存在しないときは、エラーを返す。
+// 書き込み途中の末尾のセグメントは無視する。書き込み可能なら、そのセグメントを切り捨てる。
+func (p *PostingsIndex) Load() error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.postings = map[uint64][]types.FuncLogID{}
+	p.pending = nil
+	p.dirty = false
+
+	return readSegments(p.File, postingsMagic, !p.ReadOnly, func(payload []byte) error {
+		for len(payload) > 0 {
+			key, n1 := binary.Uvarint(payload)
+			if n1 <= 0 {
+				return errors.New("invalid key")
+			}
+			id, n2 := binary.Uvarint(payload[n1:])
+			if n2 <= 0 {
+				return errors.New("invalid id")
+			}
+			payload = payload[n1+n2:]
+			p.insert(key, types.FuncLogID(id))
+		}
+		return nil
+	})
+}
+
+// 変更されていれば、ファイルに書き込む。
+// ファイルが存在すれば、前回の保存以降に追加されたエントリのみを追記する。
+// ファイルが存在しなければ、全てのエントリをatomicに書き込む。
+func (p *PostingsIndex) Save() error {
+	if p.ReadOnly {
+		return ErrReadOnly
+	}
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if !p.File.Exists() {
+		return p.saveAll()
+	}
+	if !p.dirty {
+		return nil
+	}
+
+	if err := appendSegment(p.File, encodePostings(p.pending)); err != nil {
+		return err
+	}
+	p.pending = p.pending[:0]
+	p.dirty = false
+	return nil
+}
+
+// saveAll は、全てのエントリを1つのセグメントとしてファイルに書き込む。書き込みはatomicに行われる。
+// 既存のファイルは上書きされる。
+// 呼び出し元は、ロックを取得していなければならない。
+func (p *PostingsIndex) saveAll() error {
+	p.init()
+	keys := make([]uint64, 0, len(p.postings))
+	var total int
+	for key, ids := range p.postings {
+		keys = append(keys, key)
+		total += len(ids)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+	entries := make([]postingsEntry, 0, total)
+	for _, key := range keys {
+		for _, id := range p.postings[key] {
+			entries = append(entries, postingsEntry{key: key, id: id})
+		}
+	}
+
+	if err := writeSegment(p.File, postingsMagic, encodePostings(entries)); err != nil {
+		return err
+	}
+	p.pending = p.pending[:0]
+	p.dirty = false
+	return nil
+}
+
+// keyに対応するposting listにidを追加する。
+func (p *PostingsIndex) Add(key uint64, id types.FuncLogID) error {
+	if p.ReadOnly {
+		return ErrReadOnly
+	}
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.init()
+
+	if p.insert(key, id) {
+		p.pending = append(p.pending, postingsEntry{key: key, id: id})
+		p.dirty = true
+	}
+	return nil
+}
+
+// insert は、keyに対応するposting listにidを追加する。
+// 登録済みであればfalseを返す。
+// 呼び出し元は、ロックを取得していなければならない。
+func (p *PostingsIndex) insert(key uint64, id types.FuncLogID) bool {
+	ids := p.postings[key]
+	n := len(ids)
+	if n == 0 || ids[n-1] < id {
+		// 殆どの場合は末尾に追加される。
+		p.postings[key] = append(ids, id)
+		return true
+	}
+	i := sort.Search(n, func(i int) bool { return ids[i] >= id })
+	if i < n && ids[i] == id {
+		// 登録済み
+		return false
+	}
+	ids = append(ids, 0)
+	copy(ids[i+1:], ids[i:])
+	ids[i] = id
+	p.postings[key] = ids
+	return true
+}
+
+// 指定したキーのいずれかに対応するFuncLogIDを、昇順に並べて返す。
+func (p *PostingsIndex) Get(keys ...uint64) []types.FuncLogID {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+
+	lists := make([][]types.FuncLogID, 0, len(keys))
+	for _, key := range keys {
+		if ids, ok := p.postings[key]; ok {
+			lists = append(lists, ids)
+		}
+	}
+	return mergePostings(lists)
+}
+
+// 領域[min, max]に含まれるキーのいずれかに対応するFuncLogIDを、昇順に並べて返す。
+func (p *PostingsIndex) GetRange(min, max uint64) []types.FuncLogID {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+
+	var lists [][]types.FuncLogID
+	for key, ids := range p.postings {
+		if min <= key && key <= max {
+			lists = append(lists, ids)
+		}
+	}
+	return mergePostings(lists)
+}
+
+func (p *PostingsIndex) init() {
+	if p.postings == nil {
+		p.postings = map[uint64][]types.FuncLogID{}
+	}
+}
+
+// encodePostings は、 entries をセグメントのペイロードに変換する。
+// ペイロードは、キーとFuncLogID (それぞれuvarint) の組の繰り返しである。
+func encodePostings(entries []postingsEntry) []byte {
+	payload := make([]byte, 0, len(entries)*4)
+	var buf [binary.MaxVarintLen64]byte
+	for _, e := range entries {
+		n := binary.PutUvarint(buf[:], e.key)
+		payload = append(payload, buf[:n]...)
+		n = binary.PutUvarint(buf[:], uint64(e.id))
+		payload = append(payload, buf[:n]...)
+	}
+	return payload
+}
+
+// 複数のposting listを結合し、重複を取り除いて返す。
+func mergePostings(lists [][]types.FuncLogID) []types.FuncLogID {
+	switch len(lists) {
+	case 0:
+		return []types.FuncLogID{}
+	case 1:
+		ids := make([]types.FuncLogID, len(lists[0]))
+		copy(ids, lists[0])
+		return ids
+	}
+
+	var total int
+	for _, ids := range lists {
+		total += len(ids)
+	}
+	merged := make([]types.FuncLogID, 0, total)
+	for _, ids := range lists {
+		merged = append(merged, ids...)
+	}
+	sort.Slice(merged, func(i, j int) bool { return merged[i] < merged[j] })
+
+	// 重複を取り除く
+	n := 0
+	for i := range merged {
+		if i == 0 || merged[i-1] != merged[i] {
+			merged[n] = merged[i]
+			n++
+		}
+	}
+	return merged[:n]
+}
+
+// AddFuncLogPostings は、flをGoroutineのインデックスと関数のインデックスに追加する。
+// 関数のインデックスには、全てのフレームのPCを登録する。
+func AddFuncLogPostings(gidIndex, funcIndex *PostingsIndex, fl *types.FuncLog) error {
+	if err := gidIndex.Add(uint64(fl.GID), fl.ID); err != nil {
+		return err
+	}
+	for _, pc := range fl.Frames {
+		if err := funcIndex.Add(uint64(pc), fl.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AddParentPostings は、flを呼び出し元のインデックスに追加する。
+// キーは呼び出し元のFuncLogIDである。呼び出し元が存在しないFuncLogは追加しない。
+func AddParentPostings(parentIndex *PostingsIndex, fl *types.FuncLog) error {
+	if fl.ParentID == types.NotFoundParent {
+		return nil
+	}
+	return parentIndex.Add(uint64(fl.ParentID), fl.ID)
+}
+
+// BuildPostings は、FuncLogファイルからセカンダリインデックスを再構築する。
+// 既存のインデックスファイルは上書きされる。
+// 対象のログを他のプロセスが開いていてはならない。
+func BuildPostings(d DirLayout, id LogID) error {
+	gidIndex := &PostingsIndex{File: d.GoroutineIndexFile(id)}
+	funcIndex := &PostingsIndex{File: d.FuncIndexFile(id)}
+	parentIndex := &PostingsIndex{File: d.ParentIndexFile(id)}
+	gidIndex.init()
+	funcIndex.init()
+	parentIndex.init()
+
+	err := scanFuncLogs(d, id, func(fl *types.FuncLog) error {
+		if err := AddFuncLogPostings(gidIndex, funcIndex, fl); err != nil {
+			return err
+		}
+		return AddParentPostings(parentIndex, fl)
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := gidIndex.saveAll(); err != nil {
+		return err
+	}
+	if err := funcIndex.saveAll(); err != nil {
+		return err
+	}
+	return parentIndex.saveAll()
+}
+
+// scanFuncLogs は、ログに記録されている全てのFuncLogをID順に読み出し、fn()に渡す。
+// デコードできないレコードと記録されていないレコードは無視する。
+// fn()に渡したFuncLogは再利用されるため、fn()の外部で保持してはならない。
+func scanFuncLogs(d DirLayout, id LogID, fn func(fl *types.FuncLog) error) error {
+	return scanFuncLogFiles(d, id, func(n int64, fl *types.FuncLog) error {
+		return fn(fl)
+	})
+}
+
+// scanFuncLogFiles は、 scanFuncLogs() と同様に全てのFuncLogを読み出す。
+// fn()には、FuncLogを格納しているFuncLogファイルの番号も渡す。
+func scanFuncLogFiles(d DirLayout, id LogID, fn func(n int64, fl *types.FuncLog) error) error {
+	if !d.MetaFile(id).Exists() && !d.FuncLogFile(id, 0).Exists() {
+		return errors.Wrap(ErrLogNotFound, id.Hex())
+	}
+
+	fl := types.FuncLogPool.Get().(*types.FuncLog)
+	defer types.FuncLogPool.Put(fl)
+	for n := int64(0); d.FuncLogFile(id, n).Exists(); n++ {
+		store := FuncLogStore{
+			Store: Store{
+				File:       d.FuncLogFile(id, n),
+				RecordSize: int(encoding.SizeFuncLog()),
+				ReadOnly:   true,
+			},
+		}
+		if err := store.Open(); err != nil {
+			return err
+		}
+
+		var err error
+		store.Lock()
+		for i := int64(0); i < store.Records(); i++ {
+			fl.Frames = fl.Frames[:cap(fl.Frames)]
+			if perr := util.PanicHandler(func() {
+				err = store.GetNolock(types.FuncLogID(i), fl)
+			}); perr != nil {
+				// デコードできないレコードは無視する。
+				continue
+			}
+			if err != nil {
+				break
+			}
+			if fl.StartTime == 0 {
+				// 記録されていないレコード
+				continue
+			}
+			if err = fn(n, fl); err != nil {
+				break
+			}
+		}
+		store.Unlock()
+		if err != nil {
+			store.Close() // nolint: errcheck
+			return err
+		}
+		if err := store.Close(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
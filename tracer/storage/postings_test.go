@@ -0,0 +1,214 @@
+package storage
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yuuki0xff/goapptrace/tracer/types"
+)
+
+func TestPostingsIndex(t *testing.T) {
+	a := assert.New(t)
+	tempdir, err := ioutil.TempDir("", ".goapptrace_storage")
+	a.NoError(err)
+	defer func() {
+		a.NoError(os.RemoveAll(tempdir))
+	}()
+	file := File(tempdir + "/test.gid.index")
+
+	p := &PostingsIndex{File: file}
+	a.NoError(p.Add(1, 10))
+	a.NoError(p.Add(1, 5))
+	a.NoError(p.Add(1, 20))
+	a.NoError(p.Add(1, 10))
+	a.NoError(p.Add(2, 7))
+	a.NoError(p.Add(100, 5))
+
+	a.Equal([]types.FuncLogID{5, 10, 20}, p.Get(1))
+	a.Equal([]types.FuncLogID{5, 7, 10, 20}, p.Get(1, 2, 3))
+	a.Equal([]types.FuncLogID{}, p.Get(3))
+	a.Equal([]types.FuncLogID{5, 7, 10, 20}, p.GetRange(0, 99))
+	a.Equal([]types.FuncLogID{5, 7}, p.GetRange(2, 100))
+
+	a.NoError(p.Save())
+	p2 := &PostingsIndex{File: file, ReadOnly: true}
+	a.NoError(p2.Load())
+	a.Equal([]types.FuncLogID{5, 10, 20}, p2.Get(1))
+	a.Equal([]types.FuncLogID{5}, p2.Get(100))
+	a.Equal(ErrReadOnly, p2.Add(1, 30))
+
+	// 2回目以降の保存では、追加されたエントリのみを追記する。
+	size, err := file.Size()
+	a.NoError(err)
+	a.NoError(p.Add(1, 30))
+	a.NoError(p.Add(3, 8))
+	a.NoError(p.Save())
+	size2, err := file.Size()
+	a.NoError(err)
+	a.Equal(size+int64(1+4+4), size2)
+	a.NoError(p.Save())
+	size3, err := file.Size()
+	a.NoError(err)
+	a.Equal(size2, size3)
+
+	p2 = &PostingsIndex{File: file, ReadOnly: true}
+	a.NoError(p2.Load())
+	a.Equal([]types.FuncLogID{5, 10, 20, 30}, p2.Get(1))
+	a.Equal([]types.FuncLogID{8}, p2.Get(3))
+}
+
+func TestPostingsIndex_Load(t *testing.T) {
+	a := assert.New(t)
+	tempdir, err := ioutil.TempDir("", ".goapptrace_storage")
+	a.NoError(err)
+	defer func() {
+		a.NoError(os.RemoveAll(tempdir))
+	}()
+	file := File(tempdir + "/test.gid.index")
+
+	p := &PostingsIndex{File: file}
+	a.NoError(p.Add(1, 10))
+	a.NoError(p.Save())
+	a.NoError(p.Add(2, 20))
+	a.NoError(p.Save())
+	size, err := file.Size()
+	a.NoError(err)
+
+	// 書き込み途中のセグメントを追加する。
+	w, err := file.OpenAppendOnly()
+	a.NoError(err)
+	_, err = w.Write(encodeSegment(encodePostings([]postingsEntry{{key: 3, id: 30}}))[:5])
+	a.NoError(err)
+	a.NoError(w.Close())
+
+	p2 := &PostingsIndex{File: file, ReadOnly: true}
+	a.NoError(p2.Load())
+	a.Equal([]types.FuncLogID{10, 20}, p2.GetRange(0, 100))
+	size2, err := file.Size()
+	a.NoError(err)
+	a.Equal(size+5, size2)
+
+	// 書き込み可能なら、書き込み途中のセグメントを切り捨ててから追記する。
+	p3 := &PostingsIndex{File: file}
+	a.NoError(p3.Load())
+	size2, err = file.Size()
+	a.NoError(err)
+	a.Equal(size, size2)
+	a.NoError(p3.Add(3, 30))
+	a.NoError(p3.Save())
+	p2 = &PostingsIndex{File: file, ReadOnly: true}
+	a.NoError(p2.Load())
+	a.Equal([]types.FuncLogID{10, 20, 30}, p2.GetRange(0, 100))
+
+	// 古い形式のファイルは読み込めない。
+	a.NoError(file.WriteAll([]byte("\x0e\xff\x81\x04\x01\x02\xff\x82")))
+	a.Error(p2.Load())
+}
+
+func TestBuildPostings(t *testing.T) {
+	withBrokenLog(t, func(d DirLayout, id LogID) {
+		// インデックスを削除して、再構築できることを確認する。
+		a := assert.New(t)
+		a.NoError(d.GoroutineIndexFile(id).Remove())
+		a.NoError(d.FuncIndexFile(id).Remove())
+		a.NoError(d.ParentIndexFile(id).Remove())
+	}, func(d DirLayout, id LogID) {
+		a := assert.New(t)
+		l := Log{
+			ID:       id,
+			Root:     d,
+			ReadOnly: true,
+		}
+		a.NoError(l.Open())
+		_, ok := l.FuncLogIDsByGID(0)
+		a.False(ok)
+		_, ok = l.ChildFuncLogIDs(0)
+		a.False(ok)
+		a.NoError(l.Close())
+
+		a.NoError(BuildPostings(d, id))
+		a.Error(BuildPostings(d, LogID{2}))
+
+		l = Log{
+			ID:       id,
+			Root:     d,
+			ReadOnly: true,
+		}
+		a.NoError(l.Open())
+		ids, ok := l.FuncLogIDsByGID(0)
+		a.True(ok)
+		a.Len(ids, 10)
+		ids, ok = l.FuncLogIDsByGID(1)
+		a.True(ok)
+		a.Len(ids, 0)
+		ids, ok = l.ChildFuncLogIDs(0)
+		a.True(ok)
+		a.Len(ids, 0)
+		a.NoError(l.Close())
+	})
+}
+
+func TestLog_FuncLogIDsByFuncName(t *testing.T) {
+	a := assert.New(t)
+	tempdir, err := ioutil.TempDir("", ".goapptrace_storage")
+	a.NoError(err)
+	defer func() {
+		a.NoError(os.RemoveAll(tempdir))
+	}()
+	d := DirLayout{Root: tempdir}
+	a.NoError(d.Init())
+
+	l := Log{
+		ID:       LogID{1},
+		Root:     d,
+		Metadata: &types.LogMetadata{},
+	}
+	a.NoError(l.Open())
+	a.NoError(l.SetSymbolsData(&types.SymbolsData{
+		Files: []string{"main.go"},
+		Mods: []types.GoModule{
+			{Name: "main", MinPC: 100, MaxPC: 399},
+		},
+		Funcs: []types.GoFunc{
+			{Entry: 100, Name: "main.foo"},
+			{Entry: 200, Name: "main.bar"},
+			{Entry: 300, Name: "main.main"},
+		},
+		Lines: []types.GoLine{
+			{PC: 100, FileID: 0, Line: 1},
+			{PC: 200, FileID: 0, Line: 2},
+			{PC: 300, FileID: 0, Line: 3},
+		},
+	}))
+	// main.main -> main.bar -> main.foo
+	a.NoError(l.AddPostings(&types.FuncLog{ID: 0, GID: 1, ParentID: types.NotFoundParent, Frames: []uintptr{310}}))
+	a.NoError(l.AddPostings(&types.FuncLog{ID: 1, GID: 1, ParentID: 0, Frames: []uintptr{210, 310}}))
+	a.NoError(l.AddPostings(&types.FuncLog{ID: 2, GID: 2, ParentID: types.NotFoundParent, Frames: []uintptr{110, 210, 310}}))
+	// どのモジュールにも含まれないPCは、直前の関数に含めない。
+	a.NoError(l.AddPostings(&types.FuncLog{ID: 3, GID: 2, ParentID: types.NotFoundParent, Frames: []uintptr{500}}))
+
+	ids, ok := l.FuncLogIDsByFuncName("main.main")
+	a.True(ok)
+	a.Equal([]types.FuncLogID{0, 1, 2}, ids)
+	ids, ok = l.FuncLogIDsByFuncName("main.foo")
+	a.True(ok)
+	a.Equal([]types.FuncLogID{2}, ids)
+	ids, ok = l.FuncLogIDsByFuncName("main.foo", "main.bar")
+	a.True(ok)
+	a.Equal([]types.FuncLogID{1, 2}, ids)
+	ids, ok = l.FuncLogIDsByFuncName("main.notfound")
+	a.True(ok)
+	a.Equal([]types.FuncLogID{}, ids)
+	ids, ok = l.FuncLogIDsByGID(1)
+	a.True(ok)
+	a.Equal([]types.FuncLogID{0, 1}, ids)
+	ids, ok = l.ChildFuncLogIDs(0)
+	a.True(ok)
+	a.Equal([]types.FuncLogID{1}, ids)
+	ids, ok = l.ChildFuncLogIDs(1)
+	a.True(ok)
+	a.Equal([]types.FuncLogID{}, ids)
+	a.NoError(l.Close())
+}
@@ -0,0 +1,230 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/pkg/errors"
+	"github.com/yuuki0xff/goapptrace/tracer/encoding"
+	"github.com/yuuki0xff/goapptrace/tracer/types"
+	"github.com/yuuki0xff/goapptrace/tracer/util"
+)
+
+var ErrLogNotFound = errors.New("log not found")
+
+// Repairer は、クラッシュなどにより壊れたログを読み込み可能な状態に修復する。
+// 修復中のログを他のプロセスが開いていてはならない。
+type Repairer struct {
+	Root DirLayout
+	ID   LogID
+	// trueの場合、問題点の検出だけを行い、ファイルを変更しない。
+	DryRun bool
+}
+
+// Repair は、ログの検査と修復を行い、検出した問題点の一覧を返す。
+// 問題が見つからなかった場合は、空のスライスを返す。
+// DryRunが有効な場合は、問題点の一覧だけを返す。
+func (r *Repairer) Repair() ([]string, error) {
+	var problems []string
+	report := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	if !r.Root.MetaFile(r.ID).Exists() && !r.Root.FuncLogFile(r.ID, 0).Exists() {
+		return nil, errors.Wrap(ErrLogNotFound, r.ID.Hex())
+	}
+
+	// 書き込み途中のレコードを切り捨てる。
+	sizes := []struct {
+		name string
+		file func(n int64) File
+		size int64
+	}{
+		{"RawFuncLog", func(n int64) File { return r.Root.RawFuncLogFile(r.ID, n) }, encoding.SizeRawFuncLog()},
+		{"FuncLog", func(n int64) File { return r.Root.FuncLogFile(r.ID, n) }, encoding.SizeFuncLog()},
+		{"Goroutine", func(n int64) File { return r.Root.GoroutineLogFile(r.ID, n) }, encoding.SizeGoroutine()},
+	}
+	for _, s := range sizes {
+		for n := int64(0); ; n++ {
+			f := s.file(n)
+			if !f.Exists() {
+				if n == 0 {
+					report("%s file is missing: %s", s.name, f)
+					if !r.DryRun {
+						if err := f.WriteAll(nil); err != nil {
+							return problems, err
+						}
+					}
+				}
+				break
+			}
+			size, err := f.Size()
+			if err != nil {
+				return problems, err
+			}
+			if torn := size % s.size; torn != 0 {
+				report("%s file has a torn record (%d bytes): %s", s.name, torn, f)
+				if !r.DryRun {
+					if err := f.Truncate(size - torn); err != nil {
+						return problems, err
+					}
+				}
+			}
+		}
+	}
+
+	// FuncLogファイルからIndexを再構築する。
+	records, err := r.buildIndex()
+	if err != nil {
+		return problems, errors.Wrap(err, "failed to rebuild Index")
+	}
+	idx := Index{
+		File:     r.Root.IndexFile(r.ID),
+		ReadOnly: r.DryRun,
+	}
+	if !idx.File.Exists() {
+		report("Index file is missing: %s", idx.File)
+	} else if err := idx.Load(); err != nil {
+		report("Index file is broken: %s: %s", idx.File, err)
+	} else if !coversIndexRecords(idx.records, records) {
+		report("Index is inconsistent with FuncLog files: %s", idx.File)
+	} else {
+		// Indexは正常なので、書き換える必要はない。
+		idx.ReadOnly = true
+	}
+	if !idx.ReadOnly {
+		if err := idx.Reset(records); err != nil {
+			return problems, err
+		}
+		if err := idx.Save(); err != nil {
+			return problems, err
+		}
+	}
+
+	// 読み込み可能なSymbolsを復元する。
+	ss := SymbolsStore{
+		File:     r.Root.SymbolFile(r.ID),
+		ReadOnly: r.DryRun,
+	}
+	symbols := &types.Symbols{
+		Writable: true,
+	}
+	symbols.Init()
+	if !ss.File.Exists() {
+		report("Symbols file is missing: %s", ss.File)
+		if !r.DryRun {
+			if err := ss.Write(symbols); err != nil {
+				return problems, err
+			}
+		}
+	} else if err := readSymbols(ss, symbols); err != nil {
+		report("Symbols file is broken: %s: %s", ss.File, err)
+		if !r.DryRun {
+			// 読み込めた最後のSymbolsDataを使用する。
+			// 1つも読み込めなかった場合は、空のSymbolsで置き換える。
+			if data, ok := r.lastSymbolsData(ss.File); ok {
+				symbols.Load(*data)
+			}
+			if err := ss.Write(symbols); err != nil {
+				return problems, err
+			}
+		}
+	}
+
+	// Metadataを復元する。
+	metaFile := r.Root.MetaFile(r.ID)
+	meta := &types.LogMetadata{}
+	if !metaFile.Exists() {
+		report("Metadata file is missing: %s", metaFile)
+	} else if data, err := metaFile.ReadAll(); err != nil {
+		report("Metadata file is broken: %s: %s", metaFile, err)
+	} else if err := json.Unmarshal(data, meta); err != nil {
+		report("Metadata file is broken: %s: %s", metaFile, err)
+	} else {
+		meta = nil
+	}
+	if meta != nil && !r.DryRun {
+		if len(records) > 0 {
+			meta.Timestamp = records[len(records)-1].MaxEnd.UnixTime()
+		}
+		data, err := json.Marshal(meta)
+		if err != nil {
+			return problems, err
+		}
+		if err := metaFile.WriteAll(data); err != nil {
+			return problems, err
+		}
+	}
+	return problems, nil
+}
+
+// buildIndex は、全てのFuncLogファイルを読み込み、1ファイルにつき1つのIndexRecordを作成する。
+// 記録されていないレコード (StartTimeが0のレコード) は無視する。
+func (r *Repairer) buildIndex() ([]IndexRecord, error) {
+	records := []IndexRecord{}
+	ir := NewIndexRecord()
+	var file int64
+	err := scanFuncLogFiles(r.Root, r.ID, func(n int64, fl *types.FuncLog) error {
+		for ; file < n; file++ {
+			if !ir.IsEmpty() {
+				records = append(records, ir)
+			}
+			ir = NewIndexRecord()
+		}
+		ir.Add(fl)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !ir.IsEmpty() {
+		records = append(records, ir)
+	}
+	return records, nil
+}
+
+// lastSymbolsData は、fileから読み込める最後のSymbolsDataを返す。
+func (r *Repairer) lastSymbolsData(file File) (*types.SymbolsData, bool) {
+	dec := Decoder{File: file}
+	if err := dec.Open(); err != nil {
+		return nil, false
+	}
+	defer dec.Close() // nolint: errcheck
+
+	var last *types.SymbolsData
+	for {
+		data := &types.SymbolsData{}
+		if err := dec.Read(data); err != nil {
+			break
+		}
+		if data.Validate() != nil {
+			break
+		}
+		last = data
+	}
+	return last, last != nil
+}
+
+// readSymbols は、不正なデータを読み込んだ時にpanicせずにエラーを返す。
+func readSymbols(ss SymbolsStore, symbols *types.Symbols) (err error) {
+	if perr := util.PanicHandler(func() {
+		err = ss.Read(symbols)
+	}); perr != nil {
+		return perr
+	}
+	return
+}
+
+// 既存のIndexRecord(a)が、再構築したIndexRecord(b)の範囲を全て含んでいればtrueを返す。
+// 書き込み時に作成されるIndexRecordは、実際の範囲よりも広くなることがある。
+func coversIndexRecords(a, b []IndexRecord) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !a[i].Covers(b[i]) {
+			return false
+		}
+	}
+	return true
+}
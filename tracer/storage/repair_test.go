@@ -0,0 +1,137 @@
+package storage
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yuuki0xff/goapptrace/tracer/types"
+)
+
+// withBrokenLog は、10個のFuncLogを含むログを作成し、breakFn()でログを壊す。
+func withBrokenLog(t *testing.T, breakFn func(d DirLayout, id LogID), fn func(d DirLayout, id LogID)) {
+	a := assert.New(t)
+	tempdir, err := ioutil.TempDir("", ".goapptrace_storage")
+	a.NoError(err)
+	defer func() {
+		a.NoError(os.RemoveAll(tempdir))
+	}()
+	d := DirLayout{Root: tempdir}
+	a.NoError(d.Init())
+
+	id := LogID{1}
+	l := Log{
+		ID:       id,
+		Root:     d,
+		Metadata: &types.LogMetadata{},
+	}
+	a.NoError(l.Open())
+	ir := NewIndexRecord()
+	l.FuncLog(func(store *FuncLogStore) {
+		for i := 0; i < 10; i++ {
+			fl := &types.FuncLog{
+				ID:        types.FuncLogID(i),
+				StartTime: types.Time(100 + i),
+				EndTime:   types.Time(200 + i),
+				ParentID:  types.NotFoundParent,
+				Frames:    []uintptr{1},
+			}
+			a.NoError(store.SetNolock(fl))
+			ir.Add(fl)
+		}
+	})
+	a.NoError(l.MergeIndex(ir))
+	a.NoError(l.Sync())
+	a.NoError(l.Close())
+
+	breakFn(d, id)
+	fn(d, id)
+}
+
+func TestRepairer_Repair(t *testing.T) {
+	repairAndOpen := func(t *testing.T, d DirLayout, id LogID, nproblems int) {
+		a := assert.New(t)
+		r := Repairer{Root: d, ID: id}
+		problems, err := r.Repair()
+		a.NoError(err)
+		a.Len(problems, nproblems, "%+v", problems)
+
+		// 修復後は問題が見つからない。
+		problems, err = r.Repair()
+		a.NoError(err)
+		a.Len(problems, 0, "%+v", problems)
+
+		l := Log{
+			ID:       id,
+			Root:     d,
+			ReadOnly: true,
+		}
+		a.NoError(l.Open())
+		l.FuncLog(func(store *FuncLogStore) {
+			a.Equal(int64(10), store.Records())
+		})
+		a.Equal(int64(1), l.IndexLen())
+		l.Index(func(index *Index) {
+			ir := index.Get(0)
+			a.Equal(int64(0), ir.MinID)
+			a.Equal(int64(9), ir.MaxID)
+			a.Equal(types.Time(100), ir.MinStart)
+			a.Equal(types.Time(209), ir.MaxEnd)
+		})
+		a.NoError(l.Close())
+	}
+
+	t.Run("healthy", func(t *testing.T) {
+		withBrokenLog(t, func(d DirLayout, id LogID) {}, func(d DirLayout, id LogID) {
+			repairAndOpen(t, d, id, 0)
+		})
+	})
+	t.Run("torn-record", func(t *testing.T) {
+		withBrokenLog(t, func(d DirLayout, id LogID) {
+			f, err := os.OpenFile(string(d.FuncLogFile(id, 0)), os.O_APPEND|os.O_WRONLY, 0600)
+			assert.NoError(t, err)
+			_, err = f.Write([]byte{1, 2, 3})
+			assert.NoError(t, err)
+			assert.NoError(t, f.Close())
+		}, func(d DirLayout, id LogID) {
+			repairAndOpen(t, d, id, 1)
+		})
+	})
+	t.Run("missing-files", func(t *testing.T) {
+		withBrokenLog(t, func(d DirLayout, id LogID) {
+			assert.NoError(t, d.IndexFile(id).Remove())
+			assert.NoError(t, d.SymbolFile(id).Remove())
+			assert.NoError(t, d.MetaFile(id).Remove())
+		}, func(d DirLayout, id LogID) {
+			repairAndOpen(t, d, id, 3)
+		})
+	})
+	t.Run("broken-index", func(t *testing.T) {
+		withBrokenLog(t, func(d DirLayout, id LogID) {
+			assert.NoError(t, d.IndexFile(id).WriteAll([]byte("broken")))
+		}, func(d DirLayout, id LogID) {
+			repairAndOpen(t, d, id, 1)
+		})
+	})
+	t.Run("dry-run", func(t *testing.T) {
+		withBrokenLog(t, func(d DirLayout, id LogID) {
+			assert.NoError(t, d.IndexFile(id).Remove())
+		}, func(d DirLayout, id LogID) {
+			a := assert.New(t)
+			r := Repairer{Root: d, ID: id, DryRun: true}
+			problems, err := r.Repair()
+			a.NoError(err)
+			a.Len(problems, 1)
+			a.False(d.IndexFile(id).Exists())
+		})
+	})
+	t.Run("not-found", func(t *testing.T) {
+		withBrokenLog(t, func(d DirLayout, id LogID) {}, func(d DirLayout, id LogID) {
+			a := assert.New(t)
+			r := Repairer{Root: d, ID: LogID{2}}
+			_, err := r.Repair()
+			a.Error(err)
+		})
+	})
+}
@@ -0,0 +1,88 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+
+	"github.com/pkg/errors"
+)
+
+// 追記型のファイルは、ファイルの種類を表す識別子 (magic) に続けて、セグメントを並べたものである。
+// 各セグメントは、ペイロードの長さ (uvarint)、ペイロードのCRC32 (4バイト, little endian) およびペイロードから成る。
+// 書き込み途中でクラッシュした場合、末尾に不完全なセグメントが残る可能性がある。
+
+// readSegments は、ファイルに含まれるセグメントのペイロードを、先頭から順に fn() に渡す。
+// ファイルの先頭が magic でなければ、エラーを返す。
+// 不完全なセグメントとそれ以降のデータは無視する。 truncate がtrueなら、それらをファイルから切り捨てる。
+func readSegments(file File, magic string, truncate bool, fn func(payload []byte) error) error {
+	data, err := file.ReadAll()
+	if err != nil {
+		return err
+	}
+	if !bytes.HasPrefix(data, []byte(magic)) {
+		return errors.Errorf("unsupported format: %s", file)
+	}
+
+	valid := len(magic)
+	for valid < len(data) {
+		payload, n := decodeSegment(data[valid:])
+		if n == 0 {
+			break
+		}
+		if err := fn(payload); err != nil {
+			return errors.Wrapf(err, "broken segment: %s", file)
+		}
+		valid += n
+	}
+	if valid < len(data) && truncate {
+		return file.Truncate(int64(valid))
+	}
+	return nil
+}
+
+// appendSegment は、 payload を格納したセグメントをファイルの末尾に追記する。
+func appendSegment(file File, payload []byte) error {
+	w, err := file.OpenAppendOnly()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(encodeSegment(payload)); err != nil {
+		w.Close() // nolint: errcheck
+		return err
+	}
+	return w.Close()
+}
+
+// writeSegment は、 magic と payload を格納した1つのセグメントでファイルを置き換える。
+// 書き込みはatomicに行われる。
+func writeSegment(file File, magic string, payload []byte) error {
+	return file.WriteAll(append([]byte(magic), encodeSegment(payload)...))
+}
+
+// encodeSegment は、 payload を格納したセグメントを返す。
+func encodeSegment(payload []byte) []byte {
+	var buf [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(buf[:], uint64(len(payload)))
+	seg := make([]byte, 0, n+4+len(payload))
+	seg = append(seg, buf[:n]...)
+	var sum [4]byte
+	binary.LittleEndian.PutUint32(sum[:], crc32.ChecksumIEEE(payload))
+	seg = append(seg, sum[:]...)
+	return append(seg, payload...)
+}
+
+// decodeSegment は、 data の先頭のセグメントのペイロードと、セグメントのバイト数を返す。
+// セグメントが不完全であるか壊れていれば、0を返す。
+func decodeSegment(data []byte) (payload []byte, n int) {
+	size, n1 := binary.Uvarint(data)
+	if n1 <= 0 || len(data) < n1+4 || uint64(len(data)-n1-4) < size {
+		return nil, 0
+	}
+	sum := binary.LittleEndian.Uint32(data[n1:])
+	payload = data[n1+4 : n1+4+int(size)]
+	if crc32.ChecksumIEEE(payload) != sum {
+		return nil, 0
+	}
+	return payload, n1 + 4 + int(size)
+}
@@ -0,0 +1,105 @@
+package storage
+
+import (
+	"github.com/pkg/errors"
+
+	"github.com/yuuki0xff/goapptrace/tracer/encoding"
+	"github.com/yuuki0xff/goapptrace/tracer/types"
+)
+
+// snapshotReadRecords は、スナップショットから1回のI/Oで読み出すレコード数。
+const snapshotReadRecords = 256
+
+var ErrOutOfSnapshot = errors.New("the record is out of snapshot")
+
+// LogSnapshot は、Log.Snapshot()を呼び出した時点までにコミットされたレコードを読み出す。
+// 書き込み中のログに対しても、書き込み処理をブロックせずに読み出すことができる。
+//
+// スナップショットに含まれるレコードの範囲 (high-water mark) は、作成後に変化しない。
+// ただし、実行中の関数のFuncLogは実行終了時に上書きされるため、
+// 作成後にコミットされた上書き後のレコードが読み出される場合がある。
+// 書き込み途中のレコードが読み出されることはない。
+//
+// スレッドセーフではない。複数のgoroutineから読み出す場合は、goroutineごとにスナップショットを作成すること。
+type LogSnapshot struct {
+	funcLog      snapshotReader
+	goroutineLog snapshotReader
+}
+
+// snapshotReader は、コミット済みのレコードをまとめて読み出してキャッシュする。
+type snapshotReader struct {
+	store *Store
+	// 読み出し可能なレコード数
+	records int64
+
+	buf []byte
+	// bufに格納されているレコードの範囲 [first, first+n)
+	first int64
+	n     int64
+}
+
+// FuncLogRecords は、スナップショットに含まれるFuncLogのレコード数を返す。
+// IDがこの値未満のFuncLogを読み出すことができる。
+func (s *LogSnapshot) FuncLogRecords() int64 {
+	return s.funcLog.records
+}
+
+// GoroutineRecords は、スナップショットに含まれるGoroutineのレコード数を返す。
+func (s *LogSnapshot) GoroutineRecords() int64 {
+	return s.goroutineLog.records
+}
+
+// FuncLog は、指定したIDのFuncLogを読み出す。
+// スナップショットに含まれないIDが指定された場合、ErrOutOfSnapshotを返す。
+func (s *LogSnapshot) FuncLog(id types.FuncLogID, fl *types.FuncLog) error {
+	buf, err := s.funcLog.read(int64(id))
+	if err != nil {
+		return err
+	}
+	encoding.UnmarshalFuncLog(buf, fl)
+	return nil
+}
+
+// Goroutine は、指定したGIDのGoroutineを読み出す。
+// スナップショットに含まれないGIDが指定された場合、ErrOutOfSnapshotを返す。
+func (s *LogSnapshot) Goroutine(gid types.GID, g *types.Goroutine) error {
+	buf, err := s.goroutineLog.read(int64(gid))
+	if err != nil {
+		return err
+	}
+	encoding.UnmarshalGoroutine(buf, g)
+	return nil
+}
+
+func newSnapshotReader(store *Store) snapshotReader {
+	return snapshotReader{
+		store:   store,
+		records: store.Committed(),
+	}
+}
+
+// read は、idx番目のレコードを返す。
+// 返したバッファは、次にread()を呼び出すまでの間のみ有効である。
+func (r *snapshotReader) read(idx int64) ([]byte, error) {
+	if idx < 0 || r.records <= idx {
+		return nil, ErrOutOfSnapshot
+	}
+	size := int64(r.store.RecordSize)
+	if idx < r.first || r.first+r.n <= idx {
+		n := r.records - idx
+		if n > snapshotReadRecords {
+			n = snapshotReadRecords
+		}
+		if r.buf == nil {
+			r.buf = make([]byte, snapshotReadRecords*size)
+		}
+		if err := r.store.ReadCommitted(idx, r.buf[:n*size]); err != nil {
+			r.n = 0
+			return nil, err
+		}
+		r.first = idx
+		r.n = n
+	}
+	offset := (idx - r.first) * size
+	return r.buf[offset : offset+size], nil
+}
@@ -0,0 +1,263 @@
+package storage
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yuuki0xff/goapptrace/tracer/types"
+)
+
+func withSnapshotTestLog(t *testing.T, fn func(l *Log)) {
+	a := assert.New(t)
+	tempdir, err := ioutil.TempDir("", ".goapptrace_storage")
+	a.NoError(err)
+	defer func() {
+		a.NoError(os.RemoveAll(tempdir))
+	}()
+	dirlayout := DirLayout{Root: tempdir}
+	a.NoError(dirlayout.Init())
+
+	l := &Log{
+		ID:       LogID{},
+		Root:     dirlayout,
+		Metadata: &types.LogMetadata{},
+	}
+	a.NoError(l.Open())
+	fn(l)
+	a.NoError(l.Close())
+}
+
+// snapshotTestFuncLog は、IDから一意に決まるFuncLogを返す。
+// endedがtrueなら、実行が終了したFuncLogを返す。
+func snapshotTestFuncLog(id types.FuncLogID, ended bool) *types.FuncLog {
+	fl := &types.FuncLog{
+		ID:        id,
+		StartTime: types.Time(id * 10),
+		EndTime:   types.NotEnded,
+		ParentID:  types.NotFoundParent,
+		Frames:    []uintptr{uintptr(id), uintptr(id) + 1, uintptr(id) + 2},
+		GID:       types.GID(id % 7),
+	}
+	if ended {
+		fl.EndTime = fl.StartTime + 5
+	}
+	return fl
+}
+
+func TestLog_Snapshot(t *testing.T) {
+	withSnapshotTestLog(t, func(l *Log) {
+		a := assert.New(t)
+		l.FuncLog(func(store *FuncLogStore) {
+			for i := types.FuncLogID(0); i < 10; i++ {
+				a.NoError(store.SetNolock(snapshotTestFuncLog(i, false)))
+			}
+		})
+		l.Goroutine(func(store *GoroutineStore) {
+			a.NoError(store.SetNolock(&types.Goroutine{GID: 0, StartTime: 1, EndTime: 2}))
+		})
+
+		// コミットされていないレコードは読み出せない。
+		s1, err := l.Snapshot()
+		a.NoError(err)
+		a.Equal(int64(0), s1.FuncLogRecords())
+		a.Equal(int64(0), s1.GoroutineRecords())
+		fl := types.FuncLogPool.Get().(*types.FuncLog)
+		defer types.FuncLogPool.Put(fl)
+		a.Equal(ErrOutOfSnapshot, s1.FuncLog(0, fl))
+
+		a.NoError(l.Sync())
+		s2, err := l.Snapshot()
+		a.NoError(err)
+		a.Equal(int64(10), s2.FuncLogRecords())
+		a.Equal(int64(1), s2.GoroutineRecords())
+		for i := types.FuncLogID(0); i < 10; i++ {
+			a.NoError(s2.FuncLog(i, fl))
+			a.Equal(*snapshotTestFuncLog(i, false), *fl)
+		}
+		a.Equal(ErrOutOfSnapshot, s2.FuncLog(10, fl))
+		a.Equal(ErrOutOfSnapshot, s2.FuncLog(-1, fl))
+		var g types.Goroutine
+		a.NoError(s2.Goroutine(0, &g))
+		a.Equal(types.Goroutine{GID: 0, StartTime: 1, EndTime: 2}, g)
+
+		// 作成後に追加されたレコードは、スナップショットに含まれない。
+		l.FuncLog(func(store *FuncLogStore) {
+			a.NoError(store.SetNolock(snapshotTestFuncLog(10, true)))
+		})
+		a.NoError(l.Sync())
+		a.Equal(int64(10), s2.FuncLogRecords())
+		a.Equal(ErrOutOfSnapshot, s2.FuncLog(10, fl))
+		a.Equal(int64(0), s1.FuncLogRecords())
+
+		// 上書きされたレコードも、書き込み途中の状態で読み出されることはない。
+		l.FuncLog(func(store *FuncLogStore) {
+			a.NoError(store.SetNolock(snapshotTestFuncLog(3, true)))
+		})
+		a.NoError(l.Sync())
+		s3, err := l.Snapshot()
+		a.NoError(err)
+		a.NoError(s3.FuncLog(3, fl))
+		a.Equal(*snapshotTestFuncLog(3, true), *fl)
+	})
+}
+
+func TestLog_SnapshotAfterClose(t *testing.T) {
+	withSnapshotTestLog(t, func(l *Log) {
+		a := assert.New(t)
+		a.NoError(l.Close())
+		_, err := l.Snapshot()
+		a.Error(err)
+	})
+}
+
+// 書き込み中のログに対して、大量の読み出しを並行して行うテスト。
+// go test -race で実行すること。
+func TestLog_SnapshotDuringWriting(t *testing.T) {
+	const (
+		batches   = 100
+		batchSize = 50
+		readers   = 8
+	)
+
+	withSnapshotTestLog(t, func(l *Log) {
+		a := assert.New(t)
+		var done int32
+		var wg sync.WaitGroup
+
+		// 書き込み側。logWriteWorkerと同様に、実行中のFuncLogを書き込んだ後で終了後のFuncLogで上書きする。
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer atomic.StoreInt32(&done, 1)
+			for b := 0; b < batches; b++ {
+				first := types.FuncLogID(b * batchSize)
+				l.FuncLog(func(store *FuncLogStore) {
+					for i := first; i < first+batchSize; i++ {
+						if err := store.SetNolock(snapshotTestFuncLog(i, false)); err != nil {
+							t.Error(err)
+							return
+						}
+					}
+					if first > 0 {
+						// 前のバッチで書き込んだFuncLogの実行を終了させる。
+						for i := first - batchSize; i < first; i++ {
+							if err := store.SetNolock(snapshotTestFuncLog(i, true)); err != nil {
+								t.Error(err)
+								return
+							}
+						}
+					}
+				})
+				l.Goroutine(func(store *GoroutineStore) {
+					if err := store.SetNolock(&types.Goroutine{GID: types.GID(b), StartTime: types.Time(b)}); err != nil {
+						t.Error(err)
+					}
+				})
+				if err := l.Sync(); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+
+		// 読み出し側。スナップショットに含まれる全てのレコードが、完全な状態で読み出せることを確認する。
+		var snapshots int64
+		for r := 0; r < readers; r++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				fl := types.FuncLogPool.Get().(*types.FuncLog)
+				defer types.FuncLogPool.Put(fl)
+				var last int64
+				for atomic.LoadInt32(&done) == 0 {
+					s, err := l.Snapshot()
+					if err != nil {
+						t.Error(err)
+						return
+					}
+					n := s.FuncLogRecords()
+					if n < last {
+						t.Errorf("high-water mark is decreased: %d -> %d", last, n)
+						return
+					}
+					last = n
+					atomic.AddInt64(&snapshots, 1)
+
+					for i := int64(0); i < n; i++ {
+						if err := s.FuncLog(types.FuncLogID(i), fl); err != nil {
+							t.Error(err)
+							return
+						}
+						id := types.FuncLogID(i)
+						if !reflect.DeepEqual(snapshotTestFuncLog(id, false), fl) && !reflect.DeepEqual(snapshotTestFuncLog(id, true), fl) {
+							t.Errorf("broken record: %+v", fl)
+							return
+						}
+					}
+					for i := int64(0); i < s.GoroutineRecords(); i++ {
+						var g types.Goroutine
+						if err := s.Goroutine(types.GID(i), &g); err != nil {
+							t.Error(err)
+							return
+						}
+						if g.GID != types.GID(i) || g.StartTime != types.Time(i) {
+							t.Errorf("broken record: %+v", g)
+							return
+						}
+					}
+				}
+			}()
+		}
+		wg.Wait()
+
+		s, err := l.Snapshot()
+		a.NoError(err)
+		a.Equal(int64(batches*batchSize), s.FuncLogRecords())
+		a.Equal(int64(batches), s.GoroutineRecords())
+		a.NotZero(atomic.LoadInt64(&snapshots))
+	})
+}
+
+func TestLog_RunningFuncLogs(t *testing.T) {
+	withSnapshotTestLog(t, func(l *Log) {
+		a := assert.New(t)
+		fls := []*types.FuncLog{
+			// gid=1: 0 -> 1 -> 2 (2は終了済み)
+			{ID: 0, StartTime: 1, EndTime: types.NotEnded, ParentID: types.NotFoundParent, Frames: []uintptr{10}, GID: 1},
+			{ID: 1, StartTime: 2, EndTime: types.NotEnded, ParentID: 0, Frames: []uintptr{20, 10}, GID: 1},
+			{ID: 2, StartTime: 3, EndTime: 4, ParentID: 1, Frames: []uintptr{30, 20, 10}, GID: 1},
+			// gid=2: 全て終了済み
+			{ID: 3, StartTime: 5, EndTime: 6, ParentID: types.NotFoundParent, Frames: []uintptr{40}, GID: 2},
+			// gid=3: 3
+			{ID: 4, StartTime: 7, EndTime: types.NotEnded, ParentID: types.NotFoundParent, Frames: []uintptr{50}, GID: 3},
+		}
+		l.FuncLog(func(store *FuncLogStore) {
+			for _, fl := range fls {
+				a.NoError(store.SetNolock(fl))
+				a.NoError(l.AddPostings(fl))
+			}
+		})
+		a.NoError(l.Sync())
+		s, err := l.Snapshot()
+		a.NoError(err)
+
+		stacks, err := l.RunningFuncLogs(s)
+		a.NoError(err)
+		a.Len(stacks, 2)
+		a.Len(stacks[1], 2)
+		a.Equal(types.FuncLogID(0), stacks[1][0].ID)
+		a.Equal(types.FuncLogID(1), stacks[1][1].ID)
+		a.Len(stacks[3], 1)
+
+		stacks, err = l.RunningFuncLogs(s, 3)
+		a.NoError(err)
+		a.Len(stacks, 1)
+		a.Len(stacks[3], 1)
+		a.Equal(types.FuncLogID(4), stacks[3][0].ID)
+	})
+}
@@ -10,6 +10,10 @@ import (
 type EncodeFn func(buf []byte) int64
 type DecodeFn func(buf []byte)
 
+type syncer interface {
+	Sync() error
+}
+
 // 固定長レコードを格納するファイルへの読み書きを行う。
 type Store struct {
 	// 書き込み先のファイル
@@ -26,6 +30,18 @@ type Store struct {
 	wb WriteBuffer
 	// File が保持しているレコード数
 	records int64
+	// ReadCommitted() で読み出せるレコード数 (high-water mark)。
+	// Commit() を呼び出すまで、追加したレコードは読み出せない。
+	committed int64
+	// ファイルへの書き込みと ReadCommitted() による読み出しを排他制御する。
+	// 書き込み途中のレコードを読み出さないようにするためのものであり、mとは独立している。
+	fileLock sync.RWMutex
+}
+
+// lockedWriter は、書き込み中に Store.fileLock を取得する。
+type lockedWriter struct {
+	FileWriter
+	lock *sync.RWMutex
 }
 
 // ファイルを開く。
@@ -49,7 +65,10 @@ func (e *Store) Open() (err error) {
 			return
 		}
 		e.wb = WriteBuffer{
-			W:            w,
+			W: &lockedWriter{
+				FileWriter: w,
+				lock:       &e.fileLock,
+			},
 			MaxWriteSize: e.RecordSize,
 			BufferSize:   100 * e.RecordSize,
 		}
@@ -78,6 +97,7 @@ func (e *Store) Open() (err error) {
 		return
 	}
 	e.records = size / int64(e.RecordSize)
+	e.committed = e.records
 	return
 }
 func (e *Store) Read(idx int64, decode DecodeFn) error {
@@ -159,6 +179,69 @@ func (e *Store) FlushNolock() error {
 	return e.wb.Flush()
 }
 
+// バッファリングされているデータを書き出し、ストレージと同期する。
+func (e *Store) Sync() error {
+	e.m.Lock()
+	defer e.m.Unlock()
+	return e.SyncNolock()
+}
+func (e *Store) SyncNolock() error {
+	if e.closed || e.ReadOnly {
+		return nil
+	}
+	if err := e.wb.Flush(); err != nil {
+		return err
+	}
+	if s, ok := e.wb.W.(syncer); ok {
+		return s.Sync()
+	}
+	return nil
+}
+
+// Commit は、バッファリングされているデータをファイルに書き出し、
+// これまでに書き込まれた全てのレコードを ReadCommitted() で読み出せるようにする。
+// Sync() とは異なり、ストレージとの同期は行わない。
+func (e *Store) Commit() error {
+	e.m.Lock()
+	defer e.m.Unlock()
+	return e.CommitNolock()
+}
+func (e *Store) CommitNolock() error {
+	if e.closed {
+		return os.ErrClosed
+	}
+	if !e.ReadOnly {
+		if err := e.wb.Flush(); err != nil {
+			return err
+		}
+	}
+	atomic.StoreInt64(&e.committed, atomic.LoadInt64(&e.records))
+	return nil
+}
+
+// Committed は、 ReadCommitted() で読み出せるレコード数を返す。
+func (e *Store) Committed() int64 {
+	return atomic.LoadInt64(&e.committed)
+}
+
+// ReadCommitted は、idx番目からlen(buf)/RecordSize個のレコードをbufに読み出す。
+// 読み出せるのは、Commit()済みのレコードのみである。
+// Store のロックを取得しないため、書き込み処理と並行して実行できる。
+func (e *Store) ReadCommitted(idx int64, buf []byte) error {
+	if len(buf)%e.RecordSize != 0 {
+		log.Panicf("invalid buffer size: len(buf)=%d RecordSize=%d", len(buf), e.RecordSize)
+	}
+	n := int64(len(buf) / e.RecordSize)
+	if idx < 0 || e.Committed() < idx+n {
+		return ErrOutOfSnapshot
+	}
+
+	e.fileLock.RLock()
+	defer e.fileLock.RUnlock()
+	_, err := e.rb.R.ReadAt(buf, idx*int64(e.RecordSize))
+	return err
+}
+
 func (e *Store) Close() (err error) {
 	e.m.Lock()
 	defer e.m.Unlock()
@@ -202,3 +285,16 @@ func fillZero(buf []byte) {
 		buf[i] = 0
 	}
 }
+
+func (w *lockedWriter) Write(p []byte) (int, error) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	return w.FileWriter.Write(p)
+}
+
+func (w *lockedWriter) Sync() error {
+	if s, ok := w.FileWriter.(syncer); ok {
+		return s.Sync()
+	}
+	return nil
+}
@@ -1,11 +1,17 @@
 package storage
 
 import (
+	"bytes"
+	"encoding/gob"
+
 	"github.com/pkg/errors"
 	"github.com/yuuki0xff/goapptrace/tracer/types"
 )
 
-var ErrReadOnly = errors.New("read only")
+var (
+	ErrReadOnly      = errors.New("read only")
+	ErrNoSymbolsData = errors.New("symbols data not found")
+)
 
 // Symbolsの永続化をする
 type SymbolsStore struct {
@@ -40,12 +46,18 @@ func (s SymbolsStore) Read(symbols *types.Symbols) (err error) {
 	); err != nil {
 		return
 	}
+	if data == nil {
+		err = ErrNoSymbolsData
+		return
+	}
 
 	symbols.Load(*data)
 
 	err = dec.Close()
 	return
 }
+
+// シンボル情報をファイルに書き込む。書き込みはatomicに行われる。
 func (s SymbolsStore) Write(symbols *types.Symbols) (err error) {
 	defer func() {
 		err = errors.Wrap(err, "SymbolsStore")
@@ -55,18 +67,13 @@ func (s SymbolsStore) Write(symbols *types.Symbols) (err error) {
 		return
 	}
 
-	enc := Encoder{File: s.File}
-	if err = enc.Open(); err != nil {
-		return
-	}
-	defer enc.Close() // nolint
-
+	var buf bytes.Buffer
+	enc := gob.NewEncoder(&buf)
 	if err = symbols.Save(func(data types.SymbolsData) error {
-		return enc.Append(&data)
+		return enc.Encode(&data)
 	}); err != nil {
 		return
 	}
-
-	err = enc.Close()
+	err = s.File.WriteAll(buf.Bytes())
 	return
 }
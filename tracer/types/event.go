@@ -0,0 +1,34 @@
+package types
+
+const (
+	// 関数の実行時間が上限を超えた。
+	SlowCallEvent EventKind = "slow-call"
+	// 関数を実行中のgoroutineの数が上限を超えた。
+	TooManyGoroutinesEvent EventKind = "too-many-goroutines"
+)
+
+type EventKind string
+
+// Event は、ログサーバが書き込み中のログから検出したイベントを表す。
+// ウォッチドッグのルールに一致したときに記録される。
+type Event struct {
+	// ログ内で一意な、0から始まる連番。
+	ID   int64     `json:"id"`
+	Kind EventKind `json:"kind"`
+	// 一致したルールの名前
+	Rule string `json:"rule"`
+	// イベントを検出した時刻。
+	// トレース対象のプロセスから最後に受信したログのタイムスタンプである。
+	Timestamp Time `json:"timestamp"`
+	// 監視対象の関数名
+	Func    string `json:"func"`
+	Message string `json:"message"`
+
+	// SlowCallEvent の場合は、上限を超えた関数呼び出しとその実行時間。
+	// 関数の実行中に検出した場合、FuncLogのEndTimeは NotEnded である。
+	FuncLogID FuncLogID `json:"func-log-id,omitempty"`
+	GID       GID       `json:"gid,omitempty"`
+	Duration  Time      `json:"duration,omitempty"`
+	// TooManyGoroutinesEvent の場合は、関数を実行中のgoroutineの数。
+	Goroutines int `json:"goroutines,omitempty"`
+}
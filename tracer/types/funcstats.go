@@ -0,0 +1,128 @@
+package types
+
+// FuncStatsBuckets は、実行時間のヒストグラムの各バケットの上限値 (この値未満) を表す。
+// 最後のバケットには、上限値が存在しない。
+var FuncStatsBuckets = [...]Time{
+	1e3,  // 1us
+	1e4,  // 10us
+	1e5,  // 100us
+	1e6,  // 1ms
+	1e7,  // 10ms
+	1e8,  // 100ms
+	1e9,  // 1s
+	1e10, // 10s
+}
+
+// FuncStatsHistogram は、実行時間のヒストグラムである。
+// i番目の要素は、実行時間が FuncStatsBuckets[i] 未満の関数呼び出しの回数を表す。
+// 最後の要素は、実行時間がそれ以上の関数呼び出しの回数を表す。
+type FuncStatsHistogram [len(FuncStatsBuckets) + 1]int64
+
+// FuncStats は、1つの関数に関する統計情報を保持する。
+// 実行が終了した関数呼び出しのみが集計対象となる。
+type FuncStats struct {
+	// 関数名。関数名が不明な場合は空になる。
+	Name string `json:"name"`
+	// 関数のエントリポイント。関数が不明な場合は、関数呼び出し時のPCになる。
+	PC uintptr `json:"pc"`
+	// 呼び出し回数
+	Calls int64 `json:"calls"`
+	// 実行時間の合計
+	TotalTime Time `json:"total-time"`
+	// 子関数の実行時間を除いた実行時間の合計
+	SelfTime Time `json:"self-time"`
+	// 実行時間の最小値と最大値
+	MinTime Time `json:"min-time"`
+	MaxTime Time `json:"max-time"`
+	// 実行時間のヒストグラム
+	Histogram FuncStatsHistogram `json:"histogram"`
+}
+
+// Add は、1回の関数呼び出しを統計情報に追加する。
+// totalは実行時間、selfは子関数の実行時間を除いた実行時間である。
+func (s *FuncStats) Add(total, self Time) {
+	if s.Calls == 0 || total < s.MinTime {
+		s.MinTime = total
+	}
+	if s.Calls == 0 || s.MaxTime < total {
+		s.MaxTime = total
+	}
+	s.Calls++
+	s.TotalTime += total
+	s.SelfTime += self
+	s.Histogram[FuncStatsBucket(total)]++
+}
+
+// Merge は、他の統計情報を結合する。
+func (s *FuncStats) Merge(other FuncStats) {
+	if other.Calls == 0 {
+		return
+	}
+	if s.Calls == 0 || other.MinTime < s.MinTime {
+		s.MinTime = other.MinTime
+	}
+	if s.Calls == 0 || s.MaxTime < other.MaxTime {
+		s.MaxTime = other.MaxTime
+	}
+	s.Calls += other.Calls
+	s.TotalTime += other.TotalTime
+	s.SelfTime += other.SelfTime
+	for i := range s.Histogram {
+		s.Histogram[i] += other.Histogram[i]
+	}
+}
+
+// AvgTime は、実行時間の平均値を返す。
+func (s FuncStats) AvgTime() Time {
+	if s.Calls == 0 {
+		return 0
+	}
+	return s.TotalTime / Time(s.Calls)
+}
+
+// CallEdge は、呼び出し元の関数と呼び出し先の関数の組に関する統計情報を保持する。
+// 呼び出し元は、 FuncLog.ParentID が指す関数呼び出しである。
+// 呼び出し元と呼び出し先の両方の実行が終了した関数呼び出しのみが集計対象となる。
+type CallEdge struct {
+	// 呼び出し元の関数名と、関数のエントリポイント。
+	// 関数名が不明な場合は空になり、PCは関数呼び出し時のPCになる。
+	CallerName string  `json:"caller-name"`
+	CallerPC   uintptr `json:"caller-pc"`
+	// 呼び出し先の関数名と、関数のエントリポイント。
+	CalleeName string  `json:"callee-name"`
+	CalleePC   uintptr `json:"callee-pc"`
+	// 呼び出し回数
+	Calls int64 `json:"calls"`
+	// 呼び出し先の関数の実行時間の合計
+	TotalTime Time `json:"total-time"`
+}
+
+// Add は、実行時間が total の関数呼び出しを1回追加する。
+func (e *CallEdge) Add(total Time) {
+	e.Calls++
+	e.TotalTime += total
+}
+
+// Merge は、他の統計情報を結合する。
+func (e *CallEdge) Merge(other CallEdge) {
+	e.Calls += other.Calls
+	e.TotalTime += other.TotalTime
+}
+
+// AvgTime は、呼び出し先の関数の実行時間の平均値を返す。
+func (e CallEdge) AvgTime() Time {
+	if e.Calls == 0 {
+		return 0
+	}
+	return e.TotalTime / Time(e.Calls)
+}
+
+// FuncStatsBucket は、実行時間tが含まれるヒストグラムのバケットのインデックスを返す。
+func FuncStatsBucket(t Time) int {
+	for i, max := range FuncStatsBuckets {
+		if t < max {
+			return i
+		}
+	}
+	return len(FuncStatsBuckets)
+}
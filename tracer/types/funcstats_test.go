@@ -0,0 +1,43 @@
+package types
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFuncStatsBucket(t *testing.T) {
+	a := assert.New(t)
+	a.Equal(0, FuncStatsBucket(0))
+	a.Equal(0, FuncStatsBucket(999))
+	a.Equal(1, FuncStatsBucket(1000))
+	a.Equal(6, FuncStatsBucket(999999999))
+	a.Equal(len(FuncStatsBuckets), FuncStatsBucket(1e10))
+	a.Equal(len(FuncStatsBuckets), FuncStatsBucket(1e12))
+}
+
+func TestFuncStats(t *testing.T) {
+	a := assert.New(t)
+	var s FuncStats
+	a.Equal(Time(0), s.AvgTime())
+
+	s.Add(100, 50)
+	s.Add(3000, 3000)
+	a.Equal(int64(2), s.Calls)
+	a.Equal(Time(3100), s.TotalTime)
+	a.Equal(Time(3050), s.SelfTime)
+	a.Equal(Time(100), s.MinTime)
+	a.Equal(Time(3000), s.MaxTime)
+	a.Equal(Time(1550), s.AvgTime())
+	a.Equal(FuncStatsHistogram{1, 1}, s.Histogram)
+
+	var other FuncStats
+	other.Add(10, 10)
+	s.Merge(other)
+	s.Merge(FuncStats{})
+	a.Equal(int64(3), s.Calls)
+	a.Equal(Time(3110), s.TotalTime)
+	a.Equal(Time(10), s.MinTime)
+	a.Equal(Time(3000), s.MaxTime)
+	a.Equal(FuncStatsHistogram{2, 1}, s.Histogram)
+}
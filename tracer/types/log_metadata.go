@@ -1,6 +1,9 @@
 package types
 
 import (
+	"fmt"
+	"sort"
+	"strings"
 	"time"
 )
 
@@ -25,12 +28,78 @@ type LogMetadata struct {
 	Host string `json:"host"`
 	// Application name
 	AppName string `json:"app-name"`
+	// User defined key/value labels
+	Labels Labels `json:"labels"`
+	// User defined free-text description
+	Description string `json:"description"`
 	// List of currently enabled tracing targets.
 	TraceTarget TraceTarget `json:"trace-target"`
 	// The configuration of user interface
 	UI UIConfig `json:"ui"`
 }
 
+// Labels は、ログに付与するユーザ定義のラベルである。
+// 文字列表現は"key1=value1,key2=value2"の形式である。
+type Labels map[string]string
+
+// ParseLabels は、"key1=value1,key2=value2"形式の文字列をLabelsに変換する。
+// 空文字列の場合は、空のLabelsを返す。
+func ParseLabels(s string) (Labels, error) {
+	labels := Labels{}
+	if s == "" {
+		return labels, nil
+	}
+	for _, kv := range strings.Split(s, ",") {
+		if err := labels.Set(kv); err != nil {
+			return nil, err
+		}
+	}
+	return labels, nil
+}
+
+// Set は、"key=value"形式の文字列を解析し、ラベルを追加する。
+// キーが既に存在する場合は、値を上書きする。
+func (l Labels) Set(kv string) error {
+	idx := strings.Index(kv, "=")
+	if idx < 0 {
+		return fmt.Errorf("invalid label: missing '=': %s", kv)
+	}
+	key, value := kv[:idx], kv[idx+1:]
+	if key == "" {
+		return fmt.Errorf("invalid label: empty key: %s", kv)
+	}
+	if strings.Contains(value, ",") {
+		return fmt.Errorf("invalid label: value must not contain ',': %s", kv)
+	}
+	l[key] = value
+	return nil
+}
+
+// Match は、labelsに含まれる全てのラベルを持っていればtrueを返す。
+func (l Labels) Match(labels Labels) bool {
+	for key, value := range labels {
+		if v, ok := l[key]; !ok || v != value {
+			return false
+		}
+	}
+	return true
+}
+
+// String は、"key1=value1,key2=value2"形式の文字列を返す。キーはソートされる。
+func (l Labels) String() string {
+	keys := make([]string, 0, len(l))
+	for key := range l {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	kvs := make([]string, len(keys))
+	for i, key := range keys {
+		kvs[i] = key + "=" + l[key]
+	}
+	return strings.Join(kvs, ",")
+}
+
 type UIConfig struct {
 	FuncLogs   map[FuncLogID]UIItemConfig `json:"func-calls"`
 	Funcs      map[string]UIItemConfig    `json:"funcs"`
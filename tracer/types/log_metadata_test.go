@@ -0,0 +1,40 @@
+package types
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseLabels(t *testing.T) {
+	a := assert.New(t)
+
+	labels, err := ParseLabels("")
+	a.NoError(err)
+	a.Len(labels, 0)
+
+	labels, err = ParseLabels("env=test,run=load-test,empty=")
+	a.NoError(err)
+	a.Equal(Labels{"env": "test", "run": "load-test", "empty": ""}, labels)
+	a.Equal("empty=,env=test,run=load-test", labels.String())
+
+	labels, err = ParseLabels("a=b=c")
+	a.NoError(err)
+	a.Equal(Labels{"a": "b=c"}, labels)
+
+	_, err = ParseLabels("noequal")
+	a.Error(err)
+	_, err = ParseLabels("=value")
+	a.Error(err)
+}
+
+func TestLabels_Match(t *testing.T) {
+	a := assert.New(t)
+	labels := Labels{"env": "test", "run": "load-test"}
+	a.True(labels.Match(nil))
+	a.True(labels.Match(Labels{"env": "test"}))
+	a.True(labels.Match(Labels{"env": "test", "run": "load-test"}))
+	a.False(labels.Match(Labels{"env": "prod"}))
+	a.False(labels.Match(Labels{"host": "a"}))
+	a.False(Labels(nil).Match(Labels{"env": "test"}))
+}
@@ -0,0 +1,107 @@
+package watchdog
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os/exec"
+	"time"
+
+	"github.com/yuuki0xff/goapptrace/config"
+	"github.com/yuuki0xff/goapptrace/tracer/types"
+)
+
+const (
+	// WebhookAction のタイムアウト
+	DefaultWebhookTimeout = 10 * time.Second
+)
+
+// ActionRunner は、ルールに一致したときのアクションを実行する。
+type ActionRunner struct {
+	// イベントの発生元のログのID
+	LogID string
+	// WebhookAction で使用するクライアント。
+	// nilなら、 DefaultWebhookTimeout でタイムアウトするクライアントを使用する。
+	Client *http.Client
+	// FlightRecorderAction で、トレース対象のプロセスにフライトレコーダーの内容を書き出させる。
+	// nilなら、 FlightRecorderAction は無視される。
+	FlightRecorder func(reason string) error
+}
+
+// ActionPayload は、 WebhookAction と CommandAction に渡されるJSONの形式である。
+type ActionPayload struct {
+	LogID string      `json:"log-id"`
+	Event types.Event `json:"event"`
+}
+
+// Run は、一致したルールのアクションをバックグラウンドで実行する。
+// アクションの実行に失敗したときは、ログに出力する。
+func (r *ActionRunner) Run(m Match) {
+	for _, action := range m.Rule.Actions {
+		go func(action config.WatchdogAction) {
+			if err := r.run(action, m.Event); err != nil {
+				log.Printf("ERROR: Watchdog(log=%s, rule=%s): %s action failed: %s", r.LogID, m.Rule.Name, action.Type, err.Error())
+			}
+		}(action)
+	}
+}
+
+func (r *ActionRunner) run(action config.WatchdogAction, event types.Event) error {
+	switch action.Type {
+	case config.WebhookAction:
+		return r.webhook(action.URL, event)
+	case config.CommandAction:
+		return r.command(action.Command, event)
+	case config.FlightRecorderAction:
+		if r.FlightRecorder == nil {
+			return nil
+		}
+		return r.FlightRecorder(event.Rule)
+	default:
+		return fmt.Errorf("unknown action: %s", action.Type)
+	}
+}
+
+func (r *ActionRunner) payload(event types.Event) ([]byte, error) {
+	return json.Marshal(ActionPayload{
+		LogID: r.LogID,
+		Event: event,
+	})
+}
+
+// webhook は、イベントをJSON形式でPOSTする。
+func (r *ActionRunner) webhook(url string, event types.Event) error {
+	data, err := r.payload(event)
+	if err != nil {
+		return err
+	}
+	client := r.Client
+	if client == nil {
+		client = &http.Client{Timeout: DefaultWebhookTimeout}
+	}
+	resp, err := client.Post(url, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close() // nolint: errcheck
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("%s returned %s", url, resp.Status)
+	}
+	return nil
+}
+
+// command は、コマンドを実行する。イベントはJSON形式で標準入力に渡される。
+func (r *ActionRunner) command(args []string, event types.Event) error {
+	data, err := r.payload(event)
+	if err != nil {
+		return err
+	}
+	cmd := exec.Command(args[0], args[1:]...) // nolint: gas
+	cmd.Stdin = bytes.NewReader(data)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%s: %s", err.Error(), bytes.TrimSpace(out))
+	}
+	return nil
+}
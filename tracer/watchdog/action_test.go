@@ -0,0 +1,85 @@
+package watchdog
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yuuki0xff/goapptrace/config"
+	"github.com/yuuki0xff/goapptrace/tracer/types"
+)
+
+var testEvent = types.Event{
+	Kind:      types.SlowCallEvent,
+	Rule:      "slow-handle",
+	Func:      "main.handle",
+	FuncLogID: 10,
+}
+
+func TestActionRunner_webhook(t *testing.T) {
+	a := assert.New(t)
+	var payload ActionPayload
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		a.Equal(http.MethodPost, r.Method)
+		a.Equal("application/json", r.Header.Get("Content-Type"))
+		a.NoError(json.NewDecoder(r.Body).Decode(&payload))
+	}))
+	defer srv.Close()
+
+	r := &ActionRunner{LogID: "0123"}
+	a.NoError(r.run(config.WatchdogAction{Type: config.WebhookAction, URL: srv.URL}, testEvent))
+	a.Equal("0123", payload.LogID)
+	a.Equal(testEvent, payload.Event)
+
+	srv.Config.Handler = http.NotFoundHandler()
+	a.Error(r.run(config.WatchdogAction{Type: config.WebhookAction, URL: srv.URL}, testEvent))
+}
+
+func TestActionRunner_command(t *testing.T) {
+	a := assert.New(t)
+	tempdir, err := ioutil.TempDir("", ".goapptrace_watchdog")
+	a.NoError(err)
+	defer func() {
+		a.NoError(os.RemoveAll(tempdir))
+	}()
+	out := filepath.Join(tempdir, "event.json")
+
+	r := &ActionRunner{LogID: "0123"}
+	a.NoError(r.run(config.WatchdogAction{
+		Type:    config.CommandAction,
+		Command: []string{"sh", "-c", `cat > "$0"`, out},
+	}, testEvent))
+	data, err := ioutil.ReadFile(out)
+	a.NoError(err)
+	var payload ActionPayload
+	a.NoError(json.Unmarshal(data, &payload))
+	a.Equal("0123", payload.LogID)
+	a.Equal(testEvent, payload.Event)
+
+	a.Error(r.run(config.WatchdogAction{
+		Type:    config.CommandAction,
+		Command: []string{"false"},
+	}, testEvent))
+}
+
+func TestActionRunner_flightRecorder(t *testing.T) {
+	a := assert.New(t)
+	action := config.WatchdogAction{Type: config.FlightRecorderAction}
+
+	// 送信先が無ければ何もしない。
+	r := &ActionRunner{}
+	a.NoError(r.run(action, testEvent))
+
+	var reason string
+	r.FlightRecorder = func(r string) error {
+		reason = r
+		return nil
+	}
+	a.NoError(r.run(action, testEvent))
+	a.Equal("slow-handle", reason)
+}
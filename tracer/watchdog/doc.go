@@ -0,0 +1,4 @@
+// watchdogパッケージは、ログサーバが書き込み中のログに対してウォッチドッグのルールを評価する。
+// ルールは config.Watchdog で設定する。
+// ルールに一致したら、イベントを返し、設定されたアクションを実行する。
+package watchdog
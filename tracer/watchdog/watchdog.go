@@ -0,0 +1,166 @@
+package watchdog
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/yuuki0xff/goapptrace/config"
+	"github.com/yuuki0xff/goapptrace/tracer/types"
+)
+
+// Watchdog は、ログサーバが受信したログに対してルールを評価し、一致したルールを検出する。
+// 1つのログに対して1つの Watchdog を使用する。
+// スレッドセーフではない。
+type Watchdog struct {
+	Rules   []config.WatchdogRule
+	Symbols *types.Symbols
+
+	// ルールごとの、既にイベントを記録した実行中の関数呼び出し。
+	// 同じ関数呼び出しに対して、イベントを何度も記録しないようにするために使用する。
+	fired []map[types.FuncLogID]bool
+	// ルールごとの、goroutineの数が上限を超えている状態ならtrue。
+	// 上限を下回るまで、再度イベントを記録しない。
+	overLimit []bool
+	// PCから関数名を求めた結果のキャッシュ。
+	funcNames map[uintptr]string
+}
+
+// Match は、ルールに一致したことを表す。
+type Match struct {
+	Rule  *config.WatchdogRule
+	Event types.Event
+}
+
+func (w *Watchdog) init() {
+	if w.fired != nil {
+		return
+	}
+	w.fired = make([]map[types.FuncLogID]bool, len(w.Rules))
+	for i := range w.fired {
+		w.fired[i] = map[types.FuncLogID]bool{}
+	}
+	w.overLimit = make([]bool, len(w.Rules))
+	w.funcNames = map[uintptr]string{}
+}
+
+// Check は、ルールを評価して、一致したルールを返す。
+// fls には、前回の呼び出し以降に終了した関数呼び出しと、実行中の全ての関数呼び出しを指定する。
+// now は、トレース対象のプロセスから最後に受信したログのタイムスタンプである。
+func (w *Watchdog) Check(fls []*types.FuncLog, now types.Time) []Match {
+	w.init()
+	var matches []Match
+	for i := range w.Rules {
+		rule := &w.Rules[i]
+		if rule.MaxDuration > 0 {
+			matches = append(matches, w.checkDuration(i, fls, now)...)
+		}
+		if rule.MaxGoroutines > 0 {
+			if m, ok := w.checkGoroutines(i, fls, now); ok {
+				matches = append(matches, m)
+			}
+		}
+	}
+	return matches
+}
+
+// checkDuration は、実行時間が上限を超えた関数呼び出しを検出する。
+// 実行中の関数呼び出しは、上限を超えた時点で1度だけ検出する。
+func (w *Watchdog) checkDuration(i int, fls []*types.FuncLog, now types.Time) []Match {
+	rule := &w.Rules[i]
+	fired := w.fired[i]
+	newFired := map[types.FuncLogID]bool{}
+	var matches []Match
+	for _, fl := range fls {
+		if w.funcName(fl) != rule.Func {
+			continue
+		}
+		if fired[fl.ID] {
+			if !fl.IsEnded() {
+				newFired[fl.ID] = true
+			}
+			continue
+		}
+
+		var dur types.Time
+		if fl.IsEnded() {
+			dur = fl.EndTime - fl.StartTime
+		} else {
+			dur = now - fl.StartTime
+		}
+		if dur <= types.Time(rule.MaxDuration) {
+			continue
+		}
+		if !fl.IsEnded() {
+			newFired[fl.ID] = true
+		}
+		matches = append(matches, Match{
+			Rule: rule,
+			Event: types.Event{
+				Kind:      types.SlowCallEvent,
+				Rule:      rule.Name,
+				Timestamp: now,
+				Func:      rule.Func,
+				Message: fmt.Sprintf("%s has been running for %s (limit %s)",
+					rule.Func, time.Duration(dur), time.Duration(rule.MaxDuration)),
+				FuncLogID: fl.ID,
+				GID:       fl.GID,
+				Duration:  dur,
+			},
+		})
+	}
+	w.fired[i] = newFired
+	return matches
+}
+
+// checkGoroutines は、関数を実行中のgoroutineの数が上限を超えたことを検出する。
+// 上限を超えた状態が続いている間は、再度検出しない。
+func (w *Watchdog) checkGoroutines(i int, fls []*types.FuncLog, now types.Time) (Match, bool) {
+	rule := &w.Rules[i]
+	gids := map[types.GID]struct{}{}
+	for _, fl := range fls {
+		if fl.IsEnded() || w.funcName(fl) != rule.Func {
+			continue
+		}
+		gids[fl.GID] = struct{}{}
+	}
+
+	if len(gids) <= rule.MaxGoroutines {
+		w.overLimit[i] = false
+		return Match{}, false
+	}
+	if w.overLimit[i] {
+		return Match{}, false
+	}
+	w.overLimit[i] = true
+	return Match{
+		Rule: rule,
+		Event: types.Event{
+			Kind:      types.TooManyGoroutinesEvent,
+			Rule:      rule.Name,
+			Timestamp: now,
+			Func:      rule.Func,
+			Message: fmt.Sprintf("%d goroutines are running %s (limit %d)",
+				len(gids), rule.Func, rule.MaxGoroutines),
+			Goroutines: len(gids),
+		},
+	}, true
+}
+
+// funcName は、関数呼び出しの関数名を返す。
+// シンボルが見つからなければ、空文字列を返す。
+func (w *Watchdog) funcName(fl *types.FuncLog) string {
+	if len(fl.Frames) == 0 {
+		return ""
+	}
+	pc := fl.Frames[0]
+	if name, ok := w.funcNames[pc]; ok {
+		return name
+	}
+	f, ok := w.Symbols.GoFunc(pc)
+	if !ok {
+		// シンボルを受信する前かもしれないので、キャッシュしない。
+		return ""
+	}
+	w.funcNames[pc] = f.Name
+	return f.Name
+}
@@ -0,0 +1,134 @@
+package watchdog
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yuuki0xff/goapptrace/config"
+	"github.com/yuuki0xff/goapptrace/tracer/types"
+)
+
+func newTestSymbolsData() types.SymbolsData {
+	return types.SymbolsData{
+		Mods: []types.GoModule{
+			{Name: "main", MinPC: 100, MaxPC: 999},
+		},
+		Funcs: []types.GoFunc{
+			{Entry: 100, Name: "main.main"},
+			{Entry: 200, Name: "main.handle"},
+			{Entry: 300, Name: "main.wait"},
+		},
+	}
+}
+
+func newTestSymbols() *types.Symbols {
+	symbols := &types.Symbols{}
+	symbols.Load(newTestSymbolsData())
+	return symbols
+}
+
+func TestWatchdog_slowCall(t *testing.T) {
+	a := assert.New(t)
+	w := &Watchdog{
+		Rules: []config.WatchdogRule{
+			{Name: "slow-handle", Func: "main.handle", MaxDuration: config.Duration(100 * time.Millisecond)},
+		},
+		Symbols: newTestSymbols(),
+	}
+	ms := types.Time(time.Millisecond)
+
+	// 実行中の関数呼び出しが上限を超えたら、1度だけ検出する。
+	fls := []*types.FuncLog{
+		{ID: 0, StartTime: 0, EndTime: types.NotEnded, Frames: []uintptr{100}, GID: 1},
+		{ID: 1, StartTime: 10 * ms, EndTime: types.NotEnded, Frames: []uintptr{210, 100}, GID: 1},
+		{ID: 2, StartTime: 20 * ms, EndTime: 30 * ms, Frames: []uintptr{220, 100}, GID: 2},
+	}
+	a.Len(w.Check(fls, 100*ms), 0)
+	matches := w.Check(fls, 120*ms)
+	if a.Len(matches, 1) {
+		e := matches[0].Event
+		a.Equal("slow-handle", matches[0].Rule.Name)
+		a.Equal(types.SlowCallEvent, e.Kind)
+		a.Equal("slow-handle", e.Rule)
+		a.Equal("main.handle", e.Func)
+		a.Equal(types.FuncLogID(1), e.FuncLogID)
+		a.Equal(types.GID(1), e.GID)
+		a.Equal(110*ms, e.Duration)
+		a.Equal(120*ms, e.Timestamp)
+	}
+	a.Len(w.Check(fls, 200*ms), 0)
+
+	// 検出済みの関数呼び出しが終了しても、再度検出しない。
+	// 実行中に検出されずに終了した関数呼び出しは、終了後に検出する。
+	fls = []*types.FuncLog{
+		{ID: 0, StartTime: 0, EndTime: types.NotEnded, Frames: []uintptr{100}, GID: 1},
+		{ID: 1, StartTime: 10 * ms, EndTime: 250 * ms, Frames: []uintptr{210, 100}, GID: 1},
+		{ID: 3, StartTime: 100 * ms, EndTime: 250 * ms, Frames: []uintptr{210, 100}, GID: 3},
+	}
+	matches = w.Check(fls, 260*ms)
+	if a.Len(matches, 1) {
+		a.Equal(types.FuncLogID(3), matches[0].Event.FuncLogID)
+		a.Equal(150*ms, matches[0].Event.Duration)
+	}
+}
+
+func TestWatchdog_tooManyGoroutines(t *testing.T) {
+	a := assert.New(t)
+	w := &Watchdog{
+		Rules: []config.WatchdogRule{
+			{Name: "many-waiters", Func: "main.wait", MaxGoroutines: 2},
+		},
+		Symbols: newTestSymbols(),
+	}
+	running := func(gids ...types.GID) []*types.FuncLog {
+		var fls []*types.FuncLog
+		for i, gid := range gids {
+			fls = append(fls, &types.FuncLog{
+				ID:      types.FuncLogID(i),
+				EndTime: types.NotEnded,
+				Frames:  []uintptr{300, 100},
+				GID:     gid,
+			})
+		}
+		// 終了した関数呼び出しは数えない。
+		fls = append(fls, &types.FuncLog{ID: 100, EndTime: 10, Frames: []uintptr{300}, GID: 100})
+		return fls
+	}
+
+	// 同じgoroutine内の再帰呼び出しは、1つとして数える。
+	a.Len(w.Check(running(1, 2, 2), 10), 0)
+	matches := w.Check(running(1, 2, 3), 20)
+	if a.Len(matches, 1) {
+		e := matches[0].Event
+		a.Equal(types.TooManyGoroutinesEvent, e.Kind)
+		a.Equal("many-waiters", e.Rule)
+		a.Equal("main.wait", e.Func)
+		a.Equal(3, e.Goroutines)
+		a.Equal(types.Time(20), e.Timestamp)
+	}
+	// 上限を超えた状態が続いている間は、再度検出しない。
+	a.Len(w.Check(running(1, 2, 3, 4), 30), 0)
+	// 上限を下回った後に再び超えたら、再度検出する。
+	a.Len(w.Check(running(1, 2), 40), 0)
+	a.Len(w.Check(running(1, 2, 3), 50), 1)
+}
+
+func TestWatchdog_unknownSymbols(t *testing.T) {
+	a := assert.New(t)
+	symbols := &types.Symbols{}
+	w := &Watchdog{
+		Rules: []config.WatchdogRule{
+			{Name: "slow-handle", Func: "main.handle", MaxDuration: 1},
+		},
+		Symbols: symbols,
+	}
+	fls := []*types.FuncLog{
+		{ID: 1, StartTime: 0, EndTime: 10, Frames: []uintptr{200}, GID: 1},
+	}
+	a.Len(w.Check(fls, 10), 0)
+
+	// シンボルを受信した後は、関数名を解決できる。
+	symbols.Load(newTestSymbolsData())
+	a.Len(w.Check(fls, 10), 1)
+}